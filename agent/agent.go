@@ -38,11 +38,13 @@ import (
 	ge "github.com/skydive-project/skydive/gremlin/traversal"
 	shttp "github.com/skydive-project/skydive/http"
 	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/metrics"
 	"github.com/skydive-project/skydive/packetinjector"
 	"github.com/skydive-project/skydive/probe"
 	"github.com/skydive-project/skydive/topology"
 	"github.com/skydive-project/skydive/topology/graph"
 	"github.com/skydive-project/skydive/topology/graph/traversal"
+	"github.com/skydive-project/skydive/topology/probes/conntrack"
 	"github.com/skydive-project/skydive/ui"
 	ws "github.com/skydive-project/skydive/websocket"
 )
@@ -208,6 +210,12 @@ func NewAgent() (*Agent, error) {
 	tr.AddTraversalExtension(ge.NewSocketsTraversalExtension())
 	tr.AddTraversalExtension(ge.NewDescendantsTraversalExtension())
 
+	if keys := config.GetStringSlice("gremlin.indexes"); len(keys) > 0 {
+		index := traversal.NewMetadataIndex(g, keys...)
+		index.Start()
+		tr.AddIndex(index)
+	}
+
 	rootNode, err := createRootNode(g)
 	if err != nil {
 		return nil, err
@@ -243,11 +251,22 @@ func NewAgent() (*Agent, error) {
 	// exposes a flow server through the client connections
 	flow.NewWSTableServer(flowTableAllocator, analyzerClientPool)
 
+	// exposes the NAT entries of the conntrack probe through the client connections
+	if natTable, ok := topologyProbeBundle.GetProbe("conntrack").(conntrack.NATTable); ok {
+		conntrack.NewWSNATServer(natTable, analyzerClientPool)
+	}
+
 	packetinjector.NewServer(g, analyzerClientPool)
 
 	flowClientPool := analyzer.NewFlowClientPool(analyzerClientPool, clusterAuthOptions)
 
-	flowProbeBundle := fprobes.NewFlowProbeBundle(topologyProbeBundle, g, flowTableAllocator, flowClientPool)
+	flowCollector := metrics.NewFlowCollectorFromConfig()
+	metricsHandler, err := metrics.NewHandler(metrics.NewInterfaceCollectorFromConfig(g), flowCollector)
+	if err != nil {
+		return nil, err
+	}
+
+	flowProbeBundle := fprobes.NewFlowProbeBundle(topologyProbeBundle, g, flowTableAllocator, flowClientPool, flowCollector.Observe)
 
 	onDemandProbeServer, err := ondemand.NewOnDemandProbeServer(flowProbeBundle, g, analyzerClientPool)
 	if err != nil {
@@ -271,6 +290,7 @@ func NewAgent() (*Agent, error) {
 	}
 
 	api.RegisterStatusAPI(hserver, agent, apiAuthBackend)
+	api.RegisterMetricsAPI(hserver, metricsHandler, apiAuthBackend)
 
 	return agent, nil
 }
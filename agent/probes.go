@@ -30,9 +30,13 @@ import (
 	"github.com/skydive-project/skydive/logging"
 	"github.com/skydive-project/skydive/probe"
 	"github.com/skydive-project/skydive/topology/graph"
+	"github.com/skydive-project/skydive/topology/probes/conntrack"
+	"github.com/skydive-project/skydive/topology/probes/cri"
 	"github.com/skydive-project/skydive/topology/probes/docker"
+	"github.com/skydive-project/skydive/topology/probes/ipvs"
 	"github.com/skydive-project/skydive/topology/probes/lldp"
 	"github.com/skydive-project/skydive/topology/probes/lxd"
+	"github.com/skydive-project/skydive/topology/probes/netfilter"
 	"github.com/skydive-project/skydive/topology/probes/netlink"
 	"github.com/skydive-project/skydive/topology/probes/netns"
 	"github.com/skydive-project/skydive/topology/probes/neutron"
@@ -86,6 +90,13 @@ func NewTopologyProbeBundleFromConfig(g *graph.Graph, hostNode *graph.Node) (*pr
 				return nil, fmt.Errorf("Failed to initialize Docker probe: %s", err)
 			}
 			probes[t] = Probe
+		case "cri":
+			criEndpoint := config.GetString("cri.endpoint")
+			Probe, err := cri.NewProbe(nsProbe, criEndpoint)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to initialize CRI probe: %s", err)
+			}
+			probes[t] = Probe
 		case "lldp":
 			interfaces := config.GetStringSlice("agent.topology.lldp.interfaces")
 			lldpProbe, err := lldp.NewProbe(g, hostNode, interfaces)
@@ -107,6 +118,24 @@ func NewTopologyProbeBundleFromConfig(g *graph.Graph, hostNode *graph.Node) (*pr
 			probes[t] = opencontrail
 		case "socketinfo":
 			probes[t] = socketinfo.NewSocketInfoProbe(g, hostNode)
+		case "conntrack":
+			conntrackProbe, err := conntrack.NewProbe(g, hostNode)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to initialize conntrack probe: %s", err)
+			}
+			probes[t] = conntrackProbe
+		case "netfilter":
+			netfilterProbe, err := netfilter.NewProbe(g, hostNode)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to initialize netfilter probe: %s", err)
+			}
+			probes[t] = netfilterProbe
+		case "ipvs":
+			ipvsProbe, err := ipvs.NewProbe(g, hostNode)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to initialize IPVS probe: %s", err)
+			}
+			probes[t] = ipvsProbe
 		default:
 			logging.GetLogger().Errorf("unknown probe type %s", t)
 		}
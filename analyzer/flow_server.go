@@ -35,6 +35,7 @@ import (
 	"github.com/skydive-project/skydive/common"
 	"github.com/skydive-project/skydive/config"
 	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/flow/exporter"
 	"github.com/skydive-project/skydive/flow/storage"
 	shttp "github.com/skydive-project/skydive/http"
 	"github.com/skydive-project/skydive/logging"
@@ -88,6 +89,8 @@ type FlowServerWebSocketConn struct {
 // FlowServer describes a flow server
 type FlowServer struct {
 	storage            storage.Storage
+	exporters          []exporter.Exporter
+	handlers           []flow.ExpireUpdateFunc
 	conn               FlowServerConn
 	state              int64
 	wgServer           sync.WaitGroup
@@ -208,11 +211,39 @@ func (s *FlowServer) storeFlows(flows []*flow.Flow) {
 	}
 }
 
+func (s *FlowServer) exportFlows(flows []*flow.Flow) {
+	if len(flows) == 0 {
+		return
+	}
+
+	for _, e := range s.exporters {
+		if err := e.ExportFlows(flows); err != nil {
+			logging.GetLogger().Errorf("Error while exporting flows: %s", err)
+			continue
+		}
+
+		logging.GetLogger().Debugf("%d flows exported", len(flows))
+	}
+}
+
+// handleFlows stores and exports a batch of flows and passes it to the handlers
+func (s *FlowServer) handleFlows(flows []*flow.Flow) {
+	s.storeFlows(flows)
+	s.exportFlows(flows)
+	for _, handler := range s.handlers {
+		handler(flows)
+	}
+}
+
 // Start the flow server
 func (s *FlowServer) Start() {
 	atomic.StoreInt64(&s.state, common.RunningState)
 	s.wgServer.Add(1)
 
+	for _, e := range s.exporters {
+		e.Start()
+	}
+
 	s.conn.Serve(s.ch, s.quit, &s.wgServer)
 	go func() {
 		defer s.wgServer.Done()
@@ -221,19 +252,19 @@ func (s *FlowServer) Start() {
 		defer dlTimer.Stop()
 
 		var flowBuffer []*flow.Flow
-		defer s.storeFlows(flowBuffer)
+		defer s.handleFlows(flowBuffer)
 
 		for {
 			select {
 			case <-s.quit:
 				return
 			case <-dlTimer.C:
-				s.storeFlows(flowBuffer)
+				s.handleFlows(flowBuffer)
 				flowBuffer = flowBuffer[:0]
 			case f := <-s.ch:
 				flowBuffer = append(flowBuffer, f)
 				if len(flowBuffer) >= s.bulkInsert {
-					s.storeFlows(flowBuffer)
+					s.handleFlows(flowBuffer)
 					flowBuffer = flowBuffer[:0]
 				}
 			}
@@ -247,6 +278,10 @@ func (s *FlowServer) Stop() {
 		s.quit <- struct{}{}
 		s.quit <- struct{}{}
 		s.wgServer.Wait()
+
+		for _, e := range s.exporters {
+			e.Stop()
+		}
 	}
 }
 
@@ -272,8 +307,9 @@ func (s *FlowServer) setupBulkConfigFromBackend() error {
 	return nil
 }
 
-// NewFlowServer creates a new flow server listening at address/port, based on configuration
-func NewFlowServer(s *shttp.Server, g *graph.Graph, store storage.Storage, probe *probe.Bundle, auth shttp.AuthenticationBackend) (*FlowServer, error) {
+// NewFlowServer creates a new flow server listening at address/port, based on configuration.
+// The received flows are passed to the given handlers.
+func NewFlowServer(s *shttp.Server, g *graph.Graph, store storage.Storage, probe *probe.Bundle, auth shttp.AuthenticationBackend, handlers ...flow.ExpireUpdateFunc) (*FlowServer, error) {
 	var conn FlowServerConn
 	protocol := strings.ToLower(config.GetString("flow.protocol"))
 
@@ -291,11 +327,18 @@ func NewFlowServer(s *shttp.Server, g *graph.Graph, store storage.Storage, probe
 		return nil, err
 	}
 
+	exporters, err := exporter.NewExportersFromConfig()
+	if err != nil {
+		return nil, err
+	}
+
 	fs := &FlowServer{
-		storage: store,
-		conn:    conn,
-		quit:    make(chan struct{}, 2),
-		auth:    auth,
+		storage:   store,
+		exporters: exporters,
+		handlers:  handlers,
+		conn:      conn,
+		quit:      make(chan struct{}, 2),
+		auth:      auth,
 	}
 	err = fs.setupBulkConfigFromBackend()
 	if err != nil {
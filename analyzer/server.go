@@ -38,15 +38,20 @@ import (
 	"github.com/skydive-project/skydive/flow"
 	ondemand "github.com/skydive-project/skydive/flow/ondemand/client"
 	"github.com/skydive-project/skydive/flow/storage"
+	_ "github.com/skydive-project/skydive/flow/storage/boltdb"        // register the boltdb flow storage driver
+	_ "github.com/skydive-project/skydive/flow/storage/elasticsearch" // register the elasticsearch flow storage driver
+	_ "github.com/skydive-project/skydive/flow/storage/orientdb"      // register the orientdb flow storage driver
 	ge "github.com/skydive-project/skydive/gremlin/traversal"
 	shttp "github.com/skydive-project/skydive/http"
 	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/metrics"
 	"github.com/skydive-project/skydive/packetinjector"
 	"github.com/skydive-project/skydive/probe"
 	"github.com/skydive-project/skydive/topology"
 	"github.com/skydive-project/skydive/topology/enhancers"
 	"github.com/skydive-project/skydive/topology/graph"
 	"github.com/skydive-project/skydive/topology/graph/traversal"
+	"github.com/skydive-project/skydive/topology/probes/conntrack"
 	"github.com/skydive-project/skydive/ui"
 	ws "github.com/skydive-project/skydive/websocket"
 )
@@ -288,6 +293,7 @@ func NewServerFromConfig() (*Server, error) {
 	}
 
 	tableClient := flow.NewWSTableClient(agentWSServer)
+	natClient := conntrack.NewWSNATClient(agentWSServer)
 
 	storage, err := storage.NewStorageFromConfig(etcdClient)
 	if err != nil {
@@ -304,10 +310,16 @@ func NewServerFromConfig() (*Server, error) {
 	tr := traversal.NewGremlinTraversalParser()
 	tr.AddTraversalExtension(ge.NewMetricsTraversalExtension())
 	tr.AddTraversalExtension(ge.NewRawPacketsTraversalExtension())
-	tr.AddTraversalExtension(ge.NewFlowTraversalExtension(tableClient, storage))
+	tr.AddTraversalExtension(ge.NewFlowTraversalExtension(tableClient, natClient, storage))
 	tr.AddTraversalExtension(ge.NewSocketsTraversalExtension())
 	tr.AddTraversalExtension(ge.NewDescendantsTraversalExtension())
 
+	if keys := config.GetStringSlice("gremlin.indexes"); len(keys) > 0 {
+		index := traversal.NewMetadataIndex(g, keys...)
+		index.Start()
+		tr.AddIndex(index)
+	}
+
 	subscriberWSServer := ws.NewStructServer(config.NewWSServer(hserver, "/ws/subscriber", apiAuthBackend))
 	topology.NewSubscriberEndpoint(subscriberWSServer, g, tr)
 
@@ -352,7 +364,13 @@ func NewServerFromConfig() (*Server, error) {
 
 	onDemandClient := ondemand.NewOnDemandProbeClient(g, captureAPIHandler, agentWSServer, subscriberWSServer, etcdClient)
 
-	flowServer, err := NewFlowServer(hserver, g, storage, probeBundle, clusterAuthBackend)
+	flowCollector := metrics.NewFlowCollectorFromConfig()
+	metricsHandler, err := metrics.NewHandler(metrics.NewInterfaceCollectorFromConfig(g), flowCollector)
+	if err != nil {
+		return nil, err
+	}
+
+	flowServer, err := NewFlowServer(hserver, g, storage, probeBundle, clusterAuthBackend, flowCollector.Observe)
 	if err != nil {
 		return nil, err
 	}
@@ -386,6 +404,7 @@ func NewServerFromConfig() (*Server, error) {
 	api.RegisterPcapAPI(hserver, storage, apiAuthBackend)
 	api.RegisterConfigAPI(hserver, apiAuthBackend)
 	api.RegisterStatusAPI(hserver, s, apiAuthBackend)
+	api.RegisterMetricsAPI(hserver, metricsHandler, apiAuthBackend)
 
 	if config.GetBool("analyzer.ssh_enabled") {
 		if err := dede.RegisterHandler("terminal", "/dede", hserver.Router); err != nil {
@@ -122,6 +122,11 @@ func (c *CaptureAPIHandler) Create(r types.Resource) error {
 				return fmt.Errorf("%s capture doesn't support extra TCP metrics capture", capture.Type)
 			}
 		}
+		if capture.SamplingRate > 1 || capture.AdaptiveSampling {
+			if !common.CheckProbeCapabilities(capture.Type, common.SamplingCapability) {
+				return fmt.Errorf("%s capture doesn't support packet sampling", capture.Type)
+			}
+		}
 	}
 
 	resources := c.Index()
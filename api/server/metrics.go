@@ -0,0 +1,67 @@
+/*
+ * Copyright (C) 2018 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package server
+
+import (
+	"net/http"
+
+	auth "github.com/abbot/go-http-auth"
+	shttp "github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/metrics"
+	"github.com/skydive-project/skydive/rbac"
+)
+
+type metricsAPI struct {
+	handler *metrics.Handler
+}
+
+func (m *metricsAPI) metricsGet(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "metrics", "read") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	m.handler.ServeHTTP(w, &r.Request)
+}
+
+func (m *metricsAPI) registerEndpoints(r *shttp.Server, authBackend shttp.AuthenticationBackend) {
+	routes := []shttp.Route{
+		{
+			Name:        "MetricsGet",
+			Method:      "GET",
+			Path:        "/metrics",
+			HandlerFunc: m.metricsGet,
+		},
+	}
+
+	r.RegisterRoutes(routes, authBackend)
+}
+
+// RegisterMetricsAPI registers the Prometheus metrics endpoint
+func RegisterMetricsAPI(s *shttp.Server, h *metrics.Handler, authBackend shttp.AuthenticationBackend) {
+	a := &metricsAPI{
+		handler: h,
+	}
+
+	a.registerEndpoints(s, authBackend)
+}
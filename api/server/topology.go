@@ -29,9 +29,11 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/abbot/go-http-auth"
 	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/config"
 	"github.com/skydive-project/skydive/flow"
 	ge "github.com/skydive-project/skydive/gremlin/traversal"
 	shttp "github.com/skydive-project/skydive/http"
@@ -123,6 +125,61 @@ func (t *TopologyAPI) topologyIndex(w http.ResponseWriter, r *auth.Authenticated
 	}
 }
 
+// roleQueryLimits returns the query limits of a role, false if none configured
+func roleQueryLimits(role string) (traversal.QueryLimits, bool) {
+	key := "gremlin.query_limits." + role
+	if !config.IsSet(key) {
+		return traversal.QueryLimits{}, false
+	}
+
+	return traversal.QueryLimits{
+		Timeout:       time.Duration(config.GetInt(key+".timeout")) * time.Second,
+		MaxVisited:    int64(config.GetInt(key + ".max_visited")),
+		MaxResultSize: int64(config.GetInt(key + ".max_result_size")),
+	}, true
+}
+
+// mostPermissive returns the greatest limit, 0 meaning no limit
+func mostPermissive(a, b int64) int64 {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// queryLimits returns the Gremlin query limits of a user, the most
+// permissive ones of its roles, the default ones if none of its roles
+// has limits configured
+func queryLimits(user string) traversal.QueryLimits {
+	var limits traversal.QueryLimits
+	found := false
+
+	for _, role := range rbac.GetUserRoles(user) {
+		rl, ok := roleQueryLimits(role)
+		if !ok {
+			continue
+		}
+
+		if !found {
+			limits, found = rl, true
+			continue
+		}
+
+		limits.Timeout = time.Duration(mostPermissive(int64(limits.Timeout), int64(rl.Timeout)))
+		limits.MaxVisited = mostPermissive(limits.MaxVisited, rl.MaxVisited)
+		limits.MaxResultSize = mostPermissive(limits.MaxResultSize, rl.MaxResultSize)
+	}
+
+	if !found {
+		limits, _ = roleQueryLimits("default")
+	}
+
+	return limits
+}
+
 func (t *TopologyAPI) topologySearch(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
 	if !rbac.Enforce(r.Username, "topology", "read") {
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -153,8 +210,17 @@ func (t *TopologyAPI) topologySearch(w http.ResponseWriter, r *auth.Authenticate
 		return
 	}
 
-	res, err := ts.Exec(t.graph, true)
-	if err != nil {
+	// the query is canceled if the client goes away
+	res, err := ts.ExecWithContext(r.Request.Context(), t.graph, true, queryLimits(r.Username))
+	switch err {
+	case nil:
+	case traversal.ErrQueryCanceled:
+		return
+	case traversal.ErrQueryTimeout:
+		// the server gave up, not the client being too slow
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	default:
 		writeError(w, http.StatusBadRequest, err)
 		return
 	}
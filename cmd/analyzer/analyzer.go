@@ -30,7 +30,9 @@ import (
 
 	"github.com/skydive-project/skydive/analyzer"
 	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/flow/storage"
 	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/topology/graph"
 	"github.com/skydive-project/skydive/version"
 
 	"github.com/spf13/cobra"
@@ -45,6 +47,8 @@ var AnalyzerCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		config.Set("logging.id", "analyzer")
 		logging.GetLogger().Noticef("Skydive Analyzer %s starting...", version.Version)
+		logging.GetLogger().Infof("Flow storage drivers: %v", storage.Drivers())
+		logging.GetLogger().Infof("Topology backend drivers: %v", graph.BackendDrivers())
 
 		server, err := analyzer.NewServerFromConfig()
 		if err != nil {
@@ -50,6 +50,8 @@ var (
 	reassembleTCP      bool
 	layerKeyMode       string
 	extraLayers        []string
+	samplingRate       int
+	adaptiveSampling   bool
 )
 
 // CaptureCmd skdyive capture root command
@@ -96,6 +98,8 @@ var CaptureCreate = &cobra.Command{
 		capture.LayerKeyMode = layerKeyMode
 		capture.RawPacketLimit = rawPacketLimit
 		capture.ExtraLayers = layers
+		capture.SamplingRate = samplingRate
+		capture.AdaptiveSampling = adaptiveSampling
 
 		if err := validator.Validate(capture); err != nil {
 			exitOnError(err)
@@ -202,6 +206,8 @@ func addCaptureFlags(cmd *cobra.Command) {
 	cmd.Flags().BoolVarP(&ipDefrag, "ip-defrag", "", false, "Defragment IPv4 packets, default: false")
 	cmd.Flags().BoolVarP(&reassembleTCP, "reassamble-tcp", "", false, "Reassemble TCP packets, default: false")
 	cmd.Flags().StringVarP(&layerKeyMode, "layer-key-mode", "", "L2", "Defines the first layer used by flow key calculation, L2 or L3")
+	cmd.Flags().IntVarP(&samplingRate, "sampling-rate", "", 0, "Keep only 1 packet out of N, the flow metrics being extrapolated, default: 0 no sampling")
+	cmd.Flags().BoolVarP(&adaptiveSampling, "adaptive-sampling", "", false, "Raise the sampling rate when packets are not processed fast enough, default: false")
 	cmd.Flags().StringArrayVarP(&extraLayers, "extra-layer", "", []string{}, fmt.Sprintf("List of extra layers to be added to the flow, available: %s", flow.ExtraLayers(flow.ALLLayer)))
 }
 
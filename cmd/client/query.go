@@ -30,11 +30,13 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/skydive-project/skydive/api/client"
 	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/topology/graph/traversal"
 )
 
 // QueryCmd skydive topology query command
@@ -91,6 +93,17 @@ var QueryCmd = &cobra.Command{
 			}
 
 			bufio.NewReader(resp.Body).WriteTo(os.Stdout)
+		case "timeline":
+			data, err := queryHelper.QueryRaw(gremlinQuery)
+			if err != nil {
+				exitOnError(err)
+			}
+
+			var revisions []traversal.ElementRevisions
+			if err := json.Unmarshal(data, &revisions); err != nil {
+				exitOnError(fmt.Errorf("Timeline format requires a query ending with Revisions: %s", err))
+			}
+			printTimeline(revisions)
 		default:
 			logging.GetLogger().Errorf("Invalid output format %s", outputFormat)
 			os.Exit(1)
@@ -98,6 +111,36 @@ var QueryCmd = &cobra.Command{
 	},
 }
 
+// printTimeline prints the successive versions of elements along with the
+// metadata keys changed by each version
+func printTimeline(revisions []traversal.ElementRevisions) {
+	for _, er := range revisions {
+		fmt.Printf("%s\n", er.ID)
+		for i, r := range er.Revisions {
+			at := time.Unix(0, r.UpdatedAt*int64(time.Millisecond)).UTC().Format("2006-01-02 15:04:05.000")
+			fmt.Printf("  %s  revision %d\n", at, r.Revision)
+
+			if i == 0 {
+				continue
+			}
+
+			if len(r.Changes) == 0 {
+				fmt.Printf("      no metadata change\n")
+			}
+			for _, c := range r.Changes {
+				switch {
+				case c.Old == nil:
+					fmt.Printf("      + %s: %v\n", c.Key, c.New)
+				case c.New == nil:
+					fmt.Printf("      - %s: %v\n", c.Key, c.Old)
+				default:
+					fmt.Printf("      ~ %s: %v -> %v\n", c.Key, c.Old, c.New)
+				}
+			}
+		}
+	}
+}
+
 func init() {
-	QueryCmd.Flags().StringVarP(&outputFormat, "format", "", "json", "Output format (json, dot or pcap)")
+	QueryCmd.Flags().StringVarP(&outputFormat, "format", "", "json", "Output format (json, dot, pcap or timeline)")
 }
@@ -25,6 +25,8 @@ package client
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/spf13/cobra"
 )
@@ -32,6 +34,8 @@ import (
 var (
 	gremlinQuery string
 	outputFormat string
+	diffFrom     string
+	diffTo       string
 )
 
 // TopologyCmd skydive topology root command
@@ -53,8 +57,43 @@ var TopologyRequest = &cobra.Command{
 	},
 }
 
+// TopologyDiff skydive topology diff command
+var TopologyDiff = &cobra.Command{
+	Use:   "diff",
+	Short: "Show the changes of the topology between two points in time",
+	Long:  "Show the nodes and edges added, removed or whose metadata changed between two points in time",
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if diffFrom == "" {
+			cmd.Usage()
+			os.Exit(1)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		query := fmt.Sprintf("G.Diff(%s)", timeParam(diffFrom))
+		if diffTo != "" {
+			query = fmt.Sprintf("G.Diff(%s, %s)", timeParam(diffFrom), timeParam(diffTo))
+		}
+
+		outputFormat = "json"
+		QueryCmd.Run(cmd, []string{query})
+	},
+}
+
+// timeParam returns the Gremlin parameter of a time, Unix timestamps and
+// NOW being passed as is
+func timeParam(t string) string {
+	if _, err := strconv.ParseInt(t, 10, 64); err == nil || strings.ToUpper(t) == "NOW" {
+		return t
+	}
+	return strconv.Quote(t)
+}
+
 func init() {
+	TopologyCmd.AddCommand(TopologyDiff)
+	TopologyDiff.Flags().StringVarP(&diffFrom, "from", "", "", "Start of the changes, either a RFC1123 date, a duration relative to now (-1h), a Unix timestamp or NOW")
+	TopologyDiff.Flags().StringVarP(&diffTo, "to", "", "", "End of the changes, now if not specified")
+
 	TopologyCmd.AddCommand(TopologyRequest)
 	TopologyRequest.Flags().StringVarP(&gremlinQuery, "gremlin", "", "G", "Gremlin Query")
-	TopologyRequest.Flags().StringVarP(&outputFormat, "format", "", "json", "Output format (json, dot or pcap)")
+	TopologyRequest.Flags().StringVarP(&outputFormat, "format", "", "json", "Output format (json, dot, pcap or timeline)")
 }
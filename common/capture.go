@@ -42,6 +42,8 @@ const (
 	RawPacketsCapability = 2
 	// ExtraTCPMetricCapability the probe can report TCP metrics
 	ExtraTCPMetricCapability = 4
+	// SamplingCapability the probe can sample the captured packets
+	SamplingCapability = 8
 )
 
 var (
@@ -66,7 +68,7 @@ func initCaptureTypes() {
 	}
 
 	for _, t := range types {
-		CaptureTypes[t] = CaptureType{Allowed: []string{"afpacket", "pcap", "pcapsocket", "sflow", "ebpf"}, Default: "afpacket"}
+		CaptureTypes[t] = CaptureType{Allowed: []string{"afpacket", "pcap", "pcapsocket", "sflow", "ipfix", "ebpf"}, Default: "afpacket"}
 	}
 }
 
@@ -77,14 +79,14 @@ func IsCaptureAllowed(nodeType string) bool {
 }
 
 func initProbeCapabilities() {
-	ProbeCapabilities["afpacket"] = BPFCapability | RawPacketsCapability | ExtraTCPMetricCapability
-	ProbeCapabilities["pcap"] = BPFCapability | RawPacketsCapability | ExtraTCPMetricCapability
+	ProbeCapabilities["afpacket"] = BPFCapability | RawPacketsCapability | ExtraTCPMetricCapability | SamplingCapability
+	ProbeCapabilities["pcap"] = BPFCapability | RawPacketsCapability | ExtraTCPMetricCapability | SamplingCapability
 	ProbeCapabilities["pcapsocket"] = BPFCapability | RawPacketsCapability | ExtraTCPMetricCapability
 	ProbeCapabilities["sflow"] = BPFCapability | RawPacketsCapability | ExtraTCPMetricCapability
 	ProbeCapabilities["ovssflow"] = BPFCapability | RawPacketsCapability | ExtraTCPMetricCapability
-	ProbeCapabilities["afpacket"] = BPFCapability | RawPacketsCapability | ExtraTCPMetricCapability
+	ProbeCapabilities["afpacket"] = BPFCapability | RawPacketsCapability | ExtraTCPMetricCapability | SamplingCapability
 	ProbeCapabilities["dpdk"] = BPFCapability | RawPacketsCapability | ExtraTCPMetricCapability
-	ProbeCapabilities["ovsmirror"] = BPFCapability | RawPacketsCapability | ExtraTCPMetricCapability
+	ProbeCapabilities["ovsmirror"] = BPFCapability | RawPacketsCapability | ExtraTCPMetricCapability | SamplingCapability
 }
 
 // CheckProbeCapabilities checks that a probe supports given capabilities
@@ -80,6 +80,10 @@ func init() {
 	cfg.SetDefault("agent.flow.pcapsocket.max_port", 8132)
 	cfg.SetDefault("agent.listen", "127.0.0.1:8081")
 	cfg.SetDefault("agent.topology.probes", []string{"ovsdb"})
+	cfg.SetDefault("agent.topology.ipvs.interface", "kube-ipvs0")
+	cfg.SetDefault("agent.topology.ipvs.update", 10)
+	cfg.SetDefault("agent.topology.netfilter.backends", []string{"iptables", "nftables"})
+	cfg.SetDefault("agent.topology.netfilter.update", 10)
 	cfg.SetDefault("agent.topology.netlink.metrics_update", 30)
 	cfg.SetDefault("agent.topology.neutron.domain_name", "Default")
 	cfg.SetDefault("agent.topology.neutron.endpoint_type", "public")
@@ -110,6 +114,9 @@ func init() {
 	cfg.SetDefault("cache.expire", 300)
 	cfg.SetDefault("cache.cleanup", 30)
 
+	cfg.SetDefault("cri.endpoint", "unix:///run/containerd/containerd.sock")
+	cfg.SetDefault("cri.update", 5)
+
 	cfg.SetDefault("docker.url", "unix:///var/run/docker.sock")
 	cfg.SetDefault("docker.netns.run_path", "/var/run/docker/netns")
 
@@ -118,10 +125,15 @@ func init() {
 	cfg.SetDefault("etcd.name", host)
 	cfg.SetDefault("etcd.listen", fmt.Sprintf("127.0.0.1:%d", etcdDefaultPort))
 
+	cfg.SetDefault("flow.application_classifier.max_packets", 0)
 	cfg.SetDefault("flow.expire", 600)
 	cfg.SetDefault("flow.update", 60)
 	cfg.SetDefault("flow.protocol", "udp")
 
+	cfg.SetDefault("gremlin.live_query_refresh", 1000)
+	cfg.SetDefault("gremlin.max_repeat_depth", 32)
+	cfg.SetDefault("gremlin.max_path_length", 16)
+
 	cfg.SetDefault("host_id", host)
 
 	cfg.SetDefault("http.rest.debug", false)
@@ -149,6 +161,12 @@ func init() {
 
 	cfg.SetDefault("sflow.port_min", 6345)
 	cfg.SetDefault("sflow.port_max", 6355)
+	cfg.SetDefault("ipfix.port_min", 4740)
+	cfg.SetDefault("ipfix.port_max", 4750)
+
+	cfg.SetDefault("prometheus.flow.labels", []string{"Application"})
+	cfg.SetDefault("prometheus.flow.max_series", 100)
+	cfg.SetDefault("prometheus.interface.max_series", 1000)
 
 	cfg.SetDefault("rbac.model.request_definition", []string{"sub, obj, act"})
 	cfg.SetDefault("rbac.model.policy_definition", []string{"sub, obj, act, eft"})
@@ -405,6 +423,11 @@ func GetStringMapString(key string) map[string]string {
 	return cfg.GetStringMapString(realKey(key))
 }
 
+// GetStringMap returns a map of interfaces from the configuration
+func GetStringMap(key string) map[string]interface{} {
+	return cfg.GetStringMap(realKey(key))
+}
+
 // BindPFlag binds a command line flag to a configuration value
 func BindPFlag(key string, flag *pflag.Flag) error {
 	return cfg.BindPFlag(key, flag)
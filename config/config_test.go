@@ -87,3 +87,47 @@ openstack:
 		t.Fatal("Relocation with default failed")
 	}
 }
+
+func TestLoadStorageConfig(t *testing.T) {
+	cfg.SetConfigType("yaml")
+
+	var yaml = []byte(`
+storage:
+  mystorage:
+    driver: mydriver
+    host: 10.0.0.1:1234
+`)
+
+	cfg.ReadConfig(bytes.NewBuffer(yaml))
+
+	options := []StorageOption{
+		{Name: "host", Default: "127.0.0.1:1234"},
+		{Name: "timeout", Default: 5},
+	}
+
+	s, err := LoadStorageConfig("mystorage", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Driver != "mydriver" {
+		t.Errorf("Wrong driver: %s", s.Driver)
+	}
+
+	if host := s.GetString("host"); host != "10.0.0.1:1234" {
+		t.Errorf("Default should not override the configured value: %s", host)
+	}
+
+	if timeout := s.GetInt("timeout"); timeout != 5 {
+		t.Errorf("Default should have been applied: %d", timeout)
+	}
+
+	options = append(options, StorageOption{Name: "token", Required: true})
+	if _, err := LoadStorageConfig("mystorage", options); err == nil {
+		t.Error("Should return an error for a missing required option")
+	}
+
+	if _, err := LoadStorageConfig("unknown", options); err == nil {
+		t.Error("Should return an error for a backend without driver")
+	}
+}
@@ -0,0 +1,108 @@
+/*
+ * Copyright (C) 2018 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// StorageOption describes a driver specific option of a storage backend
+type StorageOption struct {
+	Name     string
+	Default  interface{}
+	Required bool
+}
+
+// StorageConfig gives access to the configuration of a storage backend,
+// defined in the `storage.<name>` section of the configuration file
+type StorageConfig struct {
+	Name   string
+	Driver string
+}
+
+// Key returns the full configuration key of a backend option
+func (s *StorageConfig) Key(option string) string {
+	return "storage." + s.Name + "." + option
+}
+
+// IsSet returns whether a backend option is set
+func (s *StorageConfig) IsSet(option string) bool {
+	return IsSet(s.Key(option))
+}
+
+// GetString returns a backend option as a string
+func (s *StorageConfig) GetString(option string) string {
+	return GetString(s.Key(option))
+}
+
+// GetInt returns a backend option as an int
+func (s *StorageConfig) GetInt(option string) int {
+	return GetInt(s.Key(option))
+}
+
+// GetBool returns a backend option as a boolean
+func (s *StorageConfig) GetBool(option string) bool {
+	return GetBool(s.Key(option))
+}
+
+// GetStringSlice returns a backend option as a slice of strings
+func (s *StorageConfig) GetStringSlice(option string) []string {
+	return GetStringSlice(s.Key(option))
+}
+
+// StorageDriver returns the driver of the given storage backend
+func StorageDriver(name string) string {
+	return GetString("storage." + name + ".driver")
+}
+
+// LoadStorageConfig loads the configuration of the given storage backend.
+// Defaults of the driver options are applied when not already defined and
+// an error is returned if a required option is missing.
+func LoadStorageConfig(name string, options []StorageOption) (*StorageConfig, error) {
+	s := &StorageConfig{Name: name, Driver: StorageDriver(name)}
+	if s.Driver == "" {
+		return nil, fmt.Errorf("No driver defined for storage backend '%s'", name)
+	}
+
+	var missing []string
+	for _, option := range options {
+		if s.IsSet(option.Name) {
+			continue
+		}
+
+		if option.Default != nil {
+			SetDefault(s.Key(option.Name), option.Default)
+		} else if option.Required {
+			missing = append(missing, option.Name)
+		}
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("Missing option(s) %s for storage backend '%s' using driver '%s'", strings.Join(missing, ", "), name, s.Driver)
+	}
+
+	return s, nil
+}
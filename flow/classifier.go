@@ -0,0 +1,422 @@
+/*
+ * Copyright (C) 2018 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package flow
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/logging"
+)
+
+const (
+	// PortApplicationConfidence is the confidence of an application found
+	// in the application port map
+	PortApplicationConfidence = 50
+	// MaxApplicationConfidence is the confidence of an application for which
+	// the payload can't belong to another protocol
+	MaxApplicationConfidence = 100
+)
+
+// ApplicationSignature matches the payload of a packet against an application
+// protocol
+type ApplicationSignature interface {
+	// Application returns the name of the application
+	Application() string
+	// Match returns the confidence, between 0 and 100, that the payload
+	// belongs to the application, 0 meaning no match
+	Match(protocol FlowProtocol, payload []byte) int
+}
+
+// ApplicationClassifier sets the application of the flows by matching the
+// payload of their first packets against a set of signatures
+type ApplicationClassifier struct {
+	signatures []ApplicationSignature
+	maxPackets int64
+}
+
+type funcSignature struct {
+	application string
+	protocols   []FlowProtocol
+	match       func(payload []byte) int
+}
+
+func (s *funcSignature) Application() string {
+	return s.application
+}
+
+func (s *funcSignature) Match(protocol FlowProtocol, payload []byte) int {
+	for _, p := range s.protocols {
+		if p == protocol {
+			return s.match(payload)
+		}
+	}
+	return 0
+}
+
+// RegexpSignature matches the payload against a regular expression
+type RegexpSignature struct {
+	application string
+	protocols   []FlowProtocol
+	regexp      *regexp.Regexp
+	confidence  int
+}
+
+// Application implements the ApplicationSignature interface
+func (s *RegexpSignature) Application() string {
+	return s.application
+}
+
+// Match implements the ApplicationSignature interface
+func (s *RegexpSignature) Match(protocol FlowProtocol, payload []byte) int {
+	for _, p := range s.protocols {
+		if p == protocol && s.regexp.Match(payload) {
+			return s.confidence
+		}
+	}
+	return 0
+}
+
+// NewRegexpSignature returns a new signature matching the payloads of the
+// given protocol, tcp, udp or any, against a regular expression
+func NewRegexpSignature(application, protocol, pattern string, confidence int) (*RegexpSignature, error) {
+	var protocols []FlowProtocol
+	switch strings.ToLower(protocol) {
+	case "tcp":
+		protocols = []FlowProtocol{FlowProtocol_TCP}
+	case "udp":
+		protocols = []FlowProtocol{FlowProtocol_UDP}
+	case "", "any":
+		protocols = []FlowProtocol{FlowProtocol_TCP, FlowProtocol_UDP, FlowProtocol_SCTP}
+	default:
+		return nil, fmt.Errorf("Unknown protocol %s for application signature %s", protocol, application)
+	}
+
+	if confidence <= 0 || confidence > MaxApplicationConfidence {
+		return nil, fmt.Errorf("Confidence of application signature %s should be in ]0, %d]", application, MaxApplicationConfidence)
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid pattern for application signature %s: %s", application, err)
+	}
+
+	return &RegexpSignature{
+		application: strings.ToUpper(application),
+		protocols:   protocols,
+		regexp:      re,
+		confidence:  confidence,
+	}, nil
+}
+
+var httpRequestPrefixes [][]byte
+
+func init() {
+	for _, method := range httpMethods {
+		httpRequestPrefixes = append(httpRequestPrefixes, []byte(method+" /"))
+	}
+	httpRequestPrefixes = append(httpRequestPrefixes, []byte("HTTP/1."))
+}
+
+var http2Preface = []byte("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n")
+
+func matchHTTP(payload []byte) int {
+	for _, prefix := range httpRequestPrefixes {
+		if bytes.HasPrefix(payload, prefix) {
+			return 90
+		}
+	}
+	return 0
+}
+
+func matchHTTP2(payload []byte) int {
+	if bytes.HasPrefix(payload, http2Preface) {
+		return 90
+	}
+	return 0
+}
+
+// matchGRPC looks for the gRPC content type which is visible when the headers
+// are not Huffman encoded
+func matchGRPC(payload []byte) int {
+	if bytes.Contains(payload, []byte("application/grpc")) {
+		return 95
+	}
+	return 0
+}
+
+func matchTLS(payload []byte) int {
+	// handshake record, SSL 3.0 to TLS 1.3, ClientHello or ServerHello
+	if len(payload) > 5 && payload[0] == 0x16 && payload[1] == 0x03 && payload[2] <= 0x04 &&
+		(payload[5] == tlsHandshakeClientHello || payload[5] == tlsHandshakeServerHello) {
+		return 90
+	}
+	return 0
+}
+
+func matchSSH(payload []byte) int {
+	if bytes.HasPrefix(payload, []byte("SSH-2.0-")) || bytes.HasPrefix(payload, []byte("SSH-1.")) {
+		return MaxApplicationConfidence
+	}
+	return 0
+}
+
+// matchDNSMessage checks the header and the first question of a DNS message
+func matchDNSMessage(payload []byte) int {
+	if len(payload) < 17 {
+		return 0
+	}
+
+	opcode := (payload[2] >> 3) & 0x0f
+	qdcount := binary.BigEndian.Uint16(payload[4:6])
+	if opcode > 5 || qdcount != 1 || payload[3]&0x40 != 0 {
+		return 0
+	}
+
+	// walk the labels of the question name
+	offset := 12
+	for offset < len(payload) {
+		length := int(payload[offset])
+		if length == 0 {
+			// type and class should follow
+			if offset+5 <= len(payload) {
+				return 80
+			}
+			return 0
+		}
+		if length > 63 {
+			return 0
+		}
+		offset += length + 1
+	}
+	return 0
+}
+
+func matchDNS(payload []byte) int {
+	return matchDNSMessage(payload)
+}
+
+// matchDNSOverTCP checks DNS messages prefixed by their length
+func matchDNSOverTCP(payload []byte) int {
+	if len(payload) < 2 || int(binary.BigEndian.Uint16(payload)) != len(payload)-2 {
+		return 0
+	}
+	return matchDNSMessage(payload[2:])
+}
+
+// matchMySQL matches the server greeting, protocol version 10
+func matchMySQL(payload []byte) int {
+	if len(payload) < 6 {
+		return 0
+	}
+
+	length := int(payload[0]) | int(payload[1])<<8 | int(payload[2])<<16
+	if length != len(payload)-4 || payload[3] != 0 || payload[4] != 10 {
+		return 0
+	}
+
+	// null terminated server version starting with a digit
+	end := bytes.IndexByte(payload[5:], 0)
+	if end <= 0 || payload[5] < '0' || payload[5] > '9' {
+		return 0
+	}
+	return 90
+}
+
+// matchPostgreSQL matches the startup and SSL request messages
+func matchPostgreSQL(payload []byte) int {
+	if len(payload) < 8 || int(binary.BigEndian.Uint32(payload)) != len(payload) {
+		return 0
+	}
+
+	switch binary.BigEndian.Uint32(payload[4:8]) {
+	case 196608, 80877103: // protocol 3.0, SSL request
+		return 95
+	}
+	return 0
+}
+
+// matchRedis matches RESP arrays of bulk strings as sent by the clients
+func matchRedis(payload []byte) int {
+	if len(payload) < 4 || payload[0] != '*' {
+		return 0
+	}
+
+	end := bytes.Index(payload, []byte("\r\n"))
+	if end < 2 || end+2 >= len(payload) || payload[end+2] != '$' {
+		return 0
+	}
+	for _, c := range payload[1:end] {
+		if c < '0' || c > '9' {
+			return 0
+		}
+	}
+	return 80
+}
+
+// matchKafka matches the header of Kafka requests
+func matchKafka(payload []byte) int {
+	if len(payload) < 14 || int(binary.BigEndian.Uint32(payload)) != len(payload)-4 {
+		return 0
+	}
+
+	apiKey := int16(binary.BigEndian.Uint16(payload[4:6]))
+	apiVersion := int16(binary.BigEndian.Uint16(payload[6:8]))
+	clientIDLength := int(int16(binary.BigEndian.Uint16(payload[12:14])))
+	if apiKey < 0 || apiKey > 67 || apiVersion < 0 || apiVersion > 15 || clientIDLength < -1 || 14+clientIDLength > len(payload) {
+		return 0
+	}
+
+	// client id is usually printable
+	for _, c := range payload[14 : 14+max(clientIDLength, 0)] {
+		if c < 0x20 || c > 0x7e {
+			return 0
+		}
+	}
+	return 60
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// DefaultApplicationSignatures returns the builtin application signatures
+func DefaultApplicationSignatures() []ApplicationSignature {
+	tcp := []FlowProtocol{FlowProtocol_TCP}
+	udp := []FlowProtocol{FlowProtocol_UDP}
+
+	return []ApplicationSignature{
+		&funcSignature{"HTTP", tcp, matchHTTP},
+		&funcSignature{"HTTP2", tcp, matchHTTP2},
+		&funcSignature{"GRPC", tcp, matchGRPC},
+		&funcSignature{"TLS", tcp, matchTLS},
+		&funcSignature{"SSH", tcp, matchSSH},
+		&funcSignature{"DNS", udp, matchDNS},
+		&funcSignature{"DNS", tcp, matchDNSOverTCP},
+		&funcSignature{"MYSQL", tcp, matchMySQL},
+		&funcSignature{"POSTGRESQL", tcp, matchPostgreSQL},
+		&funcSignature{"REDIS", tcp, matchRedis},
+		&funcSignature{"KAFKA", tcp, matchKafka},
+	}
+}
+
+// AddSignature adds a signature to the classifier, the signatures being
+// evaluated in the order they have been added
+func (c *ApplicationClassifier) AddSignature(s ApplicationSignature) {
+	c.signatures = append(c.signatures, s)
+}
+
+// Classify returns the application with the highest confidence for the given
+// payload, an empty string if no signature matches
+func (c *ApplicationClassifier) Classify(protocol FlowProtocol, payload []byte) (string, int) {
+	var application string
+	var confidence int
+
+	for _, s := range c.signatures {
+		if conf := s.Match(protocol, payload); conf > confidence {
+			application, confidence = s.Application(), conf
+			if confidence >= MaxApplicationConfidence {
+				break
+			}
+		}
+	}
+
+	return application, confidence
+}
+
+// classify updates the application of the flow with the payload of the packet
+// if the classification gives a higher confidence
+func (c *ApplicationClassifier) classify(f *Flow, packet *Packet) {
+	if c == nil || f.Transport == nil || f.XXX_state.classifiedPackets >= c.maxPackets ||
+		f.ApplicationConfidence >= MaxApplicationConfidence {
+		return
+	}
+
+	layer := packet.TransportLayer()
+	if layer == nil || len(layer.LayerPayload()) == 0 {
+		return
+	}
+	f.XXX_state.classifiedPackets++
+
+	if app, confidence := c.Classify(f.Transport.Protocol, layer.LayerPayload()); int64(confidence) > f.ApplicationConfidence {
+		f.Application, f.ApplicationConfidence = app, int64(confidence)
+	}
+}
+
+// NewApplicationClassifier returns a new classifier using the given
+// signatures on the first maxPackets packets with a payload of the flows
+func NewApplicationClassifier(maxPackets int, signatures ...ApplicationSignature) *ApplicationClassifier {
+	return &ApplicationClassifier{
+		signatures: signatures,
+		maxPackets: int64(maxPackets),
+	}
+}
+
+// NewApplicationClassifierFromConfig returns a new classifier with the builtin
+// signatures and the ones defined in the configuration, nil if the
+// classification is disabled
+func NewApplicationClassifierFromConfig() *ApplicationClassifier {
+	maxPackets := config.GetInt("flow.application_classifier.max_packets")
+	if maxPackets <= 0 {
+		return nil
+	}
+
+	// user defined signatures first so that they take precedence with the
+	// same confidence
+	var names []string
+	for name := range config.GetStringMap("flow.application_classifier.signatures") {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	c := NewApplicationClassifier(maxPackets)
+	for _, name := range names {
+		prefix := "flow.application_classifier.signatures." + name + "."
+
+		confidence := 90
+		if config.IsSet(prefix + "confidence") {
+			confidence = config.GetInt(prefix + "confidence")
+		}
+
+		s, err := NewRegexpSignature(name, config.GetString(prefix+"protocol"), config.GetString(prefix+"pattern"), confidence)
+		if err != nil {
+			logging.GetLogger().Errorf("Unable to load application signature: %s", err)
+			continue
+		}
+		c.AddSignature(s)
+	}
+
+	for _, s := range DefaultApplicationSignatures() {
+		c.AddSignature(s)
+	}
+
+	return c
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright (C) 2018 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package flow
+
+import (
+	"testing"
+)
+
+func TestApplicationClassifier(t *testing.T) {
+	c := NewApplicationClassifier(4, DefaultApplicationSignatures()...)
+
+	tests := []struct {
+		protocol    FlowProtocol
+		payload     []byte
+		application string
+	}{
+		{FlowProtocol_TCP, []byte("GET /index.html HTTP/1.1\r\nHost: example.com\r\n\r\n"), "HTTP"},
+		{FlowProtocol_TCP, []byte("HTTP/1.1 200 OK\r\n"), "HTTP"},
+		{FlowProtocol_TCP, append([]byte("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"), 0, 0, 0, 4), "HTTP2"},
+		{FlowProtocol_TCP, []byte("\x00\x00\x20\x01\x04\x00\x00\x00\x01content-typeapplication/grpc"), "GRPC"},
+		{FlowProtocol_TCP, []byte{0x16, 0x03, 0x01, 0x00, 0xc8, 0x01, 0x00, 0x00, 0xc4, 0x03, 0x03}, "TLS"},
+		{FlowProtocol_TCP, []byte("SSH-2.0-OpenSSH_7.4\r\n"), "SSH"},
+		{FlowProtocol_UDP, []byte("\x12\x34\x01\x00\x00\x01\x00\x00\x00\x00\x00\x00\x07example\x03com\x00\x00\x01\x00\x01"), "DNS"},
+		{FlowProtocol_TCP, []byte("\x00\x1d\x12\x34\x01\x00\x00\x01\x00\x00\x00\x00\x00\x00\x07example\x03com\x00\x00\x01\x00\x01"), "DNS"},
+		{FlowProtocol_TCP, []byte("\x0a\x00\x00\x00\x0a5.7.22\x00\x01\x02"), "MYSQL"},
+		{FlowProtocol_TCP, []byte("\x00\x00\x00\x08\x04\xd2\x16\x2f"), "POSTGRESQL"},
+		{FlowProtocol_TCP, []byte("*1\r\n$4\r\nPING\r\n"), "REDIS"},
+		{FlowProtocol_TCP, []byte("\x00\x00\x00\x11\x00\x03\x00\x01\x00\x00\x00\x07\x00\x07produce"), "KAFKA"},
+		{FlowProtocol_TCP, []byte("random payload"), ""},
+		{FlowProtocol_UDP, []byte("GET /index.html HTTP/1.1\r\n"), ""},
+	}
+
+	for _, test := range tests {
+		app, confidence := c.Classify(test.protocol, test.payload)
+		if app != test.application {
+			t.Errorf("Expected application %q for %q, got %q", test.application, test.payload, app)
+		}
+		if app != "" && (confidence <= 0 || confidence > MaxApplicationConfidence) {
+			t.Errorf("Wrong confidence %d for %s", confidence, app)
+		}
+	}
+}
+
+func TestRegexpSignature(t *testing.T) {
+	s, err := NewRegexpSignature("memcached", "tcp", `^(get|set) \S+`, 80)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewApplicationClassifier(4, s)
+	for _, sig := range DefaultApplicationSignatures() {
+		c.AddSignature(sig)
+	}
+
+	if app, confidence := c.Classify(FlowProtocol_TCP, []byte("get mykey\r\n")); app != "MEMCACHED" || confidence != 80 {
+		t.Errorf("Expected MEMCACHED with confidence 80, got %s with %d", app, confidence)
+	}
+
+	if app, _ := c.Classify(FlowProtocol_UDP, []byte("get mykey\r\n")); app != "" {
+		t.Errorf("Signature should only match TCP payloads, got %s", app)
+	}
+
+	if _, err := NewRegexpSignature("invalid", "tcp", `(`, 80); err == nil {
+		t.Error("Invalid pattern should be rejected")
+	}
+
+	if _, err := NewRegexpSignature("invalid", "icmp", `.`, 80); err == nil {
+		t.Error("Invalid protocol should be rejected")
+	}
+}
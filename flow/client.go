@@ -23,6 +23,9 @@
 package flow
 
 import (
+	"context"
+	"time"
+
 	"github.com/golang/protobuf/proto"
 
 	"github.com/skydive-project/skydive/common"
@@ -34,8 +37,8 @@ import (
 
 // TableClient describes a mechanism to query a flow table
 type TableClient interface {
-	LookupFlows(flowSearchQuery filters.SearchQuery) (*FlowSet, error)
-	LookupFlowsByNodes(hnmap topology.HostNodeTIDMap, flowSearchQuery filters.SearchQuery) (*FlowSet, error)
+	LookupFlows(ctx context.Context, flowSearchQuery filters.SearchQuery) (*FlowSet, error)
+	LookupFlowsByNodes(ctx context.Context, hnmap topology.HostNodeTIDMap, flowSearchQuery filters.SearchQuery) (*FlowSet, error)
 }
 
 // WSTableClient implements a flow table client using WebSocket
@@ -43,12 +46,30 @@ type WSTableClient struct {
 	structServer *ws.StructServer
 }
 
-func (f *WSTableClient) lookupFlows(flowset chan *FlowSet, host string, flowSearchQuery filters.SearchQuery) {
+func newMergeContext(flowSearchQuery filters.SearchQuery) MergeContext {
+	// for sort order we assume that the SortOrder of a flowSearchQuery comes from
+	// an already validated entry.
+	return MergeContext{
+		Sort:      flowSearchQuery.Sort,
+		SortBy:    flowSearchQuery.SortBy,
+		SortOrder: common.SortOrder(flowSearchQuery.SortOrder),
+		Dedup:     flowSearchQuery.Dedup,
+		DedupBy:   flowSearchQuery.DedupBy,
+	}
+}
+
+func (f *WSTableClient) lookupFlows(ctx context.Context, flowset chan *FlowSet, host string, flowSearchQuery filters.SearchQuery) {
 	obj, _ := proto.Marshal(&flowSearchQuery)
 	tq := TableQuery{Type: "SearchQuery", Obj: obj}
 	msg := ws.NewStructMessage(Namespace, "TableQuery", tq)
 
-	resp, err := f.structServer.Request(host, msg, ws.DefaultRequestTimeout)
+	// do not wait for the agent longer than the caller
+	timeout := ws.DefaultRequestTimeout
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < timeout {
+		timeout = time.Until(deadline)
+	}
+
+	resp, err := f.structServer.Request(host, msg, timeout)
 	if err != nil {
 		logging.GetLogger().Errorf("Unable to send message to agent %s: %s", host, err.Error())
 		flowset <- NewFlowSet()
@@ -59,16 +80,11 @@ func (f *WSTableClient) lookupFlows(flowset chan *FlowSet, host string, flowSear
 	if resp == nil || resp.UnmarshalObj(&reply) != nil {
 		logging.GetLogger().Errorf("Error returned while reading TableReply from: %s", host)
 		flowset <- NewFlowSet()
+		return
 	}
 
 	fs := NewFlowSet()
-	context := MergeContext{
-		Sort:      flowSearchQuery.Sort,
-		SortBy:    flowSearchQuery.SortBy,
-		SortOrder: common.SortOrder(flowSearchQuery.SortOrder),
-		Dedup:     flowSearchQuery.Dedup,
-		DedupBy:   flowSearchQuery.DedupBy,
-	}
+	context := newMergeContext(flowSearchQuery)
 	for _, b := range reply.Obj {
 		var fsr FlowSearchReply
 		if err := proto.Unmarshal(b, &fsr); err != nil {
@@ -80,62 +96,56 @@ func (f *WSTableClient) lookupFlows(flowset chan *FlowSet, host string, flowSear
 	flowset <- fs
 }
 
-// LookupFlows query flow table based on a filter search query
-func (f *WSTableClient) LookupFlows(flowSearchQuery filters.SearchQuery) (*FlowSet, error) {
-	speakers := f.structServer.GetSpeakersByType(common.AgentService)
-	ch := make(chan *FlowSet, len(speakers))
+// mergeFlowSets merges the replies of n agents, returning as soon as the
+// context is done
+func mergeFlowSets(ctx context.Context, ch chan *FlowSet, n int, flowSearchQuery filters.SearchQuery) (*FlowSet, error) {
+	flowset := NewFlowSet()
 
-	for _, c := range speakers {
-		go f.lookupFlows(ch, c.GetRemoteHost(), flowSearchQuery)
+	context := newMergeContext(flowSearchQuery)
+	for i := 0; i != n; i++ {
+		select {
+		case fs := <-ch:
+			flowset.Merge(fs, context)
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
 	}
 
-	flowset := NewFlowSet()
+	return flowset, nil
+}
 
-	// for sort order we assume that the SortOrder of a flowSearchQuery comes from
-	// an already validated entry.
-	context := MergeContext{
-		Sort:      flowSearchQuery.Sort,
-		SortBy:    flowSearchQuery.SortBy,
-		SortOrder: common.SortOrder(flowSearchQuery.SortOrder),
-		Dedup:     flowSearchQuery.Dedup,
-		DedupBy:   flowSearchQuery.DedupBy,
+// LookupFlows query flow table based on a filter search query
+func (f *WSTableClient) LookupFlows(ctx context.Context, flowSearchQuery filters.SearchQuery) (*FlowSet, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
-	for i := 0; i != len(speakers); i++ {
-		fs := <-ch
-		flowset.Merge(fs, context)
+
+	speakers := f.structServer.GetSpeakersByType(common.AgentService)
+	ch := make(chan *FlowSet, len(speakers))
+
+	for _, c := range speakers {
+		go f.lookupFlows(ctx, ch, c.GetRemoteHost(), flowSearchQuery)
 	}
 
-	return flowset, nil
+	return mergeFlowSets(ctx, ch, len(speakers), flowSearchQuery)
 }
 
 // LookupFlowsByNodes query flow table based on multiple nodes
-func (f *WSTableClient) LookupFlowsByNodes(hnmap topology.HostNodeTIDMap, flowSearchQuery filters.SearchQuery) (*FlowSet, error) {
+func (f *WSTableClient) LookupFlowsByNodes(ctx context.Context, hnmap topology.HostNodeTIDMap, flowSearchQuery filters.SearchQuery) (*FlowSet, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	ch := make(chan *FlowSet, len(hnmap))
 
 	// We conserve the original filter to reuse it for each host
 	searchQuery := flowSearchQuery.Filter
 	for host, tids := range hnmap {
 		flowSearchQuery.Filter = filters.NewAndFilter(NewFilterForNodeTIDs(tids), searchQuery)
-		go f.lookupFlows(ch, host, flowSearchQuery)
-	}
-
-	flowset := NewFlowSet()
-
-	// for sort order we assume that the SortOrder of a flowSearchQuery comes from
-	// an already validated entry.
-	context := MergeContext{
-		Sort:      flowSearchQuery.Sort,
-		SortBy:    flowSearchQuery.SortBy,
-		SortOrder: common.SortOrder(flowSearchQuery.SortOrder),
-		Dedup:     flowSearchQuery.Dedup,
-		DedupBy:   flowSearchQuery.DedupBy,
-	}
-	for i := 0; i != len(hnmap); i++ {
-		fs := <-ch
-		flowset.Merge(fs, context)
+		go f.lookupFlows(ctx, ch, host, flowSearchQuery)
 	}
 
-	return flowset, nil
+	return mergeFlowSets(ctx, ch, len(hnmap), flowSearchQuery)
 }
 
 // NewWSTableClient creates a new table client based on websocket
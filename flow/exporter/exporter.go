@@ -0,0 +1,71 @@
+/*
+ * Copyright (C) 2018 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package exporter
+
+import (
+	"fmt"
+
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/logging"
+)
+
+// Exporter interface of a flow export mechanism
+type Exporter interface {
+	Start()
+	ExportFlows(flows []*flow.Flow) error
+	Stop()
+}
+
+// NewExporter creates a new flow exporter based on the exporter definition
+// found in the configuration
+func NewExporter(name string) (e Exporter, err error) {
+	typ := config.GetString("exporter." + name + ".type")
+	switch typ {
+	case "ipfix", "netflow9":
+		e, err = NewIPFIXExporterFromConfig(name)
+	default:
+		err = fmt.Errorf("Flow exporter type '%s' not supported", typ)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	logging.GetLogger().Infof("Using %s as flow exporter", name)
+	return e, nil
+}
+
+// NewExportersFromConfig creates the flow exporters listed in the configuration
+func NewExportersFromConfig() ([]Exporter, error) {
+	var exporters []Exporter
+	for _, name := range config.GetStringSlice("analyzer.flow.exporters") {
+		e, err := NewExporter(name)
+		if err != nil {
+			return nil, err
+		}
+		exporters = append(exporters, e)
+	}
+
+	return exporters, nil
+}
@@ -0,0 +1,727 @@
+/*
+ * Copyright (C) 2018 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package exporter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/logging"
+)
+
+const (
+	// IPFIXVersion version number of the IPFIX protocol (RFC 7011)
+	IPFIXVersion uint16 = 10
+	// NetFlow9Version version number of the NetFlow v9 protocol (RFC 3954)
+	NetFlow9Version uint16 = 9
+
+	// SkydiveEnterpriseNumber private enterprise number used for the Skydive
+	// specific information elements (Red Hat, Inc.)
+	SkydiveEnterpriseNumber uint32 = 2312
+	// ReverseEnterpriseNumber private enterprise number used for reverse
+	// information elements of biflows (RFC 5103)
+	ReverseEnterpriseNumber uint32 = 29305
+
+	// DefaultIPFIXTemplateRefresh delay between two template announcements
+	DefaultIPFIXTemplateRefresh = 60 * time.Second
+	// DefaultIPFIXMaxMessageSize maximum size of an exported message, chosen to fit in an ethernet frame
+	DefaultIPFIXMaxMessageSize = 1400
+
+	ipfixHeaderLength    = 16
+	netflow9HeaderLength = 20
+
+	ipfixTemplateSetID    uint16 = 2
+	netflow9TemplateSetID uint16 = 0
+	firstTemplateID       uint16 = 256
+
+	variableLength uint16 = 65535
+)
+
+// IANA information elements
+const (
+	ieOctetDeltaCount          uint16 = 1
+	iePacketDeltaCount         uint16 = 2
+	ieProtocolIdentifier       uint16 = 4
+	ieSourceTransportPort      uint16 = 7
+	ieSourceIPv4Address        uint16 = 8
+	ieDestinationTransportPort uint16 = 11
+	ieDestinationIPv4Address   uint16 = 12
+	ieSourceIPv6Address        uint16 = 27
+	ieDestinationIPv6Address   uint16 = 28
+	ieSourceMacAddress         uint16 = 56
+	ieVlanID                   uint16 = 58
+	ieDestinationMacAddress    uint16 = 80
+	ieOctetTotalCount          uint16 = 85
+	iePacketTotalCount         uint16 = 86
+	ieApplicationName          uint16 = 96
+	ieFlowStartMilliseconds    uint16 = 152
+	ieFlowEndMilliseconds      uint16 = 153
+	ieLayer2SegmentID          uint16 = 351
+)
+
+// Skydive enterprise specific information elements
+const (
+	ieSkydiveUUID         uint16 = 1
+	ieSkydiveParentUUID   uint16 = 2
+	ieSkydiveLayersPath   uint16 = 3
+	ieSkydiveNodeTID      uint16 = 4
+	ieSkydiveTrackingID   uint16 = 5
+	ieSkydiveL3TrackingID uint16 = 6
+	ieSkydiveRTT          uint16 = 7
+	ieSkydiveABSynStart   uint16 = 10
+	ieSkydiveBASynStart   uint16 = 11
+	ieSkydiveABSynTTL     uint16 = 12
+	ieSkydiveBASynTTL     uint16 = 13
+	ieSkydiveABFinStart   uint16 = 14
+	ieSkydiveBAFinStart   uint16 = 15
+	ieSkydiveABRstStart   uint16 = 16
+	ieSkydiveBARstStart   uint16 = 17
+)
+
+// ErrExporterNotStarted the exporter is not connected to its collector
+var ErrExporterNotStarted = errors.New("Exporter not started")
+
+// IPFIXOpts describes the options of an IPFIX exporter
+type IPFIXOpts struct {
+	Version           uint16
+	ObservationDomain uint32
+	TemplateRefresh   time.Duration
+	MaxMessageSize    int
+}
+
+// record is a directional view of a flow. IPFIX exports a flow as a single
+// biflow record whereas NetFlow v9 exports one record per direction.
+type record struct {
+	flow    *flow.Flow
+	reverse bool
+}
+
+type field struct {
+	id         uint16
+	enterprise uint32
+	length     uint16
+	encode     func(b *bytes.Buffer, r *record)
+}
+
+type templateKey struct {
+	link      bool
+	network   flow.FlowProtocol
+	transport bool
+	tcpMetric bool
+}
+
+type template struct {
+	id        uint16
+	fields    []*field
+	announced bool
+}
+
+type dataSet struct {
+	id   uint16
+	data bytes.Buffer
+}
+
+type message struct {
+	templates []*template
+	sets      []*dataSet
+	size      int
+	records   int
+}
+
+// IPFIXExporter exports flows to an IPFIX or a NetFlow v9 collector over UDP
+type IPFIXExporter struct {
+	sync.Mutex
+	addr         string
+	opts         IPFIXOpts
+	conn         net.Conn
+	startTime    time.Time
+	sequence     uint32
+	templates    map[templateKey]*template
+	nextID       uint16
+	lastAnnounce time.Time
+}
+
+func writeUint8(b *bytes.Buffer, v uint8) {
+	b.WriteByte(v)
+}
+
+func writeUint16(b *bytes.Buffer, v uint16) {
+	binary.Write(b, binary.BigEndian, v)
+}
+
+func writeUint32(b *bytes.Buffer, v uint32) {
+	binary.Write(b, binary.BigEndian, v)
+}
+
+func writeUint64(b *bytes.Buffer, v uint64) {
+	binary.Write(b, binary.BigEndian, v)
+}
+
+func writeMAC(b *bytes.Buffer, s string) {
+	mac, err := net.ParseMAC(s)
+	if err != nil || len(mac) != 6 {
+		mac = make(net.HardwareAddr, 6)
+	}
+	b.Write(mac)
+}
+
+func writeIP(b *bytes.Buffer, s string, length int) {
+	ip := net.ParseIP(s)
+	if length == net.IPv4len {
+		ip = ip.To4()
+	} else {
+		ip = ip.To16()
+	}
+	if ip == nil {
+		ip = make(net.IP, length)
+	}
+	b.Write(ip)
+}
+
+// writeString encodes a variable length string as described in RFC 7011 section 7
+func writeString(b *bytes.Buffer, s string) {
+	if len(s) > int(variableLength) {
+		s = s[:variableLength]
+	}
+	if len(s) < 255 {
+		writeUint8(b, uint8(len(s)))
+	} else {
+		writeUint8(b, 255)
+		writeUint16(b, uint16(len(s)))
+	}
+	b.WriteString(s)
+}
+
+func (r *record) linkEndpoints() (string, string) {
+	if r.reverse {
+		return r.flow.Link.B, r.flow.Link.A
+	}
+	return r.flow.Link.A, r.flow.Link.B
+}
+
+func (r *record) networkEndpoints() (string, string) {
+	if r.reverse {
+		return r.flow.Network.B, r.flow.Network.A
+	}
+	return r.flow.Network.A, r.flow.Network.B
+}
+
+func (r *record) transportEndpoints() (int64, int64) {
+	if r.reverse {
+		return r.flow.Transport.B, r.flow.Transport.A
+	}
+	return r.flow.Transport.A, r.flow.Transport.B
+}
+
+// counters returns the packets and bytes of the record direction,
+// the reverse direction if reverse is set
+func counters(m *flow.FlowMetric, reverse bool) (uint64, uint64) {
+	if m == nil {
+		return 0, 0
+	}
+	if reverse {
+		return uint64(m.BAPackets), uint64(m.BABytes)
+	}
+	return uint64(m.ABPackets), uint64(m.ABBytes)
+}
+
+func protocolIdentifier(f *flow.Flow) uint8 {
+	if f.Transport != nil {
+		switch f.Transport.Protocol {
+		case flow.FlowProtocol_TCP:
+			return 6
+		case flow.FlowProtocol_UDP:
+			return 17
+		case flow.FlowProtocol_SCTP:
+			return 132
+		}
+	}
+	if f.ICMP != nil {
+		if f.Network.Protocol == flow.FlowProtocol_IPV6 {
+			return 58
+		}
+		return 1
+	}
+	return 0
+}
+
+func metricFields(delta bool, enterprise uint32, reverse func(r *record) bool) []*field {
+	metric := func(r *record) *flow.FlowMetric {
+		if delta {
+			return r.flow.LastUpdateMetric
+		}
+		return r.flow.Metric
+	}
+
+	packetsID, bytesID := iePacketTotalCount, ieOctetTotalCount
+	if delta {
+		packetsID, bytesID = iePacketDeltaCount, ieOctetDeltaCount
+	}
+
+	return []*field{
+		{id: bytesID, enterprise: enterprise, length: 8, encode: func(b *bytes.Buffer, r *record) {
+			_, octets := counters(metric(r), reverse(r))
+			writeUint64(b, octets)
+		}},
+		{id: packetsID, enterprise: enterprise, length: 8, encode: func(b *bytes.Buffer, r *record) {
+			packets, _ := counters(metric(r), reverse(r))
+			writeUint64(b, packets)
+		}},
+	}
+}
+
+func stringField(id uint16, value func(f *flow.Flow) string) *field {
+	return &field{id: id, enterprise: SkydiveEnterpriseNumber, length: variableLength, encode: func(b *bytes.Buffer, r *record) {
+		writeString(b, value(r.flow))
+	}}
+}
+
+func timestampField(id uint16, enterprise uint32, value func(f *flow.Flow) int64) *field {
+	return &field{id: id, enterprise: enterprise, length: 8, encode: func(b *bytes.Buffer, r *record) {
+		writeUint64(b, uint64(value(r.flow)))
+	}}
+}
+
+// newFields returns the list of fields used to encode the records matching
+// the given template key
+func (e *IPFIXExporter) newFields(k templateKey) []*field {
+	var fields []*field
+
+	if k.link {
+		fields = append(fields,
+			&field{id: ieSourceMacAddress, length: 6, encode: func(b *bytes.Buffer, r *record) {
+				a, _ := r.linkEndpoints()
+				writeMAC(b, a)
+			}},
+			&field{id: ieDestinationMacAddress, length: 6, encode: func(b *bytes.Buffer, r *record) {
+				_, bb := r.linkEndpoints()
+				writeMAC(b, bb)
+			}},
+			&field{id: ieVlanID, length: 2, encode: func(b *bytes.Buffer, r *record) {
+				writeUint16(b, uint16(r.flow.Link.ID&0xfff))
+			}},
+		)
+	}
+
+	switch k.network {
+	case flow.FlowProtocol_IPV4, flow.FlowProtocol_IPV6:
+		srcID, dstID, length := ieSourceIPv4Address, ieDestinationIPv4Address, net.IPv4len
+		if k.network == flow.FlowProtocol_IPV6 {
+			srcID, dstID, length = ieSourceIPv6Address, ieDestinationIPv6Address, net.IPv6len
+		}
+
+		fields = append(fields,
+			&field{id: srcID, length: uint16(length), encode: func(b *bytes.Buffer, r *record) {
+				a, _ := r.networkEndpoints()
+				writeIP(b, a, length)
+			}},
+			&field{id: dstID, length: uint16(length), encode: func(b *bytes.Buffer, r *record) {
+				_, bb := r.networkEndpoints()
+				writeIP(b, bb, length)
+			}},
+			&field{id: ieProtocolIdentifier, length: 1, encode: func(b *bytes.Buffer, r *record) {
+				writeUint8(b, protocolIdentifier(r.flow))
+			}},
+			&field{id: ieLayer2SegmentID, length: 8, encode: func(b *bytes.Buffer, r *record) {
+				writeUint64(b, uint64(r.flow.Network.ID))
+			}},
+		)
+	}
+
+	if k.transport {
+		fields = append(fields,
+			&field{id: ieSourceTransportPort, length: 2, encode: func(b *bytes.Buffer, r *record) {
+				a, _ := r.transportEndpoints()
+				writeUint16(b, uint16(a))
+			}},
+			&field{id: ieDestinationTransportPort, length: 2, encode: func(b *bytes.Buffer, r *record) {
+				_, bb := r.transportEndpoints()
+				writeUint16(b, uint16(bb))
+			}},
+		)
+	}
+
+	fields = append(fields,
+		timestampField(ieFlowStartMilliseconds, 0, func(f *flow.Flow) int64 { return f.Start }),
+		timestampField(ieFlowEndMilliseconds, 0, func(f *flow.Flow) int64 { return f.Last }),
+	)
+
+	direction := func(r *record) bool { return r.reverse }
+	fields = append(fields, metricFields(true, 0, direction)...)
+	fields = append(fields, metricFields(false, 0, direction)...)
+
+	// NetFlow v9 supports neither enterprise nor variable length elements
+	if e.opts.Version == NetFlow9Version {
+		return fields
+	}
+
+	reverse := func(r *record) bool { return true }
+	fields = append(fields, metricFields(true, ReverseEnterpriseNumber, reverse)...)
+	fields = append(fields, metricFields(false, ReverseEnterpriseNumber, reverse)...)
+
+	fields = append(fields,
+		&field{id: ieApplicationName, length: variableLength, encode: func(b *bytes.Buffer, r *record) {
+			writeString(b, r.flow.Application)
+		}},
+		stringField(ieSkydiveUUID, func(f *flow.Flow) string { return f.UUID }),
+		stringField(ieSkydiveParentUUID, func(f *flow.Flow) string { return f.ParentUUID }),
+		stringField(ieSkydiveLayersPath, func(f *flow.Flow) string { return f.LayersPath }),
+		stringField(ieSkydiveNodeTID, func(f *flow.Flow) string { return f.NodeTID }),
+		stringField(ieSkydiveTrackingID, func(f *flow.Flow) string { return f.TrackingID }),
+		stringField(ieSkydiveL3TrackingID, func(f *flow.Flow) string { return f.L3TrackingID }),
+		timestampField(ieSkydiveRTT, SkydiveEnterpriseNumber, func(f *flow.Flow) int64 { return f.RTT }),
+	)
+
+	if k.tcpMetric {
+		ttlField := func(id uint16, value func(m *flow.TCPMetric) uint32) *field {
+			return &field{id: id, enterprise: SkydiveEnterpriseNumber, length: 4, encode: func(b *bytes.Buffer, r *record) {
+				writeUint32(b, value(r.flow.TCPMetric))
+			}}
+		}
+
+		fields = append(fields,
+			timestampField(ieSkydiveABSynStart, SkydiveEnterpriseNumber, func(f *flow.Flow) int64 { return f.TCPMetric.ABSynStart }),
+			timestampField(ieSkydiveBASynStart, SkydiveEnterpriseNumber, func(f *flow.Flow) int64 { return f.TCPMetric.BASynStart }),
+			ttlField(ieSkydiveABSynTTL, func(m *flow.TCPMetric) uint32 { return m.ABSynTTL }),
+			ttlField(ieSkydiveBASynTTL, func(m *flow.TCPMetric) uint32 { return m.BASynTTL }),
+			timestampField(ieSkydiveABFinStart, SkydiveEnterpriseNumber, func(f *flow.Flow) int64 { return f.TCPMetric.ABFinStart }),
+			timestampField(ieSkydiveBAFinStart, SkydiveEnterpriseNumber, func(f *flow.Flow) int64 { return f.TCPMetric.BAFinStart }),
+			timestampField(ieSkydiveABRstStart, SkydiveEnterpriseNumber, func(f *flow.Flow) int64 { return f.TCPMetric.ABRstStart }),
+			timestampField(ieSkydiveBARstStart, SkydiveEnterpriseNumber, func(f *flow.Flow) int64 { return f.TCPMetric.BARstStart }),
+		)
+	}
+
+	return fields
+}
+
+func (e *IPFIXExporter) templateKey(f *flow.Flow) templateKey {
+	k := templateKey{
+		link:      f.Link != nil,
+		network:   -1,
+		transport: f.Transport != nil,
+		tcpMetric: f.TCPMetric != nil && e.opts.Version == IPFIXVersion,
+	}
+	if f.Network != nil {
+		k.network = f.Network.Protocol
+	}
+	return k
+}
+
+func (e *IPFIXExporter) getTemplate(f *flow.Flow) *template {
+	k := e.templateKey(f)
+	if t, ok := e.templates[k]; ok {
+		return t
+	}
+
+	t := &template{id: e.nextID, fields: e.newFields(k)}
+	e.templates[k] = t
+	e.nextID++
+
+	return t
+}
+
+// records returns the records used to export a flow. NetFlow v9 being
+// unidirectional, a record is added for the reverse direction if needed.
+func (e *IPFIXExporter) records(f *flow.Flow) []*record {
+	records := []*record{{flow: f}}
+	if e.opts.Version == NetFlow9Version && f.Metric != nil && f.Metric.BAPackets > 0 {
+		records = append(records, &record{flow: f, reverse: true})
+	}
+	return records
+}
+
+func (t *template) length() int {
+	l := 4
+	for _, f := range t.fields {
+		l += 4
+		if f.enterprise != 0 {
+			l += 4
+		}
+	}
+	return l
+}
+
+func (t *template) encode(b *bytes.Buffer) {
+	writeUint16(b, t.id)
+	writeUint16(b, uint16(len(t.fields)))
+	for _, f := range t.fields {
+		if f.enterprise != 0 {
+			writeUint16(b, f.id|0x8000)
+			writeUint16(b, f.length)
+			writeUint32(b, f.enterprise)
+		} else {
+			writeUint16(b, f.id)
+			writeUint16(b, f.length)
+		}
+	}
+}
+
+func (e *IPFIXExporter) headerLength() int {
+	if e.opts.Version == NetFlow9Version {
+		return netflow9HeaderLength
+	}
+	return ipfixHeaderLength
+}
+
+func (e *IPFIXExporter) newMessage() *message {
+	return &message{size: e.headerLength()}
+}
+
+func (m *message) hasTemplate(t *template) bool {
+	for _, mt := range m.templates {
+		if mt == t {
+			return true
+		}
+	}
+	return false
+}
+
+// requiredSize returns the number of bytes needed to add a record
+// of the given template to the message
+func (m *message) requiredSize(t *template, length int) int {
+	size := length
+	if !t.announced && !m.hasTemplate(t) {
+		size += t.length()
+		if len(m.templates) == 0 {
+			size += 4
+		}
+	}
+	if len(m.sets) == 0 || m.sets[len(m.sets)-1].id != t.id {
+		// set header and the worst case padding
+		size += 4 + 3
+	}
+	return size
+}
+
+func (m *message) add(t *template, data []byte) {
+	m.size += m.requiredSize(t, len(data))
+
+	if !t.announced && !m.hasTemplate(t) {
+		m.templates = append(m.templates, t)
+	}
+
+	if len(m.sets) == 0 || m.sets[len(m.sets)-1].id != t.id {
+		m.sets = append(m.sets, &dataSet{id: t.id})
+	}
+	m.sets[len(m.sets)-1].data.Write(data)
+	m.records++
+}
+
+func writeSet(b *bytes.Buffer, id uint16, data []byte, pad bool) {
+	length := 4 + len(data)
+	padding := 0
+	if pad && length%4 != 0 {
+		padding = 4 - length%4
+	}
+
+	writeUint16(b, id)
+	writeUint16(b, uint16(length+padding))
+	b.Write(data)
+	b.Write(make([]byte, padding))
+}
+
+func (e *IPFIXExporter) encodeMessage(m *message, now time.Time) []byte {
+	var b bytes.Buffer
+
+	if e.opts.Version == NetFlow9Version {
+		uptime := now.Sub(e.startTime) / time.Millisecond
+
+		writeUint16(&b, NetFlow9Version)
+		writeUint16(&b, uint16(len(m.templates)+m.records))
+		writeUint32(&b, uint32(uptime))
+		writeUint32(&b, uint32(now.Unix()))
+		writeUint32(&b, e.sequence)
+		writeUint32(&b, e.opts.ObservationDomain)
+	} else {
+		writeUint16(&b, IPFIXVersion)
+		writeUint16(&b, 0) // length, set once the message is encoded
+		writeUint32(&b, uint32(now.Unix()))
+		writeUint32(&b, e.sequence)
+		writeUint32(&b, e.opts.ObservationDomain)
+	}
+
+	pad := e.opts.Version == NetFlow9Version
+	if len(m.templates) > 0 {
+		var tb bytes.Buffer
+		for _, t := range m.templates {
+			t.encode(&tb)
+		}
+
+		setID := ipfixTemplateSetID
+		if e.opts.Version == NetFlow9Version {
+			setID = netflow9TemplateSetID
+		}
+		writeSet(&b, setID, tb.Bytes(), pad)
+	}
+
+	for _, s := range m.sets {
+		writeSet(&b, s.id, s.data.Bytes(), pad)
+	}
+
+	data := b.Bytes()
+	if e.opts.Version == IPFIXVersion {
+		binary.BigEndian.PutUint16(data[2:], uint16(len(data)))
+	}
+
+	return data
+}
+
+func (e *IPFIXExporter) send(m *message, now time.Time) error {
+	if _, err := e.conn.Write(e.encodeMessage(m, now)); err != nil {
+		return err
+	}
+
+	for _, t := range m.templates {
+		t.announced = true
+	}
+
+	// IPFIX sequence numbers count data records while NetFlow v9 ones count packets
+	if e.opts.Version == NetFlow9Version {
+		e.sequence++
+	} else {
+		e.sequence += uint32(m.records)
+	}
+
+	return nil
+}
+
+// ExportFlows encodes the given flows and sends them to the collector
+func (e *IPFIXExporter) ExportFlows(flows []*flow.Flow) error {
+	e.Lock()
+	defer e.Unlock()
+
+	if e.conn == nil {
+		return ErrExporterNotStarted
+	}
+
+	// templates have to be periodically sent again as UDP is not reliable
+	now := time.Now()
+	if now.Sub(e.lastAnnounce) >= e.opts.TemplateRefresh {
+		for _, t := range e.templates {
+			t.announced = false
+		}
+		e.lastAnnounce = now
+	}
+
+	m := e.newMessage()
+	for _, f := range flows {
+		for _, r := range e.records(f) {
+			t := e.getTemplate(f)
+
+			var data bytes.Buffer
+			for _, field := range t.fields {
+				field.encode(&data, r)
+			}
+
+			if m.records > 0 && m.size+m.requiredSize(t, data.Len()) > e.opts.MaxMessageSize {
+				if err := e.send(m, now); err != nil {
+					return err
+				}
+				m = e.newMessage()
+			}
+			m.add(t, data.Bytes())
+		}
+	}
+
+	if m.records > 0 {
+		return e.send(m, now)
+	}
+
+	return nil
+}
+
+// Start connects the exporter to its collector
+func (e *IPFIXExporter) Start() {
+	e.Lock()
+	defer e.Unlock()
+
+	conn, err := net.Dial("udp", e.addr)
+	if err != nil {
+		logging.GetLogger().Errorf("Unable to connect to flow collector %s: %s", e.addr, err)
+		return
+	}
+
+	e.conn = conn
+	e.startTime = time.Now()
+}
+
+// Stop the exporter
+func (e *IPFIXExporter) Stop() {
+	e.Lock()
+	defer e.Unlock()
+
+	if e.conn != nil {
+		e.conn.Close()
+		e.conn = nil
+	}
+}
+
+// NewIPFIXExporter returns a new IPFIX exporter sending flows to the given collector address
+func NewIPFIXExporter(addr string, opts IPFIXOpts) (*IPFIXExporter, error) {
+	if opts.Version != IPFIXVersion && opts.Version != NetFlow9Version {
+		return nil, fmt.Errorf("Unsupported IPFIX version %d", opts.Version)
+	}
+	if opts.TemplateRefresh <= 0 {
+		opts.TemplateRefresh = DefaultIPFIXTemplateRefresh
+	}
+	if opts.MaxMessageSize <= 0 {
+		opts.MaxMessageSize = DefaultIPFIXMaxMessageSize
+	}
+
+	return &IPFIXExporter{
+		addr:      addr,
+		opts:      opts,
+		templates: make(map[templateKey]*template),
+		nextID:    firstTemplateID,
+	}, nil
+}
+
+// NewIPFIXExporterFromConfig returns a new IPFIX exporter based on the exporter definition
+// found in the configuration
+func NewIPFIXExporterFromConfig(name string) (*IPFIXExporter, error) {
+	prefix := "exporter." + name + "."
+
+	addr := config.GetString(prefix + "address")
+	if addr == "" {
+		return nil, fmt.Errorf("No collector address defined for flow exporter %s", name)
+	}
+
+	opts := IPFIXOpts{
+		Version:           IPFIXVersion,
+		ObservationDomain: uint32(config.GetInt(prefix + "observation_domain")),
+		TemplateRefresh:   time.Duration(config.GetInt(prefix+"template_refresh")) * time.Second,
+		MaxMessageSize:    config.GetInt(prefix + "max_message_size"),
+	}
+	if config.GetString(prefix+"type") == "netflow9" {
+		opts.Version = NetFlow9Version
+	}
+
+	return NewIPFIXExporter(addr, opts)
+}
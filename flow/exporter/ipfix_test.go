@@ -0,0 +1,389 @@
+/*
+ * Copyright (C) 2018 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package exporter
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/skydive-project/skydive/flow"
+)
+
+type fieldKey struct {
+	id         uint16
+	enterprise uint32
+}
+
+type fieldSpec struct {
+	fieldKey
+	length uint16
+}
+
+type decodedMessage struct {
+	version   uint16
+	sequence  uint32
+	domain    uint32
+	templates map[uint16][]fieldSpec
+	records   []map[fieldKey][]byte
+}
+
+// collector is a minimal IPFIX/NetFlow v9 collector used to check the exported messages
+type collector struct {
+	t         *testing.T
+	conn      *net.UDPConn
+	templates map[uint16][]fieldSpec
+}
+
+func newCollector(t *testing.T) *collector {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &collector{t: t, conn: conn, templates: make(map[uint16][]fieldSpec)}
+}
+
+func (c *collector) addr() string {
+	return c.conn.LocalAddr().String()
+}
+
+func (c *collector) close() {
+	c.conn.Close()
+}
+
+func (c *collector) read() *decodedMessage {
+	c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	data := make([]byte, 65535)
+	n, err := c.conn.Read(data)
+	if err != nil {
+		c.t.Fatalf("Unable to read exported message: %s", err)
+	}
+	data = data[:n]
+
+	m := &decodedMessage{
+		version:   binary.BigEndian.Uint16(data),
+		templates: make(map[uint16][]fieldSpec),
+	}
+
+	var offset int
+	templateSetID := ipfixTemplateSetID
+	if m.version == NetFlow9Version {
+		m.sequence = binary.BigEndian.Uint32(data[12:])
+		m.domain = binary.BigEndian.Uint32(data[16:])
+		templateSetID = netflow9TemplateSetID
+		offset = netflow9HeaderLength
+	} else {
+		if length := int(binary.BigEndian.Uint16(data[2:])); length != n {
+			c.t.Fatalf("Wrong message length, expected %d got %d", n, length)
+		}
+		m.sequence = binary.BigEndian.Uint32(data[8:])
+		m.domain = binary.BigEndian.Uint32(data[12:])
+		offset = ipfixHeaderLength
+	}
+
+	for offset < len(data) {
+		id := binary.BigEndian.Uint16(data[offset:])
+		length := int(binary.BigEndian.Uint16(data[offset+2:]))
+		set := data[offset+4 : offset+length]
+		offset += length
+
+		if id == templateSetID {
+			for len(set) >= 4 {
+				templateID := binary.BigEndian.Uint16(set)
+				count := int(binary.BigEndian.Uint16(set[2:]))
+				set = set[4:]
+
+				var fields []fieldSpec
+				for i := 0; i < count; i++ {
+					spec := fieldSpec{fieldKey: fieldKey{id: binary.BigEndian.Uint16(set)}, length: binary.BigEndian.Uint16(set[2:])}
+					set = set[4:]
+					if spec.id&0x8000 != 0 {
+						spec.id &= 0x7fff
+						spec.enterprise = binary.BigEndian.Uint32(set)
+						set = set[4:]
+					}
+					fields = append(fields, spec)
+				}
+				m.templates[templateID] = fields
+				c.templates[templateID] = fields
+			}
+			continue
+		}
+
+		fields, ok := c.templates[id]
+		if !ok {
+			c.t.Fatalf("Data set received for an unknown template %d", id)
+		}
+
+		for len(set) > 0 {
+			r := make(map[fieldKey][]byte)
+			for _, spec := range fields {
+				length := int(spec.length)
+				if spec.length == variableLength {
+					length, set = int(set[0]), set[1:]
+					if length == 255 {
+						length, set = int(binary.BigEndian.Uint16(set)), set[2:]
+					}
+				}
+				r[spec.fieldKey], set = set[:length], set[length:]
+			}
+			m.records = append(m.records, r)
+
+			// skip NetFlow v9 padding
+			if len(set) < 4 {
+				break
+			}
+		}
+	}
+
+	return m
+}
+
+func newTestFlow(uuid string) *flow.Flow {
+	return &flow.Flow{
+		UUID:         uuid,
+		LayersPath:   "Ethernet/IPv4/TCP",
+		Application:  "TCP",
+		NodeTID:      "probe-tid",
+		TrackingID:   "tracking-" + uuid,
+		L3TrackingID: "l3tracking-" + uuid,
+		Link: &flow.FlowLayer{
+			Protocol: flow.FlowProtocol_ETHERNET,
+			A:        "00:11:22:33:44:55",
+			B:        "66:77:88:99:aa:bb",
+		},
+		Network: &flow.FlowLayer{
+			Protocol: flow.FlowProtocol_IPV4,
+			A:        "192.168.0.1",
+			B:        "192.168.0.2",
+		},
+		Transport: &flow.TransportLayer{
+			Protocol: flow.FlowProtocol_TCP,
+			A:        47838,
+			B:        80,
+		},
+		Metric: &flow.FlowMetric{
+			ABPackets: 10,
+			ABBytes:   1000,
+			BAPackets: 20,
+			BABytes:   2000,
+		},
+		LastUpdateMetric: &flow.FlowMetric{
+			ABPackets: 1,
+			ABBytes:   100,
+			BAPackets: 2,
+			BABytes:   200,
+		},
+		TCPMetric: &flow.TCPMetric{
+			ABSynStart: 1000,
+			ABSynTTL:   64,
+		},
+		Start: 1000,
+		Last:  2000,
+		RTT:   33,
+	}
+}
+
+func newTestExporter(t *testing.T, c *collector, opts IPFIXOpts) *IPFIXExporter {
+	e, err := NewIPFIXExporter(c.addr(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Start()
+
+	return e
+}
+
+func checkUint(t *testing.T, r map[fieldKey][]byte, k fieldKey, expected uint64) {
+	value, ok := r[k]
+	if !ok {
+		t.Fatalf("Field %+v not found in record", k)
+	}
+
+	var got uint64
+	for _, b := range value {
+		got = got<<8 | uint64(b)
+	}
+	if got != expected {
+		t.Errorf("Wrong value for field %+v, expected %d got %d", k, expected, got)
+	}
+}
+
+func checkBytes(t *testing.T, r map[fieldKey][]byte, k fieldKey, expected string) {
+	value, ok := r[k]
+	if !ok {
+		t.Fatalf("Field %+v not found in record", k)
+	}
+	if string(value) != expected {
+		t.Errorf("Wrong value for field %+v, expected %q got %q", k, expected, string(value))
+	}
+}
+
+func TestIPFIXExport(t *testing.T) {
+	c := newCollector(t)
+	defer c.close()
+
+	e := newTestExporter(t, c, IPFIXOpts{Version: IPFIXVersion, ObservationDomain: 42})
+	defer e.Stop()
+
+	if err := e.ExportFlows([]*flow.Flow{newTestFlow("aaa")}); err != nil {
+		t.Fatal(err)
+	}
+
+	m := c.read()
+	if m.version != IPFIXVersion || m.domain != 42 || m.sequence != 0 {
+		t.Fatalf("Wrong message header: %+v", m)
+	}
+	if len(m.templates) != 1 {
+		t.Fatalf("Expected one template, got %d", len(m.templates))
+	}
+	if len(m.records) != 1 {
+		t.Fatalf("Expected one record, got %d", len(m.records))
+	}
+
+	r := m.records[0]
+	checkBytes(t, r, fieldKey{id: ieSourceMacAddress}, string([]byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}))
+	checkBytes(t, r, fieldKey{id: ieSourceIPv4Address}, string(net.ParseIP("192.168.0.1").To4()))
+	checkBytes(t, r, fieldKey{id: ieDestinationIPv4Address}, string(net.ParseIP("192.168.0.2").To4()))
+	checkUint(t, r, fieldKey{id: ieProtocolIdentifier}, 6)
+	checkUint(t, r, fieldKey{id: ieSourceTransportPort}, 47838)
+	checkUint(t, r, fieldKey{id: ieDestinationTransportPort}, 80)
+	checkUint(t, r, fieldKey{id: ieFlowStartMilliseconds}, 1000)
+	checkUint(t, r, fieldKey{id: ieFlowEndMilliseconds}, 2000)
+	checkUint(t, r, fieldKey{id: ieOctetTotalCount}, 1000)
+	checkUint(t, r, fieldKey{id: iePacketTotalCount}, 10)
+	checkUint(t, r, fieldKey{id: ieOctetDeltaCount}, 100)
+	checkUint(t, r, fieldKey{id: iePacketDeltaCount}, 1)
+	checkUint(t, r, fieldKey{id: ieOctetTotalCount, enterprise: ReverseEnterpriseNumber}, 2000)
+	checkUint(t, r, fieldKey{id: iePacketTotalCount, enterprise: ReverseEnterpriseNumber}, 20)
+	checkUint(t, r, fieldKey{id: ieOctetDeltaCount, enterprise: ReverseEnterpriseNumber}, 200)
+	checkUint(t, r, fieldKey{id: iePacketDeltaCount, enterprise: ReverseEnterpriseNumber}, 2)
+	checkBytes(t, r, fieldKey{id: ieApplicationName}, "TCP")
+	checkBytes(t, r, fieldKey{id: ieSkydiveNodeTID, enterprise: SkydiveEnterpriseNumber}, "probe-tid")
+	checkBytes(t, r, fieldKey{id: ieSkydiveTrackingID, enterprise: SkydiveEnterpriseNumber}, "tracking-aaa")
+	checkBytes(t, r, fieldKey{id: ieSkydiveL3TrackingID, enterprise: SkydiveEnterpriseNumber}, "l3tracking-aaa")
+	checkUint(t, r, fieldKey{id: ieSkydiveRTT, enterprise: SkydiveEnterpriseNumber}, 33)
+	checkUint(t, r, fieldKey{id: ieSkydiveABSynStart, enterprise: SkydiveEnterpriseNumber}, 1000)
+	checkUint(t, r, fieldKey{id: ieSkydiveABSynTTL, enterprise: SkydiveEnterpriseNumber}, 64)
+}
+
+func TestIPFIXTemplates(t *testing.T) {
+	c := newCollector(t)
+	defer c.close()
+
+	e := newTestExporter(t, c, IPFIXOpts{Version: IPFIXVersion, TemplateRefresh: time.Hour})
+	defer e.Stop()
+
+	ipv6 := newTestFlow("bbb")
+	ipv6.Network = &flow.FlowLayer{Protocol: flow.FlowProtocol_IPV6, A: "fd00::1", B: "fd00::2"}
+
+	if err := e.ExportFlows([]*flow.Flow{newTestFlow("aaa"), ipv6}); err != nil {
+		t.Fatal(err)
+	}
+
+	m := c.read()
+	if len(m.templates) != 2 || len(m.records) != 2 {
+		t.Fatalf("Expected 2 templates and 2 records, got %d and %d", len(m.templates), len(m.records))
+	}
+	checkBytes(t, m.records[1], fieldKey{id: ieSourceIPv6Address}, string(net.ParseIP("fd00::1")))
+
+	// templates already announced should not be sent again before the refresh delay
+	if err := e.ExportFlows([]*flow.Flow{newTestFlow("ccc")}); err != nil {
+		t.Fatal(err)
+	}
+
+	m = c.read()
+	if len(m.templates) != 0 || len(m.records) != 1 {
+		t.Fatalf("Expected no template and 1 record, got %d and %d", len(m.templates), len(m.records))
+	}
+	if m.sequence != 2 {
+		t.Errorf("Expected sequence number 2, got %d", m.sequence)
+	}
+}
+
+func TestIPFIXMaxMessageSize(t *testing.T) {
+	c := newCollector(t)
+	defer c.close()
+
+	e := newTestExporter(t, c, IPFIXOpts{Version: IPFIXVersion, MaxMessageSize: 512})
+	defer e.Stop()
+
+	var flows []*flow.Flow
+	for _, uuid := range []string{"aaa", "bbb", "ccc", "ddd", "eee", "fff"} {
+		flows = append(flows, newTestFlow(uuid))
+	}
+
+	if err := e.ExportFlows(flows); err != nil {
+		t.Fatal(err)
+	}
+
+	var received uint32
+	for received < uint32(len(flows)) {
+		m := c.read()
+		if m.sequence != received {
+			t.Errorf("Expected sequence number %d, got %d", received, m.sequence)
+		}
+		if len(m.records) == 0 {
+			t.Fatal("Message without any record")
+		}
+		received += uint32(len(m.records))
+	}
+}
+
+func TestNetFlow9Export(t *testing.T) {
+	c := newCollector(t)
+	defer c.close()
+
+	e := newTestExporter(t, c, IPFIXOpts{Version: NetFlow9Version, ObservationDomain: 7})
+	defer e.Stop()
+
+	if err := e.ExportFlows([]*flow.Flow{newTestFlow("aaa")}); err != nil {
+		t.Fatal(err)
+	}
+
+	m := c.read()
+	if m.version != NetFlow9Version || m.domain != 7 {
+		t.Fatalf("Wrong message header: %+v", m)
+	}
+
+	for _, spec := range m.templates[firstTemplateID] {
+		if spec.enterprise != 0 || spec.length == variableLength {
+			t.Errorf("NetFlow v9 template should not contain field %+v", spec)
+		}
+	}
+
+	// one record per direction
+	if len(m.records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(m.records))
+	}
+
+	ab, ba := m.records[0], m.records[1]
+	checkBytes(t, ab, fieldKey{id: ieSourceIPv4Address}, string(net.ParseIP("192.168.0.1").To4()))
+	checkUint(t, ab, fieldKey{id: ieOctetTotalCount}, 1000)
+	checkBytes(t, ba, fieldKey{id: ieSourceIPv4Address}, string(net.ParseIP("192.168.0.2").To4()))
+	checkUint(t, ba, fieldKey{id: ieSourceTransportPort}, 80)
+	checkUint(t, ba, fieldKey{id: ieOctetTotalCount}, 2000)
+	checkUint(t, ba, fieldKey{id: iePacketDeltaCount}, 2)
+}
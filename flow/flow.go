@@ -65,10 +65,13 @@ const (
 // flowState is used internally to track states within the flow table.
 // it is added to the generated Flow struct by Makefile
 type flowState struct {
-	lastMetric       *FlowMetric
-	link1stPacket    int64
-	network1stPacket int64
-	updateVersion    int64
+	lastMetric        *FlowMetric
+	link1stPacket     int64
+	network1stPacket  int64
+	updateVersion     int64
+	http              *httpState
+	classifiedPackets int64
+	tcp               *tcpState
 }
 
 // Packet describes one packet
@@ -87,7 +90,8 @@ type Packet struct {
 
 // PacketSequence represents a suite of parent/child Packet
 type PacketSequence struct {
-	Packets []*Packet
+	Packets      []*Packet
+	SamplingRate int64 // number of packets each packet stands for, 0 or 1 if not sampled
 }
 
 // RawPackets embeds flow RawPacket array with the associated link type
@@ -116,6 +120,10 @@ const (
 	DNSLayer ExtraLayers = 2
 	// DHCPv4Layer extra layer
 	DHCPv4Layer ExtraLayers = 4
+	// HTTPLayer extra layer, requires TCP reassembly
+	HTTPLayer ExtraLayers = 8
+	// TLSLayer extra layer, requires TCP reassembly
+	TLSLayer ExtraLayers = 16
 	// ALLLayer all extra layers
 	ALLLayer ExtraLayers = 255
 )
@@ -124,6 +132,8 @@ var extraLayersMap = map[string]ExtraLayers{
 	"VRRP":   VRRPLayer,
 	"DNS":    DNSLayer,
 	"DHCPv4": DHCPv4Layer,
+	"HTTP":   HTTPLayer,
+	"TLS":    TLSLayer,
 }
 
 // Parse set the ExtraLayers struct with the given list of protocol strings
@@ -175,6 +185,7 @@ type Opts struct {
 	IPDefrag     bool
 	LayerKeyMode LayerKeyMode
 	AppPortMap   *ApplicationPortMap
+	Classifier   *ApplicationClassifier
 	ExtraLayers  ExtraLayers
 }
 
@@ -607,6 +618,8 @@ func (f *Flow) Update(packet *Packet, opts Opts) {
 	if f.TCPMetric != nil {
 		f.updateTCPMetrics(packet)
 	}
+
+	opts.Classifier.classify(f, packet)
 }
 
 func (f *Flow) newLinkLayer(packet *Packet) error {
@@ -796,11 +809,6 @@ func (f *Flow) updateTCPMetrics(packet *Packet) error {
 		return nil
 	}
 
-	// we capture SYN, FIN & RST
-	if !(tcpPacket.SYN || tcpPacket.FIN || tcpPacket.RST) {
-		return nil
-	}
-
 	var srcIP string
 	var timeToLive uint32
 	switch f.Network.Protocol {
@@ -854,6 +862,8 @@ func (f *Flow) updateTCPMetrics(packet *Packet) error {
 		}
 	}
 
+	f.updateTCPPerformanceMetrics(tcpPacket, f.Network.A == srcIP, metadata.CaptureInfo.Timestamp.UnixNano())
+
 	return nil
 }
 
@@ -866,11 +876,11 @@ func (f *Flow) newTransportLayer(packet *Packet, opts Opts) error {
 		f.Transport.A, f.Transport.B = int64(srcPort), int64(dstPort)
 
 		if app, ok := opts.AppPortMap.tcpApplication(srcPort, dstPort); ok {
-			f.Application = app
+			f.Application, f.ApplicationConfidence = app, PortApplicationConfidence
 		}
 
 		if opts.TCPMetric {
-			f.TCPMetric = &TCPMetric{}
+			f.TCPMetric = &TCPMetric{ABWindowScale: -1, BAWindowScale: -1}
 		}
 	} else if layer := packet.Layer(layers.LayerTypeUDP); layer != nil {
 		f.Transport = &TransportLayer{Protocol: FlowProtocol_UDP}
@@ -880,7 +890,7 @@ func (f *Flow) newTransportLayer(packet *Packet, opts Opts) error {
 		f.Transport.A, f.Transport.B = int64(srcPort), int64(dstPort)
 
 		if app, ok := opts.AppPortMap.udpApplication(srcPort, dstPort); ok {
-			f.Application = app
+			f.Application, f.ApplicationConfidence = app, PortApplicationConfidence
 		}
 	} else if layer := packet.Layer(layers.LayerTypeSCTP); layer != nil {
 		f.Transport = &TransportLayer{Protocol: FlowProtocol_SCTP}
@@ -1202,7 +1212,7 @@ func (i *TCPMetric) GetFieldInt64(field string) (int64, error) {
 	case "BAFinStart":
 		return i.BAFinStart, nil
 	case "ABRstStart":
-		return i.BARstStart, nil
+		return i.ABRstStart, nil
 	case "BARstStart":
 		return i.BARstStart, nil
 	case "ABSegmentOutOfOrder":
@@ -1233,6 +1243,38 @@ func (i *TCPMetric) GetFieldInt64(field string) (int64, error) {
 		return i.BASawStart, nil
 	case "BASawEnd":
 		return i.BASawEnd, nil
+	case "ABRetransmissions":
+		return i.ABRetransmissions, nil
+	case "BARetransmissions":
+		return i.BARetransmissions, nil
+	case "ABDuplicateAcks":
+		return i.ABDuplicateAcks, nil
+	case "BADuplicateAcks":
+		return i.BADuplicateAcks, nil
+	case "ABZeroWindows":
+		return i.ABZeroWindows, nil
+	case "BAZeroWindows":
+		return i.BAZeroWindows, nil
+	case "ABWindowScale":
+		return i.ABWindowScale, nil
+	case "BAWindowScale":
+		return i.BAWindowScale, nil
+	case "ABRTTMin":
+		return i.ABRTTMin, nil
+	case "BARTTMin":
+		return i.BARTTMin, nil
+	case "ABRTTAvg":
+		return i.ABRTTAvg, nil
+	case "BARTTAvg":
+		return i.BARTTAvg, nil
+	case "ABRTTMax":
+		return i.ABRTTMax, nil
+	case "BARTTMax":
+		return i.BARTTMax, nil
+	case "ABRTTSamples":
+		return i.ABRTTSamples, nil
+	case "BARTTSamples":
+		return i.BARTTSamples, nil
 	default:
 		return 0, common.ErrFieldNotFound
 	}
@@ -1305,6 +1347,10 @@ func (f *Flow) GetFieldInt64(field string) (_ int64, err error) {
 		return f.Start, nil
 	case "RTT":
 		return f.RTT, nil
+	case "SamplingRate":
+		return f.SamplingRate, nil
+	case "ApplicationConfidence":
+		return f.ApplicationConfidence, nil
 	}
 
 	fields := strings.Split(field, ".")
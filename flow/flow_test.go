@@ -1131,6 +1131,16 @@ func TestGetFieldInterface(t *testing.T) {
 	}
 }
 
+func TestTCPMetricGetFieldInt64(t *testing.T) {
+	m := &TCPMetric{ABRstStart: 1, BARstStart: 2, ABFinStart: 3, BAFinStart: 4}
+
+	for field, expected := range map[string]int64{"ABRstStart": 1, "BARstStart": 2, "ABFinStart": 3, "BAFinStart": 4} {
+		if value, err := m.GetFieldInt64(field); err != nil || value != expected {
+			t.Errorf("%s should be %d, got %d (%v)", field, expected, value, err)
+		}
+	}
+}
+
 func TestVxlanIcmpv4Truncated(t *testing.T) {
 	expected := []*Flow{
 		{
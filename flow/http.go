@@ -0,0 +1,392 @@
+/*
+ * Copyright (C) 2018 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package flow
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maximum size of the headers of a HTTP message, if exceeded the stream
+	// is considered as not being HTTP
+	httpMaxHeaderSize = 8192
+	// maximum number of requests waiting for a response
+	httpMaxPendingRequests = 32
+)
+
+var httpMethods = []string{"GET", "HEAD", "POST", "PUT", "DELETE", "CONNECT", "OPTIONS", "TRACE", "PATCH"}
+
+type httpBodyMode int
+
+const (
+	httpBodyNone httpBodyMode = iota
+	httpBodyLength
+	httpBodyChunked
+	httpBodyUntilClose
+)
+
+type httpChunkState int
+
+const (
+	httpChunkSize httpChunkState = iota
+	httpChunkData
+	httpChunkTrailer
+)
+
+// httpRequest holds a request waiting for its response
+type httpRequest struct {
+	method string
+	seen   time.Time
+}
+
+// httpState tracks the HTTP exchanges of a flow, shared by both directions
+type httpState struct {
+	pending []httpRequest
+}
+
+// httpStream incrementally parses the HTTP/1.x messages of one direction
+// of a reassembled TCP stream
+type httpStream struct {
+	flow       *Flow
+	buffer     []byte
+	start      time.Time
+	bodyMode   httpBodyMode
+	bodyLeft   int64
+	chunkState httpChunkState
+	invalid    bool
+}
+
+func isHTTPStart(data []byte) bool {
+	if hasPartialPrefix(data, "HTTP/") {
+		return true
+	}
+	for _, method := range httpMethods {
+		if hasPartialPrefix(data, method+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+// hasPartialPrefix returns whether the data starts with the prefix, or is
+// the beginning of it if shorter, a message start being split across
+// several segments
+func hasPartialPrefix(data []byte, prefix string) bool {
+	if len(data) < len(prefix) {
+		prefix = prefix[:len(data)]
+	}
+	return bytes.HasPrefix(data, []byte(prefix))
+}
+
+func (h *HTTPMetric) addStatusCode(code int64) {
+	h.StatusCode = code
+	switch code / 100 {
+	case 1:
+		h.Status1xx++
+	case 2:
+		h.Status2xx++
+	case 3:
+		h.Status3xx++
+	case 4:
+		h.Status4xx++
+	case 5:
+		h.Status5xx++
+	}
+}
+
+func (h *HTTPMetric) addTTFB(ttfb int64) {
+	h.TTFB = ttfb
+	if h.MinTTFB == 0 || ttfb < h.MinTTFB {
+		h.MinTTFB = ttfb
+	}
+	if ttfb > h.MaxTTFB {
+		h.MaxTTFB = ttfb
+	}
+}
+
+func (s *httpStream) state() *httpState {
+	if s.flow.XXX_state.http == nil {
+		s.flow.XXX_state.http = &httpState{}
+	}
+	return s.flow.XXX_state.http
+}
+
+func (s *httpStream) metric() *HTTPMetric {
+	if s.flow.HTTP == nil {
+		s.flow.HTTP = &HTTPMetric{}
+	}
+	return s.flow.HTTP
+}
+
+// httpHeaders returns the values of the given headers, names being lower cased
+func httpHeaders(lines []string, names ...string) map[string]string {
+	values := make(map[string]string)
+	for _, line := range lines {
+		i := strings.IndexByte(line, ':')
+		if i <= 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:i]))
+		for _, name := range names {
+			if key == name {
+				values[name] = strings.TrimSpace(line[i+1:])
+			}
+		}
+	}
+	return values
+}
+
+func (s *httpStream) setBodyMode(headers map[string]string, response bool) {
+	s.bodyMode = httpBodyNone
+	if te, ok := headers["transfer-encoding"]; ok && strings.Contains(strings.ToLower(te), "chunked") {
+		s.bodyMode = httpBodyChunked
+		s.chunkState = httpChunkSize
+	} else if cl, ok := headers["content-length"]; ok {
+		if length, err := strconv.ParseInt(cl, 10, 64); err == nil && length > 0 {
+			s.bodyMode = httpBodyLength
+			s.bodyLeft = length
+		}
+	} else if response {
+		s.bodyMode = httpBodyUntilClose
+	}
+}
+
+func (s *httpStream) onRequest(line string, headers []string) bool {
+	fields := strings.SplitN(line, " ", 3)
+	if len(fields) != 3 || !strings.HasPrefix(fields[2], "HTTP/") {
+		return false
+	}
+
+	values := httpHeaders(headers, "host", "content-length", "transfer-encoding")
+
+	h := s.metric()
+	h.Requests++
+	h.Method = fields[0]
+	h.Path = fields[1]
+	h.Host = values["host"]
+
+	state := s.state()
+	if len(state.pending) < httpMaxPendingRequests {
+		state.pending = append(state.pending, httpRequest{method: fields[0], seen: s.start})
+	}
+
+	s.setBodyMode(values, false)
+	return true
+}
+
+func (s *httpStream) onResponse(line string, headers []string) bool {
+	fields := strings.SplitN(line, " ", 3)
+	if len(fields) < 2 {
+		return false
+	}
+
+	code, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || code < 100 || code > 999 {
+		return false
+	}
+
+	h := s.metric()
+	h.addStatusCode(code)
+
+	// informational responses are followed by the final response
+	if code < 200 {
+		s.bodyMode = httpBodyNone
+		return true
+	}
+	h.Responses++
+
+	var method string
+	state := s.state()
+	if len(state.pending) > 0 {
+		request := state.pending[0]
+		state.pending = state.pending[1:]
+
+		method = request.method
+		if ttfb := s.start.Sub(request.seen).Nanoseconds(); ttfb >= 0 {
+			h.addTTFB(ttfb)
+		}
+	}
+
+	if method == "HEAD" || code == 204 || code == 304 {
+		s.bodyMode = httpBodyNone
+		return true
+	}
+
+	s.setBodyMode(httpHeaders(headers, "content-length", "transfer-encoding"), true)
+	return true
+}
+
+// parseHeaders tries to parse the headers of a message from the buffer and
+// returns the number of bytes consumed, 0 if the headers are not complete
+func (s *httpStream) parseHeaders() int {
+	end := bytes.Index(s.buffer, []byte("\r\n\r\n"))
+	if end == -1 {
+		if len(s.buffer) > httpMaxHeaderSize {
+			s.invalid = true
+		}
+		return 0
+	}
+
+	lines := strings.Split(string(s.buffer[:end]), "\r\n")
+
+	var ok bool
+	if strings.HasPrefix(lines[0], "HTTP/") {
+		ok = s.onResponse(lines[0], lines[1:])
+	} else {
+		ok = s.onRequest(lines[0], lines[1:])
+	}
+	if !ok {
+		s.invalid = true
+		return 0
+	}
+
+	return end + 4
+}
+
+// skipChunked consumes the chunks of a chunked body and returns the number
+// of bytes consumed, 0 if more data is needed
+func (s *httpStream) skipChunked(data []byte) int {
+	switch s.chunkState {
+	case httpChunkData:
+		n := int64(len(data))
+		if n > s.bodyLeft {
+			n = s.bodyLeft
+		}
+		s.bodyLeft -= n
+		if s.bodyLeft == 0 {
+			s.chunkState = httpChunkSize
+		}
+		return int(n)
+	default:
+		end := bytes.Index(data, []byte("\r\n"))
+		if end == -1 {
+			return 0
+		}
+
+		line := string(data[:end])
+		if s.chunkState == httpChunkTrailer {
+			if line == "" {
+				s.bodyMode = httpBodyNone
+			}
+			return end + 2
+		}
+
+		if i := strings.IndexByte(line, ';'); i != -1 {
+			line = line[:i]
+		}
+		size, err := strconv.ParseInt(strings.TrimSpace(line), 16, 64)
+		if err != nil {
+			s.invalid = true
+			return 0
+		}
+
+		if size == 0 {
+			s.chunkState = httpChunkTrailer
+		} else {
+			// chunk data followed by CRLF
+			s.chunkState = httpChunkData
+			s.bodyLeft = size + 2
+		}
+		return end + 2
+	}
+}
+
+// feed parses the data of the stream seen at the given time
+func (s *httpStream) feed(data []byte, seen time.Time) {
+	if s.invalid {
+		return
+	}
+
+	for len(data) > 0 {
+		switch s.bodyMode {
+		case httpBodyUntilClose:
+			return
+		case httpBodyLength:
+			n := int64(len(data))
+			if n > s.bodyLeft {
+				n = s.bodyLeft
+			}
+			s.bodyLeft -= n
+			if s.bodyLeft == 0 {
+				s.bodyMode = httpBodyNone
+			}
+			data = data[n:]
+			continue
+		case httpBodyChunked:
+			s.buffer = append(s.buffer, data...)
+			data = nil
+
+			for len(s.buffer) > 0 && s.bodyMode == httpBodyChunked && !s.invalid {
+				n := s.skipChunked(s.buffer)
+				if n == 0 {
+					break
+				}
+				s.buffer = s.buffer[n:]
+			}
+
+			if s.invalid || s.bodyMode == httpBodyChunked {
+				return
+			}
+
+			data, s.buffer = s.buffer, nil
+			continue
+		}
+
+		if len(s.buffer) == 0 {
+			s.start = seen
+		}
+
+		s.buffer = append(s.buffer, data...)
+		data = nil
+
+		// checked again until the buffer holds the whole method
+		if !isHTTPStart(s.buffer) {
+			s.invalid = true
+			return
+		}
+
+		n := s.parseHeaders()
+		if n == 0 {
+			return
+		}
+		data, s.buffer = s.buffer[n:], nil
+	}
+}
+
+// skip is called when bytes of the stream have been lost, the parser
+// waits for the next message
+func (s *httpStream) skip() {
+	s.buffer = nil
+	s.bodyMode = httpBodyNone
+	s.invalid = false
+	if s.flow.XXX_state.http != nil {
+		s.flow.XXX_state.http.pending = nil
+	}
+}
+
+func newHTTPStream(f *Flow) *httpStream {
+	return &httpStream{flow: f}
+}
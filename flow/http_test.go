@@ -0,0 +1,103 @@
+/*
+ * Copyright (C) 2018 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package flow
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHTTPStream(t *testing.T) {
+	f := NewFlow()
+	client, server := newHTTPStream(f), newHTTPStream(f)
+
+	now := time.Now()
+	at := func(ms int) time.Time {
+		return now.Add(time.Duration(ms) * time.Millisecond)
+	}
+
+	// pipelined requests split across several segments
+	client.feed([]byte("GET /index.html HTTP/1.1\r\nHost: www.example.com\r\n"), at(0))
+	client.feed([]byte("\r\nPOST /api HTTP/1.1\r\nHost: www.example.com\r\nContent-Length: 5\r\n\r\nhel"), at(1))
+	client.feed([]byte("loHEAD /missing HTTP/1.1\r\nHost: www.example.com\r\n\r\n"), at(2))
+
+	if f.HTTP == nil || f.HTTP.Requests != 3 {
+		t.Fatalf("Should have parsed 3 requests : %+v", f.HTTP)
+	}
+	if f.HTTP.Method != "HEAD" || f.HTTP.Path != "/missing" || f.HTTP.Host != "www.example.com" {
+		t.Errorf("Wrong last request : %+v", f.HTTP)
+	}
+
+	server.feed([]byte("HTTP/1.1 200 OK\r\nContent-Length: 4\r\n\r\nbody"), at(10))
+	server.feed([]byte("HTTP/1.1 100 Continue\r\n\r\n"), at(11))
+	server.feed([]byte("HTTP/1.1 201 Created\r\nTransfer-Encoding: chunked\r\n\r\n4\r\nbo"), at(13))
+	server.feed([]byte("dy\r\n0\r\n\r\n"), at(14))
+	server.feed([]byte("HTTP/1.1 404 Not Found\r\nContent-Length: 10\r\n\r\n"), at(32))
+
+	h := f.HTTP
+	if h.Responses != 3 || h.StatusCode != 404 {
+		t.Errorf("Should have parsed 3 responses : %+v", h)
+	}
+	if h.Status1xx != 1 || h.Status2xx != 2 || h.Status4xx != 1 || h.Status3xx != 0 || h.Status5xx != 0 {
+		t.Errorf("Wrong status code histogram : %+v", h)
+	}
+	if h.MinTTFB != int64(10*time.Millisecond) || h.MaxTTFB != int64(30*time.Millisecond) || h.TTFB != int64(30*time.Millisecond) {
+		t.Errorf("Wrong time to first byte : %+v", h)
+	}
+}
+
+func TestHTTPStreamNotHTTP(t *testing.T) {
+	f := NewFlow()
+	s := newHTTPStream(f)
+
+	s.feed([]byte{0x16, 0x03, 0x01, 0x02, 0x00}, time.Now())
+	s.feed([]byte("GET / HTTP/1.1\r\n\r\n"), time.Now())
+
+	if f.HTTP != nil {
+		t.Errorf("Non HTTP stream should be ignored : %+v", f.HTTP)
+	}
+}
+
+func TestHTTPStreamSplitStart(t *testing.T) {
+	f := NewFlow()
+	client, server := newHTTPStream(f), newHTTPStream(f)
+
+	client.feed([]byte("GE"), time.Now())
+	client.feed([]byte("T / HTTP/1.1\r\nHost: www.example.com\r\n\r\n"), time.Now())
+	server.feed([]byte("HTT"), time.Now())
+	server.feed([]byte("P/1.1 204 No Content\r\n\r\n"), time.Now())
+
+	if f.HTTP == nil || f.HTTP.Requests != 1 || f.HTTP.Method != "GET" || f.HTTP.Responses != 1 || f.HTTP.StatusCode != 204 {
+		t.Errorf("Split message starts should be parsed : %+v", f.HTTP)
+	}
+
+	f = NewFlow()
+	s := newHTTPStream(f)
+
+	s.feed([]byte("GX"), time.Now())
+	s.feed([]byte("T / HTTP/1.1\r\n\r\n"), time.Now())
+
+	if f.HTTP != nil {
+		t.Errorf("Non HTTP stream should be ignored : %+v", f.HTTP)
+	}
+}
@@ -73,6 +73,22 @@ func (tm *TCPMetric) Copy() *TCPMetric {
 		BABytes:               tm.BABytes,
 		BASawStart:            tm.BASawStart,
 		BASawEnd:              tm.BASawEnd,
+		ABRetransmissions:     tm.ABRetransmissions,
+		BARetransmissions:     tm.BARetransmissions,
+		ABDuplicateAcks:       tm.ABDuplicateAcks,
+		BADuplicateAcks:       tm.BADuplicateAcks,
+		ABZeroWindows:         tm.ABZeroWindows,
+		BAZeroWindows:         tm.BAZeroWindows,
+		ABWindowScale:         tm.ABWindowScale,
+		BAWindowScale:         tm.BAWindowScale,
+		ABRTTMin:              tm.ABRTTMin,
+		BARTTMin:              tm.BARTTMin,
+		ABRTTAvg:              tm.ABRTTAvg,
+		BARTTAvg:              tm.BARTTAvg,
+		ABRTTMax:              tm.ABRTTMax,
+		BARTTMax:              tm.BARTTMax,
+		ABRTTSamples:          tm.ABRTTSamples,
+		BARTTSamples:          tm.BARTTSamples,
 	}
 }
 
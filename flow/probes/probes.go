@@ -53,17 +53,26 @@ type FlowProbeEventHandler interface {
 // FlowProbeTableAllocator allocates table and set the table update callback
 type FlowProbeTableAllocator struct {
 	*flow.TableAllocator
-	fcpool *analyzer.FlowClientPool
+	fcpool   *analyzer.FlowClientPool
+	handlers []flow.ExpireUpdateFunc
+}
+
+func (a *FlowProbeTableAllocator) sendFlows(flows []*flow.Flow) {
+	a.fcpool.SendFlows(flows)
+	for _, handler := range a.handlers {
+		handler(flows)
+	}
 }
 
 // Alloc override the default implementation provide a default update function
 func (a *FlowProbeTableAllocator) Alloc(nodeTID string, opts flow.TableOpts) *flow.Table {
-	return a.TableAllocator.Alloc(a.fcpool.SendFlows, nodeTID, opts)
+	return a.TableAllocator.Alloc(a.sendFlows, nodeTID, opts)
 }
 
-// NewFlowProbeBundle returns a new bundle of flow probes
-func NewFlowProbeBundle(tb *probe.Bundle, g *graph.Graph, fta *flow.TableAllocator, fcpool *analyzer.FlowClientPool) *probe.Bundle {
-	list := []string{"pcapsocket", "ovssflow", "sflow", "gopacket", "dpdk", "ebpf", "ovsmirror"}
+// NewFlowProbeBundle returns a new bundle of flow probes, the flows are sent to
+// the analyzers and passed to the additional handlers
+func NewFlowProbeBundle(tb *probe.Bundle, g *graph.Graph, fta *flow.TableAllocator, fcpool *analyzer.FlowClientPool, handlers ...flow.ExpireUpdateFunc) *probe.Bundle {
+	list := []string{"pcapsocket", "ovssflow", "sflow", "ipfix", "gopacket", "dpdk", "ebpf", "ovsmirror"}
 	logging.GetLogger().Infof("Flow probes: %v", list)
 
 	var captureTypes []string
@@ -73,6 +82,7 @@ func NewFlowProbeBundle(tb *probe.Bundle, g *graph.Graph, fta *flow.TableAllocat
 	fpta := &FlowProbeTableAllocator{
 		TableAllocator: fta,
 		fcpool:         fcpool,
+		handlers:       handlers,
 	}
 
 	fb := probe.NewBundle(make(map[string]probe.Probe))
@@ -98,6 +108,9 @@ func NewFlowProbeBundle(tb *probe.Bundle, g *graph.Graph, fta *flow.TableAllocat
 		case "sflow":
 			fp, err = NewSFlowProbesHandler(g, fpta)
 			captureTypes = []string{"sflow"}
+		case "ipfix":
+			fp, err = NewIPFIXProbesHandler(g, fpta)
+			captureTypes = []string{"ipfix"}
 		case "dpdk":
 			if fp, err = NewDPDKProbesHandler(g, fpta); err == nil {
 				captureTypes = []string{"dpdk"}
@@ -131,11 +144,13 @@ func tableOptsFromCapture(capture *types.Capture) flow.TableOpts {
 	layerKeyMode, _ := flow.LayerKeyModeByName(capture.LayerKeyMode)
 
 	return flow.TableOpts{
-		RawPacketLimit: int64(capture.RawPacketLimit),
-		ExtraTCPMetric: capture.ExtraTCPMetric,
-		IPDefrag:       capture.IPDefrag,
-		ReassembleTCP:  capture.ReassembleTCP,
-		LayerKeyMode:   layerKeyMode,
-		ExtraLayers:    capture.ExtraLayers,
+		RawPacketLimit:   int64(capture.RawPacketLimit),
+		ExtraTCPMetric:   capture.ExtraTCPMetric,
+		IPDefrag:         capture.IPDefrag,
+		ReassembleTCP:    capture.ReassembleTCP,
+		LayerKeyMode:     layerKeyMode,
+		ExtraLayers:      capture.ExtraLayers,
+		SamplingRate:     int64(capture.SamplingRate),
+		AdaptiveSampling: capture.AdaptiveSampling,
 	}
 }
@@ -0,0 +1,113 @@
+/*
+ * Copyright (C) 2018 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package flow
+
+import (
+	"sync/atomic"
+
+	"github.com/skydive-project/skydive/logging"
+)
+
+const (
+	// MaxSamplingRate : maximum sampling rate, 1 packet out of MaxSamplingRate
+	MaxSamplingRate uint32 = 65536
+
+	// number of packets between two checks of the queue in adaptive mode
+	samplerCheckInterval = 1024
+	// queue usage ratios above which the rate is raised and below which it is lowered
+	samplerHighWatermark = 0.5
+	samplerLowWatermark  = 0.1
+)
+
+// Sampler keeps 1 packet out of N. In adaptive mode, N is doubled when the
+// queue of packets waiting to be processed backs up and halved, down to the
+// configured rate, once it drains.
+type Sampler struct {
+	rate     int64
+	minRate  int64
+	adaptive bool
+	count    int64
+}
+
+// Rate returns the current sampling rate
+func (s *Sampler) Rate() int64 {
+	return atomic.LoadInt64(&s.rate)
+}
+
+func (s *Sampler) adapt(queueLen, queueCap int) {
+	if queueCap == 0 {
+		return
+	}
+
+	rate := atomic.LoadInt64(&s.rate)
+	usage := float64(queueLen) / float64(queueCap)
+
+	newRate := rate
+	switch {
+	case usage > samplerHighWatermark && rate < int64(MaxSamplingRate):
+		newRate = rate * 2
+		if newRate > int64(MaxSamplingRate) {
+			newRate = int64(MaxSamplingRate)
+		}
+	case usage < samplerLowWatermark && rate > s.minRate:
+		newRate = rate / 2
+		if newRate < s.minRate {
+			newRate = s.minRate
+		}
+	}
+
+	if newRate != rate && atomic.CompareAndSwapInt64(&s.rate, rate, newRate) {
+		logging.GetLogger().Debugf("Sampling rate changed from %d to %d, queue usage %.2f", rate, newRate, usage)
+	}
+}
+
+// Sample returns whether the packet has to be kept and the sampling rate
+// it has been kept with. queueLen and queueCap are the usage and the capacity
+// of the queue of packets waiting to be processed.
+func (s *Sampler) Sample(queueLen, queueCap int) (int64, bool) {
+	count := atomic.AddInt64(&s.count, 1)
+
+	if s.adaptive && count%samplerCheckInterval == 0 {
+		s.adapt(queueLen, queueCap)
+	}
+
+	rate := atomic.LoadInt64(&s.rate)
+	return rate, count%rate == 0
+}
+
+// NewSampler returns a new sampler keeping 1 packet out of rate, a rate
+// lower than 1 meaning that all the packets are kept
+func NewSampler(rate int64, adaptive bool) *Sampler {
+	if rate < 1 {
+		rate = 1
+	}
+	if rate > int64(MaxSamplingRate) {
+		rate = int64(MaxSamplingRate)
+	}
+
+	return &Sampler{
+		rate:     rate,
+		minRate:  rate,
+		adaptive: adaptive,
+	}
+}
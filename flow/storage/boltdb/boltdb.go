@@ -0,0 +1,692 @@
+/*
+ * Copyright (C) 2018 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package boltdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/golang/protobuf/proto"
+	"github.com/google/gopacket/layers"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/etcd"
+	"github.com/skydive-project/skydive/filters"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/flow/storage"
+	"github.com/skydive-project/skydive/logging"
+)
+
+var (
+	// flows indexed by UUID
+	flowBucket = []byte("Flow")
+	// flow UUIDs indexed by last update time, used for the retention
+	flowLastBucket = []byte("FlowLast")
+	// flow metrics indexed by last time and flow UUID
+	metricBucket = []byte("FlowMetric")
+	// raw packets indexed by timestamp, flow UUID and index
+	rawPacketBucket = []byte("FlowRawPacket")
+
+	buckets = [][]byte{flowBucket, flowLastBucket, metricBucket, rawPacketBucket}
+)
+
+// StorageOptions describes the options of an embedded BoltDB storage backend
+var StorageOptions = []config.StorageOption{
+	{Name: "path", Default: "/var/lib/skydive/flows.db"},
+	{Name: "retention", Default: "168h"},
+	{Name: "cleanup_interval", Default: "1m"},
+	{Name: "compaction_interval", Default: "24h"},
+}
+
+// Storage describes a flow storage backed by an embedded BoltDB database
+type Storage struct {
+	common.RWMutex
+	db                 *bolt.DB
+	path               string
+	retention          time.Duration
+	cleanupInterval    time.Duration
+	compactionInterval time.Duration
+	quit               chan struct{}
+	wg                 sync.WaitGroup
+}
+
+// metricGetter gives access to the fields of a metric, including the time
+// boundaries, for filters evaluation
+type metricGetter struct {
+	*flow.FlowMetric
+}
+
+func (m metricGetter) GetFieldInt64(field string) (int64, error) {
+	switch field {
+	case "Start":
+		return m.Start, nil
+	case "Last":
+		return m.Last, nil
+	}
+	return m.FlowMetric.GetFieldInt64(field)
+}
+
+func (m metricGetter) GetFieldString(field string) (string, error) {
+	return "", common.ErrFieldNotFound
+}
+
+func (m metricGetter) GetField(field string) (interface{}, error) {
+	return m.GetFieldInt64(field)
+}
+
+// rawPacketGetter gives access to the fields of a raw packet for filters evaluation
+type rawPacketGetter struct {
+	*flow.RawPacket
+}
+
+func (r rawPacketGetter) GetFieldInt64(field string) (int64, error) {
+	switch field {
+	case "Timestamp":
+		return r.Timestamp, nil
+	case "Index":
+		return r.Index, nil
+	}
+	return 0, common.ErrFieldNotFound
+}
+
+func (r rawPacketGetter) GetFieldString(field string) (string, error) {
+	return "", common.ErrFieldNotFound
+}
+
+func (r rawPacketGetter) GetField(field string) (interface{}, error) {
+	return r.GetFieldInt64(field)
+}
+
+// timeKey returns a key starting with the given time so that keys are
+// ordered chronologically
+func timeKey(t int64, uuid string, index ...int64) []byte {
+	key := make([]byte, 8, 8+len(uuid)+8*len(index))
+	binary.BigEndian.PutUint64(key, uint64(t))
+	key = append(key, uuid...)
+	for _, i := range index {
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], uint64(i))
+		key = append(key, b[:]...)
+	}
+	return key
+}
+
+func keyTime(key []byte) int64 {
+	return int64(binary.BigEndian.Uint64(key[:8]))
+}
+
+// keyUUID returns the flow UUID of a time key
+func keyUUID(key []byte, indexes int) string {
+	return string(key[8 : len(key)-8*indexes])
+}
+
+func (c *Storage) storeFlow(tx *bolt.Tx, f *flow.Flow) error {
+	fb, lb := tx.Bucket(flowBucket), tx.Bucket(flowLastBucket)
+
+	if data := fb.Get([]byte(f.UUID)); data != nil {
+		prev, err := flow.FromData(data)
+		if err != nil {
+			return err
+		}
+		if err := lb.Delete(timeKey(prev.Last, prev.UUID)); err != nil {
+			return err
+		}
+	}
+
+	// raw packets and metrics are stored separately
+	fl := *f
+	fl.LastRawPackets = nil
+	fl.LastUpdateMetric = nil
+
+	data, err := fl.GetData()
+	if err != nil {
+		return err
+	}
+
+	if err := fb.Put([]byte(f.UUID), data); err != nil {
+		return err
+	}
+	if err := lb.Put(timeKey(f.Last, f.UUID), nil); err != nil {
+		return err
+	}
+
+	if f.LastUpdateMetric != nil {
+		data, err := proto.Marshal(f.LastUpdateMetric)
+		if err != nil {
+			return err
+		}
+
+		key := timeKey(f.LastUpdateMetric.Last, f.UUID, f.LastUpdateMetric.Start)
+		if err := tx.Bucket(metricBucket).Put(key, data); err != nil {
+			return err
+		}
+	}
+
+	if len(f.LastRawPackets) > 0 {
+		linkType, err := f.LinkType()
+		if err != nil {
+			logging.GetLogger().Errorf("Error while storing raw packets of flow %s: %s", f.UUID, err)
+			return nil
+		}
+
+		rb := tx.Bucket(rawPacketBucket)
+		for _, r := range f.LastRawPackets {
+			data, err := proto.Marshal(r)
+			if err != nil {
+				return err
+			}
+
+			// value is prefixed by the link type of the flow
+			value := make([]byte, 2, 2+len(data))
+			binary.BigEndian.PutUint16(value, uint16(linkType))
+			value = append(value, data...)
+
+			if err := rb.Put(timeKey(r.Timestamp, f.UUID, r.Index), value); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// StoreFlows pushes a set of flows in the database
+func (c *Storage) StoreFlows(flows []*flow.Flow) error {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.db.Update(func(tx *bolt.Tx) error {
+		for _, f := range flows {
+			if err := c.storeFlow(tx, f); err != nil {
+				logging.GetLogger().Errorf("Error while storing flow %s: %s", f.UUID, err)
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// flowMatcher evaluates a flow filter against stored flows, keeping the
+// results as metrics and raw packets of a same flow are matched many times
+type flowMatcher struct {
+	bucket  *bolt.Bucket
+	filter  *filters.Filter
+	matches map[string]bool
+}
+
+func (m *flowMatcher) match(uuid string) (bool, error) {
+	if m.filter == nil {
+		return true, nil
+	}
+
+	if matched, found := m.matches[uuid]; found {
+		return matched, nil
+	}
+
+	var matched bool
+	if data := m.bucket.Get([]byte(uuid)); data != nil {
+		f, err := flow.FromData(data)
+		if err != nil {
+			return false, err
+		}
+		matched = m.filter.Eval(f)
+	}
+	m.matches[uuid] = matched
+
+	return matched, nil
+}
+
+func newFlowMatcher(tx *bolt.Tx, filter *filters.Filter) *flowMatcher {
+	return &flowMatcher{
+		bucket:  tx.Bucket(flowBucket),
+		filter:  filter,
+		matches: make(map[string]bool),
+	}
+}
+
+// SearchFlows search flow matching filters in the database
+func (c *Storage) SearchFlows(fsq filters.SearchQuery) (*flow.FlowSet, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	flowset := flow.NewFlowSet()
+	err := c.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(flowBucket).ForEach(func(k, v []byte) error {
+			f, err := flow.FromData(v)
+			if err != nil {
+				return err
+			}
+
+			if fsq.Filter == nil || fsq.Filter.Eval(f) {
+				if flowset.Start == 0 || flowset.Start > f.Start {
+					flowset.Start = f.Start
+				}
+				if flowset.End == 0 || flowset.End < f.Last {
+					flowset.End = f.Last
+				}
+				flowset.Flows = append(flowset.Flows, f)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if fsq.Sort {
+		flowset.Sort(common.SortOrder(fsq.SortOrder), fsq.SortBy)
+	}
+
+	if fsq.Dedup {
+		if err := flowset.Dedup(fsq.DedupBy); err != nil {
+			return nil, err
+		}
+	}
+
+	if fsq.PaginationRange != nil {
+		flowset.Slice(int(fsq.PaginationRange.From), int(fsq.PaginationRange.To))
+	}
+
+	return flowset, nil
+}
+
+func sortMetrics(metrics []common.Metric, sortBy string, order common.SortOrder) {
+	value := func(m common.Metric) int64 {
+		v, _ := metricGetter{m.(*flow.FlowMetric)}.GetFieldInt64(sortBy)
+		return v
+	}
+
+	sort.SliceStable(metrics, func(i, j int) bool {
+		if order == common.SortDescending {
+			return value(metrics[i]) > value(metrics[j])
+		}
+		return value(metrics[i]) < value(metrics[j])
+	})
+}
+
+// SearchMetrics searches flow metrics matching filters in the database
+func (c *Storage) SearchMetrics(fsq filters.SearchQuery, metricFilter *filters.Filter) (map[string][]common.Metric, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	metrics := make(map[string][]common.Metric)
+	err := c.db.View(func(tx *bolt.Tx) error {
+		matcher := newFlowMatcher(tx, fsq.Filter)
+
+		return tx.Bucket(metricBucket).ForEach(func(k, v []byte) error {
+			metric := new(flow.FlowMetric)
+			if err := proto.Unmarshal(v, metric); err != nil {
+				return err
+			}
+
+			if metricFilter != nil && !metricFilter.Eval(metricGetter{metric}) {
+				return nil
+			}
+
+			uuid := keyUUID(k, 1)
+			matched, err := matcher.match(uuid)
+			if err != nil || !matched {
+				return err
+			}
+
+			metrics[uuid] = append(metrics[uuid], metric)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if fsq.Sort {
+		for _, m := range metrics {
+			sortMetrics(m, fsq.SortBy, common.SortOrder(fsq.SortOrder))
+		}
+	}
+
+	return metrics, nil
+}
+
+// SearchRawPackets searches flow raw packets matching filters in the database
+func (c *Storage) SearchRawPackets(fsq filters.SearchQuery, packetFilter *filters.Filter) (map[string]*flow.RawPackets, error) {
+	c.RLock()
+	defer c.RUnlock()
+
+	rawpackets := make(map[string]*flow.RawPackets)
+	err := c.db.View(func(tx *bolt.Tx) error {
+		matcher := newFlowMatcher(tx, fsq.Filter)
+
+		return tx.Bucket(rawPacketBucket).ForEach(func(k, v []byte) error {
+			if len(v) < 2 {
+				return fmt.Errorf("Invalid raw packet record %x", k)
+			}
+
+			r := new(flow.RawPacket)
+			if err := proto.Unmarshal(v[2:], r); err != nil {
+				return err
+			}
+
+			if packetFilter != nil && !packetFilter.Eval(rawPacketGetter{r}) {
+				return nil
+			}
+
+			uuid := keyUUID(k, 1)
+			matched, err := matcher.match(uuid)
+			if err != nil || !matched {
+				return err
+			}
+
+			if fr, ok := rawpackets[uuid]; ok {
+				fr.RawPackets = append(fr.RawPackets, r)
+			} else {
+				rawpackets[uuid] = &flow.RawPackets{
+					LinkType:   layers.LinkType(binary.BigEndian.Uint16(v[:2])),
+					RawPackets: []*flow.RawPacket{r},
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if fsq.Sort {
+		for _, fr := range rawpackets {
+			packets := fr.RawPackets
+			sort.SliceStable(packets, func(i, j int) bool {
+				vi, _ := rawPacketGetter{packets[i]}.GetFieldInt64(fsq.SortBy)
+				vj, _ := rawPacketGetter{packets[j]}.GetFieldInt64(fsq.SortBy)
+				if common.SortOrder(fsq.SortOrder) == common.SortDescending {
+					return vi > vj
+				}
+				return vi < vj
+			})
+		}
+	}
+
+	return rawpackets, nil
+}
+
+// deleteBefore removes the entries of a time indexed bucket older than the given time
+func deleteBefore(b *bolt.Bucket, before int64, onDelete func(k []byte) error) (int, error) {
+	var deleted int
+
+	c := b.Cursor()
+	for k, _ := c.First(); k != nil && keyTime(k) < before; k, _ = c.Next() {
+		if onDelete != nil {
+			if err := onDelete(k); err != nil {
+				return deleted, err
+			}
+		}
+		if err := c.Delete(); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+
+	return deleted, nil
+}
+
+// expire removes flows, metrics and raw packets older than the retention
+func (c *Storage) expire(now time.Time) error {
+	c.RLock()
+	defer c.RUnlock()
+
+	before := common.UnixMillis(now.Add(-c.retention))
+
+	return c.db.Update(func(tx *bolt.Tx) error {
+		fb := tx.Bucket(flowBucket)
+		flows, err := deleteBefore(tx.Bucket(flowLastBucket), before, func(k []byte) error {
+			return fb.Delete([]byte(keyUUID(k, 0)))
+		})
+		if err != nil {
+			return err
+		}
+
+		metrics, err := deleteBefore(tx.Bucket(metricBucket), before, nil)
+		if err != nil {
+			return err
+		}
+
+		rawpackets, err := deleteBefore(tx.Bucket(rawPacketBucket), before, nil)
+		if err != nil {
+			return err
+		}
+
+		if flows+metrics+rawpackets > 0 {
+			logging.GetLogger().Debugf("Flow storage retention: removed %d flows, %d metrics, %d raw packets", flows, metrics, rawpackets)
+		}
+		return nil
+	})
+}
+
+// compactionBatchSize is the number of keys copied by transaction when
+// compacting the database, to bound the memory used by a transaction
+var compactionBatchSize = 10000
+
+// copyBucket copies a bucket into a database in batches of transactions
+func copyBucket(src *bolt.Tx, dst *bolt.DB, name []byte) error {
+	cursor := src.Bucket(name).Cursor()
+	k, v := cursor.First()
+	for {
+		err := dst.Update(func(tx *bolt.Tx) error {
+			b, err := tx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
+			b.FillPercent = 1.0
+
+			for i := 0; k != nil && i < compactionBatchSize; i++ {
+				if err := b.Put(k, v); err != nil {
+					return err
+				}
+				k, v = cursor.Next()
+			}
+			return nil
+		})
+		if err != nil || k == nil {
+			return err
+		}
+	}
+}
+
+// compact rewrites the database in a new file to release the pages freed by
+// the retention, BoltDB never shrinks its file otherwise. The current
+// database is kept if the new one can't replace it.
+func (c *Storage) compact() error {
+	c.Lock()
+	defer c.Unlock()
+
+	tmpPath := c.path + ".compact"
+	os.Remove(tmpPath)
+
+	dst, err := bolt.Open(tmpPath, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return err
+	}
+
+	err = c.db.View(func(src *bolt.Tx) error {
+		for _, name := range buckets {
+			if err := copyBucket(src, dst, name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		// the compacted database stays open while replacing the current one
+		err = os.Rename(tmpPath, c.path)
+	}
+
+	if err != nil {
+		dst.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := c.db.Close(); err != nil {
+		logging.GetLogger().Errorf("Unable to close the flow database replaced by its compacted version: %s", err)
+	}
+	c.db = dst
+
+	return nil
+}
+
+func (c *Storage) run() {
+	defer c.wg.Done()
+
+	// a zero retention keeps data forever, the compaction still being done
+	var cleanupTicker <-chan time.Time
+	if c.retention > 0 {
+		ticker := time.NewTicker(c.cleanupInterval)
+		defer ticker.Stop()
+		cleanupTicker = ticker.C
+	}
+
+	var compactionTicker <-chan time.Time
+	if c.compactionInterval > 0 {
+		ticker := time.NewTicker(c.compactionInterval)
+		defer ticker.Stop()
+		compactionTicker = ticker.C
+	}
+
+	for {
+		select {
+		case <-c.quit:
+			return
+		case now := <-cleanupTicker:
+			if err := c.expire(now); err != nil {
+				logging.GetLogger().Errorf("Flow storage retention error: %s", err)
+			}
+		case <-compactionTicker:
+			if err := c.compact(); err != nil {
+				logging.GetLogger().Errorf("Flow storage compaction error: %s", err)
+			}
+		}
+	}
+}
+
+// Start the retention and compaction jobs
+func (c *Storage) Start() {
+	if c.retention <= 0 && c.compactionInterval <= 0 {
+		return
+	}
+
+	c.wg.Add(1)
+	go c.run()
+}
+
+// Stop the jobs and close the database
+func (c *Storage) Stop() {
+	close(c.quit)
+	c.wg.Wait()
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.db.Close()
+}
+
+func openDB(path string) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range buckets {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// New creates a new flow storage in the BoltDB database located at the given path.
+// Data older than the retention is removed every cleanup interval, a zero
+// retention keeps data forever. A zero compaction interval disables compaction.
+func New(path string, retention, cleanupInterval, compactionInterval time.Duration) (*Storage, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	db, err := openDB(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if cleanupInterval <= 0 {
+		cleanupInterval = time.Minute
+	}
+
+	return &Storage{
+		db:                 db,
+		path:               path,
+		retention:          retention,
+		cleanupInterval:    cleanupInterval,
+		compactionInterval: compactionInterval,
+		quit:               make(chan struct{}),
+	}, nil
+}
+
+// NewFromConfig creates a new flow storage based on the configuration of a backend
+func NewFromConfig(cfg *config.StorageConfig) (*Storage, error) {
+	var durations [3]time.Duration
+	for i, option := range []string{"retention", "cleanup_interval", "compaction_interval"} {
+		d, err := time.ParseDuration(cfg.GetString(option))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s for storage backend '%s': %s", option, cfg.Name, err)
+		}
+		durations[i] = d
+	}
+
+	return New(cfg.GetString("path"), durations[0], durations[1], durations[2])
+}
+
+func init() {
+	storage.RegisterDriver(&storage.Driver{
+		Name: "boltdb",
+		Factory: func(cfg *config.StorageConfig, etcdClient *etcd.Client) (storage.Storage, error) {
+			s, err := NewFromConfig(cfg)
+			if err != nil {
+				return nil, fmt.Errorf("Can't open BoltDB flow database: %v", err)
+			}
+			return s, nil
+		},
+		Options: StorageOptions,
+	})
+}
@@ -0,0 +1,261 @@
+/*
+ * Copyright (C) 2018 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package boltdb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/filters"
+	"github.com/skydive-project/skydive/flow"
+)
+
+func newTestStorage(t *testing.T) (*Storage, func()) {
+	dir, err := ioutil.TempDir("", "skydive-boltdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := New(filepath.Join(dir, "flows.db"), time.Hour, time.Minute, 0)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return s, func() {
+		s.Stop()
+		os.RemoveAll(dir)
+	}
+}
+
+func newTestFlow(uuid, a, b string, start, last int64) *flow.Flow {
+	f := flow.NewFlow()
+	f.UUID = uuid
+	f.LayersPath = "IPv4"
+	f.Network = &flow.FlowLayer{Protocol: flow.FlowProtocol_IPV4, A: a, B: b}
+	f.Start, f.Last = start, last
+	f.Metric = &flow.FlowMetric{ABPackets: 1, ABBytes: 100, Start: start, Last: last}
+	f.LastUpdateMetric = &flow.FlowMetric{ABPackets: 1, ABBytes: 100, Start: start, Last: last}
+	f.LastRawPackets = []*flow.RawPacket{{Timestamp: start, Index: 1, Data: []byte{0x45}}}
+	return f
+}
+
+func TestStoreAndSearch(t *testing.T) {
+	s, cleanup := newTestStorage(t)
+	defer cleanup()
+
+	now := common.UnixMillis(time.Now())
+	flows := []*flow.Flow{
+		newTestFlow("flow-1", "192.168.0.1", "192.168.0.2", now-2000, now-1000),
+		newTestFlow("flow-2", "192.168.0.1", "192.168.0.3", now-2000, now),
+	}
+	if err := s.StoreFlows(flows); err != nil {
+		t.Fatal(err)
+	}
+
+	// second update of the first flow
+	f := newTestFlow("flow-1", "192.168.0.1", "192.168.0.2", now-2000, now)
+	f.LastUpdateMetric.Start = now - 1000
+	f.LastRawPackets[0].Timestamp, f.LastRawPackets[0].Index = now, 2
+	if err := s.StoreFlows([]*flow.Flow{f}); err != nil {
+		t.Fatal(err)
+	}
+
+	fsq := filters.SearchQuery{
+		Filter: filters.NewOrFilter(
+			filters.NewTermStringFilter("Network.B", "192.168.0.2"),
+			filters.NewTermStringFilter("Network.B", "192.168.0.3"),
+		),
+		Sort:   true,
+		SortBy: "Last",
+	}
+
+	flowset, err := s.SearchFlows(fsq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flowset.Flows) != 2 {
+		t.Fatalf("Should return 2 flows, got: %+v", flowset.Flows)
+	}
+
+	fsq.Filter = filters.NewTermStringFilter("Network.B", "192.168.0.2")
+	if flowset, err = s.SearchFlows(fsq); err != nil || len(flowset.Flows) != 1 || flowset.Flows[0].Last != now {
+		t.Fatalf("Should return the last version of flow-1, got: %+v (%v)", flowset.Flows, err)
+	}
+
+	metricFilter := filters.NewFilterIncludedIn(filters.Range{From: now - 1500, To: now}, "")
+	metrics, err := s.SearchMetrics(fsq, metricFilter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metrics) != 1 || len(metrics["flow-1"]) != 1 {
+		t.Fatalf("Should return 1 metric of flow-1, got: %+v", metrics)
+	}
+
+	fsq.SortBy = "Index"
+	rawPackets, err := s.SearchRawPackets(fsq, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rawPackets) != 1 || len(rawPackets["flow-1"].RawPackets) != 2 {
+		t.Fatalf("Should return 2 raw packets of flow-1, got: %+v", rawPackets)
+	}
+	if rawPackets["flow-1"].LinkType != layers.LinkTypeIPv4 || rawPackets["flow-1"].RawPackets[1].Index != 2 {
+		t.Errorf("Wrong raw packets: %+v", rawPackets["flow-1"])
+	}
+}
+
+func TestRetentionAndCompaction(t *testing.T) {
+	s, cleanup := newTestStorage(t)
+	defer cleanup()
+
+	now := time.Now()
+	old := common.UnixMillis(now.Add(-2 * time.Hour))
+	recent := common.UnixMillis(now)
+
+	flows := []*flow.Flow{
+		newTestFlow("old", "192.168.0.1", "192.168.0.2", old, old),
+		newTestFlow("recent", "192.168.0.1", "192.168.0.3", recent, recent),
+		newTestFlow("kept", "192.168.0.1", "192.168.0.4", old, old),
+	}
+	if err := s.StoreFlows(flows); err != nil {
+		t.Fatal(err)
+	}
+
+	// long lived flow updated recently, only its old metric and raw packet expire
+	f := newTestFlow("kept", "192.168.0.1", "192.168.0.4", old, recent)
+	f.LastUpdateMetric.Start = recent
+	f.LastRawPackets[0].Timestamp, f.LastRawPackets[0].Index = recent, 2
+	if err := s.StoreFlows([]*flow.Flow{f}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.expire(now); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	flowset, err := s.SearchFlows(filters.SearchQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flowset.Flows) != 2 {
+		t.Fatalf("Only the recent and kept flows should be kept, got: %+v", flowset.Flows)
+	}
+	for _, f := range flowset.Flows {
+		if f.UUID == "old" {
+			t.Fatalf("The old flow should be removed, got: %+v", flowset.Flows)
+		}
+	}
+
+	metrics, err := s.SearchMetrics(filters.SearchQuery{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found := metrics["old"]; found || len(metrics["recent"]) != 1 {
+		t.Errorf("Only the metrics of the recent flow should be kept, got: %+v", metrics)
+	}
+	if kept := metrics["kept"]; len(kept) != 1 || kept[0].(*flow.FlowMetric).Last != recent {
+		t.Errorf("Only the last metric of the kept flow should be kept, got: %+v", kept)
+	}
+
+	rawPackets, err := s.SearchRawPackets(filters.SearchQuery{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found := rawPackets["old"]; found || rawPackets["recent"] == nil {
+		t.Errorf("Only the raw packets of the recent flow should be kept, got: %+v", rawPackets)
+	}
+	if kept := rawPackets["kept"]; kept == nil || len(kept.RawPackets) != 1 || kept.RawPackets[0].Index != 2 {
+		t.Errorf("Only the last raw packet of the kept flow should be kept, got: %+v", kept)
+	}
+}
+
+func TestCompaction(t *testing.T) {
+	s, cleanup := newTestStorage(t)
+	defer cleanup()
+
+	// copy the buckets in several transactions
+	batchSize := compactionBatchSize
+	compactionBatchSize = 2
+	defer func() { compactionBatchSize = batchSize }()
+
+	now := common.UnixMillis(time.Now())
+	var flows []*flow.Flow
+	for i := 0; i < 5; i++ {
+		flows = append(flows, newTestFlow(fmt.Sprintf("flow%d", i), "192.168.0.1", fmt.Sprintf("192.168.1.%d", i), now, now))
+	}
+	if err := s.StoreFlows(flows); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	flowset, err := s.SearchFlows(filters.SearchQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flowset.Flows) != 5 {
+		t.Fatalf("All the flows should be kept, got: %+v", flowset.Flows)
+	}
+
+	rawPackets, err := s.SearchRawPackets(filters.SearchQuery{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rawPackets) != 5 {
+		t.Fatalf("All the raw packets should be kept, got: %+v", rawPackets)
+	}
+
+	// the current database is kept when the compacted one can't be created
+	if err := os.MkdirAll(filepath.Join(s.path+".compact", "busy"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.compact(); err == nil {
+		t.Fatal("Compaction should fail")
+	}
+
+	if err := s.StoreFlows([]*flow.Flow{newTestFlow("flow5", "192.168.0.1", "192.168.1.5", now, now)}); err != nil {
+		t.Fatal(err)
+	}
+
+	flowset, err = s.SearchFlows(filters.SearchQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flowset.Flows) != 6 {
+		t.Fatalf("The database should still be usable, got: %+v", flowset.Flows)
+	}
+}
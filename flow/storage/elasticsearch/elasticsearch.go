@@ -25,14 +25,17 @@ package elasticsearch
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 
 	"github.com/google/gopacket/layers"
 	"github.com/olivere/elastic"
 
 	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
 	"github.com/skydive-project/skydive/etcd"
 	"github.com/skydive-project/skydive/filters"
 	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/flow/storage"
 	"github.com/skydive-project/skydive/logging"
 	es "github.com/skydive-project/skydive/storage/elasticsearch"
 )
@@ -73,6 +76,15 @@ const flowMapping = `
 				}
 			}
 		},
+		{
+			"notafter": {
+				"match": "*NotAfter",
+				"mapping": {
+					"type": "date",
+					"format": "epoch_millis"
+				}
+			}
+		},
 		{
 			"start": {
 				"match": "*Start",
@@ -381,3 +393,17 @@ func New(backend string, etcdClient *etcd.Client) (*Storage, error) {
 
 	return &Storage{client: client}, nil
 }
+
+func init() {
+	storage.RegisterDriver(&storage.Driver{
+		Name: "elasticsearch",
+		Factory: func(cfg *config.StorageConfig, etcdClient *etcd.Client) (storage.Storage, error) {
+			s, err := New(cfg.Name, etcdClient)
+			if err != nil {
+				return nil, fmt.Errorf("Can't connect to ElasticSearch server: %v", err)
+			}
+			return s, nil
+		},
+		Options: es.StorageOptions,
+	})
+}
@@ -32,8 +32,10 @@ import (
 	"github.com/mitchellh/mapstructure"
 	"github.com/skydive-project/skydive/common"
 	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/etcd"
 	"github.com/skydive-project/skydive/filters"
 	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/flow/storage"
 	"github.com/skydive-project/skydive/logging"
 	orient "github.com/skydive-project/skydive/storage/orientdb"
 )
@@ -99,6 +101,22 @@ func flowTCPMetricToDocument(flow *flow.Flow, tcpMetric *flow.TCPMetric) orient.
 		"BABytes":               tcpMetric.BABytes,
 		"BASawStart":            tcpMetric.BASawStart,
 		"BASawEnd":              tcpMetric.BASawEnd,
+		"ABRetransmissions":     tcpMetric.ABRetransmissions,
+		"BARetransmissions":     tcpMetric.BARetransmissions,
+		"ABDuplicateAcks":       tcpMetric.ABDuplicateAcks,
+		"BADuplicateAcks":       tcpMetric.BADuplicateAcks,
+		"ABZeroWindows":         tcpMetric.ABZeroWindows,
+		"BAZeroWindows":         tcpMetric.BAZeroWindows,
+		"ABWindowScale":         tcpMetric.ABWindowScale,
+		"BAWindowScale":         tcpMetric.BAWindowScale,
+		"ABRTTMin":              tcpMetric.ABRTTMin,
+		"BARTTMin":              tcpMetric.BARTTMin,
+		"ABRTTAvg":              tcpMetric.ABRTTAvg,
+		"BARTTAvg":              tcpMetric.BARTTAvg,
+		"ABRTTMax":              tcpMetric.ABRTTMax,
+		"BARTTMax":              tcpMetric.BARTTMax,
+		"ABRTTSamples":          tcpMetric.ABRTTSamples,
+		"BARTTSamples":          tcpMetric.BARTTSamples,
 	}
 }
 
@@ -121,19 +139,21 @@ func flowToDocument(flow *flow.Flow) orient.Document {
 	ipMetricDoc := flowIPMetricToDocument(flow, flow.IPMetric)
 	var flowDoc orient.Document
 	flowDoc = orient.Document{
-		"@class":             "Flow",
-		"UUID":               flow.UUID,
-		"LayersPath":         flow.LayersPath,
-		"Application":        flow.Application,
-		"Metric":             metricDoc,
-		"Start":              flow.Start,
-		"Last":               flow.Last,
-		"RTT":                flow.RTT,
-		"TrackingID":         flow.TrackingID,
-		"L3TrackingID":       flow.L3TrackingID,
-		"ParentUUID":         flow.ParentUUID,
-		"NodeTID":            flow.NodeTID,
-		"RawPacketsCaptured": flow.RawPacketsCaptured,
+		"@class":                "Flow",
+		"UUID":                  flow.UUID,
+		"LayersPath":            flow.LayersPath,
+		"Application":           flow.Application,
+		"ApplicationConfidence": flow.ApplicationConfidence,
+		"Metric":                metricDoc,
+		"Start":                 flow.Start,
+		"Last":                  flow.Last,
+		"RTT":                   flow.RTT,
+		"TrackingID":            flow.TrackingID,
+		"L3TrackingID":          flow.L3TrackingID,
+		"ParentUUID":            flow.ParentUUID,
+		"NodeTID":               flow.NodeTID,
+		"RawPacketsCaptured":    flow.RawPacketsCaptured,
+		"SamplingRate":          flow.SamplingRate,
 	}
 
 	if tcpMetricDoc != nil {
@@ -522,3 +542,17 @@ func New(backend string) (*Storage, error) {
 		client: client,
 	}, nil
 }
+
+func init() {
+	storage.RegisterDriver(&storage.Driver{
+		Name: "orientdb",
+		Factory: func(cfg *config.StorageConfig, etcdClient *etcd.Client) (storage.Storage, error) {
+			s, err := New(cfg.Name)
+			if err != nil {
+				return nil, fmt.Errorf("Can't connect to OrientDB server: %v", err)
+			}
+			return s, nil
+		},
+		Options: orient.StorageOptions,
+	})
+}
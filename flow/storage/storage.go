@@ -25,14 +25,14 @@ package storage
 import (
 	"errors"
 	"fmt"
+	"sort"
+	"sync"
 
 	"github.com/skydive-project/skydive/common"
 	"github.com/skydive-project/skydive/config"
 	"github.com/skydive-project/skydive/etcd"
 	"github.com/skydive-project/skydive/filters"
 	"github.com/skydive-project/skydive/flow"
-	"github.com/skydive-project/skydive/flow/storage/elasticsearch"
-	"github.com/skydive-project/skydive/flow/storage/orientdb"
 	"github.com/skydive-project/skydive/logging"
 )
 
@@ -51,34 +51,89 @@ type Storage interface {
 	Stop()
 }
 
+// DriverFactory creates a flow storage from the configuration of a backend.
+// A driver may return a nil storage meaning that flows are not persisted.
+type DriverFactory func(cfg *config.StorageConfig, etcdClient *etcd.Client) (Storage, error)
+
+// Driver describes a flow storage driver
+type Driver struct {
+	Name    string
+	Factory DriverFactory
+	Options []config.StorageOption
+}
+
+var (
+	driversLock sync.RWMutex
+	drivers     = make(map[string]*Driver)
+)
+
+// RegisterDriver makes a flow storage driver available by its name. It is
+// meant to be called from the init function of the driver package.
+func RegisterDriver(driver *Driver) {
+	driversLock.Lock()
+	defer driversLock.Unlock()
+
+	if driver.Factory == nil {
+		panic("flow storage: nil factory for driver " + driver.Name)
+	}
+	if _, found := drivers[driver.Name]; found {
+		panic("flow storage: driver registered twice " + driver.Name)
+	}
+	drivers[driver.Name] = driver
+}
+
+// Drivers returns the sorted list of the registered driver names
+func Drivers() []string {
+	driversLock.RLock()
+	defer driversLock.RUnlock()
+
+	var names []string
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
 // NewStorage creates a new flow storage based on the backend
-func NewStorage(backend string, etcdClient *etcd.Client) (s Storage, err error) {
-	driver := config.GetString("storage." + backend + ".driver")
-	switch driver {
-	case "elasticsearch":
-		s, err = elasticsearch.New(backend, etcdClient)
-		if err != nil {
-			err = fmt.Errorf("Can't connect to ElasticSearch server: %v", err)
-			return
-		}
-	case "orientdb":
-		s, err = orientdb.New(backend)
-		if err != nil {
-			err = fmt.Errorf("Can't connect to OrientDB server: %v", err)
-			return
-		}
-	case "memory":
-		return
-	default:
-		err = fmt.Errorf("Flow backend driver '%s' not supported", driver)
-		return
+func NewStorage(backend string, etcdClient *etcd.Client) (Storage, error) {
+	name := config.StorageDriver(backend)
+
+	driversLock.RLock()
+	driver, found := drivers[name]
+	driversLock.RUnlock()
+
+	if !found {
+		return nil, fmt.Errorf("Flow backend driver '%s' not supported", name)
+	}
+
+	cfg, err := config.LoadStorageConfig(backend, driver.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := driver.Factory(cfg, etcdClient)
+	if err != nil {
+		return nil, err
 	}
 
-	logging.GetLogger().Infof("Using %s as storage", backend)
-	return
+	if s != nil {
+		logging.GetLogger().Infof("Using %s as storage", backend)
+	}
+	return s, nil
 }
 
 // NewStorageFromConfig creates a new storage based configuration
 func NewStorageFromConfig(etcdClient *etcd.Client) (s Storage, err error) {
 	return NewStorage(config.GetString("analyzer.flow.backend"), etcdClient)
 }
+
+func init() {
+	RegisterDriver(&Driver{
+		Name: "memory",
+		Factory: func(cfg *config.StorageConfig, etcdClient *etcd.Client) (Storage, error) {
+			return nil, nil
+		},
+	})
+}
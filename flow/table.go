@@ -24,6 +24,7 @@ package flow
 
 import (
 	"net/http"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -76,50 +77,59 @@ type TableOpts struct {
 	ReassembleTCP  bool
 	LayerKeyMode   LayerKeyMode
 	ExtraLayers    ExtraLayers
+	// SamplingRate keeps 1 packet out of SamplingRate, 0 or 1 to keep them all
+	SamplingRate int64
+	// AdaptiveSampling raises the sampling rate when the packets are not
+	// processed fast enough
+	AdaptiveSampling bool
 }
 
 // Table store the flow table and related metrics mechanism
 type Table struct {
-	Opts          TableOpts
-	packetSeqChan chan *PacketSequence
-	flowChan      chan *Flow
-	table         map[string]*Flow
-	flush         chan bool
-	flushDone     chan bool
-	query         chan *TableQuery
-	reply         chan *TableReply
-	state         int64
-	lockState     common.RWMutex
-	wg            sync.WaitGroup
-	quit          chan bool
-	updateHandler *Handler
-	lastUpdate    int64
-	updateVersion int64
-	expireHandler *Handler
-	lastExpire    int64
-	nodeTID       string
-	ipDefragger   *IPDefragger
-	tcpAssembler  *TCPAssembler
-	flowOpts      Opts
-	appPortMap    *ApplicationPortMap
+	Opts             TableOpts
+	packetSeqChan    chan *PacketSequence
+	flowChan         chan *Flow
+	exportedFlowChan chan *Flow
+	table            map[string]*Flow
+	flush            chan bool
+	flushDone        chan bool
+	query            chan *TableQuery
+	reply            chan *TableReply
+	state            int64
+	lockState        common.RWMutex
+	wg               sync.WaitGroup
+	quit             chan bool
+	updateHandler    *Handler
+	lastUpdate       int64
+	updateVersion    int64
+	expireHandler    *Handler
+	lastExpire       int64
+	nodeTID          string
+	ipDefragger      *IPDefragger
+	tcpAssembler     *TCPAssembler
+	flowOpts         Opts
+	appPortMap       *ApplicationPortMap
+	sampler          *Sampler
+	reassembleTCP    bool
 }
 
 // NewTable creates a new flow table
 func NewTable(updateHandler *Handler, expireHandler *Handler, nodeTID string, opts ...TableOpts) *Table {
 	t := &Table{
-		packetSeqChan: make(chan *PacketSequence, 1000),
-		flowChan:      make(chan *Flow, 1000),
-		table:         make(map[string]*Flow),
-		flush:         make(chan bool),
-		flushDone:     make(chan bool),
-		state:         common.StoppedState,
-		quit:          make(chan bool),
-		updateHandler: updateHandler,
-		expireHandler: expireHandler,
-		nodeTID:       nodeTID,
-		ipDefragger:   NewIPDefragger(),
-		tcpAssembler:  NewTCPAssembler(),
-		appPortMap:    NewApplicationPortMapFromConfig(),
+		packetSeqChan:    make(chan *PacketSequence, 1000),
+		flowChan:         make(chan *Flow, 1000),
+		exportedFlowChan: make(chan *Flow, 1000),
+		table:            make(map[string]*Flow),
+		flush:            make(chan bool),
+		flushDone:        make(chan bool),
+		state:            common.StoppedState,
+		quit:             make(chan bool),
+		updateHandler:    updateHandler,
+		expireHandler:    expireHandler,
+		nodeTID:          nodeTID,
+		ipDefragger:      NewIPDefragger(),
+		tcpAssembler:     NewTCPAssembler(),
+		appPortMap:       NewApplicationPortMapFromConfig(),
 	}
 	if len(opts) > 0 {
 		t.Opts = opts[0]
@@ -130,9 +140,20 @@ func NewTable(updateHandler *Handler, expireHandler *Handler, nodeTID string, op
 		IPDefrag:     t.Opts.IPDefrag,
 		LayerKeyMode: t.Opts.LayerKeyMode,
 		AppPortMap:   t.appPortMap,
+		Classifier:   NewApplicationClassifierFromConfig(),
 		ExtraLayers:  t.Opts.ExtraLayers,
 	}
 
+	// HTTP and TLS parsing rely on the TCP reassembly
+	t.reassembleTCP = t.Opts.ReassembleTCP || t.Opts.ExtraLayers&(HTTPLayer|TLSLayer) != 0
+	t.tcpAssembler.tcpMetric = t.Opts.ReassembleTCP
+	t.tcpAssembler.http = t.Opts.ExtraLayers&HTTPLayer != 0
+	t.tcpAssembler.tls = t.Opts.ExtraLayers&TLSLayer != 0
+
+	if t.Opts.SamplingRate > 1 || t.Opts.AdaptiveSampling {
+		t.sampler = NewSampler(t.Opts.SamplingRate, t.Opts.AdaptiveSampling)
+	}
+
 	t.updateVersion = 0
 	return t
 }
@@ -352,15 +373,32 @@ func (ft *Table) Query(query *TableQuery) *TableReply {
 	return nil
 }
 
-func (ft *Table) packetToFlow(packet *Packet, parentUUID string) *Flow {
+// scaleMetric extrapolates the metric update of a sampled packet so that it
+// accounts for all the packets it has been sampled from
+func scaleMetric(m *FlowMetric, prev *FlowMetric, samplingRate int64) {
+	m.ABPackets += (m.ABPackets - prev.ABPackets) * (samplingRate - 1)
+	m.ABBytes += (m.ABBytes - prev.ABBytes) * (samplingRate - 1)
+	m.BAPackets += (m.BAPackets - prev.BAPackets) * (samplingRate - 1)
+	m.BABytes += (m.BABytes - prev.BABytes) * (samplingRate - 1)
+}
+
+func (ft *Table) packetToFlow(packet *Packet, parentUUID string, samplingRate int64) *Flow {
 	key := packet.Key(parentUUID, ft.flowOpts)
 	flow, new := ft.getOrCreateFlow(key)
+
+	prev := &FlowMetric{
+		ABPackets: flow.Metric.ABPackets,
+		ABBytes:   flow.Metric.ABBytes,
+		BAPackets: flow.Metric.BAPackets,
+		BABytes:   flow.Metric.BABytes,
+	}
+
 	if new {
 		uuids := UUIDs{
 			ParentUUID: parentUUID,
 		}
 
-		if ft.Opts.ReassembleTCP {
+		if ft.reassembleTCP {
 			if layer := packet.GoPacket.TransportLayer(); layer != nil && layer.LayerType() == layers.LayerTypeTCP {
 				ft.tcpAssembler.RegisterFlow(flow, packet.GoPacket)
 			}
@@ -368,7 +406,7 @@ func (ft *Table) packetToFlow(packet *Packet, parentUUID string) *Flow {
 
 		flow.initFromPacket(key, packet, ft.nodeTID, uuids, ft.flowOpts)
 	} else {
-		if ft.Opts.ReassembleTCP {
+		if ft.reassembleTCP {
 			if layer := packet.GoPacket.TransportLayer(); layer != nil && layer.LayerType() == layers.LayerTypeTCP {
 				ft.tcpAssembler.Assemble(packet.GoPacket)
 			}
@@ -377,6 +415,11 @@ func (ft *Table) packetToFlow(packet *Packet, parentUUID string) *Flow {
 		flow.Update(packet, ft.flowOpts)
 	}
 
+	if samplingRate > 1 {
+		scaleMetric(flow.Metric, prev, samplingRate)
+		flow.SamplingRate = samplingRate
+	}
+
 	flow.XXX_state.updateVersion = ft.updateVersion + 1
 
 	if ft.Opts.RawPacketLimit != 0 && flow.RawPacketsCaptured < ft.Opts.RawPacketLimit {
@@ -396,7 +439,7 @@ func (ft *Table) processPacketSeq(ps *PacketSequence) {
 	var parentUUID string
 	logging.GetLogger().Debugf("%d Packets received for capture node %s", len(ps.Packets), ft.nodeTID)
 	for _, packet := range ps.Packets {
-		f := ft.packetToFlow(packet, parentUUID)
+		f := ft.packetToFlow(packet, parentUUID, ps.SamplingRate)
 		parentUUID = f.UUID
 	}
 }
@@ -410,6 +453,95 @@ func (ft *Table) processFlow(fl *Flow) {
 	}
 }
 
+func exportedFlowEndpoints(f *Flow) (string, string) {
+	var a, b string
+	if f.Link != nil {
+		a, b = f.Link.A, f.Link.B
+	}
+	if f.Network != nil {
+		a, b = f.Network.A, f.Network.B
+	}
+	if f.Transport != nil {
+		a = a + ":" + strconv.FormatInt(f.Transport.A, 10)
+		b = b + ":" + strconv.FormatInt(f.Transport.B, 10)
+	}
+	return a, b
+}
+
+// exportedFlowKey returns a key identifying both directions of a flow
+// received from a flow exporter.
+func (ft *Table) exportedFlowKey(f *Flow) string {
+	a, b := exportedFlowEndpoints(f)
+	if a > b {
+		a, b = b, a
+	}
+
+	key := f.LayersPath + "|" + a + "|" + b
+	if f.Link != nil && (ft.flowOpts.LayerKeyMode == L2KeyMode || f.Network == nil) {
+		l2a, l2b := f.Link.A, f.Link.B
+		if l2a > l2b {
+			l2a, l2b = l2b, l2a
+		}
+		key += "|" + l2a + "|" + l2b + "|" + strconv.FormatInt(f.Link.ID, 10)
+	}
+	if f.ICMP != nil {
+		key += "|" + f.ICMP.Type.String()
+	}
+
+	return key
+}
+
+// processExportedFlow merges a flow record received from a flow exporter,
+// NetFlow or IPFIX, in the table. Exporters report each direction in a
+// separate record, records matching the reverse direction of an existing
+// flow update its BA metrics.
+func (ft *Table) processExportedFlow(fl *Flow) {
+	key := ft.exportedFlowKey(fl)
+
+	f, found := ft.table[key]
+	if !found {
+		fl.NodeTID = ft.nodeTID
+		if fl.Transport != nil {
+			srcPort, dstPort := int(fl.Transport.A), int(fl.Transport.B)
+			switch fl.Transport.Protocol {
+			case FlowProtocol_TCP:
+				if app, ok := ft.appPortMap.tcpApplication(srcPort, dstPort); ok {
+					fl.Application, fl.ApplicationConfidence = app, PortApplicationConfidence
+				}
+			case FlowProtocol_UDP:
+				if app, ok := ft.appPortMap.udpApplication(srcPort, dstPort); ok {
+					fl.Application, fl.ApplicationConfidence = app, PortApplicationConfidence
+				}
+			}
+		}
+		fl.UpdateUUID(key, ft.flowOpts)
+		fl.XXX_state.updateVersion = ft.updateVersion + 1
+
+		ft.table[key] = fl
+		return
+	}
+
+	fa, _ := exportedFlowEndpoints(f)
+	if a, _ := exportedFlowEndpoints(fl); a == fa {
+		f.Metric.ABPackets += fl.Metric.ABPackets
+		f.Metric.ABBytes += fl.Metric.ABBytes
+		f.Metric.BAPackets += fl.Metric.BAPackets
+		f.Metric.BABytes += fl.Metric.BABytes
+	} else {
+		f.Metric.ABPackets += fl.Metric.BAPackets
+		f.Metric.ABBytes += fl.Metric.BABytes
+		f.Metric.BAPackets += fl.Metric.ABPackets
+		f.Metric.BABytes += fl.Metric.ABBytes
+	}
+
+	if fl.Last > f.Last {
+		f.Last = fl.Last
+		f.Metric.Last = fl.Last
+	}
+
+	f.XXX_state.updateVersion = ft.updateVersion + 1
+}
+
 // State returns the state of the flow table, stopped, running...
 func (ft *Table) State() int64 {
 	return atomic.LoadInt64(&ft.state)
@@ -460,6 +592,8 @@ func (ft *Table) Run() {
 			ft.processPacketSeq(ps)
 		case fl := <-ft.flowChan:
 			ft.processFlow(fl)
+		case fl := <-ft.exportedFlowChan:
+			ft.processExportedFlow(fl)
 		case now := <-ctTicker.C:
 			t := now.Add(-ctDuration)
 			ft.tcpAssembler.FlushOlderThan(t)
@@ -476,9 +610,19 @@ func (ft *Table) IPDefragger() *IPDefragger {
 	return nil
 }
 
-// FeedWithGoPacket feeds the table with a gopacket
+// FeedWithGoPacket feeds the table with a gopacket, the packet is dropped if
+// not selected by the sampler of the table
 func (ft *Table) FeedWithGoPacket(packet gopacket.Packet, bpf *BPF) {
+	var samplingRate int64
+	if ft.sampler != nil {
+		var keep bool
+		if samplingRate, keep = ft.sampler.Sample(len(ft.packetSeqChan), cap(ft.packetSeqChan)); !keep {
+			return
+		}
+	}
+
 	if ps := PacketSeqFromGoPacket(packet, 0, bpf, ft.ipDefragger); len(ps.Packets) > 0 {
+		ps.SamplingRate = samplingRate
 		ft.packetSeqChan <- ps
 	}
 }
@@ -490,6 +634,12 @@ func (ft *Table) FeedWithSFlowSample(sample *layers.SFlowFlowSample, bpf *BPF) {
 	}
 }
 
+// FeedWithExportedFlow feeds the table with a flow record received from a
+// NetFlow or IPFIX exporter
+func (ft *Table) FeedWithExportedFlow(f *Flow) {
+	ft.exportedFlowChan <- f
+}
+
 // Start the flow table
 func (ft *Table) Start() (chan *PacketSequence, chan *Flow) {
 	go ft.Run()
@@ -518,8 +668,14 @@ func (ft *Table) Stop() {
 			ft.processFlow(fl)
 		}
 
+		for len(ft.exportedFlowChan) != 0 {
+			fl := <-ft.exportedFlowChan
+			ft.processExportedFlow(fl)
+		}
+
 		close(ft.packetSeqChan)
 		close(ft.flowChan)
+		close(ft.exportedFlowChan)
 	}
 
 	ft.expireNow()
@@ -23,9 +23,11 @@
 package flow
 
 import (
+	"net"
 	"testing"
 	"time"
 
+	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
 	"github.com/skydive-project/skydive/common"
 	"github.com/skydive-project/skydive/filters"
@@ -207,3 +209,132 @@ func TestUpdate(t *testing.T) {
 		t.Errorf("Should have been notified : %+v", flow2)
 	}
 }
+
+func newExportedFlow(srcIP, dstIP string, srcPort, dstPort, packets, bytes, start, last int64) *Flow {
+	f := NewFlow()
+	f.LayersPath = "IPv4/TCP"
+	f.Application = "TCP"
+	f.Network = &FlowLayer{Protocol: FlowProtocol_IPV4, A: srcIP, B: dstIP}
+	f.Transport = &TransportLayer{Protocol: FlowProtocol_TCP, A: srcPort, B: dstPort}
+	f.Start, f.Last = start, last
+	f.Metric = &FlowMetric{ABPackets: packets, ABBytes: bytes, Start: start, Last: last}
+	return f
+}
+
+func TestExportedFlows(t *testing.T) {
+	table := NewTable(nil, nil, "probe-1", TableOpts{})
+	table.appPortMap.TCP[80] = "HTTP"
+
+	table.processExportedFlow(newExportedFlow("192.168.0.1", "192.168.0.2", 34567, 80, 10, 1000, 1000, 2000))
+	table.processExportedFlow(newExportedFlow("192.168.0.2", "192.168.0.1", 80, 34567, 8, 5000, 1010, 2010))
+	table.processExportedFlow(newExportedFlow("192.168.0.1", "192.168.0.2", 34567, 80, 2, 200, 2100, 3000))
+	table.processExportedFlow(newExportedFlow("192.168.0.1", "192.168.0.3", 34567, 80, 1, 60, 1000, 1000))
+
+	flows := table.getFlows(&filters.SearchQuery{}).Flows
+	if len(flows) != 2 {
+		t.Fatalf("Should return 2 flows got : %+v", flows)
+	}
+
+	searchQuery := &filters.SearchQuery{
+		Filter: filters.NewTermStringFilter("Network.B", "192.168.0.2"),
+	}
+
+	flows = table.getFlows(searchQuery).Flows
+	if len(flows) != 1 {
+		t.Fatalf("Should return 1 flow got : %+v", flows)
+	}
+
+	f := flows[0]
+	if f.UUID == "" || f.NodeTID != "probe-1" {
+		t.Errorf("Flow should be bound to the probe node : %+v", f)
+	}
+
+	if f.Application != "HTTP" {
+		t.Errorf("Application should be resolved from the port map : %s", f.Application)
+	}
+
+	m := f.Metric
+	if m.ABPackets != 12 || m.ABBytes != 1200 || m.BAPackets != 8 || m.BABytes != 5000 {
+		t.Errorf("Both directions should have been merged : %+v", m)
+	}
+
+	if f.Start != 1000 || f.Last != 3000 || m.Last != 3000 {
+		t.Errorf("Wrong flow times : %+v", f)
+	}
+}
+
+func newUDPPacket(t *testing.T, payload []byte) gopacket.Packet {
+	eth := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0x00, 0x0f, 0xaa, 0xfa, 0xaa, 0x00},
+		DstMAC:       net.HardwareAddr{0x00, 0x0f, 0xaa, 0xfa, 0xaa, 0x01},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip := &layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		Protocol: layers.IPProtocolUDP,
+		SrcIP:    net.ParseIP("192.168.0.1"),
+		DstIP:    net.ParseIP("192.168.0.2"),
+	}
+	udp := &layers.UDP{SrcPort: 12345, DstPort: 53}
+	udp.SetNetworkLayerForChecksum(ip)
+
+	buffer := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buffer, opts, eth, ip, udp, gopacket.Payload(payload)); err != nil {
+		t.Fatal(err)
+	}
+
+	p := gopacket.NewPacket(buffer.Bytes(), layers.LinkTypeEthernet, gopacket.Default)
+	p.Metadata().CaptureInfo.Timestamp = time.Now()
+	return p
+}
+
+func TestSampling(t *testing.T) {
+	table := NewTable(nil, nil, "", TableOpts{SamplingRate: 4})
+
+	for i := 0; i != 8; i++ {
+		table.FeedWithGoPacket(newUDPPacket(t, make([]byte, 10)), nil)
+	}
+
+	if len(table.packetSeqChan) != 2 {
+		t.Fatalf("Should have sampled 2 packets out of 8, got %d", len(table.packetSeqChan))
+	}
+
+	for len(table.packetSeqChan) != 0 {
+		table.processPacketSeq(<-table.packetSeqChan)
+	}
+
+	flows := table.getFlows(&filters.SearchQuery{}).Flows
+	if len(flows) != 1 {
+		t.Fatalf("Should return 1 flow got : %+v", flows)
+	}
+
+	f := flows[0]
+	if f.SamplingRate != 4 {
+		t.Errorf("Flow should be marked with the sampling rate : %d", f.SamplingRate)
+	}
+
+	// 14 bytes of ethernet, 20 of IPv4, 8 of UDP and 10 of payload
+	if f.Metric.ABPackets != 8 || f.Metric.ABBytes != 8*52 {
+		t.Errorf("Metric should be scaled by the sampling rate : %+v", f.Metric)
+	}
+}
+
+func TestAdaptiveSampling(t *testing.T) {
+	sampler := NewSampler(1, true)
+
+	for i := 0; i != 3*samplerCheckInterval; i++ {
+		sampler.Sample(900, 1000)
+	}
+	if rate := sampler.Rate(); rate != 8 {
+		t.Errorf("Sampling rate should have been raised to 8, got %d", rate)
+	}
+
+	for i := 0; i != 10*samplerCheckInterval; i++ {
+		sampler.Sample(0, 1000)
+	}
+	if rate := sampler.Rate(); rate != 1 {
+		t.Errorf("Sampling rate should have been lowered to 1, got %d", rate)
+	}
+}
@@ -37,6 +37,9 @@ import (
 type TCPAssembler struct {
 	assembler *tcpassembly.Assembler
 	flows     map[uint64]*Flow
+	tcpMetric bool // report the reassembly metrics in the flow TCPMetric
+	http      bool // parse the HTTP exchanges of the streams
+	tls       bool // parse the TLS handshakes of the streams
 }
 
 // TCPAssemblerStream will handle the actual tcp stream decoding
@@ -53,6 +56,9 @@ type TCPAssemblerStream struct {
 	end          time.Time
 	sawStart     bool
 	sawEnd       bool
+	tcpMetric    bool
+	http         *httpStream
+	tls          *tlsStream
 }
 
 // NewTCPAssembler returns a new TCPAssembler
@@ -101,7 +107,15 @@ func (t *TCPAssembler) New(network, transport gopacket.Flow) tcpassembly.Stream
 		logging.GetLogger().Errorf("TCP Reassembly, unable to find flow: %s, %s", network.String(), transport.String())
 	}
 
-	return &TCPAssemblerStream{flow: f, network: network, transport: transport}
+	stream := &TCPAssemblerStream{flow: f, network: network, transport: transport, tcpMetric: t.tcpMetric}
+	if t.http && f != nil {
+		stream.http = newHTTPStream(f)
+	}
+	if t.tls && f != nil {
+		stream.tls = newTLSStream(f)
+	}
+
+	return stream
 }
 
 // Reassembled is called whenever new packet data is available for reading.
@@ -125,13 +139,27 @@ func (s *TCPAssemblerStream) Reassembled(reassemblies []tcpassembly.Reassembly)
 		}
 		s.sawStart = s.sawStart || reassembly.Start
 		s.sawEnd = s.sawEnd || reassembly.End
+
+		if s.http != nil {
+			if reassembly.Skip != 0 {
+				s.http.skip()
+			}
+			s.http.feed(reassembly.Bytes, reassembly.Seen)
+		}
+
+		if s.tls != nil {
+			if reassembly.Skip != 0 {
+				s.tls.skip()
+			}
+			s.tls.feed(reassembly.Bytes)
+		}
 	}
 }
 
 // ReassemblyComplete is called when the TCP assembler believes a stream has finished.
 func (s *TCPAssemblerStream) ReassemblyComplete() {
 	f := s.flow
-	if f == nil {
+	if f == nil || !s.tcpMetric {
 		return
 	}
 
@@ -0,0 +1,185 @@
+/*
+ * Copyright (C) 2018 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package flow
+
+import (
+	"github.com/google/gopacket/layers"
+)
+
+// maximum number of unacknowledged segments kept per direction for RTT sampling
+const maxTCPRTTSegments = 32
+
+type tcpSegment struct {
+	end       uint32
+	timestamp int64
+}
+
+// tcpDirState holds the sequence tracking of one direction of a TCP flow
+type tcpDirState struct {
+	seqInit    bool
+	nextSeq    uint32
+	ackInit    bool
+	lastAck    uint32
+	lastWindow uint16
+	zeroWindow bool
+	segments   []tcpSegment
+	rttSum     int64
+}
+
+type tcpState struct {
+	ab tcpDirState
+	ba tcpDirState
+}
+
+// tcpDirMetric points to the TCPMetric fields of one direction
+type tcpDirMetric struct {
+	retransmissions *int64
+	duplicateAcks   *int64
+	zeroWindows     *int64
+	windowScale     *int64
+	rttMin          *int64
+	rttAvg          *int64
+	rttMax          *int64
+	rttSamples      *int64
+}
+
+func (tm *TCPMetric) direction(ab bool) tcpDirMetric {
+	if ab {
+		return tcpDirMetric{
+			retransmissions: &tm.ABRetransmissions,
+			duplicateAcks:   &tm.ABDuplicateAcks,
+			zeroWindows:     &tm.ABZeroWindows,
+			windowScale:     &tm.ABWindowScale,
+			rttMin:          &tm.ABRTTMin,
+			rttAvg:          &tm.ABRTTAvg,
+			rttMax:          &tm.ABRTTMax,
+			rttSamples:      &tm.ABRTTSamples,
+		}
+	}
+	return tcpDirMetric{
+		retransmissions: &tm.BARetransmissions,
+		duplicateAcks:   &tm.BADuplicateAcks,
+		zeroWindows:     &tm.BAZeroWindows,
+		windowScale:     &tm.BAWindowScale,
+		rttMin:          &tm.BARTTMin,
+		rttAvg:          &tm.BARTTAvg,
+		rttMax:          &tm.BARTTMax,
+		rttSamples:      &tm.BARTTSamples,
+	}
+}
+
+func (m tcpDirMetric) addRTTSample(state *tcpDirState, rtt int64) {
+	if *m.rttSamples == 0 || rtt < *m.rttMin {
+		*m.rttMin = rtt
+	}
+	if rtt > *m.rttMax {
+		*m.rttMax = rtt
+	}
+	*m.rttSamples++
+	state.rttSum += rtt
+	*m.rttAvg = state.rttSum / *m.rttSamples
+}
+
+// seqAfter returns whether a is after b in the sequence space
+func seqAfter(a, b uint32) bool {
+	return int32(a-b) > 0
+}
+
+// updateTCPPerformanceMetrics updates the retransmission, duplicate ACK,
+// zero window, window scale and RTT metrics with a segment sent from A if
+// ab is true, from B otherwise. The timestamp is in nanoseconds.
+func (f *Flow) updateTCPPerformanceMetrics(tcp *layers.TCP, ab bool, timestamp int64) {
+	state := f.XXX_state.tcp
+	if state == nil {
+		state = &tcpState{}
+		f.XXX_state.tcp = state
+	}
+
+	snd, rcv := &state.ab, &state.ba
+	if !ab {
+		snd, rcv = rcv, snd
+	}
+	sndMetric, rcvMetric := f.TCPMetric.direction(ab), f.TCPMetric.direction(!ab)
+
+	if tcp.SYN {
+		for _, opt := range tcp.Options {
+			if opt.OptionType == layers.TCPOptionKindWindowScale && len(opt.OptionData) == 1 {
+				*sndMetric.windowScale = int64(opt.OptionData[0])
+			}
+		}
+	}
+
+	length := uint32(len(tcp.Payload))
+	if tcp.SYN || tcp.FIN {
+		length++
+	}
+
+	if length > 0 {
+		end := tcp.Seq + length
+		if snd.seqInit && !seqAfter(end, snd.nextSeq) {
+			*sndMetric.retransmissions++
+
+			// Karn's algorithm, do not sample RTT of retransmitted segments
+			for i, segment := range snd.segments {
+				if seqAfter(segment.end, tcp.Seq) {
+					snd.segments = snd.segments[:i]
+					break
+				}
+			}
+		} else {
+			snd.seqInit, snd.nextSeq = true, end
+			if len(snd.segments) < maxTCPRTTSegments {
+				snd.segments = append(snd.segments, tcpSegment{end: end, timestamp: timestamp})
+			}
+		}
+	}
+
+	if tcp.ACK && !tcp.RST {
+		// segments are sorted by end, sample the last one cumulatively acknowledged
+		acked := 0
+		for acked < len(rcv.segments) && !seqAfter(rcv.segments[acked].end, tcp.Ack) {
+			acked++
+		}
+		if acked > 0 {
+			rcvMetric.addRTTSample(rcv, timestamp-rcv.segments[acked-1].timestamp)
+			rcv.segments = rcv.segments[acked:]
+		}
+
+		if length == 0 && snd.ackInit && tcp.Ack == snd.lastAck && tcp.Window == snd.lastWindow &&
+			rcv.seqInit && seqAfter(rcv.nextSeq, tcp.Ack) {
+			*sndMetric.duplicateAcks++
+		}
+		snd.ackInit, snd.lastAck, snd.lastWindow = true, tcp.Ack, tcp.Window
+	}
+
+	if !tcp.RST {
+		if tcp.Window == 0 {
+			if !snd.zeroWindow {
+				*sndMetric.zeroWindows++
+			}
+			snd.zeroWindow = true
+		} else {
+			snd.zeroWindow = false
+		}
+	}
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright (C) 2018 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package flow
+
+import (
+	"testing"
+
+	"github.com/google/gopacket/layers"
+)
+
+func TestTCPPerformanceMetrics(t *testing.T) {
+	f := &Flow{TCPMetric: &TCPMetric{ABWindowScale: -1, BAWindowScale: -1}}
+
+	wscale := func(shift byte) []layers.TCPOption {
+		return []layers.TCPOption{{OptionType: layers.TCPOptionKindWindowScale, OptionLength: 3, OptionData: []byte{shift}}}
+	}
+	payload := make([]byte, 100)
+
+	segments := []struct {
+		ab        bool
+		timestamp int64
+		tcp       *layers.TCP
+	}{
+		{true, 0, &layers.TCP{SYN: true, Seq: 100, Window: 1000, Options: wscale(7)}},
+		{false, 10, &layers.TCP{SYN: true, ACK: true, Seq: 500, Ack: 101, Window: 2000, Options: wscale(8)}},
+		{true, 15, &layers.TCP{ACK: true, Seq: 101, Ack: 501, Window: 1000}},
+		{true, 20, &layers.TCP{ACK: true, Seq: 101, Ack: 501, Window: 1000, BaseLayer: layers.BaseLayer{Payload: payload}}},
+		{true, 30, &layers.TCP{ACK: true, Seq: 201, Ack: 501, Window: 1000, BaseLayer: layers.BaseLayer{Payload: payload}}},
+		{false, 40, &layers.TCP{ACK: true, Seq: 501, Ack: 201, Window: 2000}},
+		// retransmission of the second segment, it must not be used as RTT sample
+		{true, 45, &layers.TCP{ACK: true, Seq: 201, Ack: 501, Window: 1000, BaseLayer: layers.BaseLayer{Payload: payload}}},
+		{false, 50, &layers.TCP{ACK: true, Seq: 501, Ack: 201, Window: 2000}},
+		{false, 60, &layers.TCP{ACK: true, Seq: 501, Ack: 301, Window: 0}},
+		{false, 70, &layers.TCP{ACK: true, Seq: 501, Ack: 301, Window: 0}},
+	}
+
+	for _, s := range segments {
+		f.updateTCPPerformanceMetrics(s.tcp, s.ab, s.timestamp)
+	}
+
+	m := f.TCPMetric
+	if m.ABWindowScale != 7 || m.BAWindowScale != 8 {
+		t.Errorf("Wrong window scales: %d %d", m.ABWindowScale, m.BAWindowScale)
+	}
+	if m.ABRetransmissions != 1 || m.BARetransmissions != 0 {
+		t.Errorf("Wrong retransmissions: %d %d", m.ABRetransmissions, m.BARetransmissions)
+	}
+	if m.ABDuplicateAcks != 0 || m.BADuplicateAcks != 1 {
+		t.Errorf("Wrong duplicate ACKs: %d %d", m.ABDuplicateAcks, m.BADuplicateAcks)
+	}
+	if m.ABZeroWindows != 0 || m.BAZeroWindows != 1 {
+		t.Errorf("Wrong zero windows: %d %d", m.ABZeroWindows, m.BAZeroWindows)
+	}
+	if m.ABRTTSamples != 2 || m.ABRTTMin != 10 || m.ABRTTAvg != 15 || m.ABRTTMax != 20 {
+		t.Errorf("Wrong AB RTT: %+v", m)
+	}
+	if m.BARTTSamples != 1 || m.BARTTMin != 5 || m.BARTTAvg != 5 || m.BARTTMax != 5 {
+		t.Errorf("Wrong BA RTT: %+v", m)
+	}
+}
@@ -0,0 +1,366 @@
+/*
+ * Copyright (C) 2018 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package flow
+
+import (
+	"crypto/md5"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/skydive-project/skydive/common"
+)
+
+const (
+	tlsRecordHeaderLength = 5
+	// maximum amount of handshake data buffered, certificate chains included
+	tlsMaxHandshakeSize = 65536
+
+	tlsRecordAlert     = 21
+	tlsRecordHandshake = 22
+
+	tlsHandshakeClientHello = 1
+	tlsHandshakeServerHello = 2
+	tlsHandshakeCertificate = 11
+
+	tlsExtensionServerName        = 0
+	tlsExtensionSupportedGroups   = 10
+	tlsExtensionECPointFormats    = 11
+	tlsExtensionALPN              = 16
+	tlsExtensionSupportedVersions = 43
+)
+
+// tlsStream parses the handshake messages of one direction of a reassembled
+// TCP stream. The parsing stops at the first encrypted record.
+type tlsStream struct {
+	flow      *Flow
+	buffer    []byte
+	handshake []byte
+	started   bool
+	done      bool
+}
+
+// tlsReader reads the fields of a handshake message, once a read failed
+// all the following ones fail too
+type tlsReader struct {
+	data []byte
+	err  bool
+}
+
+func (r *tlsReader) bytes(n int) []byte {
+	if r.err || n > len(r.data) {
+		r.err = true
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *tlsReader) uint8() int {
+	if b := r.bytes(1); b != nil {
+		return int(b[0])
+	}
+	return 0
+}
+
+func (r *tlsReader) uint16() int {
+	if b := r.bytes(2); b != nil {
+		return int(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (r *tlsReader) uint24() int {
+	if b := r.bytes(3); b != nil {
+		return int(b[0])<<16 | int(b[1])<<8 | int(b[2])
+	}
+	return 0
+}
+
+// vector returns a reader on a vector whose length is encoded on lengthSize bytes
+func (r *tlsReader) vector(lengthSize int) *tlsReader {
+	var length int
+	switch lengthSize {
+	case 1:
+		length = r.uint8()
+	case 2:
+		length = r.uint16()
+	case 3:
+		length = r.uint24()
+	}
+	return &tlsReader{data: r.bytes(length), err: r.err}
+}
+
+func (r *tlsReader) uint16List() (values []int) {
+	for len(r.data) >= 2 && !r.err {
+		values = append(values, r.uint16())
+	}
+	return
+}
+
+// isGREASE returns whether the value is one of the reserved values used by
+// clients to check server tolerance, RFC 8701. They are ignored by JA3.
+func isGREASE(v int) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+func tlsVersionName(v int) string {
+	switch v {
+	case 0x0300:
+		return "SSL 3.0"
+	case 0x0301:
+		return "TLS 1.0"
+	case 0x0302:
+		return "TLS 1.1"
+	case 0x0303:
+		return "TLS 1.2"
+	case 0x0304:
+		return "TLS 1.3"
+	}
+	return fmt.Sprintf("0x%04x", v)
+}
+
+// ja3Join joins the values ignoring the GREASE ones
+func ja3Join(values []int) string {
+	var s []string
+	for _, v := range values {
+		if !isGREASE(v) {
+			s = append(s, strconv.Itoa(v))
+		}
+	}
+	return strings.Join(s, "-")
+}
+
+func ja3Hash(fields ...string) string {
+	sum := md5.Sum([]byte(strings.Join(fields, ",")))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *tlsStream) handshakeInfo() *TLSHandshake {
+	if s.flow.TLS == nil {
+		s.flow.TLS = &TLSHandshake{}
+	}
+	return s.flow.TLS
+}
+
+func (s *tlsStream) onClientHello(r *tlsReader) {
+	version := r.uint16()
+	r.bytes(32) // random
+	r.vector(1) // session id
+	ciphers := r.vector(2).uint16List()
+	r.vector(1) // compression methods
+	extensions := r.vector(2)
+	if r.err {
+		return
+	}
+
+	t := s.handshakeInfo()
+	t.ClientVersion = tlsVersionName(version)
+
+	var extensionTypes, groups, pointFormats []int
+	for len(extensions.data) > 0 && !extensions.err {
+		extType := extensions.uint16()
+		ext := extensions.vector(2)
+		extensionTypes = append(extensionTypes, extType)
+
+		switch extType {
+		case tlsExtensionServerName:
+			names := ext.vector(2)
+			for len(names.data) > 0 && !names.err {
+				nameType := names.uint8()
+				name := names.vector(2)
+				if nameType == 0 && !name.err {
+					t.ServerName = string(name.data)
+				}
+			}
+		case tlsExtensionSupportedGroups:
+			groups = ext.vector(2).uint16List()
+		case tlsExtensionECPointFormats:
+			for _, f := range ext.vector(1).data {
+				pointFormats = append(pointFormats, int(f))
+			}
+		case tlsExtensionALPN:
+			protocols := ext.vector(2)
+			for len(protocols.data) > 0 && !protocols.err {
+				if p := protocols.vector(1); !p.err {
+					t.ALPN = append(t.ALPN, string(p.data))
+				}
+			}
+		case tlsExtensionSupportedVersions:
+			max := 0
+			for _, v := range ext.vector(1).uint16List() {
+				if !isGREASE(v) && v > max {
+					max = v
+				}
+			}
+			if max != 0 {
+				t.ClientVersion = tlsVersionName(max)
+			}
+		}
+	}
+
+	t.JA3 = ja3Hash(strconv.Itoa(version), ja3Join(ciphers), ja3Join(extensionTypes), ja3Join(groups), ja3Join(pointFormats))
+}
+
+func (s *tlsStream) onServerHello(r *tlsReader) {
+	version := r.uint16()
+	r.bytes(32) // random
+	r.vector(1) // session id
+	cipher := r.uint16()
+	r.uint8() // compression method
+	if r.err {
+		return
+	}
+
+	t := s.handshakeInfo()
+	t.Version = tlsVersionName(version)
+	t.CipherSuite = uint32(cipher)
+
+	var extensionTypes []int
+	extensions := r.vector(2)
+	for len(extensions.data) > 0 && !extensions.err {
+		extType := extensions.uint16()
+		ext := extensions.vector(2)
+		extensionTypes = append(extensionTypes, extType)
+
+		switch extType {
+		case tlsExtensionALPN:
+			if p := ext.vector(2).vector(1); !p.err {
+				t.SelectedALPN = string(p.data)
+			}
+		case tlsExtensionSupportedVersions:
+			if v := ext.uint16(); !ext.err {
+				t.Version = tlsVersionName(v)
+			}
+		}
+	}
+
+	t.JA3S = ja3Hash(strconv.Itoa(version), strconv.Itoa(cipher), ja3Join(extensionTypes))
+}
+
+func (s *tlsStream) onCertificate(r *tlsReader) {
+	// only the leaf certificate is reported
+	der := r.vector(3).vector(3)
+	if der.err {
+		return
+	}
+
+	cert, err := x509.ParseCertificate(der.data)
+	if err != nil {
+		return
+	}
+
+	t := s.handshakeInfo()
+	t.CertificateSubject = cert.Subject.CommonName
+	t.CertificateIssuer = cert.Issuer.CommonName
+	t.CertificateNotAfter = common.UnixMillis(cert.NotAfter)
+}
+
+// parseHandshake parses the complete handshake messages buffered
+func (s *tlsStream) parseHandshake() {
+	for len(s.handshake) >= 4 {
+		length := int(s.handshake[1])<<16 | int(s.handshake[2])<<8 | int(s.handshake[3])
+		if len(s.handshake) < 4+length {
+			if 4+length > tlsMaxHandshakeSize {
+				s.done = true
+			}
+			return
+		}
+
+		r := &tlsReader{data: s.handshake[4 : 4+length]}
+		switch s.handshake[0] {
+		case tlsHandshakeClientHello:
+			s.onClientHello(r)
+			s.done = true
+		case tlsHandshakeServerHello:
+			s.onServerHello(r)
+		case tlsHandshakeCertificate:
+			s.onCertificate(r)
+			s.done = true
+		}
+
+		s.handshake = s.handshake[4+length:]
+		if s.done {
+			return
+		}
+	}
+}
+
+// feed parses the records of the stream
+func (s *tlsStream) feed(data []byte) {
+	if s.done {
+		return
+	}
+
+	s.buffer = append(s.buffer, data...)
+	for len(s.buffer) >= tlsRecordHeaderLength && !s.done {
+		contentType := s.buffer[0]
+
+		// stream not starting with a handshake record, not TLS
+		if !s.started && (contentType != tlsRecordHandshake || s.buffer[1] != 3) {
+			s.done = true
+			return
+		}
+		s.started = true
+
+		length := int(binary.BigEndian.Uint16(s.buffer[3:5]))
+		if len(s.buffer) < tlsRecordHeaderLength+length {
+			return
+		}
+		payload := s.buffer[tlsRecordHeaderLength : tlsRecordHeaderLength+length]
+
+		switch contentType {
+		case tlsRecordHandshake:
+			s.handshake = append(s.handshake, payload...)
+			s.parseHandshake()
+		case tlsRecordAlert:
+		default:
+			// change cipher spec, application data or garbage, the
+			// following messages are encrypted
+			s.done = true
+		}
+
+		s.buffer = s.buffer[tlsRecordHeaderLength+length:]
+	}
+
+	if s.done {
+		s.buffer, s.handshake = nil, nil
+	}
+}
+
+// skip is called when bytes of the stream have been lost, the records can't
+// be delimited anymore
+func (s *tlsStream) skip() {
+	if s.started {
+		s.done = true
+		s.buffer, s.handshake = nil, nil
+	}
+}
+
+func newTLSStream(f *Flow) *tlsStream {
+	return &tlsStream{flow: f}
+}
@@ -0,0 +1,154 @@
+/*
+ * Copyright (C) 2018 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package flow
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/skydive-project/skydive/common"
+)
+
+// recordingConn records the bytes written to the connection
+type recordingConn struct {
+	net.Conn
+	sync.Mutex
+	written bytes.Buffer
+}
+
+func (c *recordingConn) Write(b []byte) (int, error) {
+	c.Lock()
+	c.written.Write(b)
+	c.Unlock()
+	return c.Conn.Write(b)
+}
+
+func newTestCertificate(t *testing.T, name string, notAfter time.Time) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestTLSStream(t *testing.T) {
+	notAfter := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	cert := newTestCertificate(t, "www.example.com", notAfter)
+
+	c, s := net.Pipe()
+	clientConn, serverConn := &recordingConn{Conn: c}, &recordingConn{Conn: s}
+
+	client := tls.Client(clientConn, &tls.Config{
+		ServerName:         "www.example.com",
+		NextProtos:         []string{"h2", "http/1.1"},
+		InsecureSkipVerify: true,
+		MaxVersion:         tls.VersionTLS12,
+	})
+	server := tls.Server(serverConn, &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"h2"},
+	})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := server.Handshake(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	if err := client.Handshake(); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+
+	f := NewFlow()
+	clientStream, serverStream := newTLSStream(f), newTLSStream(f)
+
+	// feed the streams byte per byte to check the record reassembly
+	for _, b := range clientConn.written.Bytes() {
+		clientStream.feed([]byte{b})
+	}
+	serverStream.feed(serverConn.written.Bytes())
+
+	h := f.TLS
+	if h == nil {
+		t.Fatal("TLS handshake not parsed")
+	}
+
+	if h.ServerName != "www.example.com" || h.ClientVersion != "TLS 1.2" || h.Version != "TLS 1.2" {
+		t.Errorf("Wrong TLS versions or server name : %+v", h)
+	}
+
+	if h.CipherSuite != uint32(client.ConnectionState().CipherSuite) {
+		t.Errorf("Wrong cipher suite : %+v", h)
+	}
+
+	if len(h.ALPN) != 2 || h.ALPN[0] != "h2" || h.ALPN[1] != "http/1.1" || h.SelectedALPN != "h2" {
+		t.Errorf("Wrong ALPN : %+v", h)
+	}
+
+	if len(h.JA3) != 32 || len(h.JA3S) != 32 {
+		t.Errorf("Wrong JA3 fingerprints : %+v", h)
+	}
+
+	if h.CertificateSubject != "www.example.com" || h.CertificateNotAfter != common.UnixMillis(notAfter) {
+		t.Errorf("Wrong certificate : %+v", h)
+	}
+}
+
+func TestJA3(t *testing.T) {
+	// GREASE values are ignored
+	if s := ja3Join([]int{0x0a0a, 4865, 4866, 0xfafa, 49195}); s != "4865-4866-49195" {
+		t.Errorf("Wrong JA3 list : %s", s)
+	}
+
+	if h := ja3Hash("771", "4865", "0-10", "29", "0"); h != "f3f2335434a688e6551634e27259067a" {
+		t.Errorf("Wrong JA3 hash : %s", h)
+	}
+}
@@ -23,6 +23,7 @@
 package traversal
 
 import (
+	"context"
 	"errors"
 	"math/rand"
 	"strconv"
@@ -44,7 +45,7 @@ type fakeTableClient struct {
 	t *flow.Table
 }
 
-func (tc *fakeTableClient) LookupFlows(flowSearchQuery filters.SearchQuery) (*flow.FlowSet, error) {
+func (tc *fakeTableClient) LookupFlows(ctx context.Context, flowSearchQuery filters.SearchQuery) (*flow.FlowSet, error) {
 	obj, _ := proto.Marshal(&flowSearchQuery)
 	resp := tc.t.Query(&flow.TableQuery{Type: "SearchQuery", Obj: obj})
 
@@ -68,13 +69,13 @@ func (tc *fakeTableClient) LookupFlows(flowSearchQuery filters.SearchQuery) (*fl
 	return fs, nil
 }
 
-func (tc *fakeTableClient) LookupFlowsByNodes(hnmap topology.HostNodeTIDMap, flowSearchQuery filters.SearchQuery) (*flow.FlowSet, error) {
-	return tc.LookupFlows(flowSearchQuery)
+func (tc *fakeTableClient) LookupFlowsByNodes(ctx context.Context, hnmap topology.HostNodeTIDMap, flowSearchQuery filters.SearchQuery) (*flow.FlowSet, error) {
+	return tc.LookupFlows(ctx, flowSearchQuery)
 }
 
 func execTraversalQuery(t *testing.T, tc *fakeTableClient, query string) traversal.GraphTraversalStep {
 	tr := traversal.NewGremlinTraversalParser()
-	tr.AddTraversalExtension(NewFlowTraversalExtension(tc, nil))
+	tr.AddTraversalExtension(NewFlowTraversalExtension(tc, nil, nil))
 
 	ts, err := tr.Parse(strings.NewReader(query))
 	if err != nil {
@@ -38,6 +38,7 @@ import (
 	"github.com/skydive-project/skydive/topology"
 	"github.com/skydive-project/skydive/topology/graph"
 	"github.com/skydive-project/skydive/topology/graph/traversal"
+	"github.com/skydive-project/skydive/topology/probes/conntrack"
 	"github.com/skydive-project/skydive/topology/probes/socketinfo"
 )
 
@@ -53,7 +54,10 @@ type FlowTraversalExtension struct {
 	CaptureNodeToken traversal.Token
 	AggregatesToken  traversal.Token
 	BpfToken         traversal.Token
+	NATPeersToken    traversal.Token
+	NATEntriesToken  traversal.Token
 	TableClient      flow.TableClient
+	NATClient        conntrack.NATClient
 	Storage          storage.Storage
 }
 
@@ -75,6 +79,7 @@ type FlowGremlinTraversalStep struct {
 // FlowTraversalStep a flow step linked to a storage
 type FlowTraversalStep struct {
 	GraphTraversal  *traversal.GraphTraversal
+	TableClient     flow.TableClient
 	Storage         storage.Storage
 	flowset         *flow.FlowSet
 	flowSearchQuery filters.SearchQuery
@@ -395,7 +400,7 @@ func (f *FlowTraversalStep) has(filterOp filters.BoolFilterOp, ctx traversal.Ste
 		return &FlowTraversalStep{error: err}
 	}
 
-	return &FlowTraversalStep{GraphTraversal: f.GraphTraversal, Storage: f.Storage, flowset: f.flowset.Filter(filter)}
+	return &FlowTraversalStep{GraphTraversal: f.GraphTraversal, TableClient: f.TableClient, Storage: f.Storage, flowset: f.flowset.Filter(filter)}
 }
 
 // Has step
@@ -427,7 +432,7 @@ func (f *FlowTraversalStep) Dedup(ctx traversal.StepContext, keys ...interface{}
 		return &FlowTraversalStep{error: err}
 	}
 
-	return &FlowTraversalStep{GraphTraversal: f.GraphTraversal, Storage: f.Storage, flowset: f.flowset}
+	return &FlowTraversalStep{GraphTraversal: f.GraphTraversal, TableClient: f.TableClient, Storage: f.Storage, flowset: f.flowset}
 }
 
 // CaptureNode step
@@ -477,7 +482,7 @@ func (f *FlowTraversalStep) Sort(ctx traversal.StepContext, keys ...interface{})
 	}
 
 	f.flowset.Sort(order, sortBy)
-	return &FlowTraversalStep{GraphTraversal: f.GraphTraversal, Storage: f.Storage, flowset: f.flowset}
+	return &FlowTraversalStep{GraphTraversal: f.GraphTraversal, TableClient: f.TableClient, Storage: f.Storage, flowset: f.flowset}
 }
 
 // Sum aggregates integer values mapped by 'key' cross flows
@@ -511,6 +516,65 @@ func (f *FlowTraversalStep) Sum(ctx traversal.StepContext, keys ...interface{})
 	return traversal.NewGraphTraversalValue(f.GraphTraversal, s)
 }
 
+func (f *FlowTraversalStep) fieldGetters() []traversal.FieldGetter {
+	elements := make([]traversal.FieldGetter, len(f.flowset.Flows))
+	for i, fl := range f.flowset.Flows {
+		elements[i] = fl
+	}
+	return elements
+}
+
+func (f *FlowTraversalStep) newStep(elements []traversal.FieldGetter) traversal.GraphTraversalStep {
+	flowset := flow.NewFlowSet()
+	for _, e := range elements {
+		flowset.Flows = append(flowset.Flows, e.(*flow.Flow))
+	}
+	return &FlowTraversalStep{GraphTraversal: f.GraphTraversal, TableClient: f.TableClient, Storage: f.Storage, flowset: flowset}
+}
+
+// GroupCount returns the number of flows per value of a flow field
+func (f *FlowTraversalStep) GroupCount(ctx traversal.StepContext, keys ...interface{}) *traversal.GraphTraversalValue {
+	if f.error != nil {
+		return traversal.NewGraphTraversalValueFromError(f.error)
+	}
+
+	key, err := traversal.ParseGroupCountParameter(keys...)
+	if err != nil {
+		return traversal.NewGraphTraversalValueFromError(err)
+	}
+
+	return traversal.GroupCount(f.GraphTraversal, f.fieldGetters(), key)
+}
+
+// Group returns the flows, or the result of a sub traversal applied to them,
+// per value of a flow field
+func (f *FlowTraversalStep) Group(ctx traversal.StepContext, s ...interface{}) *traversal.GraphTraversalValue {
+	if f.error != nil {
+		return traversal.NewGraphTraversalValueFromError(f.error)
+	}
+
+	key, st, err := traversal.ParseGroupParameter(s...)
+	if err != nil {
+		return traversal.NewGraphTraversalValueFromError(err)
+	}
+
+	return traversal.Group(f.GraphTraversal, f.fieldGetters(), key, st, f.newStep)
+}
+
+// Project returns for each flow an object with the values of the given fields
+func (f *FlowTraversalStep) Project(ctx traversal.StepContext, keys ...interface{}) *traversal.GraphTraversalValue {
+	if f.error != nil {
+		return traversal.NewGraphTraversalValueFromError(f.error)
+	}
+
+	fields, err := traversal.ParseProjectParameter(keys...)
+	if err != nil {
+		return traversal.NewGraphTraversalValueFromError(err)
+	}
+
+	return traversal.Project(f.GraphTraversal, f.fieldGetters(), fields...)
+}
+
 // PropertyValues returns a flow field value
 func (f *FlowTraversalStep) PropertyValues(ctx traversal.StepContext, keys ...interface{}) *traversal.GraphTraversalValue {
 	if f.error != nil {
@@ -718,7 +782,7 @@ func (f *FlowTraversalStep) Error() error {
 }
 
 // NewFlowTraversalExtension creates a new flow traversal extension for Gremlin parser
-func NewFlowTraversalExtension(client flow.TableClient, storage storage.Storage) *FlowTraversalExtension {
+func NewFlowTraversalExtension(client flow.TableClient, natClient conntrack.NATClient, storage storage.Storage) *FlowTraversalExtension {
 	return &FlowTraversalExtension{
 		FlowToken:        traversalFlowToken,
 		HopsToken:        traversalHopsToken,
@@ -726,7 +790,10 @@ func NewFlowTraversalExtension(client flow.TableClient, storage storage.Storage)
 		CaptureNodeToken: traversalCaptureNodeToken,
 		AggregatesToken:  traversalAggregatesToken,
 		BpfToken:         traversalBpfToken,
+		NATPeersToken:    traversalNATPeersToken,
+		NATEntriesToken:  traversalNATEntriesToken,
 		TableClient:      client,
+		NATClient:        natClient,
 		Storage:          storage,
 	}
 }
@@ -746,6 +813,10 @@ func (e *FlowTraversalExtension) ScanIdent(s string) (traversal.Token, bool) {
 		return e.AggregatesToken, true
 	case "BPF":
 		return e.BpfToken, true
+	case "NATPEERS":
+		return e.NATPeersToken, true
+	case "NATENTRIES":
+		return e.NATEntriesToken, true
 	}
 	return traversal.IDENT, false
 }
@@ -774,6 +845,10 @@ func (e *FlowTraversalExtension) ParseStep(t traversal.Token, p traversal.Gremli
 		return &AggregatesGremlinTraversalStep{GremlinTraversalContext: p}, nil
 	case e.BpfToken:
 		return &BpfGremlinTraversalStep{GremlinTraversalContext: p}, nil
+	case e.NATPeersToken:
+		return &NATPeersGremlinTraversalStep{GremlinTraversalContext: p, NATClient: e.NATClient}, nil
+	case e.NATEntriesToken:
+		return &NATEntriesGremlinTraversalStep{GremlinTraversalContext: p, NATClient: e.NATClient}, nil
 	}
 
 	return nil, nil
@@ -810,7 +885,7 @@ func captureAllowedNodes(nodes []*graph.Node) []*graph.Node {
 	return allowed
 }
 
-func (s *FlowGremlinTraversalStep) addTimeFilter(fsq *filters.SearchQuery, timeContext *common.TimeSlice) {
+func addTimeFilter(fsq *filters.SearchQuery, timeContext *common.TimeSlice) {
 	var timeFilter *filters.Filter
 	tr := filters.Range{
 		// When we query the flows on the agents, we get the flows that have not
@@ -856,7 +931,7 @@ func (s *FlowGremlinTraversalStep) Exec(last traversal.GraphTraversalStep) (trav
 		// not need to get flows from node not supporting capture
 		if nodes = captureAllowedNodes(tv.GetNodes()); len(nodes) == 0 {
 			graphTraversal.RUnlock()
-			return &FlowTraversalStep{GraphTraversal: graphTraversal, Storage: s.Storage, flowset: flowset, flowSearchQuery: flowSearchQuery}, nil
+			return &FlowTraversalStep{GraphTraversal: graphTraversal, TableClient: s.TableClient, Storage: s.Storage, flowset: flowset, flowSearchQuery: flowSearchQuery}, nil
 		}
 		graphTraversal.RUnlock()
 	case *traversal.GraphTraversalShortestPath:
@@ -867,7 +942,7 @@ func (s *FlowGremlinTraversalStep) Exec(last traversal.GraphTraversalStep) (trav
 		// not need to get flows from node not supporting capture
 		if nodes = captureAllowedNodes(tv.GetNodes()); len(nodes) == 0 {
 			graphTraversal.RUnlock()
-			return &FlowTraversalStep{GraphTraversal: graphTraversal, Storage: s.Storage, flowset: flowset, flowSearchQuery: flowSearchQuery}, nil
+			return &FlowTraversalStep{GraphTraversal: graphTraversal, TableClient: s.TableClient, Storage: s.Storage, flowset: flowset, flowSearchQuery: flowSearchQuery}, nil
 		}
 		graphTraversal.RUnlock()
 	default:
@@ -879,7 +954,7 @@ func (s *FlowGremlinTraversalStep) Exec(last traversal.GraphTraversalStep) (trav
 			return nil, storage.ErrNoStorageConfigured
 		}
 
-		s.addTimeFilter(&flowSearchQuery, context.TimeSlice)
+		addTimeFilter(&flowSearchQuery, context.TimeSlice)
 
 		if len(nodes) != 0 {
 			graphTraversal.RLock()
@@ -891,13 +966,13 @@ func (s *FlowGremlinTraversalStep) Exec(last traversal.GraphTraversalStep) (trav
 		// We do nothing as the following step is Metrics
 		// and we'll make a request on metrics instead of flows
 		if s.metricsNextStep {
-			return &FlowTraversalStep{GraphTraversal: graphTraversal, Storage: s.Storage, flowSearchQuery: flowSearchQuery}, nil
+			return &FlowTraversalStep{GraphTraversal: graphTraversal, TableClient: s.TableClient, Storage: s.Storage, flowSearchQuery: flowSearchQuery}, nil
 		}
 
 		// We do nothing as the following step is Metrics
 		// and we'll make a request on rawpackets instead of flows
 		if s.rawpacketsNextStep {
-			return &FlowTraversalStep{GraphTraversal: graphTraversal, Storage: s.Storage, flowSearchQuery: flowSearchQuery}, nil
+			return &FlowTraversalStep{GraphTraversal: graphTraversal, TableClient: s.TableClient, Storage: s.Storage, flowSearchQuery: flowSearchQuery}, nil
 		}
 
 		if flowset, err = s.Storage.SearchFlows(flowSearchQuery); err != nil {
@@ -908,9 +983,9 @@ func (s *FlowGremlinTraversalStep) Exec(last traversal.GraphTraversalStep) (trav
 			graphTraversal.RLock()
 			hnmap := topology.BuildHostNodeTIDMap(nodes)
 			graphTraversal.RUnlock()
-			flowset, err = s.TableClient.LookupFlowsByNodes(hnmap, flowSearchQuery)
+			flowset, err = s.TableClient.LookupFlowsByNodes(graphTraversal.QueryContext(), hnmap, flowSearchQuery)
 		} else {
-			flowset, err = s.TableClient.LookupFlows(flowSearchQuery)
+			flowset, err = s.TableClient.LookupFlows(graphTraversal.QueryContext(), flowSearchQuery)
 		}
 	}
 
@@ -923,7 +998,7 @@ func (s *FlowGremlinTraversalStep) Exec(last traversal.GraphTraversalStep) (trav
 		flowset.Slice(int(r[0]), int(r[1]))
 	}
 
-	return &FlowTraversalStep{GraphTraversal: graphTraversal, Storage: s.Storage, flowset: flowset, flowSearchQuery: flowSearchQuery}, nil
+	return &FlowTraversalStep{GraphTraversal: graphTraversal, TableClient: s.TableClient, Storage: s.Storage, flowset: flowset, flowSearchQuery: flowSearchQuery}, nil
 }
 
 // Reduce flow step
@@ -0,0 +1,305 @@
+/*
+ * Copyright (C) 2018 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package traversal
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/skydive-project/skydive/filters"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/flow/storage"
+	"github.com/skydive-project/skydive/topology/graph"
+	"github.com/skydive-project/skydive/topology/graph/traversal"
+	"github.com/skydive-project/skydive/topology/probes/conntrack"
+)
+
+// NATPeersGremlinTraversalStep describes the NATPeers gremlin traversal step
+type NATPeersGremlinTraversalStep struct {
+	traversal.GremlinTraversalContext
+	NATClient conntrack.NATClient
+}
+
+// Exec NATPeers step
+func (s *NATPeersGremlinTraversalStep) Exec(last traversal.GraphTraversalStep) (traversal.GraphTraversalStep, error) {
+	switch tv := last.(type) {
+	case *FlowTraversalStep:
+		return tv.NATPeers(s.StepContext, s.NATClient, s.Params...), nil
+	}
+	return nil, traversal.ErrExecutionError
+}
+
+// Reduce NATPeers step
+func (s *NATPeersGremlinTraversalStep) Reduce(next traversal.GremlinTraversalStep) (traversal.GremlinTraversalStep, error) {
+	if s.ReduceRange(next) {
+		return s, nil
+	}
+	return next, nil
+}
+
+// Context NATPeers step
+func (s *NATPeersGremlinTraversalStep) Context() *traversal.GremlinTraversalContext {
+	return &s.GremlinTraversalContext
+}
+
+// NATEntriesGremlinTraversalStep describes the NATEntries gremlin traversal step
+type NATEntriesGremlinTraversalStep struct {
+	traversal.GremlinTraversalContext
+	NATClient conntrack.NATClient
+}
+
+// Exec NATEntries step
+func (s *NATEntriesGremlinTraversalStep) Exec(last traversal.GraphTraversalStep) (traversal.GraphTraversalStep, error) {
+	switch tv := last.(type) {
+	case *traversal.GraphTraversalV:
+		return NATEntries(s.StepContext, tv, s.NATClient, s.Params...), nil
+	}
+	return nil, traversal.ErrExecutionError
+}
+
+// Reduce NATEntries step
+func (s *NATEntriesGremlinTraversalStep) Reduce(next traversal.GremlinTraversalStep) (traversal.GremlinTraversalStep, error) {
+	if s.ReduceRange(next) {
+		return s, nil
+	}
+	return next, nil
+}
+
+// Context NATEntries step
+func (s *NATEntriesGremlinTraversalStep) Context() *traversal.GremlinTraversalContext {
+	return &s.GremlinTraversalContext
+}
+
+// NATEntriesTraversalStep describes the NAT entries of host or network
+// namespace nodes
+type NATEntriesTraversalStep struct {
+	GraphTraversal *traversal.GraphTraversal
+	entries        map[string][]*conntrack.NATEntry
+	error          error
+}
+
+// Values returns the NAT entries indexed by node ID
+func (s *NATEntriesTraversalStep) Values() []interface{} {
+	if len(s.entries) == 0 {
+		return []interface{}{}
+	}
+	return []interface{}{s.entries}
+}
+
+// MarshalJSON serialize in JSON
+func (s *NATEntriesTraversalStep) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.Values())
+}
+
+// Error returns traversal error
+func (s *NATEntriesTraversalStep) Error() error {
+	return s.error
+}
+
+// NATEntries returns the NAT entries of the conntrack tables of the host
+// and network namespace nodes, looked up on the agents at the time of the
+// query
+func NATEntries(ctx traversal.StepContext, tv *traversal.GraphTraversalV, natClient conntrack.NATClient, s ...interface{}) *NATEntriesTraversalStep {
+	if tv.Error() != nil {
+		return &NATEntriesTraversalStep{error: tv.Error()}
+	}
+
+	if len(s) != 0 {
+		return &NATEntriesTraversalStep{error: fmt.Errorf("NATEntries requires no parameter")}
+	}
+
+	if natClient == nil {
+		return &NATEntriesTraversalStep{error: fmt.Errorf("NATEntries requires a NAT client")}
+	}
+
+	tv.GraphTraversal.RLock()
+	if tv.GraphTraversal.Graph.GetContext().TimeSlice != nil {
+		tv.GraphTraversal.RUnlock()
+		return &NATEntriesTraversalStep{error: fmt.Errorf("NATEntries is only available on the live topology")}
+	}
+
+	var ids []string
+	nodes := make(map[string][]graph.Identifier)
+	for _, n := range tv.GetNodes() {
+		switch tp, _ := n.GetFieldString("Type"); tp {
+		case "host", "netns":
+			ids = append(ids, string(n.ID))
+			nodes[n.Host()] = append(nodes[n.Host()], n.ID)
+		}
+	}
+	tv.GraphTraversal.RUnlock()
+
+	step := &NATEntriesTraversalStep{GraphTraversal: tv.GraphTraversal, entries: make(map[string][]*conntrack.NATEntry)}
+	if len(nodes) == 0 {
+		return step
+	}
+
+	entries, err := natClient.NATEntries(tv.GraphTraversal.QueryContext(), nodes)
+	if err != nil {
+		return &NATEntriesTraversalStep{error: err}
+	}
+
+	it := ctx.PaginationRange.Iterator()
+	sort.Strings(ids)
+	for _, id := range ids {
+		for _, entry := range entries[id] {
+			if it.Done() {
+				return step
+			} else if it.Next() {
+				step.entries[id] = append(step.entries[id], entry)
+			}
+		}
+	}
+	return step
+}
+
+// flowTuple returns the tuple of a flow, from A to B
+func flowTuple(fl *flow.Flow) conntrack.Tuple {
+	return conntrack.Tuple{
+		SrcAddress: fl.GetNetwork().GetA(),
+		SrcPort:    fl.GetTransport().GetA(),
+		DstAddress: fl.GetNetwork().GetB(),
+		DstPort:    fl.GetTransport().GetB(),
+	}
+}
+
+// tupleFilter returns a filter matching the flows of a tuple in both directions
+func tupleFilter(protocol flow.FlowProtocol, t conntrack.Tuple) *filters.Filter {
+	direction := func(t conntrack.Tuple) *filters.Filter {
+		return filters.NewAndFilter(
+			filters.NewTermStringFilter("Network.A", t.SrcAddress),
+			filters.NewTermInt64Filter("Transport.A", t.SrcPort),
+			filters.NewTermStringFilter("Network.B", t.DstAddress),
+			filters.NewTermInt64Filter("Transport.B", t.DstPort),
+		)
+	}
+
+	return filters.NewAndFilter(
+		filters.NewTermStringFilter("Transport.Protocol", protocol.String()),
+		filters.NewOrFilter(direction(t), direction(t.Reverse())),
+	)
+}
+
+// NATPeers returns the flows at the other side of the address translations
+// of the specified flows, using the NAT entries of the conntrack tables of
+// the agents looked up at the time of the query
+func (f *FlowTraversalStep) NATPeers(ctx traversal.StepContext, natClient conntrack.NATClient, s ...interface{}) *FlowTraversalStep {
+	if f.error != nil {
+		return &FlowTraversalStep{error: f.error}
+	}
+
+	if len(s) != 0 {
+		return &FlowTraversalStep{error: fmt.Errorf("NATPeers requires no parameter")}
+	}
+
+	if natClient == nil {
+		return &FlowTraversalStep{error: fmt.Errorf("NATPeers requires a NAT client")}
+	}
+
+	f.GraphTraversal.RLock()
+	context := f.GraphTraversal.Graph.GetContext()
+	f.GraphTraversal.RUnlock()
+
+	type flowKey struct {
+		protocol flow.FlowProtocol
+		tuple    conntrack.Tuple
+	}
+
+	var keys []flowKey
+	var hashes []string
+	for _, fl := range f.flowset.Flows {
+		transport := fl.GetTransport()
+		if transport == nil || fl.GetNetwork() == nil {
+			continue
+		}
+
+		protocol := transport.GetProtocol()
+		switch protocol {
+		case flow.FlowProtocol_TCP, flow.FlowProtocol_UDP, flow.FlowProtocol_SCTP:
+		default:
+			continue
+		}
+
+		tuple := flowTuple(fl)
+		keys = append(keys, flowKey{protocol: protocol, tuple: tuple})
+		hashes = append(hashes, tuple.Hash(protocol))
+	}
+
+	var entries []*conntrack.NATEntry
+	if len(hashes) > 0 {
+		var err error
+		if entries, err = natClient.LookupNAT(f.GraphTraversal.QueryContext(), hashes); err != nil {
+			return &FlowTraversalStep{error: err}
+		}
+	}
+
+	entriesByHash := make(map[string][]*conntrack.NATEntry)
+	for _, entry := range entries {
+		for _, hash := range entry.Hashes() {
+			entriesByHash[hash] = append(entriesByHash[hash], entry)
+		}
+	}
+
+	var peerFilters []*filters.Filter
+	for _, key := range keys {
+		for _, entry := range entriesByHash[key.tuple.Hash(key.protocol)] {
+			if peer, ok := entry.Peer(key.tuple); ok {
+				peerFilters = append(peerFilters, tupleFilter(key.protocol, peer))
+			}
+		}
+	}
+
+	if len(peerFilters) == 0 {
+		return &FlowTraversalStep{GraphTraversal: f.GraphTraversal, TableClient: f.TableClient, Storage: f.Storage, flowset: flow.NewFlowSet()}
+	}
+
+	fsq := filters.SearchQuery{Filter: filters.NewOrFilter(peerFilters...)}
+	if r := ctx.PaginationRange; r != nil {
+		fsq.PaginationRange = &filters.Range{From: r[0], To: r[1]}
+	}
+
+	var flowset *flow.FlowSet
+	var err error
+
+	if context.TimeSlice != nil {
+		if f.Storage == nil {
+			return &FlowTraversalStep{error: storage.ErrNoStorageConfigured}
+		}
+
+		addTimeFilter(&fsq, context.TimeSlice)
+		flowset, err = f.Storage.SearchFlows(fsq)
+	} else {
+		if f.TableClient == nil {
+			return &FlowTraversalStep{error: fmt.Errorf("NATPeers requires a flow table client")}
+		}
+
+		flowset, err = f.TableClient.LookupFlows(f.GraphTraversal.QueryContext(), fsq)
+	}
+
+	if err != nil {
+		return &FlowTraversalStep{error: err}
+	}
+
+	return &FlowTraversalStep{GraphTraversal: f.GraphTraversal, TableClient: f.TableClient, Storage: f.Storage, flowset: flowset, flowSearchQuery: fsq}
+}
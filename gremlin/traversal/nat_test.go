@@ -0,0 +1,111 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package traversal
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/topology/graph"
+	"github.com/skydive-project/skydive/topology/graph/traversal"
+	"github.com/skydive-project/skydive/topology/probes/conntrack"
+)
+
+type fakeNATClient struct {
+	nodes   map[string][]graph.Identifier
+	entries map[string][]*conntrack.NATEntry
+}
+
+func (c *fakeNATClient) LookupNAT(ctx context.Context, hashes []string) ([]*conntrack.NATEntry, error) {
+	return nil, nil
+}
+
+func (c *fakeNATClient) NATEntries(ctx context.Context, nodes map[string][]graph.Identifier) (map[string][]*conntrack.NATEntry, error) {
+	c.nodes = nodes
+	return c.entries, nil
+}
+
+func TestNATEntriesStep(t *testing.T) {
+	b, _ := graph.NewMemoryBackend()
+	g := graph.NewGraph("host1", b, common.AnalyzerService)
+
+	host := g.NewNode(graph.GenID(), graph.Metadata{"Type": "host"})
+	netns := g.NewNode(graph.GenID(), graph.Metadata{"Type": "netns"})
+	g.NewNode(graph.GenID(), graph.Metadata{"Type": "veth"})
+
+	entry1 := &conntrack.NATEntry{
+		Protocol: "TCP",
+		Original: conntrack.Tuple{SrcAddress: "10.0.0.1", SrcPort: 40000, DstAddress: "172.30.0.1", DstPort: 80},
+		Reply:    conntrack.Tuple{SrcAddress: "192.168.0.2", SrcPort: 8080, DstAddress: "10.0.0.1", DstPort: 40000},
+	}
+	entry2 := &conntrack.NATEntry{
+		Protocol: "UDP",
+		Original: conntrack.Tuple{SrcAddress: "10.0.0.1", SrcPort: 40001, DstAddress: "172.30.0.10", DstPort: 53},
+		Reply:    conntrack.Tuple{SrcAddress: "192.168.0.3", SrcPort: 53, DstAddress: "10.0.0.1", DstPort: 40001},
+	}
+
+	natClient := &fakeNATClient{
+		entries: map[string][]*conntrack.NATEntry{
+			string(netns.ID): {entry1, entry2},
+		},
+	}
+
+	exec := func(query string) traversal.GraphTraversalStep {
+		tr := traversal.NewGremlinTraversalParser()
+		tr.AddTraversalExtension(NewFlowTraversalExtension(nil, natClient, nil))
+
+		ts, err := tr.Parse(strings.NewReader(query))
+		if err != nil {
+			t.Fatalf("%s: %s", query, err)
+		}
+
+		res, err := ts.Exec(g, false)
+		if err != nil {
+			t.Fatalf("%s: %s", query, err)
+		}
+		return res
+	}
+
+	res := exec(`G.V().NATEntries()`)
+
+	if nodes := natClient.nodes["host1"]; len(nodes) != 2 || len(natClient.nodes) != 1 {
+		t.Fatalf("Should only look up the host and netns nodes, looked up: %v", natClient.nodes)
+	} else if (nodes[0] != host.ID || nodes[1] != netns.ID) && (nodes[0] != netns.ID || nodes[1] != host.ID) {
+		t.Fatalf("Should look up the host and netns nodes, looked up: %v", nodes)
+	}
+
+	expected := map[string][]*conntrack.NATEntry{string(netns.ID): {entry1, entry2}}
+	if values := res.Values(); len(values) != 1 || !reflect.DeepEqual(values[0], expected) {
+		t.Fatalf("Should return the NAT entries of the netns node, returned: %v", values)
+	}
+
+	res = exec(`G.V().NATEntries().Limit(1)`)
+
+	expected = map[string][]*conntrack.NATEntry{string(netns.ID): {entry1}}
+	if values := res.Values(); len(values) != 1 || !reflect.DeepEqual(values[0], expected) {
+		t.Fatalf("Should return the first NAT entry, returned: %v", values)
+	}
+}
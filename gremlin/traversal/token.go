@@ -35,4 +35,6 @@ const (
 	traversalMetricsToken     traversal.Token = 1008
 	traversalSocketsToken     traversal.Token = 1009
 	traversalDescendantsToken traversal.Token = 1010
+	traversalNATPeersToken    traversal.Token = 1011
+	traversalNATEntriesToken  traversal.Token = 1012
 )
@@ -31,10 +31,13 @@ import (
 	"github.com/skydive-project/skydive/topology"
 	"github.com/skydive-project/skydive/topology/graph"
 	"github.com/skydive-project/skydive/topology/graph/traversal"
+	"github.com/skydive-project/skydive/topology/probes/ipvs"
+	"github.com/skydive-project/skydive/topology/probes/netfilter"
 	"github.com/skydive-project/skydive/topology/probes/socketinfo"
 )
 
-// InterfaceMetrics returns a Metrics step from interface metric metadata
+// InterfaceMetrics returns a Metrics step from interface, netfilter rule or
+// IPVS real server metric metadata
 func InterfaceMetrics(ctx traversal.StepContext, tv *traversal.GraphTraversalV) *MetricsTraversalStep {
 	if tv.Error() != nil {
 		return NewMetricsTraversalStepFromError(tv.Error())
@@ -65,13 +68,21 @@ nodeloop:
 
 		// NOTE(safchain) mapstructure for now, need to be change once converted from json to
 		// protobuf
-		var lastMetric topology.InterfaceMetric
-		if err := mapstructure.WeakDecode(m, &lastMetric); err != nil {
+		var lastMetric common.Metric
+		switch tp, _ := n.GetFieldString("Type"); tp {
+		case "netfilter-chain", "netfilter-rule":
+			lastMetric = &netfilter.RuleMetric{}
+		case "ipvs-server":
+			lastMetric = &ipvs.ServerMetric{}
+		default:
+			lastMetric = &topology.InterfaceMetric{}
+		}
+		if err := mapstructure.WeakDecode(m, lastMetric); err != nil {
 			return NewMetricsTraversalStepFromError(err)
 		}
 
-		if gslice == nil || (lastMetric.Start > gslice.Start && lastMetric.Last < gslice.Last) && it.Next() {
-			metrics[string(n.ID)] = append(metrics[string(n.ID)], &lastMetric)
+		if gslice == nil || (lastMetric.GetStart() > gslice.Start && lastMetric.GetLast() < gslice.Last) && it.Next() {
+			metrics[string(n.ID)] = append(metrics[string(n.ID)], lastMetric)
 		}
 	}
 
@@ -0,0 +1,207 @@
+/*
+ * Copyright (C) 2018 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package ipfix
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/logging"
+)
+
+const (
+	maxDgramSize = 65535
+)
+
+var (
+	// ErrAgentAlreadyAllocated error agent already allocated for this uuid
+	ErrAgentAlreadyAllocated = errors.New("agent already allocated for this uuid")
+)
+
+// Agent describes a NetFlow/IPFIX collector probe
+type Agent struct {
+	common.RWMutex
+	UUID      string
+	Addr      string
+	Port      int
+	FlowTable *flow.Table
+	Conn      *net.UDPConn
+	decoder   *Decoder
+}
+
+// AgentAllocator describes a NetFlow/IPFIX agent allocator to manage multiple agent probes
+type AgentAllocator struct {
+	common.RWMutex
+	portAllocator *common.PortAllocator
+	agents        []*Agent
+}
+
+// GetTarget returns the current used connection
+func (a *Agent) GetTarget() string {
+	target := []string{a.Addr, strconv.FormatInt(int64(a.Port), 10)}
+	return strings.Join(target, ":")
+}
+
+func (a *Agent) feedFlowTable() {
+	var buf [maxDgramSize]byte
+	for {
+		n, exporter, err := a.Conn.ReadFromUDP(buf[:])
+		if err != nil {
+			return
+		}
+
+		flows, err := a.decoder.Decode(exporter.String(), buf[:n])
+		if err != nil {
+			logging.GetLogger().Errorf("Unable to decode export packet from %s: %s", exporter, err)
+		}
+
+		logging.GetLogger().Debugf("%d flow records received from %s", len(flows), exporter)
+		for _, f := range flows {
+			a.FlowTable.FeedWithExportedFlow(f)
+		}
+	}
+}
+
+func (a *Agent) start() error {
+	a.Lock()
+	addr := net.UDPAddr{
+		Port: a.Port,
+		IP:   net.ParseIP(a.Addr),
+	}
+	conn, err := net.ListenUDP("udp", &addr)
+	if err != nil {
+		logging.GetLogger().Errorf("Unable to listen on port %d: %s", a.Port, err.Error())
+		a.Unlock()
+		return err
+	}
+	a.Conn = conn
+	a.Unlock()
+
+	a.FlowTable.Start()
+	defer a.FlowTable.Stop()
+
+	a.feedFlowTable()
+
+	return nil
+}
+
+// Start the NetFlow/IPFIX probe agent
+func (a *Agent) Start() {
+	go a.start()
+}
+
+// Stop the NetFlow/IPFIX probe agent
+func (a *Agent) Stop() {
+	a.Lock()
+	defer a.Unlock()
+
+	if a.Conn != nil {
+		a.Conn.Close()
+	}
+}
+
+// NewAgent creates a new NetFlow/IPFIX agent which will populate the given flowtable
+func NewAgent(u string, a *common.ServiceAddress, ft *flow.Table) *Agent {
+	return &Agent{
+		UUID:      u,
+		Addr:      a.Addr,
+		Port:      a.Port,
+		FlowTable: ft,
+		decoder:   NewDecoder(),
+	}
+}
+
+func (a *AgentAllocator) release(uuid string) {
+	for i, agent := range a.agents {
+		if uuid == agent.UUID {
+			agent.Stop()
+			a.portAllocator.Release(agent.Port)
+			a.agents = append(a.agents[:i], a.agents[i+1:]...)
+
+			break
+		}
+	}
+}
+
+// Release a NetFlow/IPFIX agent
+func (a *AgentAllocator) Release(uuid string) {
+	a.Lock()
+	defer a.Unlock()
+
+	a.release(uuid)
+}
+
+// ReleaseAll NetFlow/IPFIX agents
+func (a *AgentAllocator) ReleaseAll() {
+	a.Lock()
+	defer a.Unlock()
+
+	for _, agent := range a.agents {
+		a.release(agent.UUID)
+	}
+}
+
+// Alloc allocates a new NetFlow/IPFIX agent
+func (a *AgentAllocator) Alloc(uuid string, ft *flow.Table, addr *common.ServiceAddress) (agent *Agent, _ error) {
+	a.Lock()
+	defer a.Unlock()
+
+	// check if there is an already allocated agent for this uuid
+	for _, agent := range a.agents {
+		if uuid == agent.UUID {
+			return agent, ErrAgentAlreadyAllocated
+		}
+	}
+
+	// get port, if port is not given by user.
+	var err error
+	if addr.Port <= 0 {
+		if addr.Port, err = a.portAllocator.Allocate(); addr.Port <= 0 {
+			return nil, errors.New("failed to allocate ipfix port: " + err.Error())
+		}
+	}
+	s := NewAgent(uuid, addr, ft)
+
+	a.agents = append(a.agents, s)
+
+	s.Start()
+	return s, nil
+}
+
+// NewAgentAllocator creates a new NetFlow/IPFIX agent allocator
+func NewAgentAllocator() (*AgentAllocator, error) {
+	min := config.GetInt("ipfix.port_min")
+	max := config.GetInt("ipfix.port_max")
+
+	portAllocator, err := common.NewPortAllocator(min, max)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AgentAllocator{portAllocator: portAllocator}, nil
+}
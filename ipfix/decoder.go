@@ -0,0 +1,673 @@
+/*
+ * Copyright (C) 2018 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package ipfix
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/skydive-project/skydive/flow"
+)
+
+// Export protocol versions
+const (
+	NetFlow5Version = 5
+	NetFlow9Version = 9
+	IPFIXVersion    = 10
+)
+
+const (
+	netflow5HeaderSize = 24
+	netflow5RecordSize = 48
+	netflow9HeaderSize = 20
+	ipfixHeaderSize    = 16
+	setHeaderSize      = 4
+
+	netflow9TemplateSetID        = 0
+	netflow9OptionsTemplateSetID = 1
+	ipfixTemplateSetID           = 2
+	ipfixOptionsTemplateSetID    = 3
+	minDataSetID                 = 256
+
+	variableLength = 65535
+
+	// reverseEnterpriseNumber is used by IPFIX biflows, RFC 5103
+	reverseEnterpriseNumber = 29305
+
+	// totalsExpire is the delay, in milliseconds, after which the last
+	// total counters of a flow that was not reported anymore are forgotten
+	totalsExpire = 10 * 60 * 1000
+)
+
+// Information elements used to build flows, identifiers are shared by
+// NetFlow v9 and IPFIX.
+const (
+	ieOctetDeltaCount          = 1
+	iePacketDeltaCount         = 2
+	ieProtocolIdentifier       = 4
+	ieSourceTransportPort      = 7
+	ieSourceIPv4Address        = 8
+	ieDestinationTransportPort = 11
+	ieDestinationIPv4Address   = 12
+	ieFlowEndSysUpTime         = 21
+	ieFlowStartSysUpTime       = 22
+	ieSourceIPv6Address        = 27
+	ieDestinationIPv6Address   = 28
+	ieICMPTypeCodeIPv4         = 32
+	ieSourceMacAddress         = 56
+	ieVlanID                   = 58
+	ieDestinationMacAddress    = 80
+	ieOctetTotalCount          = 85
+	iePacketTotalCount         = 86
+	ieICMPTypeCodeIPv6         = 139
+	ieFlowStartSeconds         = 150
+	ieFlowEndSeconds           = 151
+	ieFlowStartMilliseconds    = 152
+	ieFlowEndMilliseconds      = 153
+	ieSystemInitTimeMillis     = 160
+	ieICMPTypeIPv4             = 176
+	ieICMPCodeIPv4             = 177
+	ieICMPTypeIPv6             = 178
+	ieICMPCodeIPv6             = 179
+	ieDot1qVlanID              = 243
+)
+
+var (
+	// ErrInvalidVersion is returned when the export packet version is not supported
+	ErrInvalidVersion = errors.New("unsupported export protocol version")
+	// ErrTruncated is returned when the export packet is shorter than announced
+	ErrTruncated = errors.New("truncated export packet")
+)
+
+type fieldSpec struct {
+	id         uint16
+	length     uint16
+	enterprise uint32
+}
+
+type template struct {
+	fields []fieldSpec
+}
+
+// minLength returns the minimal length of a record described by the template
+func (t *template) minLength() int {
+	var length int
+	for _, field := range t.fields {
+		if field.length == variableLength {
+			length++
+		} else {
+			length += int(field.length)
+		}
+	}
+	return length
+}
+
+// templates are scoped by exporter, observation domain (source ID for NetFlow v9)
+// and protocol version as RFC 7011 section 8 mandates.
+type templateKey struct {
+	exporter string
+	version  uint16
+	domain   uint32
+	id       uint16
+}
+
+// record holds the values of a data record needed to build a flow
+type record struct {
+	srcMAC, dstMAC     net.HardwareAddr
+	vlan               uint16
+	srcIP, dstIP       net.IP
+	protocol           uint8
+	srcPort, dstPort   uint16
+	icmpType, icmpCode uint8
+	packets, bytes     uint64
+	totalPackets       uint64
+	totalBytes         uint64
+	revPackets         uint64
+	revBytes           uint64
+	revTotalPackets    uint64
+	revTotalBytes      uint64
+	start, last        int64
+	startUpTime        int64
+	lastUpTime         int64
+	hasUpTime          bool
+	sysInitTime        int64
+}
+
+// totalsKey identifies the flow of a record reporting total counters
+type totalsKey struct {
+	exporter           string
+	version            uint16
+	domain             uint32
+	srcIP, dstIP       string
+	protocol           uint8
+	srcPort, dstPort   uint16
+	icmpType, icmpCode uint8
+	vlan               uint16
+}
+
+// totals holds the last total counters reported for a flow
+type totals struct {
+	packets, bytes       uint64
+	revPackets, revBytes uint64
+	seen                 int64
+}
+
+// Decoder decodes NetFlow v5, NetFlow v9 and IPFIX export packets into flows.
+// Templates received from exporters are kept so that data records of following
+// packets can be decoded. The last total counters of the flows are kept as
+// well so that flows only get the packets and bytes counted since their
+// previous record.
+type Decoder struct {
+	templates  map[templateKey]*template
+	totals     map[totalsKey]*totals
+	lastExpire int64
+}
+
+func uintValue(b []byte) uint64 {
+	var value uint64
+	for _, c := range b {
+		value = value<<8 | uint64(c)
+	}
+	return value
+}
+
+func (r *record) setField(field fieldSpec, value []byte) {
+	if field.enterprise == reverseEnterpriseNumber {
+		switch field.id {
+		case ieOctetDeltaCount:
+			r.revBytes = uintValue(value)
+		case iePacketDeltaCount:
+			r.revPackets = uintValue(value)
+		case ieOctetTotalCount:
+			r.revTotalBytes = uintValue(value)
+		case iePacketTotalCount:
+			r.revTotalPackets = uintValue(value)
+		}
+		return
+	}
+
+	if field.enterprise != 0 {
+		return
+	}
+
+	switch field.id {
+	case ieOctetDeltaCount:
+		r.bytes = uintValue(value)
+	case iePacketDeltaCount:
+		r.packets = uintValue(value)
+	case ieOctetTotalCount:
+		r.totalBytes = uintValue(value)
+	case iePacketTotalCount:
+		r.totalPackets = uintValue(value)
+	case ieProtocolIdentifier:
+		r.protocol = uint8(uintValue(value))
+	case ieSourceTransportPort:
+		r.srcPort = uint16(uintValue(value))
+	case ieDestinationTransportPort:
+		r.dstPort = uint16(uintValue(value))
+	case ieSourceIPv4Address, ieSourceIPv6Address:
+		if len(value) == net.IPv4len || len(value) == net.IPv6len {
+			r.srcIP = net.IP(append([]byte{}, value...))
+		}
+	case ieDestinationIPv4Address, ieDestinationIPv6Address:
+		if len(value) == net.IPv4len || len(value) == net.IPv6len {
+			r.dstIP = net.IP(append([]byte{}, value...))
+		}
+	case ieSourceMacAddress:
+		if len(value) == 6 {
+			r.srcMAC = net.HardwareAddr(append([]byte{}, value...))
+		}
+	case ieDestinationMacAddress:
+		if len(value) == 6 {
+			r.dstMAC = net.HardwareAddr(append([]byte{}, value...))
+		}
+	case ieVlanID, ieDot1qVlanID:
+		r.vlan = uint16(uintValue(value)) & 0x0fff
+	case ieICMPTypeCodeIPv4, ieICMPTypeCodeIPv6:
+		typeCode := uint16(uintValue(value))
+		r.icmpType, r.icmpCode = uint8(typeCode>>8), uint8(typeCode)
+	case ieICMPTypeIPv4, ieICMPTypeIPv6:
+		r.icmpType = uint8(uintValue(value))
+	case ieICMPCodeIPv4, ieICMPCodeIPv6:
+		r.icmpCode = uint8(uintValue(value))
+	case ieFlowStartSysUpTime:
+		r.startUpTime, r.hasUpTime = int64(uintValue(value)), true
+	case ieFlowEndSysUpTime:
+		r.lastUpTime, r.hasUpTime = int64(uintValue(value)), true
+	case ieSystemInitTimeMillis:
+		r.sysInitTime = int64(uintValue(value))
+	case ieFlowStartSeconds:
+		r.start = int64(uintValue(value)) * 1000
+	case ieFlowEndSeconds:
+		r.last = int64(uintValue(value)) * 1000
+	case ieFlowStartMilliseconds:
+		r.start = int64(uintValue(value))
+	case ieFlowEndMilliseconds:
+		r.last = int64(uintValue(value))
+	}
+}
+
+// resolveTimes computes absolute timestamps, in milliseconds, using the
+// boot time of the exporter when times are relative to its system uptime.
+func (r *record) resolveTimes(bootTime, exportTime int64) {
+	if r.hasUpTime && r.start == 0 {
+		if r.sysInitTime != 0 {
+			bootTime = r.sysInitTime
+		}
+		if bootTime != 0 {
+			r.start = bootTime + r.startUpTime
+			r.last = bootTime + r.lastUpTime
+		}
+	}
+
+	if r.start == 0 {
+		r.start = exportTime
+	}
+	if r.last < r.start {
+		r.last = r.start
+	}
+}
+
+// flow returns a unidirectional flow, or a bidirectional one for IPFIX biflows,
+// filled with the record values.
+func (r *record) flow() *flow.Flow {
+	f := flow.NewFlow()
+
+	var path []string
+	if r.srcMAC != nil && r.dstMAC != nil {
+		f.Link = &flow.FlowLayer{
+			Protocol: flow.FlowProtocol_ETHERNET,
+			A:        r.srcMAC.String(),
+			B:        r.dstMAC.String(),
+			ID:       int64(r.vlan),
+		}
+		path = append(path, "Ethernet")
+		if r.vlan != 0 {
+			path = append(path, "Dot1Q")
+		}
+	}
+
+	if r.srcIP != nil && r.dstIP != nil {
+		if r.srcIP.To4() != nil && len(r.srcIP) == net.IPv4len {
+			f.Network = &flow.FlowLayer{Protocol: flow.FlowProtocol_IPV4}
+			path = append(path, "IPv4")
+		} else {
+			f.Network = &flow.FlowLayer{Protocol: flow.FlowProtocol_IPV6}
+			path = append(path, "IPv6")
+		}
+		f.Network.A, f.Network.B = r.srcIP.String(), r.dstIP.String()
+
+		switch r.protocol {
+		case 1:
+			f.ICMP = &flow.ICMPLayer{
+				Type: flow.ICMPv4TypeToFlowICMPType(r.icmpType),
+				Code: uint32(r.icmpCode),
+			}
+			path = append(path, "ICMPv4")
+		case 6:
+			f.Transport = &flow.TransportLayer{Protocol: flow.FlowProtocol_TCP}
+			path = append(path, "TCP")
+		case 17:
+			f.Transport = &flow.TransportLayer{Protocol: flow.FlowProtocol_UDP}
+			path = append(path, "UDP")
+		case 58:
+			f.ICMP = &flow.ICMPLayer{
+				Type: flow.ICMPv6TypeToFlowICMPType(r.icmpType),
+				Code: uint32(r.icmpCode),
+			}
+			path = append(path, "ICMPv6")
+		case 132:
+			f.Transport = &flow.TransportLayer{Protocol: flow.FlowProtocol_SCTP}
+			path = append(path, "SCTP")
+		}
+
+		if f.Transport != nil {
+			f.Transport.A, f.Transport.B = int64(r.srcPort), int64(r.dstPort)
+		}
+	}
+
+	if len(path) > 0 {
+		f.LayersPath = strings.Join(path, "/")
+		f.Application = path[len(path)-1]
+	}
+
+	f.Start, f.Last = r.start, r.last
+	f.Metric = &flow.FlowMetric{
+		ABPackets: int64(r.packets),
+		ABBytes:   int64(r.bytes),
+		BAPackets: int64(r.revPackets),
+		BABytes:   int64(r.revBytes),
+		Start:     r.start,
+		Last:      r.last,
+	}
+
+	return f
+}
+
+func counterDelta(prev, total uint64) uint64 {
+	// a lower total means that the counters of the exporter were reset
+	if total < prev {
+		return total
+	}
+	return total - prev
+}
+
+// totalsToDeltas converts the total counters of a record, reported by
+// exporters that don't send delta counters, into the packets and bytes
+// counted since the previous record of the same flow. The flow table
+// adds the counters of the successive records of a flow.
+func (d *Decoder) totalsToDeltas(key templateKey, r *record, exportTime int64) {
+	useTotals := r.packets == 0 && r.bytes == 0 && (r.totalPackets != 0 || r.totalBytes != 0)
+	useRevTotals := r.revPackets == 0 && r.revBytes == 0 && (r.revTotalPackets != 0 || r.revTotalBytes != 0)
+	if !useTotals && !useRevTotals {
+		return
+	}
+
+	tk := totalsKey{
+		exporter: key.exporter,
+		version:  key.version,
+		domain:   key.domain,
+		srcIP:    r.srcIP.String(),
+		dstIP:    r.dstIP.String(),
+		protocol: r.protocol,
+		srcPort:  r.srcPort,
+		dstPort:  r.dstPort,
+		icmpType: r.icmpType,
+		icmpCode: r.icmpCode,
+		vlan:     r.vlan,
+	}
+
+	prev, ok := d.totals[tk]
+	if !ok {
+		prev = &totals{}
+		d.totals[tk] = prev
+	}
+	prev.seen = exportTime
+
+	if useTotals {
+		r.packets = counterDelta(prev.packets, r.totalPackets)
+		r.bytes = counterDelta(prev.bytes, r.totalBytes)
+		prev.packets, prev.bytes = r.totalPackets, r.totalBytes
+	}
+
+	if useRevTotals {
+		r.revPackets = counterDelta(prev.revPackets, r.revTotalPackets)
+		r.revBytes = counterDelta(prev.revBytes, r.revTotalBytes)
+		prev.revPackets, prev.revBytes = r.revTotalPackets, r.revTotalBytes
+	}
+}
+
+// expireTotals forgets the total counters of the flows not reported since
+// totalsExpire
+func (d *Decoder) expireTotals(now int64) {
+	if now-d.lastExpire < totalsExpire {
+		return
+	}
+	d.lastExpire = now
+
+	for key, t := range d.totals {
+		if now-t.seen > totalsExpire {
+			delete(d.totals, key)
+		}
+	}
+}
+
+func (d *Decoder) decodeNetFlow5(data []byte) ([]*flow.Flow, error) {
+	if len(data) < netflow5HeaderSize {
+		return nil, ErrTruncated
+	}
+
+	count := int(binary.BigEndian.Uint16(data[2:4]))
+	if len(data) < netflow5HeaderSize+count*netflow5RecordSize {
+		return nil, ErrTruncated
+	}
+
+	sysUpTime := int64(binary.BigEndian.Uint32(data[4:8]))
+	exportTime := int64(binary.BigEndian.Uint32(data[8:12]))*1000 + int64(binary.BigEndian.Uint32(data[12:16]))/1000000
+	bootTime := exportTime - sysUpTime
+
+	flows := make([]*flow.Flow, 0, count)
+	for i := 0; i < count; i++ {
+		b := data[netflow5HeaderSize+i*netflow5RecordSize:]
+
+		r := &record{
+			srcIP:       net.IP(append([]byte{}, b[0:4]...)),
+			dstIP:       net.IP(append([]byte{}, b[4:8]...)),
+			packets:     uint64(binary.BigEndian.Uint32(b[16:20])),
+			bytes:       uint64(binary.BigEndian.Uint32(b[20:24])),
+			startUpTime: int64(binary.BigEndian.Uint32(b[24:28])),
+			lastUpTime:  int64(binary.BigEndian.Uint32(b[28:32])),
+			hasUpTime:   true,
+			srcPort:     binary.BigEndian.Uint16(b[32:34]),
+			dstPort:     binary.BigEndian.Uint16(b[34:36]),
+			protocol:    b[38],
+		}
+
+		// NetFlow v5 reports ICMP type and code in the destination port
+		if r.protocol == 1 {
+			r.icmpType, r.icmpCode = uint8(r.dstPort>>8), uint8(r.dstPort)
+		}
+
+		r.resolveTimes(bootTime, exportTime)
+		flows = append(flows, r.flow())
+	}
+
+	return flows, nil
+}
+
+// decodeTemplateSet parses a template set and registers its templates
+func (d *Decoder) decodeTemplateSet(key templateKey, data []byte, enterprise bool) error {
+	for len(data) >= 4 {
+		key.id = binary.BigEndian.Uint16(data[0:2])
+		count := int(binary.BigEndian.Uint16(data[2:4]))
+		data = data[4:]
+
+		// template withdrawal
+		if count == 0 {
+			delete(d.templates, key)
+			continue
+		}
+
+		t := &template{fields: make([]fieldSpec, 0, count)}
+		for i := 0; i < count; i++ {
+			if len(data) < 4 {
+				return ErrTruncated
+			}
+
+			field := fieldSpec{
+				id:     binary.BigEndian.Uint16(data[0:2]),
+				length: binary.BigEndian.Uint16(data[2:4]),
+			}
+			data = data[4:]
+
+			if enterprise && field.id&0x8000 != 0 {
+				if len(data) < 4 {
+					return ErrTruncated
+				}
+				field.id &= 0x7fff
+				field.enterprise = binary.BigEndian.Uint32(data[0:4])
+				data = data[4:]
+			}
+
+			t.fields = append(t.fields, field)
+		}
+
+		d.templates[key] = t
+	}
+
+	return nil
+}
+
+// decodeDataSet decodes the records of a data set using a previously received template
+func (d *Decoder) decodeDataSet(key templateKey, t *template, data []byte, bootTime, exportTime int64) ([]*flow.Flow, error) {
+	var flows []*flow.Flow
+
+	minLength := t.minLength()
+	if minLength == 0 {
+		return nil, nil
+	}
+
+	// remaining bytes shorter than a record are padding
+	for len(data) >= minLength {
+		r := &record{}
+		for _, field := range t.fields {
+			length := int(field.length)
+			if field.length == variableLength {
+				if len(data) < 1 {
+					return flows, ErrTruncated
+				}
+				length, data = int(data[0]), data[1:]
+				if length == 255 {
+					if len(data) < 2 {
+						return flows, ErrTruncated
+					}
+					length, data = int(binary.BigEndian.Uint16(data[0:2])), data[2:]
+				}
+			}
+
+			if len(data) < length {
+				return flows, ErrTruncated
+			}
+
+			r.setField(field, data[:length])
+			data = data[length:]
+		}
+
+		r.resolveTimes(bootTime, exportTime)
+		d.totalsToDeltas(key, r, exportTime)
+		flows = append(flows, r.flow())
+	}
+
+	return flows, nil
+}
+
+// decodeSets walks through the sets of NetFlow v9 and IPFIX export packets
+func (d *Decoder) decodeSets(key templateKey, data []byte, bootTime, exportTime int64) ([]*flow.Flow, error) {
+	var flows []*flow.Flow
+
+	d.expireTotals(exportTime)
+
+	for len(data) >= setHeaderSize {
+		id := binary.BigEndian.Uint16(data[0:2])
+		length := int(binary.BigEndian.Uint16(data[2:4]))
+		if length < setHeaderSize || length > len(data) {
+			return flows, ErrTruncated
+		}
+		body := data[setHeaderSize:length]
+		data = data[length:]
+
+		switch {
+		case key.version == NetFlow9Version && id == netflow9TemplateSetID:
+			if err := d.decodeTemplateSet(key, body, false); err != nil {
+				return flows, err
+			}
+		case key.version == IPFIXVersion && id == ipfixTemplateSetID:
+			if err := d.decodeTemplateSet(key, body, true); err != nil {
+				return flows, err
+			}
+		case id >= minDataSetID:
+			key.id = id
+			t, ok := d.templates[key]
+			if !ok {
+				// data set received before its template or described by
+				// an options template, skip it
+				continue
+			}
+
+			f, err := d.decodeDataSet(key, t, body, bootTime, exportTime)
+			flows = append(flows, f...)
+			if err != nil {
+				return flows, err
+			}
+		}
+	}
+
+	return flows, nil
+}
+
+func (d *Decoder) decodeNetFlow9(exporter string, data []byte) ([]*flow.Flow, error) {
+	if len(data) < netflow9HeaderSize {
+		return nil, ErrTruncated
+	}
+
+	sysUpTime := int64(binary.BigEndian.Uint32(data[4:8]))
+	exportTime := int64(binary.BigEndian.Uint32(data[8:12])) * 1000
+	key := templateKey{
+		exporter: exporter,
+		version:  NetFlow9Version,
+		domain:   binary.BigEndian.Uint32(data[16:20]),
+	}
+
+	return d.decodeSets(key, data[netflow9HeaderSize:], exportTime-sysUpTime, exportTime)
+}
+
+func (d *Decoder) decodeIPFIX(exporter string, data []byte) ([]*flow.Flow, error) {
+	if len(data) < ipfixHeaderSize {
+		return nil, ErrTruncated
+	}
+
+	length := int(binary.BigEndian.Uint16(data[2:4]))
+	if length < ipfixHeaderSize || length > len(data) {
+		return nil, ErrTruncated
+	}
+
+	exportTime := int64(binary.BigEndian.Uint32(data[4:8])) * 1000
+	key := templateKey{
+		exporter: exporter,
+		version:  IPFIXVersion,
+		domain:   binary.BigEndian.Uint32(data[12:16]),
+	}
+
+	return d.decodeSets(key, data[ipfixHeaderSize:length], 0, exportTime)
+}
+
+// Decode decodes an export packet sent by the given exporter and returns
+// the flows of its data records. The flows are not yet bound to any node,
+// UUIDs are computed by the flow table they are fed to.
+func (d *Decoder) Decode(exporter string, data []byte) ([]*flow.Flow, error) {
+	if len(data) < 2 {
+		return nil, ErrTruncated
+	}
+
+	switch version := binary.BigEndian.Uint16(data[0:2]); version {
+	case NetFlow5Version:
+		return d.decodeNetFlow5(data)
+	case NetFlow9Version:
+		return d.decodeNetFlow9(exporter, data)
+	case IPFIXVersion:
+		return d.decodeIPFIX(exporter, data)
+	default:
+		return nil, fmt.Errorf("%s: %d", ErrInvalidVersion, version)
+	}
+}
+
+// NewDecoder returns a new NetFlow/IPFIX decoder
+func NewDecoder() *Decoder {
+	return &Decoder{
+		templates: make(map[templateKey]*template),
+		totals:    make(map[totalsKey]*totals),
+	}
+}
@@ -0,0 +1,248 @@
+/*
+ * Copyright (C) 2018 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package ipfix
+
+import (
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+
+	"github.com/skydive-project/skydive/flow"
+)
+
+func flowsFromPCAP(t *testing.T, filename string) [][]*flow.Flow {
+	handleRead, err := pcap.OpenOffline(filename)
+	if err != nil {
+		t.Fatal("PCAP OpenOffline error (handle to read packet): ", err)
+	}
+	defer handleRead.Close()
+
+	decoder := NewDecoder()
+
+	var flows [][]*flow.Flow
+	for {
+		data, _, err := handleRead.ReadPacketData()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal("PCAP OpenOffline error (handle to read packet): ", err)
+		}
+
+		p := gopacket.NewPacket(data, layers.LinkTypeEthernet, gopacket.Default)
+		ipLayer, udpLayer := p.Layer(layers.LayerTypeIPv4), p.Layer(layers.LayerTypeUDP)
+		if ipLayer == nil || udpLayer == nil {
+			t.Fatalf("Not an UDP export packet: %s", p.Dump())
+		}
+
+		exporter := ipLayer.(*layers.IPv4).SrcIP.String()
+		f, err := decoder.Decode(exporter, udpLayer.(*layers.UDP).Payload)
+		if err != nil {
+			t.Fatalf("Unable to decode export packet: %s", err)
+		}
+		flows = append(flows, f)
+	}
+
+	return flows
+}
+
+func TestDecodeExportPackets(t *testing.T) {
+	flows := flowsFromPCAP(t, "../flow/pcaptraces/netflow-ipfix.pcap")
+
+	// NetFlow v5, NetFlow v9 template and data, IPFIX biflow, NetFlow v9 data
+	if len(flows) != 4 {
+		t.Fatalf("Should get 4 export packets, got %d", len(flows))
+	}
+
+	expected := []struct {
+		count    int
+		path     string
+		network  [2]string
+		ports    [2]int64
+		metric   flow.FlowMetric
+		hasICMP  bool
+		icmpType flow.ICMPType
+	}{
+		{
+			count:   2,
+			path:    "IPv4/TCP",
+			network: [2]string{"192.168.0.1", "192.168.0.2"},
+			ports:   [2]int64{34567, 80},
+			metric:  flow.FlowMetric{ABPackets: 10, ABBytes: 1000, Start: 1499999990000, Last: 1499999999000},
+		},
+		{
+			count:   1,
+			path:    "IPv4/UDP",
+			network: [2]string{"10.0.0.1", "10.0.0.2"},
+			ports:   [2]int64{5353, 53},
+			metric:  flow.FlowMetric{ABPackets: 3, ABBytes: 300, Start: 1499999995000, Last: 1499999996000},
+		},
+		{
+			count:    1,
+			path:     "IPv6/ICMPv6",
+			network:  [2]string{"fd00::1", "fd00::2"},
+			metric:   flow.FlowMetric{ABPackets: 5, ABBytes: 520, BAPackets: 5, BABytes: 520, Start: 1500000001000, Last: 1500000005000},
+			hasICMP:  true,
+			icmpType: flow.ICMPType_ECHO,
+		},
+		{
+			count:   1,
+			path:    "IPv4/UDP",
+			network: [2]string{"10.0.0.2", "10.0.0.1"},
+			ports:   [2]int64{53, 5353},
+			metric:  flow.FlowMetric{ABPackets: 2, ABBytes: 250, Start: 1499999995010, Last: 1499999996010},
+		},
+	}
+
+	for i, e := range expected {
+		if len(flows[i]) != e.count {
+			t.Fatalf("Packet %d: expected %d flows, got %d", i, e.count, len(flows[i]))
+		}
+
+		f := flows[i][0]
+		if f.LayersPath != e.path {
+			t.Errorf("Packet %d: expected layers path %s, got %s", i, e.path, f.LayersPath)
+		}
+
+		if f.Network == nil || f.Network.A != e.network[0] || f.Network.B != e.network[1] {
+			t.Errorf("Packet %d: wrong network layer %+v", i, f.Network)
+		}
+
+		if e.hasICMP {
+			if f.ICMP == nil || f.ICMP.Type != e.icmpType {
+				t.Errorf("Packet %d: wrong ICMP layer %+v", i, f.ICMP)
+			}
+		} else if f.Transport == nil || f.Transport.A != e.ports[0] || f.Transport.B != e.ports[1] {
+			t.Errorf("Packet %d: wrong transport layer %+v", i, f.Transport)
+		}
+
+		m := f.Metric
+		if m.ABPackets != e.metric.ABPackets || m.ABBytes != e.metric.ABBytes ||
+			m.BAPackets != e.metric.BAPackets || m.BABytes != e.metric.BABytes ||
+			m.Start != e.metric.Start || m.Last != e.metric.Last {
+			t.Errorf("Packet %d: expected metric %+v, got %+v", i, e.metric, f.Metric)
+		}
+
+		if f.Start != e.metric.Start || f.Last != e.metric.Last {
+			t.Errorf("Packet %d: wrong flow times %d/%d", i, f.Start, f.Last)
+		}
+	}
+}
+
+func TestDecodeUnknownTemplate(t *testing.T) {
+	// NetFlow v9 data set without any prior template
+	data := []byte{
+		0x00, 0x09, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01,
+		0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01,
+		0x00, 0x00, 0x00, 0x01,
+		0x01, 0x00, 0x00, 0x08, 0x0a, 0x00, 0x00, 0x01,
+	}
+
+	flows, err := NewDecoder().Decode("127.0.0.1", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(flows) != 0 {
+		t.Errorf("Should not decode records without template, got %+v", flows)
+	}
+
+	if _, err := NewDecoder().Decode("127.0.0.1", []byte{0x00, 0x07}); err == nil {
+		t.Error("Should return an error for an unsupported version")
+	}
+}
+
+// ipfixTotalsPacket returns an IPFIX export packet with a template and a
+// data record reporting only the total counters of a TCP flow
+func ipfixTotalsPacket(exportTime uint32, packets, bytes uint64) []byte {
+	template := []byte{
+		0x00, 0x02, 0x00, 0x24, // template set
+		0x01, 0x00, 0x00, 0x07, // template 256, 7 fields
+		0x00, 0x08, 0x00, 0x04, // sourceIPv4Address
+		0x00, 0x0c, 0x00, 0x04, // destinationIPv4Address
+		0x00, 0x04, 0x00, 0x01, // protocolIdentifier
+		0x00, 0x07, 0x00, 0x02, // sourceTransportPort
+		0x00, 0x0b, 0x00, 0x02, // destinationTransportPort
+		0x00, 0x56, 0x00, 0x08, // packetTotalCount
+		0x00, 0x55, 0x00, 0x08, // octetTotalCount
+	}
+
+	record := []byte{
+		0x01, 0x00, 0x00, 0x21, // data set 256
+		192, 168, 0, 1,
+		192, 168, 0, 2,
+		6,
+		0x87, 0x07,
+		0x00, 0x50,
+	}
+	record = append(record, make([]byte, 16)...)
+	binary.BigEndian.PutUint64(record[17:25], packets)
+	binary.BigEndian.PutUint64(record[25:33], bytes)
+
+	header := make([]byte, ipfixHeaderSize)
+	binary.BigEndian.PutUint16(header[0:2], IPFIXVersion)
+	binary.BigEndian.PutUint16(header[2:4], uint16(ipfixHeaderSize+len(template)+len(record)))
+	binary.BigEndian.PutUint32(header[4:8], exportTime)
+
+	return append(append(header, template...), record...)
+}
+
+func TestDecodeTotalCounters(t *testing.T) {
+	decoder := NewDecoder()
+
+	expected := []struct {
+		exportTime     uint32
+		totalPackets   uint64
+		totalBytes     uint64
+		packets, bytes int64
+	}{
+		{exportTime: 1500000000, totalPackets: 10, totalBytes: 1000, packets: 10, bytes: 1000},
+		{exportTime: 1500000060, totalPackets: 15, totalBytes: 1600, packets: 5, bytes: 600},
+		// counters of the exporter reset
+		{exportTime: 1500000120, totalPackets: 2, totalBytes: 100, packets: 2, bytes: 100},
+	}
+
+	for i, e := range expected {
+		flows, err := decoder.Decode("127.0.0.1", ipfixTotalsPacket(e.exportTime, e.totalPackets, e.totalBytes))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(flows) != 1 {
+			t.Fatalf("Record %d: expected 1 flow, got %d", i, len(flows))
+		}
+
+		if m := flows[0].Metric; m.ABPackets != e.packets || m.ABBytes != e.bytes {
+			t.Errorf("Record %d: expected %d packets and %d bytes since the previous record, got %+v", i, e.packets, e.bytes, m)
+		}
+	}
+
+	// the totals of a flow not reported anymore are forgotten
+	decoder.expireTotals(1500000120*1000 + totalsExpire + 1)
+	if len(decoder.totals) != 0 {
+		t.Errorf("Totals of expired flows should be removed: %+v", decoder.totals)
+	}
+}
@@ -0,0 +1,165 @@
+/*
+ * Copyright (C) 2018 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package metrics
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/flow"
+)
+
+type flowSeries struct {
+	labels    []string
+	abPackets int64
+	baPackets int64
+	abBytes   int64
+	baBytes   int64
+}
+
+// FlowCollector aggregates the counters of the flows by a configurable set
+// of flow fields, for example Application or NodeTID
+type FlowCollector struct {
+	sync.RWMutex
+	fields      []string
+	maxSeries   int
+	series      map[string]*flowSeries
+	dropped     int64
+	packetsDesc *prometheus.Desc
+	bytesDesc   *prometheus.Desc
+}
+
+// Describe implements the prometheus.Collector interface
+func (c *FlowCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.packetsDesc
+	ch <- c.bytesDesc
+	ch <- limitedDesc
+}
+
+// Collect implements the prometheus.Collector interface
+func (c *FlowCollector) Collect(ch chan<- prometheus.Metric) {
+	c.RLock()
+	defer c.RUnlock()
+
+	for _, s := range c.series {
+		ch <- prometheus.MustNewConstMetric(c.packetsDesc, prometheus.CounterValue, float64(s.abPackets), withDirection(s.labels, "ab")...)
+		ch <- prometheus.MustNewConstMetric(c.packetsDesc, prometheus.CounterValue, float64(s.baPackets), withDirection(s.labels, "ba")...)
+		ch <- prometheus.MustNewConstMetric(c.bytesDesc, prometheus.CounterValue, float64(s.abBytes), withDirection(s.labels, "ab")...)
+		ch <- prometheus.MustNewConstMetric(c.bytesDesc, prometheus.CounterValue, float64(s.baBytes), withDirection(s.labels, "ba")...)
+	}
+
+	ch <- prometheus.MustNewConstMetric(limitedDesc, prometheus.GaugeValue, float64(c.dropped), "flow")
+}
+
+func withDirection(labels []string, direction string) []string {
+	return append(labels[:len(labels):len(labels)], direction)
+}
+
+func (c *FlowCollector) getSeries(f *flow.Flow) *flowSeries {
+	labels := make([]string, len(c.fields))
+	for i, field := range c.fields {
+		labels[i], _ = f.GetFieldString(field)
+	}
+
+	key := strings.Join(labels, "\x00")
+	if s, ok := c.series[key]; ok {
+		return s
+	}
+
+	if c.maxSeries > 0 && len(c.series) >= c.maxSeries {
+		c.dropped++
+
+		for i := range labels {
+			labels[i] = OtherLabelValue
+		}
+		key = strings.Join(labels, "\x00")
+		if s, ok := c.series[key]; ok {
+			return s
+		}
+	}
+
+	s := &flowSeries{labels: labels}
+	c.series[key] = s
+
+	return s
+}
+
+// Observe adds the counters of the given flows to the aggregated series.
+// It is meant to be used as a flow table callback so that only the delta
+// since the last update of a flow is added.
+func (c *FlowCollector) Observe(flows []*flow.Flow) {
+	c.Lock()
+	defer c.Unlock()
+
+	for _, f := range flows {
+		m := f.LastUpdateMetric
+		if m == nil {
+			m = f.Metric
+		}
+		if m == nil {
+			continue
+		}
+
+		s := c.getSeries(f)
+		s.abPackets += m.ABPackets
+		s.baPackets += m.BAPackets
+		s.abBytes += m.ABBytes
+		s.baBytes += m.BABytes
+	}
+}
+
+// NewFlowCollector returns a new collector aggregating the flows by the
+// given fields. At most maxSeries combinations are exported, the others being
+// accounted in a series where all the labels are set to "other", 0 means no limit.
+func NewFlowCollector(fields []string, maxSeries int) *FlowCollector {
+	labels := make([]string, len(fields), len(fields)+1)
+	for i, field := range fields {
+		labels[i] = labelName(field)
+	}
+	labels = append(labels, "direction")
+
+	return &FlowCollector{
+		fields:    fields,
+		maxSeries: maxSeries,
+		series:    make(map[string]*flowSeries),
+		packetsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "flow", "packets_total"),
+			"Number of packets of the flows",
+			labels, nil,
+		),
+		bytesDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "flow", "bytes_total"),
+			"Number of bytes of the flows",
+			labels, nil,
+		),
+	}
+}
+
+// NewFlowCollectorFromConfig returns a new flow collector using the fields
+// and the cardinality limit defined in the configuration
+func NewFlowCollectorFromConfig() *FlowCollector {
+	return NewFlowCollector(config.GetStringSlice("prometheus.flow.labels"), config.GetInt("prometheus.flow.max_series"))
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright (C) 2018 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/skydive-project/skydive/flow"
+)
+
+func getMetrics(t *testing.T, h *Handler) string {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	body, err := ioutil.ReadAll(w.Result().Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func newTestFlow(application string, ab, ba int64) *flow.Flow {
+	return &flow.Flow{
+		Application: application,
+		Metric: &flow.FlowMetric{
+			ABPackets: ab,
+			ABBytes:   ab * 100,
+			BAPackets: ba,
+			BABytes:   ba * 100,
+		},
+	}
+}
+
+func TestLabelName(t *testing.T) {
+	for field, expected := range map[string]string{
+		"Application": "application",
+		"NodeTID":     "node_tid",
+		"Network.A":   "network_a",
+		"RxCrcErrors": "rx_crc_errors",
+	} {
+		if name := labelName(field); name != expected {
+			t.Errorf("Expected %s for %s, got %s", expected, field, name)
+		}
+	}
+}
+
+func TestFlowCollector(t *testing.T) {
+	c := NewFlowCollector([]string{"Application"}, 2)
+	h, err := NewHandler(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Observe([]*flow.Flow{newTestFlow("HTTP", 1, 2), newTestFlow("DNS", 3, 4)})
+
+	// only the delta since the last update is accounted
+	f := newTestFlow("HTTP", 5, 6)
+	f.LastUpdateMetric = &flow.FlowMetric{ABPackets: 4, ABBytes: 400, BAPackets: 4, BABytes: 400}
+	c.Observe([]*flow.Flow{f, newTestFlow("SSH", 7, 8), newTestFlow("ICMPv4", 1, 1)})
+
+	body := getMetrics(t, h)
+	for _, expected := range []string{
+		`skydive_flow_packets_total{application="HTTP",direction="ab"} 5`,
+		`skydive_flow_packets_total{application="HTTP",direction="ba"} 6`,
+		`skydive_flow_bytes_total{application="DNS",direction="ab"} 300`,
+		`skydive_flow_packets_total{application="other",direction="ab"} 8`,
+		`skydive_flow_bytes_total{application="other",direction="ba"} 900`,
+		`skydive_metrics_limited{collector="flow"} 2`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected %s in metrics, got:\n%s", expected, body)
+		}
+	}
+
+	if strings.Contains(body, `application="SSH"`) {
+		t.Errorf("Cardinality limit not applied:\n%s", body)
+	}
+}
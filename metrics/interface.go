@@ -0,0 +1,171 @@
+/*
+ * Copyright (C) 2018 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/topology"
+	"github.com/skydive-project/skydive/topology/graph"
+)
+
+var interfaceLabels = []string{"name", "type", "host", "namespace"}
+
+type int64Getter interface {
+	GetFieldInt64(field string) (int64, error)
+}
+
+type interfaceCounter struct {
+	field     string
+	desc      *prometheus.Desc
+	valueType prometheus.ValueType
+}
+
+// interfaceGauges are the interface metric fields that are not counters
+var interfaceGauges = map[string]bool{
+	"QdiscBacklog": true,
+}
+
+// InterfaceCollector collects the counters of the interface nodes of a graph
+type InterfaceCollector struct {
+	graph     *graph.Graph
+	maxSeries int
+	counters  []interfaceCounter
+}
+
+// Describe implements the prometheus.Collector interface
+func (c *InterfaceCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, counter := range c.counters {
+		ch <- counter.desc
+	}
+	ch <- limitedDesc
+}
+
+// interfaceMetric returns the interface metric of a node. Agents store the
+// metric as an InterfaceMetric while the analyzer receives it as a map.
+func interfaceMetric(n *graph.Node) int64Getter {
+	m, err := n.GetField("Metric")
+	if err != nil {
+		return nil
+	}
+
+	switch m := m.(type) {
+	case *topology.InterfaceMetric:
+		return m
+	case map[string]interface{}:
+		return mapMetric(m)
+	}
+	return nil
+}
+
+type mapMetric map[string]interface{}
+
+func (m mapMetric) GetFieldInt64(field string) (int64, error) {
+	v, ok := m[field]
+	if !ok {
+		return 0, common.ErrFieldNotFound
+	}
+	return common.ToInt64(v)
+}
+
+// Collect implements the prometheus.Collector interface
+func (c *InterfaceCollector) Collect(ch chan<- prometheus.Metric) {
+	c.graph.RLock()
+	defer c.graph.RUnlock()
+
+	var series, dropped int
+	for _, node := range c.graph.GetNodes(nil) {
+		metric := interfaceMetric(node)
+		if metric == nil {
+			continue
+		}
+
+		if c.maxSeries > 0 && series >= c.maxSeries {
+			dropped++
+			continue
+		}
+		series++
+
+		name, _ := node.GetFieldString("Name")
+		tp, _ := node.GetFieldString("Type")
+		netns, _, _ := topology.NamespaceFromNode(c.graph, node)
+
+		for _, counter := range c.counters {
+			value, err := metric.GetFieldInt64(counter.field)
+			if err != nil {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(counter.desc, counter.valueType, float64(value), name, tp, node.Host(), netns)
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(limitedDesc, prometheus.GaugeValue, float64(dropped), "interface")
+}
+
+// NewInterfaceCollector returns a new collector of the interface counters
+// of the graph, at most maxSeries interfaces are exported, 0 means no limit.
+func NewInterfaceCollector(g *graph.Graph, maxSeries int) *InterfaceCollector {
+	c := &InterfaceCollector{
+		graph:     g,
+		maxSeries: maxSeries,
+	}
+
+	for _, field := range (&topology.InterfaceMetric{}).GetFields() {
+		if field == "Start" || field == "Last" {
+			continue
+		}
+
+		if interfaceGauges[field] {
+			c.counters = append(c.counters, interfaceCounter{
+				field: field,
+				desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "interface", labelName(field)),
+					"Interface "+field+" gauge",
+					interfaceLabels, nil,
+				),
+				valueType: prometheus.GaugeValue,
+			})
+			continue
+		}
+
+		c.counters = append(c.counters, interfaceCounter{
+			field: field,
+			desc: prometheus.NewDesc(
+				prometheus.BuildFQName(namespace, "interface", labelName(field)+"_total"),
+				"Interface "+field+" counter",
+				interfaceLabels, nil,
+			),
+			valueType: prometheus.CounterValue,
+		})
+	}
+
+	return c
+}
+
+// NewInterfaceCollectorFromConfig returns a new interface collector using
+// the cardinality limit defined in the configuration
+func NewInterfaceCollectorFromConfig(g *graph.Graph) *InterfaceCollector {
+	return NewInterfaceCollector(g, config.GetInt("prometheus.interface.max_series"))
+}
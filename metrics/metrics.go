@@ -0,0 +1,112 @@
+/*
+ * Copyright (C) 2018 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"unicode"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+
+	"github.com/skydive-project/skydive/logging"
+)
+
+const namespace = "skydive"
+
+// OtherLabelValue is the label value used for the series exceeding the
+// cardinality limit of a collector
+const OtherLabelValue = "other"
+
+// Handler exposes the metrics of a set of collectors in the
+// Prometheus/OpenMetrics text format
+type Handler struct {
+	registry *prometheus.Registry
+}
+
+// ServeHTTP gathers the metrics and writes them in the format negotiated with the client
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	mfs, err := h.registry.Gather()
+	if err != nil {
+		logging.GetLogger().Errorf("Error while gathering metrics: %s", err)
+		if len(mfs) == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	format := expfmt.Negotiate(r.Header)
+	w.Header().Set("Content-Type", string(format))
+	w.WriteHeader(http.StatusOK)
+
+	encoder := expfmt.NewEncoder(w, format)
+	for _, mf := range mfs {
+		if err := encoder.Encode(mf); err != nil {
+			logging.GetLogger().Warningf("Error while writing metrics: %s", err)
+			return
+		}
+	}
+}
+
+// NewHandler returns a new metrics handler exposing the given collectors
+func NewHandler(collectors ...prometheus.Collector) (*Handler, error) {
+	registry := prometheus.NewRegistry()
+	for _, c := range collectors {
+		if err := registry.Register(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Handler{registry: registry}, nil
+}
+
+// labelName converts a field name like Network.A or RxBytes to a valid
+// Prometheus name, network_a and rx_bytes
+func labelName(field string) string {
+	var b bytes.Buffer
+
+	runes := []rune(field)
+	for i, r := range runes {
+		switch {
+		case unicode.IsUpper(r):
+			if i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) ||
+				(i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))) {
+				b.WriteRune('_')
+			}
+			b.WriteRune(unicode.ToLower(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+
+	return b.String()
+}
+
+var limitedDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "metrics", "limited"),
+	"Number of interfaces or flow updates not exported in their own series because of the cardinality limit",
+	[]string{"collector"}, nil,
+)
@@ -62,7 +62,7 @@ Vue.component('capture-form', {
                 <option v-for="option in options" :value="option.type">{{ option.type }} ({{option.desc}})</option>\
               </select>\
             </div>\
-            <div class="form-group" v-if="captureType == \'sflow\'">\
+            <div class="form-group" v-if="captureType == \'sflow\' || captureType == \'ipfix\'">\
               <label for="port">Port</label>\
               <input id="port" type="number" class="form-control input-sm" v-model.number="port" min="0"/>\
             </div>\
@@ -83,6 +83,14 @@ Vue.component('capture-form', {
               <label for="capture-raw-packets">Raw packets limit</label>\
               <input id="capture-raw-packets" type="number" class="form-control input-sm" v-model.number="rawPackets" min="0" max="10"/>\
             </div>\
+            <div class="form-group">\
+              <label for="capture-sampling-rate">Sampling rate (1 packet out of N)</label>\
+              <input id="capture-sampling-rate" type="number" class="form-control input-sm" v-model.number="samplingRate" min="0" max="65536"/>\
+              <label class="form-check-label">\
+                <input id="capture-adaptive-sampling" type="checkbox" class="form-check-input" v-model="adaptiveSampling">\
+                Adaptive sampling\
+              </label>\
+            </div>\
             <div class="form-group">\
               <label class="form-check-label">\
                 <input id="capture-tcp-metric" type="checkbox" class="form-check-input" v-model="extraTCPMetric">\
@@ -125,6 +133,8 @@ Vue.component('capture-form', {
       extraTCPMetric: true,
       ipDefrag: false,
       reassembleTCP: false,
+      samplingRate: 0,
+      adaptiveSampling: false,
       userQuery: "",
       mode: "selection",
       visible: false,
@@ -151,6 +161,7 @@ Vue.component('capture-form', {
           {"type": "pcap", "desc": "Packet Capture library based probe"},
           {"type": "pcapsocket", "desc": "Socket reading PCAP format data"},
           {"type": "sflow", "desc": "Socket reading sFlow frames"},
+          {"type": "ipfix", "desc": "Socket reading NetFlow/IPFIX records"},
           {"type": "ebpf", "desc": "Flow capture within kernel - experimental"},
           {"type": "ovsmirror", "desc": "Leverages mirroring to capture - experimental"}
         ];
@@ -273,6 +284,8 @@ Vue.component('capture-form', {
       this.extraTCPMetric = true;
       this.ipDefrag = false;
       this.reassembleTCP = false;
+      this.samplingRate = 0;
+      this.adaptiveSampling = false;
       this.visible = false;
       this.captureType = "";
       this.captureLayerKeyMode = "";
@@ -316,6 +329,8 @@ Vue.component('capture-form', {
       capture.IPDefrag = this.ipDefrag;
       capture.ReassembleTCP = this.reassembleTCP;
       capture.LayerKeyMode = this.layerKeyMode
+      capture.SamplingRate = this.samplingRate;
+      capture.AdaptiveSampling = this.adaptiveSampling;
       return self.captureAPI.create(capture)
       .then(function(data) {
         self.$success({message: 'Capture created'});
@@ -59,6 +59,15 @@ type Config struct {
 	IndicesLimit int
 }
 
+// StorageOptions describes the options of an ElasticSearch storage backend
+var StorageOptions = []config.StorageOption{
+	{Name: "host", Default: "127.0.0.1:9200"},
+	{Name: "bulk_maxdelay", Default: 5},
+	{Name: "index_age_limit", Default: 0},
+	{Name: "index_entries_limit", Default: 0},
+	{Name: "indices_to_keep", Default: 0},
+}
+
 // NewConfig returns a new Config for the given backend name
 func NewConfig(name ...string) Config {
 	cfg := Config{}
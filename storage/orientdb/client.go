@@ -35,9 +35,18 @@ import (
 	"strings"
 
 	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
 	"github.com/skydive-project/skydive/filters"
 )
 
+// StorageOptions describes the options of an OrientDB storage backend
+var StorageOptions = []config.StorageOption{
+	{Name: "addr", Default: "http://localhost:2480"},
+	{Name: "database", Default: "Skydive"},
+	{Name: "username", Default: "root"},
+	{Name: "password", Default: "root"},
+}
+
 // Document describes an orientdb docmuent interface
 type Document map[string]interface{}
 
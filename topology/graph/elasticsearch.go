@@ -31,6 +31,7 @@ import (
 	"github.com/olivere/elastic"
 
 	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
 	"github.com/skydive-project/skydive/etcd"
 	"github.com/skydive-project/skydive/filters"
 	"github.com/skydive-project/skydive/logging"
@@ -582,3 +583,13 @@ func NewElasticSearchBackendFromConfig(backend string, etcdClient *etcd.Client)
 
 	return NewElasticSearchBackendFromClient(client)
 }
+
+func init() {
+	RegisterBackendDriver(&BackendDriver{
+		Name: "elasticsearch",
+		Factory: func(cfg *config.StorageConfig, etcdClient *etcd.Client) (Backend, error) {
+			return NewElasticSearchBackendFromConfig(cfg.Name, etcdClient)
+		},
+		Options: es.StorageOptions,
+	})
+}
@@ -27,7 +27,9 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/nu7hatch/gouuid"
@@ -1187,6 +1189,12 @@ func (g *Graph) GetEdge(i Identifier) *Edge {
 	return nil
 }
 
+// GetEdgeRevisions returns the revisions of an edge within the time slice
+// of the graph context, sorted by revision
+func (g *Graph) GetEdgeRevisions(i Identifier) []*Edge {
+	return g.backend.GetEdge(i, g.context)
+}
+
 // NodeAdded in the graph
 func (g *Graph) NodeAdded(n *Node) bool {
 	if g.GetNode(n.ID) == nil {
@@ -1213,6 +1221,12 @@ func (g *Graph) GetNode(i Identifier) *Node {
 	return nil
 }
 
+// GetNodeRevisions returns the revisions of a node within the time slice
+// of the graph context, sorted by revision
+func (g *Graph) GetNodeRevisions(i Identifier) []*Node {
+	return g.backend.GetNode(i, g.context)
+}
+
 // CreateNode returns a new node not bound to a graph
 func CreateNode(i Identifier, m Metadata, t time.Time, h string, s common.ServiceType) *Node {
 	o := string(s)
@@ -1495,21 +1509,69 @@ func NewGraphFromConfig(backend Backend, service common.ServiceType) *Graph {
 	return NewGraph(host, backend, service)
 }
 
+// BackendFactory creates a graph backend from the configuration of a storage backend
+type BackendFactory func(cfg *config.StorageConfig, etcdClient *etcd.Client) (Backend, error)
+
+// BackendDriver describes a graph backend driver
+type BackendDriver struct {
+	Name    string
+	Factory BackendFactory
+	Options []config.StorageOption
+}
+
+var (
+	backendDriversLock sync.RWMutex
+	backendDrivers     = make(map[string]*BackendDriver)
+)
+
+// RegisterBackendDriver makes a graph backend driver available by its name.
+// It is meant to be called from an init function.
+func RegisterBackendDriver(driver *BackendDriver) {
+	backendDriversLock.Lock()
+	defer backendDriversLock.Unlock()
+
+	if driver.Factory == nil {
+		panic("graph: nil factory for backend driver " + driver.Name)
+	}
+	if _, found := backendDrivers[driver.Name]; found {
+		panic("graph: backend driver registered twice " + driver.Name)
+	}
+	backendDrivers[driver.Name] = driver
+}
+
+// BackendDrivers returns the sorted list of the registered backend driver names
+func BackendDrivers() []string {
+	backendDriversLock.RLock()
+	defer backendDriversLock.RUnlock()
+
+	var names []string
+	for name := range backendDrivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
 // NewBackendByName creates a new graph backend based on the name
-// memory, orientdb, elasticsearch backend are supported
-func NewBackendByName(name string, etcdClient *etcd.Client) (backend Backend, err error) {
-	driver := config.GetString("storage." + name + ".driver")
-	switch driver {
-	case "memory":
-		backend, err = NewMemoryBackend()
-	case "orientdb":
-		backend, err = NewOrientDBBackendFromConfig(name)
-	case "elasticsearch":
-		backend, err = NewElasticSearchBackendFromConfig(name, etcdClient)
-	default:
-		return nil, fmt.Errorf("Topology backend driver '%s' not supported", driver)
+// of a storage backend defined in the configuration
+func NewBackendByName(name string, etcdClient *etcd.Client) (Backend, error) {
+	driverName := config.StorageDriver(name)
+
+	backendDriversLock.RLock()
+	driver, found := backendDrivers[driverName]
+	backendDriversLock.RUnlock()
+
+	if !found {
+		return nil, fmt.Errorf("Topology backend driver '%s' not supported", driverName)
+	}
+
+	cfg, err := config.LoadStorageConfig(name, driver.Options)
+	if err != nil {
+		return nil, err
 	}
 
+	backend, err := driver.Factory(cfg, etcdClient)
 	if err != nil {
 		return nil, err
 	}
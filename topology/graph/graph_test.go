@@ -23,6 +23,7 @@
 package graph
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
@@ -377,6 +378,149 @@ func TestComplexPath(t *testing.T) {
 	}
 }
 
+func TestKShortestPaths(t *testing.T) {
+	g := newGraph(t)
+
+	pathsToString := func(paths [][]*Node) string {
+		var s []string
+		for _, p := range paths {
+			var values []string
+			for _, n := range p {
+				value, _ := n.GetFieldInt64("Value")
+				values = append(values, strconv.FormatInt(value, 10))
+			}
+			s = append(s, strings.Join(values, "/"))
+		}
+		return strings.Join(s, " ")
+	}
+
+	// n1 -- n2 -- n3 -- n4 -----------
+	//  \                              \
+	//   \-- n11 -- n12---------------- n5
+	//                \                /
+	//                 \-- n121 -- n122
+	nodes := make(map[int]*Node)
+	for _, value := range []int{1, 2, 3, 4, 5, 11, 12, 121, 122} {
+		nodes[value] = g.NewNode(GenID(), Metadata{"Value": value})
+	}
+	g.Link(nodes[1], nodes[2], Metadata{"Type": "Layer2"})
+	g.Link(nodes[2], nodes[3], Metadata{"Type": "Layer2"})
+	g.Link(nodes[3], nodes[4], Metadata{"Type": "Layer2"})
+	g.Link(nodes[4], nodes[5], Metadata{"Type": "Layer2"})
+	g.Link(nodes[1], nodes[11], Metadata{"Type": "Layer2"})
+	g.Link(nodes[11], nodes[12], Metadata{"Type": "Layer2"})
+	g.Link(nodes[12], nodes[5], Metadata{"Type": "Layer3", "Cost": 10})
+	g.Link(nodes[12], nodes[121], Metadata{"Type": "Layer2"})
+	g.Link(nodes[121], nodes[122], Metadata{"Type": "Layer2"})
+	g.Link(nodes[122], nodes[5], Metadata{"Type": "Layer2"})
+
+	r, _ := g.LookupKShortestPaths(nodes[1], Metadata{"Value": 5}, nil, 2, PathWeight{}, nil)
+	if s := pathsToString(r); s != "1/11/12/5 1/2/3/4/5" {
+		t.Errorf("Wrong paths returned: %s", s)
+	}
+
+	r, _ = g.LookupKShortestPaths(nodes[1], Metadata{"Value": 5}, nil, 5, PathWeight{Key: "Cost"}, nil)
+	if s := pathsToString(r); s != "1/2/3/4/5 1/11/12/121/122/5 1/11/12/5" {
+		t.Errorf("Wrong paths returned: %s", s)
+	}
+
+	r, _ = g.LookupKShortestPaths(nodes[1], Metadata{"Value": 5}, Metadata{"Type": "Layer2"}, 5, PathWeight{}, nil)
+	if s := pathsToString(r); s != "1/2/3/4/5 1/11/12/121/122/5" {
+		t.Errorf("Wrong paths returned: %s", s)
+	}
+
+	r, _ = g.LookupKShortestPaths(nodes[1], Metadata{"Value": 55}, nil, 5, PathWeight{}, nil)
+	if len(r) != 0 {
+		t.Errorf("Shouldn't have returned paths: %s", pathsToString(r))
+	}
+
+	r, _ = g.LookupAllPaths(nodes[1], Metadata{"Value": 5}, nil, 0, PathWeight{}, nil)
+	if s := pathsToString(r); s != "1/11/12/5 1/2/3/4/5 1/11/12/121/122/5" {
+		t.Errorf("Wrong paths returned: %s", s)
+	}
+
+	r, _ = g.LookupAllPaths(nodes[1], Metadata{"Value": 5}, nil, 4, PathWeight{Key: "Cost"}, nil)
+	if s := pathsToString(r); s != "1/2/3/4/5 1/11/12/5" {
+		t.Errorf("Wrong paths returned: %s", s)
+	}
+
+	errAbort := errors.New("aborted")
+	abortAfter := func(size int) PathCheck {
+		return func(found int) error {
+			if found > size {
+				return errAbort
+			}
+			return nil
+		}
+	}
+
+	if _, err := g.LookupAllPaths(nodes[1], Metadata{"Value": 5}, nil, 0, PathWeight{}, abortAfter(10)); err != errAbort {
+		t.Errorf("Search should have been aborted once the size was exceeded, returned: %v", err)
+	}
+
+	if _, err := g.LookupKShortestPaths(nodes[1], Metadata{"Value": 5}, nil, 5, PathWeight{}, abortAfter(4)); err != errAbort {
+		t.Errorf("Search should have been aborted once the size was exceeded, returned: %v", err)
+	}
+
+	calls := 0
+	canceled := func(found int) error {
+		if calls++; calls > 2 {
+			return errAbort
+		}
+		return nil
+	}
+	if _, err := g.LookupAllPaths(nodes[1], Metadata{"Value": 55}, nil, 0, PathWeight{}, canceled); err != errAbort {
+		t.Errorf("Search should have been aborted while walking the graph, returned: %v", err)
+	}
+
+	if r, err := g.LookupAllPaths(nodes[1], Metadata{"Value": 5}, nil, 0, PathWeight{}, abortAfter(15)); err != nil || len(r) != 3 {
+		t.Errorf("Search should be within the size, returned: %v", err)
+	}
+}
+
+func TestPathWeightInverse(t *testing.T) {
+	g := newGraph(t)
+
+	// n1 --10-- n2 --10-- n3
+	//  \                 /
+	//   \-------1-------/
+	n1 := g.NewNode(GenID(), Metadata{"Value": 1})
+	n2 := g.NewNode(GenID(), Metadata{"Value": 2})
+	n3 := g.NewNode(GenID(), Metadata{"Value": 3})
+	g.Link(n1, n2, Metadata{"Speed": 10})
+	g.Link(n2, n3, Metadata{"Speed": 10})
+	g.Link(n1, n3, Metadata{"Speed": 1})
+
+	pathsToString := func(paths [][]*Node) string {
+		var s []string
+		for _, p := range paths {
+			var values []string
+			for _, n := range p {
+				value, _ := n.GetFieldInt64("Value")
+				values = append(values, strconv.FormatInt(value, 10))
+			}
+			s = append(s, strings.Join(values, "/"))
+		}
+		return strings.Join(s, " ")
+	}
+
+	// the highest speed wins when using its inverse as weight
+	r, _ := g.LookupKShortestPaths(n1, Metadata{"Value": 3}, nil, 2, PathWeight{Key: "Speed", Inverse: true}, nil)
+	if s := pathsToString(r); s != "1/2/3 1/3" {
+		t.Errorf("Wrong paths returned: %s", s)
+	}
+
+	r, _ = g.LookupAllPaths(n1, Metadata{"Value": 3}, nil, 0, PathWeight{Key: "Speed", Inverse: true}, nil)
+	if s := pathsToString(r); s != "1/2/3 1/3" {
+		t.Errorf("Wrong paths returned: %s", s)
+	}
+
+	r, _ = g.LookupKShortestPaths(n1, Metadata{"Value": 3}, nil, 2, PathWeight{Key: "Speed"}, nil)
+	if s := pathsToString(r); s != "1/3 1/2/3" {
+		t.Errorf("Wrong paths returned: %s", s)
+	}
+}
+
 func TestMetadata(t *testing.T) {
 	g := newGraph(t)
 
@@ -32,8 +32,13 @@ import (
 // a set of hash,value pairs
 type NodeHasher func(n *Node) map[string]interface{}
 
-// Indexer provides a way to index graph nodes. A node can be mapped to
-// multiple hash,value pairs. A hash can also be mapped to multiple nodes.
+// EdgeHasher describes a callback that is called to map an edge to
+// a set of hash,value pairs
+type EdgeHasher func(e *Edge) map[string]interface{}
+
+// Indexer provides a way to index graph nodes and edges. An element can be
+// mapped to multiple hash,value pairs. A hash can also be mapped to multiple
+// elements.
 type Indexer struct {
 	common.RWMutex
 	DefaultGraphListener
@@ -41,9 +46,10 @@ type Indexer struct {
 	eventHandler    *EventHandler
 	listenerHandler ListenerHandler
 	hashNode        NodeHasher
+	hashEdge        EdgeHasher
 	appendOnly      bool
 	hashToValues    map[string]map[Identifier]interface{}
-	nodeToHashes    map[Identifier]map[string]bool
+	elementToHashes map[Identifier]map[string]bool
 }
 
 func (i *Indexer) index(id Identifier, h string, value interface{}) {
@@ -51,7 +57,7 @@ func (i *Indexer) index(id Identifier, h string, value interface{}) {
 		i.hashToValues[h] = make(map[Identifier]interface{})
 	}
 	i.hashToValues[h][id] = value
-	i.nodeToHashes[id][h] = true
+	i.elementToHashes[id][h] = true
 }
 
 func (i *Indexer) unindex(id Identifier, h string) {
@@ -61,34 +67,49 @@ func (i *Indexer) unindex(id Identifier, h string) {
 	}
 }
 
-// cacheNode indexes a node with a set of hash -> value map
-func (i *Indexer) cacheNode(n *Node, kv map[string]interface{}) {
-	i.Lock()
-	defer i.Unlock()
-
-	if hashes, found := i.nodeToHashes[n.ID]; !found {
-		// Node was not in the cache
-		i.nodeToHashes[n.ID] = make(map[string]bool)
-		for k, v := range kv {
-			i.index(n.ID, k, v)
-		}
-
-		i.eventHandler.NotifyEvent(NodeAdded, n)
-	} else {
-		// Node already was in the cache
-		if !i.appendOnly {
-			for h := range hashes {
-				if _, found := kv[h]; !found {
-					i.unindex(n.ID, h)
-				}
+// cache indexes an element with a set of hash -> value map, returns whether
+// the element was already in the cache
+func (i *Indexer) cache(id Identifier, kv map[string]interface{}) bool {
+	hashes, found := i.elementToHashes[id]
+	if !found {
+		i.elementToHashes[id] = make(map[string]bool)
+	} else if !i.appendOnly {
+		for h := range hashes {
+			if _, found := kv[h]; !found {
+				i.unindex(id, h)
 			}
 		}
+	}
+
+	for k, v := range kv {
+		i.index(id, k, v)
+	}
+
+	return found
+}
 
-		for k, v := range kv {
-			i.index(n.ID, k, v)
+// forget removes an element and its associated hashes from the index,
+// returns whether the element was in the cache
+func (i *Indexer) forget(id Identifier) bool {
+	hashes, found := i.elementToHashes[id]
+	if found {
+		delete(i.elementToHashes, id)
+		for h := range hashes {
+			i.unindex(id, h)
 		}
+	}
+	return found
+}
 
+// cacheNode indexes a node with a set of hash -> value map
+func (i *Indexer) cacheNode(n *Node, kv map[string]interface{}) {
+	i.Lock()
+	defer i.Unlock()
+
+	if i.cache(n.ID, kv) {
 		i.eventHandler.NotifyEvent(NodeUpdated, n)
+	} else {
+		i.eventHandler.NotifyEvent(NodeAdded, n)
 	}
 }
 
@@ -97,18 +118,39 @@ func (i *Indexer) forgetNode(n *Node) {
 	i.Lock()
 	defer i.Unlock()
 
-	if hashes, found := i.nodeToHashes[n.ID]; found {
-		delete(i.nodeToHashes, n.ID)
-		for h := range hashes {
-			delete(i.hashToValues[h], n.ID)
-		}
-
+	if i.forget(n.ID) {
 		i.eventHandler.NotifyEvent(NodeDeleted, n)
 	}
 }
 
+// cacheEdge indexes an edge with a set of hash -> value map
+func (i *Indexer) cacheEdge(e *Edge, kv map[string]interface{}) {
+	i.Lock()
+	defer i.Unlock()
+
+	if i.cache(e.ID, kv) {
+		i.eventHandler.NotifyEvent(EdgeUpdated, e)
+	} else {
+		i.eventHandler.NotifyEvent(EdgeAdded, e)
+	}
+}
+
+// forgetEdge removes the edge and its associated hashes from the index
+func (i *Indexer) forgetEdge(e *Edge) {
+	i.Lock()
+	defer i.Unlock()
+
+	if i.forget(e.ID) {
+		i.eventHandler.NotifyEvent(EdgeDeleted, e)
+	}
+}
+
 // OnNodeAdded event
 func (i *Indexer) OnNodeAdded(n *Node) {
+	if i.hashNode == nil {
+		return
+	}
+
 	if kv := i.hashNode(n); len(kv) != 0 {
 		i.cacheNode(n, kv)
 	}
@@ -116,6 +158,10 @@ func (i *Indexer) OnNodeAdded(n *Node) {
 
 // OnNodeUpdated event
 func (i *Indexer) OnNodeUpdated(n *Node) {
+	if i.hashNode == nil {
+		return
+	}
+
 	if kv := i.hashNode(n); len(kv) != 0 {
 		i.cacheNode(n, kv)
 	} else {
@@ -128,12 +174,56 @@ func (i *Indexer) OnNodeDeleted(n *Node) {
 	i.forgetNode(n)
 }
 
+// OnEdgeAdded event
+func (i *Indexer) OnEdgeAdded(e *Edge) {
+	if i.hashEdge == nil {
+		return
+	}
+
+	if kv := i.hashEdge(e); len(kv) != 0 {
+		i.cacheEdge(e, kv)
+	}
+}
+
+// OnEdgeUpdated event
+func (i *Indexer) OnEdgeUpdated(e *Edge) {
+	if i.hashEdge == nil {
+		return
+	}
+
+	if kv := i.hashEdge(e); len(kv) != 0 {
+		i.cacheEdge(e, kv)
+	} else {
+		i.forgetEdge(e)
+	}
+}
+
+// OnEdgeDeleted event
+func (i *Indexer) OnEdgeDeleted(e *Edge) {
+	i.forgetEdge(e)
+}
+
 // FromHash returns the nodes mapped by a hash along with their associated values
 func (i *Indexer) FromHash(hash string) (nodes []*Node, values []interface{}) {
 	if ids, found := i.hashToValues[hash]; found {
 		for id, obj := range ids {
-			nodes = append(nodes, i.graph.GetNode(id))
-			values = append(values, obj)
+			if node := i.graph.GetNode(id); node != nil {
+				nodes = append(nodes, node)
+				values = append(values, obj)
+			}
+		}
+	}
+	return
+}
+
+// EdgesFromHash returns the edges mapped by a hash along with their associated values
+func (i *Indexer) EdgesFromHash(hash string) (edges []*Edge, values []interface{}) {
+	if ids, found := i.hashToValues[hash]; found {
+		for id, obj := range ids {
+			if edge := i.graph.GetEdge(id); edge != nil {
+				edges = append(edges, edge)
+				values = append(values, obj)
+			}
 		}
 	}
 	return
@@ -161,13 +251,21 @@ func (i *Indexer) RemoveEventListener(l EventListener) {
 
 // NewIndexer returns a new graph indexer with the associated hashing callback
 func NewIndexer(g *Graph, listenerHandler ListenerHandler, hashNode NodeHasher, appendOnly bool) *Indexer {
+	return NewElementIndexer(g, listenerHandler, hashNode, nil, appendOnly)
+}
+
+// NewElementIndexer returns a new graph indexer of nodes and edges with the
+// associated hashing callbacks, a nil callback disabling the indexing of
+// the corresponding elements
+func NewElementIndexer(g *Graph, listenerHandler ListenerHandler, hashNode NodeHasher, hashEdge EdgeHasher, appendOnly bool) *Indexer {
 	indexer := &Indexer{
 		graph:           g,
 		eventHandler:    NewEventHandler(maxEvents),
 		listenerHandler: listenerHandler,
 		hashNode:        hashNode,
+		hashEdge:        hashEdge,
 		hashToValues:    make(map[string]map[Identifier]interface{}),
-		nodeToHashes:    make(map[Identifier]map[string]bool),
+		elementToHashes: make(map[Identifier]map[string]bool),
 		appendOnly:      appendOnly,
 	}
 	return indexer
@@ -22,6 +22,11 @@
 
 package graph
 
+import (
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/etcd"
+)
+
 // MemoryBackendNode a memory backend node
 type MemoryBackendNode struct {
 	*Node
@@ -187,3 +192,12 @@ func NewMemoryBackend() (*MemoryBackend, error) {
 		edges: make(map[Identifier]*MemoryBackendEdge),
 	}, nil
 }
+
+func init() {
+	RegisterBackendDriver(&BackendDriver{
+		Name: "memory",
+		Factory: func(cfg *config.StorageConfig, etcdClient *etcd.Client) (Backend, error) {
+			return NewMemoryBackend()
+		},
+	})
+}
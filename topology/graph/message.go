@@ -42,12 +42,17 @@ const (
 	EdgeUpdatedMsgType        = "EdgeUpdated"
 	EdgeDeletedMsgType        = "EdgeDeleted"
 	EdgeAddedMsgType          = "EdgeAdded"
+	LiveQueryRequestMsgType   = "LiveQueryRequest"
+	LiveQueryReplyMsgType     = "LiveQueryReply"
+	LiveQueryStopMsgType      = "LiveQueryStop"
+	LiveQueryEventMsgType     = "LiveQueryEvent"
 )
 
 // Graph error message
 var (
 	ErrSyncRequestMalFormed = errors.New("SyncRequestMsg malformed")
 	ErrSyncMsgMalFormed     = errors.New("SyncMsg/SyncReplyMsg malformed")
+	ErrLiveQueryMalFormed   = errors.New("LiveQueryRequestMsg/LiveQueryStopMsg malformed")
 )
 
 // SyncRequestMsg describes a graph synchro request message
@@ -56,6 +61,27 @@ type SyncRequestMsg struct {
 	GremlinFilter string
 }
 
+// LiveQueryRequestMsg describes the registration of a live query, the
+// result deltas being sent with the given ID
+type LiveQueryRequestMsg struct {
+	ID           string
+	GremlinQuery string
+}
+
+// LiveQueryStopMsg describes the unregistration of a live query
+type LiveQueryStopMsg struct {
+	ID string
+}
+
+// LiveQueryMsg describes the initial result of a live query or its changes
+type LiveQueryMsg struct {
+	ID      string
+	Values  []interface{} `json:",omitempty"`
+	Added   []interface{} `json:",omitempty"`
+	Removed []interface{} `json:",omitempty"`
+	Updated []interface{} `json:",omitempty"`
+}
+
 // SyncMsg describes graph syncho message
 type SyncMsg struct {
 	Nodes []*Node
@@ -135,6 +161,27 @@ func UnmarshalMessage(msg *ws.StructMessage) (string, interface{}, error) {
 		}
 
 		return msg.Type, result, nil
+	case LiveQueryRequestMsgType, LiveQueryStopMsgType:
+		m, ok := obj.(map[string]interface{})
+		if !ok {
+			return "", msg, ErrLiveQueryMalFormed
+		}
+
+		id, _ := m["ID"].(string)
+		if id == "" {
+			return "", msg, ErrLiveQueryMalFormed
+		}
+
+		if msg.Type == LiveQueryStopMsgType {
+			return msg.Type, LiveQueryStopMsg{ID: id}, nil
+		}
+
+		gremlinQuery, _ := m["GremlinQuery"].(string)
+		if gremlinQuery == "" {
+			return "", msg, ErrLiveQueryMalFormed
+		}
+
+		return msg.Type, LiveQueryRequestMsg{ID: id, GremlinQuery: gremlinQuery}, nil
 	case OriginGraphDeletedMsgType:
 		return msg.Type, obj, nil
 	case NodeUpdatedMsgType, NodeDeletedMsgType, NodeAddedMsgType:
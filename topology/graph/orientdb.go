@@ -30,6 +30,7 @@ import (
 
 	"github.com/skydive-project/skydive/common"
 	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/etcd"
 	"github.com/skydive-project/skydive/filters"
 	"github.com/skydive-project/skydive/logging"
 	"github.com/skydive-project/skydive/storage/orientdb"
@@ -409,3 +410,13 @@ func NewOrientDBBackendFromConfig(backend string) (*OrientDBBackend, error) {
 	password := config.GetString(path + ".password")
 	return NewOrientDBBackend(addr, database, username, password)
 }
+
+func init() {
+	RegisterBackendDriver(&BackendDriver{
+		Name: "orientdb",
+		Factory: func(cfg *config.StorageConfig, etcdClient *etcd.Client) (Backend, error) {
+			return NewOrientDBBackendFromConfig(cfg.Name)
+		},
+		Options: orientdb.StorageOptions,
+	})
+}
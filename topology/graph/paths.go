@@ -0,0 +1,404 @@
+/*
+ * Copyright (C) 2018 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package graph
+
+import (
+	"container/heap"
+	"sort"
+	"strings"
+
+	"github.com/skydive-project/skydive/common"
+)
+
+// hop describes a neighbor of a node and the weight of the edge to reach it
+type hop struct {
+	node   *Node
+	weight float64
+}
+
+// hopQueue is a priority queue of nodes ordered by weight, the weight
+// being the distance from the source node
+type hopQueue []hop
+
+func (q hopQueue) Len() int            { return len(q) }
+func (q hopQueue) Less(i, j int) bool  { return q[i].weight < q[j].weight }
+func (q hopQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *hopQueue) Push(x interface{}) { *q = append(*q, x.(hop)) }
+func (q *hopQueue) Pop() interface{} {
+	old := *q
+	h := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return h
+}
+
+// weightedPath is a path with the distance from its first node of each node
+type weightedPath struct {
+	nodes     []*Node
+	distances []float64
+}
+
+func (p *weightedPath) cost() float64 {
+	return p.distances[len(p.distances)-1]
+}
+
+func (p *weightedPath) key() string {
+	ids := make([]string, len(p.nodes))
+	for i, n := range p.nodes {
+		ids[i] = string(n.ID)
+	}
+	return strings.Join(ids, ",")
+}
+
+// PathWeight describes the edge field giving the cost of walking through
+// an edge when looking for paths. The cost is the value of the field, or
+// its inverse for fields like the speed of a link where the highest value
+// is the best one.
+type PathWeight struct {
+	Key     string
+	Inverse bool
+}
+
+// PathCheck is called during a path search with the number of nodes of the
+// paths found so far. The search stops if it returns an error.
+type PathCheck func(size int) error
+
+// pathFinder searches for the paths between a node and the nodes matching
+// a metadata filter. Edges are walked in both directions.
+type pathFinder struct {
+	graph  *Graph
+	target ElementMatcher
+	edges  ElementMatcher
+	weight PathWeight
+	hops   map[Identifier][]hop
+	check  PathCheck
+	size   int
+}
+
+func newPathFinder(g *Graph, m ElementMatcher, em ElementMatcher, weight PathWeight, check PathCheck) *pathFinder {
+	return &pathFinder{
+		graph:  g,
+		target: m,
+		edges:  em,
+		weight: weight,
+		hops:   make(map[Identifier][]hop),
+		check:  check,
+	}
+}
+
+// checkSearch returns the error of the check callback if any
+func (f *pathFinder) checkSearch() error {
+	if f.check == nil {
+		return nil
+	}
+	return f.check(f.size)
+}
+
+// found accounts for a path found by the search
+func (f *pathFinder) found(p *weightedPath) error {
+	f.size += len(p.nodes)
+	return f.checkSearch()
+}
+
+// edgeWeight returns the value of the weight key of the edge, or its
+// inverse, 1 if there is no weight key or if the edge has no positive
+// value for it
+func (f *pathFinder) edgeWeight(e *Edge) float64 {
+	if f.weight.Key == "" {
+		return 1
+	}
+
+	value, err := e.GetField(f.weight.Key)
+	if err != nil {
+		return 1
+	}
+
+	weight, err := common.ToFloat64(value)
+	if err != nil || weight <= 0 {
+		return 1
+	}
+
+	if f.weight.Inverse {
+		return 1 / weight
+	}
+	return weight
+}
+
+// neighbors returns the neighbors of a node, keeping the lightest edge when
+// several edges link the same nodes
+func (f *pathFinder) neighbors(n *Node) []hop {
+	if hops, ok := f.hops[n.ID]; ok {
+		return hops
+	}
+
+	var hops []hop
+	index := make(map[Identifier]int)
+	for _, e := range f.graph.backend.GetNodeEdges(n, f.graph.context, f.edges) {
+		weight := f.edgeWeight(e)
+
+		parents, children := f.graph.backend.GetEdgeNodes(e, f.graph.context, nil, nil)
+		for _, nodes := range [][]*Node{parents, children} {
+			for _, neighbor := range nodes {
+				if neighbor.ID == n.ID {
+					continue
+				}
+				if i, ok := index[neighbor.ID]; ok {
+					if weight < hops[i].weight {
+						hops[i].weight = weight
+					}
+					continue
+				}
+				index[neighbor.ID] = len(hops)
+				hops = append(hops, hop{node: neighbor, weight: weight})
+			}
+		}
+	}
+	f.hops[n.ID] = hops
+
+	return hops
+}
+
+// shortest returns the lightest path from a node to the closest target
+// without walking through the excluded nodes nor the excluded hops
+func (f *pathFinder) shortest(from *Node, excludedNodes map[Identifier]bool, excludedHops map[[2]Identifier]bool) *weightedPath {
+	distance := map[Identifier]float64{from.ID: 0}
+	previous := make(map[Identifier]*Node)
+	done := make(map[Identifier]bool)
+
+	queue := &hopQueue{{node: from}}
+	for queue.Len() > 0 {
+		h := heap.Pop(queue).(hop)
+		if done[h.node.ID] {
+			continue
+		}
+		done[h.node.ID] = true
+
+		if h.node.MatchMetadata(f.target) {
+			path := &weightedPath{}
+			for n := h.node; n != nil; n = previous[n.ID] {
+				path.nodes = append([]*Node{n}, path.nodes...)
+				path.distances = append([]float64{distance[n.ID]}, path.distances...)
+			}
+			return path
+		}
+
+		for _, next := range f.neighbors(h.node) {
+			id := next.node.ID
+			if done[id] || excludedNodes[id] || excludedHops[[2]Identifier{h.node.ID, id}] {
+				continue
+			}
+
+			d := h.weight + next.weight
+			if current, ok := distance[id]; !ok || d < current {
+				distance[id] = d
+				previous[id] = h.node
+				heap.Push(queue, hop{node: next.node, weight: d})
+			}
+		}
+	}
+
+	return nil
+}
+
+// kShortest returns the k lightest loopless paths using the Yen algorithm
+func (f *pathFinder) kShortest(from *Node, k int) ([]*weightedPath, error) {
+	first := f.shortest(from, nil, nil)
+	if first == nil {
+		return nil, nil
+	}
+	if err := f.found(first); err != nil {
+		return nil, err
+	}
+
+	paths := []*weightedPath{first}
+	seen := map[string]bool{first.key(): true}
+	var candidates []*weightedPath
+
+	for len(paths) < k {
+		last := paths[len(paths)-1]
+
+		// deviate from the last path at each of its nodes
+		for i := 0; i < len(last.nodes)-1; i++ {
+			if err := f.checkSearch(); err != nil {
+				return nil, err
+			}
+
+			spur, root := last.nodes[i], last.nodes[:i+1]
+
+			excludedHops := make(map[[2]Identifier]bool)
+			for _, p := range paths {
+				if len(p.nodes) > i+1 && sameNodes(p.nodes[:i+1], root) {
+					excludedHops[[2]Identifier{spur.ID, p.nodes[i+1].ID}] = true
+				}
+			}
+
+			excludedNodes := make(map[Identifier]bool)
+			for _, n := range root[:i] {
+				excludedNodes[n.ID] = true
+			}
+
+			spurPath := f.shortest(spur, excludedNodes, excludedHops)
+			if spurPath == nil {
+				continue
+			}
+
+			path := &weightedPath{
+				nodes:     append(append([]*Node{}, root[:i]...), spurPath.nodes...),
+				distances: append([]float64{}, last.distances[:i]...),
+			}
+			for _, d := range spurPath.distances {
+				path.distances = append(path.distances, last.distances[i]+d)
+			}
+
+			if key := path.key(); !seen[key] {
+				seen[key] = true
+				candidates = append(candidates, path)
+			}
+		}
+
+		if len(candidates) == 0 {
+			break
+		}
+
+		best := 0
+		for i, c := range candidates {
+			if lighterPath(c, candidates[best]) {
+				best = i
+			}
+		}
+		if err := f.found(candidates[best]); err != nil {
+			return nil, err
+		}
+		paths = append(paths, candidates[best])
+		candidates = append(candidates[:best], candidates[best+1:]...)
+	}
+
+	return paths, nil
+}
+
+// all returns all the loopless paths of at most maxLength edges, 0 meaning
+// no limit, from the lightest to the heaviest. A path ends at the first
+// target reached.
+func (f *pathFinder) all(from *Node, maxLength int) ([]*weightedPath, error) {
+	var paths []*weightedPath
+
+	visited := map[Identifier]bool{from.ID: true}
+	current := &weightedPath{nodes: []*Node{from}, distances: []float64{0}}
+
+	var walk func(n *Node) error
+	walk = func(n *Node) error {
+		if n.MatchMetadata(f.target) {
+			path := &weightedPath{
+				nodes:     append([]*Node{}, current.nodes...),
+				distances: append([]float64{}, current.distances...),
+			}
+			paths = append(paths, path)
+			return f.found(path)
+		}
+
+		if maxLength > 0 && len(current.nodes) > maxLength {
+			return nil
+		}
+
+		if err := f.checkSearch(); err != nil {
+			return err
+		}
+
+		for _, next := range f.neighbors(n) {
+			if visited[next.node.ID] {
+				continue
+			}
+
+			visited[next.node.ID] = true
+			current.nodes = append(current.nodes, next.node)
+			current.distances = append(current.distances, current.cost()+next.weight)
+
+			err := walk(next.node)
+
+			current.nodes = current.nodes[:len(current.nodes)-1]
+			current.distances = current.distances[:len(current.distances)-1]
+			delete(visited, next.node.ID)
+
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(from); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(paths, func(i, j int) bool {
+		return lighterPath(paths[i], paths[j])
+	})
+
+	return paths, nil
+}
+
+func lighterPath(p1, p2 *weightedPath) bool {
+	if p1.cost() != p2.cost() {
+		return p1.cost() < p2.cost()
+	}
+	return len(p1.nodes) < len(p2.nodes)
+}
+
+func sameNodes(n1, n2 []*Node) bool {
+	if len(n1) != len(n2) {
+		return false
+	}
+	for i := range n1 {
+		if n1[i].ID != n2[i].ID {
+			return false
+		}
+	}
+	return true
+}
+
+func pathsNodes(paths []*weightedPath, err error) ([][]*Node, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make([][]*Node, len(paths))
+	for i, p := range paths {
+		nodes[i] = p.nodes
+	}
+	return nodes, nil
+}
+
+// LookupKShortestPaths returns the k lightest loopless paths between the
+// node and the nodes matching the metadata, walking through the edges
+// matching the edge metadata. The weight of an edge is computed from its
+// weight key field, 1 if not defined. The search is aborted with the error
+// returned by the optional check callback.
+func (g *Graph) LookupKShortestPaths(n *Node, m ElementMatcher, em ElementMatcher, k int, weight PathWeight, check PathCheck) ([][]*Node, error) {
+	return pathsNodes(newPathFinder(g, m, em, weight, check).kShortest(n, k))
+}
+
+// LookupAllPaths returns all the loopless paths of at most maxLength edges
+// between the node and the nodes matching the metadata, from the lightest
+// to the heaviest according to the weight of the edges. The search is
+// aborted with the error returned by the optional check callback.
+func (g *Graph) LookupAllPaths(n *Node, m ElementMatcher, em ElementMatcher, maxLength int, weight PathWeight, check PathCheck) ([][]*Node, error) {
+	return pathsNodes(newPathFinder(g, m, em, weight, check).all(n, maxLength))
+}
@@ -32,6 +32,7 @@ import (
 
 	"github.com/mitchellh/hashstructure"
 	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
 	"github.com/skydive-project/skydive/filters"
 	"github.com/skydive-project/skydive/topology/graph"
 )
@@ -47,6 +48,54 @@ type GraphTraversalStep interface {
 	Error() error
 }
 
+// SubTraversal describes a traversal starting at the elements of a step,
+// as used by the Where, Not, And and Or steps
+type SubTraversal func(start GraphTraversalStep) (GraphTraversalStep, error)
+
+// matches returns whether the sub traversal returns at least one value
+func (st SubTraversal) matches(start GraphTraversalStep) (bool, error) {
+	step, err := st(start)
+	if err != nil {
+		return false, err
+	}
+	if step == nil {
+		return false, nil
+	}
+	if err := step.Error(); err != nil {
+		return false, err
+	}
+	return len(step.Values()) > 0, nil
+}
+
+func notMatcher(st SubTraversal) func(start GraphTraversalStep) (bool, error) {
+	return func(start GraphTraversalStep) (bool, error) {
+		ok, err := st.matches(start)
+		return !ok, err
+	}
+}
+
+func andMatcher(sts []SubTraversal) func(start GraphTraversalStep) (bool, error) {
+	return func(start GraphTraversalStep) (bool, error) {
+		for _, st := range sts {
+			if ok, err := st.matches(start); err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+}
+
+func orMatcher(sts []SubTraversal) func(start GraphTraversalStep) (bool, error) {
+	return func(start GraphTraversalStep) (bool, error) {
+		for _, st := range sts {
+			if ok, err := st.matches(start); err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+	}
+}
+
 // StepContext a step within a context
 type StepContext struct {
 	PaginationRange *GraphTraversalRange
@@ -65,16 +114,19 @@ type GraphTraversalRange [2]int64
 
 // GraphTraversal describes multiple step within a graph
 type GraphTraversal struct {
-	Graph     *graph.Graph
-	error     error
-	lockGraph bool
-	as        map[string]*GraphTraversalAs
+	Graph      *graph.Graph
+	error      error
+	lockGraph  bool
+	trackPaths bool
+	as         map[string]*GraphTraversalAs
+	query      *queryState
 }
 
 // GraphTraversalV traversal steps on nodes
 type GraphTraversalV struct {
 	GraphTraversal *GraphTraversal
 	nodes          []*graph.Node
+	paths          []graphPath
 	error          error
 }
 
@@ -82,6 +134,7 @@ type GraphTraversalV struct {
 type GraphTraversalE struct {
 	GraphTraversal *GraphTraversal
 	edges          []*graph.Edge
+	paths          []graphPath
 	error          error
 }
 
@@ -103,6 +156,7 @@ type GraphTraversalValue struct {
 type GraphTraversalAs struct {
 	GraphTraversal *GraphTraversal
 	nodes          []*graph.Node
+	paths          []graphPath
 }
 
 // KeyValueToFilter creates a filter for a key with a fixed value or a predicate
@@ -414,6 +468,18 @@ type Since struct {
 	Seconds int64
 }
 
+// EdgeWeight describes the edge metadata key giving the cost of walking
+// through an edge when looking for paths
+type EdgeWeight struct {
+	weight graph.PathWeight
+}
+
+// Weight predicate, inverse making the cost the inverse of the metadata
+// value, for keys like the speed of a link where the highest is the best
+func Weight(key string, inverse bool) *EdgeWeight {
+	return &EdgeWeight{weight: graph.PathWeight{Key: key, Inverse: inverse}}
+}
+
 // NewGraphTraversal creates a new graph traversal
 func NewGraphTraversal(g *graph.Graph, lockGraph bool) *GraphTraversal {
 	return &GraphTraversal{
@@ -507,7 +573,14 @@ func (t *GraphTraversal) Context(s ...interface{}) *GraphTraversal {
 		return &GraphTraversal{error: err}
 	}
 
-	return &GraphTraversal{Graph: g}
+	return &GraphTraversal{Graph: g, trackPaths: t.trackPaths, query: t.query}
+}
+
+// TrackPaths enables the recording of the nodes and edges walked by
+// each traverser, as returned by the Path step
+func (t *GraphTraversal) TrackPaths() *GraphTraversal {
+	t.trackPaths = true
+	return t
 }
 
 // V step : [node ID]
@@ -556,7 +629,7 @@ func (t *GraphTraversal) V(ctx StepContext, s ...interface{}) *GraphTraversalV {
 		nodes = nodeRange
 	}
 
-	return &GraphTraversalV{GraphTraversal: t, nodes: nodes}
+	return NewGraphTraversalV(t, nodes)
 }
 
 // NewGraphTraversalV returns a new traversal step
@@ -566,6 +639,13 @@ func NewGraphTraversalV(gt *GraphTraversal, nodes []*graph.Node, err ...error) *
 		nodes:          nodes,
 	}
 
+	if gt != nil && gt.trackPaths {
+		tv.paths = make([]graphPath, len(nodes))
+		for i, n := range nodes {
+			tv.paths[i] = graphPath{n}
+		}
+	}
+
 	if len(err) > 0 {
 		tv.error = err[0]
 	}
@@ -573,6 +653,51 @@ func NewGraphTraversalV(gt *GraphTraversal, nodes []*graph.Node, err ...error) *
 	return tv
 }
 
+// newStepV returns an empty step on nodes, tracking the paths if the
+// given step does
+func (tv *GraphTraversalV) newStepV() *GraphTraversalV {
+	ntv := &GraphTraversalV{GraphTraversal: tv.GraphTraversal, nodes: []*graph.Node{}}
+	if tv.paths != nil {
+		ntv.paths = []graphPath{}
+	}
+	return ntv
+}
+
+// newStepE returns an empty step on edges, tracking the paths if the
+// given step does
+func (tv *GraphTraversalV) newStepE() *GraphTraversalE {
+	nte := &GraphTraversalE{GraphTraversal: tv.GraphTraversal, edges: []*graph.Edge{}}
+	if tv.paths != nil {
+		nte.paths = []graphPath{}
+	}
+	return nte
+}
+
+// path returns the path of the i-th node, nil if the paths are not tracked
+func (tv *GraphTraversalV) path(i int) graphPath {
+	if tv.paths == nil {
+		return nil
+	}
+	return tv.paths[i]
+}
+
+// at returns a step made of the i-th node only, keeping its path
+func (tv *GraphTraversalV) at(i int) *GraphTraversalV {
+	ntv := &GraphTraversalV{GraphTraversal: tv.GraphTraversal, nodes: []*graph.Node{tv.nodes[i]}}
+	if tv.paths != nil {
+		ntv.paths = []graphPath{tv.paths[i]}
+	}
+	return ntv
+}
+
+// add appends a node with the path that lead to it
+func (tv *GraphTraversalV) add(n *graph.Node, p graphPath) {
+	tv.nodes = append(tv.nodes, n)
+	if tv.paths != nil {
+		tv.paths = append(tv.paths, p)
+	}
+}
+
 func (tv *GraphTraversalV) Error() error {
 	return tv.error
 }
@@ -707,7 +832,7 @@ func (tv *GraphTraversalV) As(ctx StepContext, keys ...interface{}) *GraphTraver
 		return &GraphTraversalV{error: errors.New("As parameter have to be a string key")}
 	}
 
-	tv.GraphTraversal.as[key] = &GraphTraversalAs{nodes: tv.nodes}
+	tv.GraphTraversal.as[key] = &GraphTraversalAs{nodes: tv.nodes, paths: tv.paths}
 
 	return tv
 }
@@ -736,6 +861,14 @@ func (tv *GraphTraversalV) Select(ctx StepContext, keys ...interface{}) *GraphTr
 		}
 
 		ntv.nodes = append(ntv.nodes, as.nodes...)
+		if as.paths != nil {
+			ntv.paths = append(ntv.paths, as.paths...)
+		}
+	}
+
+	// paths are only consistent if all the selected steps tracked them
+	if len(ntv.paths) != len(ntv.nodes) {
+		ntv.paths = nil
 	}
 
 	return ntv
@@ -787,7 +920,7 @@ func (t *GraphTraversal) E(ctx StepContext, s ...interface{}) *GraphTraversalE {
 		edges = edgeRange
 	}
 
-	return &GraphTraversalE{GraphTraversal: t, edges: edges}
+	return NewGraphTraversalE(t, edges)
 }
 
 // NewGraphTraversalE creates a new graph traversal Edges
@@ -797,6 +930,13 @@ func NewGraphTraversalE(gt *GraphTraversal, edges []*graph.Edge, err ...error) *
 		edges:          edges,
 	}
 
+	if gt != nil && gt.trackPaths {
+		te.paths = make([]graphPath, len(edges))
+		for i, e := range edges {
+			te.paths[i] = graphPath{e}
+		}
+	}
+
 	if len(err) > 0 {
 		te.error = err[0]
 	}
@@ -804,6 +944,42 @@ func NewGraphTraversalE(gt *GraphTraversal, edges []*graph.Edge, err ...error) *
 	return te
 }
 
+// newStepV returns an empty step on nodes, tracking the paths if the
+// given step does
+func (te *GraphTraversalE) newStepV() *GraphTraversalV {
+	ntv := &GraphTraversalV{GraphTraversal: te.GraphTraversal, nodes: []*graph.Node{}}
+	if te.paths != nil {
+		ntv.paths = []graphPath{}
+	}
+	return ntv
+}
+
+// newStepE returns an empty step on edges, tracking the paths if the
+// given step does
+func (te *GraphTraversalE) newStepE() *GraphTraversalE {
+	nte := &GraphTraversalE{GraphTraversal: te.GraphTraversal, edges: []*graph.Edge{}}
+	if te.paths != nil {
+		nte.paths = []graphPath{}
+	}
+	return nte
+}
+
+// path returns the path of the i-th edge, nil if the paths are not tracked
+func (te *GraphTraversalE) path(i int) graphPath {
+	if te.paths == nil {
+		return nil
+	}
+	return te.paths[i]
+}
+
+// add appends an edge with the path that lead to it
+func (te *GraphTraversalE) add(e *graph.Edge, p graphPath) {
+	te.edges = append(te.edges, e)
+	if te.paths != nil {
+		te.paths = append(te.paths, p)
+	}
+}
+
 func (te *GraphTraversalE) Error() error {
 	return te.error
 }
@@ -869,8 +1045,23 @@ func (tv *GraphTraversalV) Sort(ctx StepContext, keys ...interface{}) *GraphTrav
 		sortBy = defaultSortBy
 	}
 
+	if tv.paths == nil {
+		graph.SortNodes(tv.nodes, sortBy, sortOrder)
+		return tv
+	}
+
+	// the same node can be reached through several paths
+	paths := make(map[*graph.Node][]graphPath)
+	for i, n := range tv.nodes {
+		paths[n] = append(paths[n], tv.paths[i])
+	}
+
 	graph.SortNodes(tv.nodes, sortBy, sortOrder)
 
+	for i, n := range tv.nodes {
+		tv.paths[i], paths[n] = paths[n][0], paths[n][1:]
+	}
+
 	return tv
 }
 
@@ -891,7 +1082,7 @@ func (tv *GraphTraversalV) Dedup(ctx StepContext, s ...interface{}) *GraphTraver
 		}
 	}
 
-	ntv := &GraphTraversalV{GraphTraversal: tv.GraphTraversal, nodes: []*graph.Node{}}
+	ntv := tv.newStepV()
 	it := ctx.PaginationRange.Iterator()
 
 	visited := make(map[interface{}]bool)
@@ -902,7 +1093,7 @@ func (tv *GraphTraversalV) Dedup(ctx StepContext, s ...interface{}) *GraphTraver
 	defer tv.GraphTraversal.RUnlock()
 
 nodeLoop:
-	for _, n := range tv.nodes {
+	for i, n := range tv.nodes {
 		if it.Done() {
 			break
 		}
@@ -931,7 +1122,7 @@ nodeLoop:
 			continue
 		}
 
-		ntv.nodes = append(ntv.nodes, n)
+		ntv.add(n, tv.path(i))
 		if !skip {
 			visited[kvisited] = true
 		}
@@ -973,12 +1164,17 @@ func (sp *GraphTraversalShortestPath) GetNodes() []*graph.Node {
 	return nodes
 }
 
-// ShortestPathTo step
-func (tv *GraphTraversalV) ShortestPathTo(ctx StepContext, m graph.Metadata, e graph.Metadata) *GraphTraversalShortestPath {
+// ShortestPathTo step, the optional weight describing the edge metadata key
+// giving the cost of walking through an edge
+func (tv *GraphTraversalV) ShortestPathTo(ctx StepContext, m graph.Metadata, e graph.Metadata, weight ...graph.PathWeight) *GraphTraversalShortestPath {
 	if tv.error != nil {
 		return &GraphTraversalShortestPath{error: tv.error}
 	}
 
+	if len(weight) > 0 && weight[0].Key != "" {
+		return tv.KShortestPathsTo(ctx, 1, m, e, weight[0])
+	}
+
 	sp := &GraphTraversalShortestPath{GraphTraversal: tv.GraphTraversal, paths: [][]*graph.Node{}}
 
 	tv.GraphTraversal.RLock()
@@ -986,6 +1182,10 @@ func (tv *GraphTraversalV) ShortestPathTo(ctx StepContext, m graph.Metadata, e g
 
 	visited := make(map[graph.Identifier]bool)
 	for _, n := range tv.nodes {
+		if err := tv.GraphTraversal.checkQuery(); err != nil {
+			return &GraphTraversalShortestPath{error: err}
+		}
+
 		if _, ok := visited[n.ID]; !ok {
 			path := tv.GraphTraversal.Graph.LookupShortestPath(n, m, e)
 			if len(path) > 0 {
@@ -996,6 +1196,66 @@ func (tv *GraphTraversalV) ShortestPathTo(ctx StepContext, m graph.Metadata, e g
 	return sp
 }
 
+// KShortestPathsTo step returns for each node the k lightest paths to the
+// nodes matching m, walking through the edges matching e. The weight of an
+// edge is the value of its weight metadata key, or its inverse, 1 if not
+// defined.
+func (tv *GraphTraversalV) KShortestPathsTo(ctx StepContext, k int64, m graph.Metadata, e graph.Metadata, weight graph.PathWeight) *GraphTraversalShortestPath {
+	if tv.error != nil {
+		return &GraphTraversalShortestPath{error: tv.error}
+	}
+
+	if k <= 0 {
+		return &GraphTraversalShortestPath{error: errors.New("KShortestPathsTo requires a positive number of paths")}
+	}
+
+	sp := &GraphTraversalShortestPath{GraphTraversal: tv.GraphTraversal, paths: [][]*graph.Node{}}
+
+	tv.GraphTraversal.RLock()
+	defer tv.GraphTraversal.RUnlock()
+
+	for _, n := range tv.nodes {
+		if err := tv.GraphTraversal.checkQuery(); err != nil {
+			return &GraphTraversalShortestPath{error: err}
+		}
+
+		paths, err := tv.GraphTraversal.Graph.LookupKShortestPaths(n, m, e, int(k), weight, tv.GraphTraversal.pathCheck(stepSize(sp)))
+		if err != nil {
+			return &GraphTraversalShortestPath{error: err}
+		}
+		sp.paths = append(sp.paths, paths...)
+	}
+	return sp
+}
+
+// AllPathsTo step returns for each node all the loopless paths to the nodes
+// matching m, walking through the edges matching e, from the lightest to the
+// heaviest. The length of the paths is limited by gremlin.max_path_length.
+func (tv *GraphTraversalV) AllPathsTo(ctx StepContext, m graph.Metadata, e graph.Metadata, weight graph.PathWeight) *GraphTraversalShortestPath {
+	if tv.error != nil {
+		return &GraphTraversalShortestPath{error: tv.error}
+	}
+
+	sp := &GraphTraversalShortestPath{GraphTraversal: tv.GraphTraversal, paths: [][]*graph.Node{}}
+	maxLength := config.GetInt("gremlin.max_path_length")
+
+	tv.GraphTraversal.RLock()
+	defer tv.GraphTraversal.RUnlock()
+
+	for _, n := range tv.nodes {
+		if err := tv.GraphTraversal.checkQuery(); err != nil {
+			return &GraphTraversalShortestPath{error: err}
+		}
+
+		paths, err := tv.GraphTraversal.Graph.LookupAllPaths(n, m, e, maxLength, weight, tv.GraphTraversal.pathCheck(stepSize(sp)))
+		if err != nil {
+			return &GraphTraversalShortestPath{error: err}
+		}
+		sp.paths = append(sp.paths, paths...)
+	}
+	return sp
+}
+
 // has apply either and or or filter
 func (tv *GraphTraversalV) has(filterOp filters.BoolFilterOp, ctx StepContext, s ...interface{}) *GraphTraversalV {
 	if tv.error != nil {
@@ -1020,18 +1280,18 @@ func (tv *GraphTraversalV) has(filterOp filters.BoolFilterOp, ctx StepContext, s
 		}
 	}
 
-	ntv := &GraphTraversalV{GraphTraversal: tv.GraphTraversal, nodes: []*graph.Node{}}
+	ntv := tv.newStepV()
 	it := ctx.PaginationRange.Iterator()
 
 	tv.GraphTraversal.RLock()
 	defer tv.GraphTraversal.RUnlock()
 
-	for _, n := range tv.nodes {
+	for i, n := range tv.nodes {
 		if it.Done() {
 			break
 		}
 		if (filter == nil || filter.Eval(n)) && it.Next() {
-			ntv.nodes = append(ntv.nodes, n)
+			ntv.add(n, tv.path(i))
 		}
 	}
 
@@ -1060,18 +1320,165 @@ func (tv *GraphTraversalV) HasNot(ctx StepContext, s string) *GraphTraversalV {
 	}
 
 	filter := filters.NewNullFilter(s)
-	ntv := &GraphTraversalV{GraphTraversal: tv.GraphTraversal, nodes: []*graph.Node{}}
+	ntv := tv.newStepV()
 	it := ctx.PaginationRange.Iterator()
 
 	tv.GraphTraversal.RLock()
 	defer tv.GraphTraversal.RUnlock()
 
-	for _, n := range tv.nodes {
+	for i, n := range tv.nodes {
 		if it.Done() {
 			break
 		}
 		if (filter == nil || filter.Eval(n)) && it.Next() {
-			ntv.nodes = append(ntv.nodes, n)
+			ntv.add(n, tv.path(i))
+		}
+	}
+
+	return ntv
+}
+
+// filter keeps the nodes for which the matcher, called with a traversal
+// starting at the node, returns true. The graph is not locked while
+// calling the matcher as the sub traversal steps lock it by themselves.
+func (tv *GraphTraversalV) filter(ctx StepContext, matcher func(start GraphTraversalStep) (bool, error)) *GraphTraversalV {
+	if tv.error != nil {
+		return tv
+	}
+
+	ntv := tv.newStepV()
+	it := ctx.PaginationRange.Iterator()
+
+	for i, n := range tv.nodes {
+		if it.Done() {
+			break
+		}
+
+		ok, err := matcher(NewGraphTraversalV(tv.GraphTraversal, []*graph.Node{n}))
+		if err != nil {
+			return &GraphTraversalV{error: err}
+		}
+		if ok && it.Next() {
+			ntv.add(n, tv.path(i))
+		}
+	}
+
+	return ntv
+}
+
+// Where step keeps the nodes for which the sub traversal returns a result
+func (tv *GraphTraversalV) Where(ctx StepContext, st SubTraversal) *GraphTraversalV {
+	return tv.filter(ctx, st.matches)
+}
+
+// Not step keeps the nodes for which the sub traversal returns no result
+func (tv *GraphTraversalV) Not(ctx StepContext, st SubTraversal) *GraphTraversalV {
+	return tv.filter(ctx, notMatcher(st))
+}
+
+// And step keeps the nodes for which all the sub traversals return a result
+func (tv *GraphTraversalV) And(ctx StepContext, sts ...SubTraversal) *GraphTraversalV {
+	return tv.filter(ctx, andMatcher(sts))
+}
+
+// Or step keeps the nodes for which at least one sub traversal returns a result
+func (tv *GraphTraversalV) Or(ctx StepContext, sts ...SubTraversal) *GraphTraversalV {
+	return tv.filter(ctx, orMatcher(sts))
+}
+
+// RepeatOptions describes the modulators of the Repeat step
+type RepeatOptions struct {
+	// Times is the number of iterations, 0 meaning no fixed number
+	Times int64
+	// Until stops the walk at the nodes for which it returns a result
+	Until SubTraversal
+	// Emit returns all the nodes reached instead of the last ones only
+	Emit bool
+}
+
+// Repeat step applies the sub traversal iteratively, starting with the
+// nodes of the step, then with the nodes returned by the previous
+// iteration. A node is never reached twice so that cycles are not followed
+// and the number of iterations is limited by gremlin.max_repeat_depth.
+// Without Times and Until, the nodes where the walk ends are returned.
+func (tv *GraphTraversalV) Repeat(ctx StepContext, st SubTraversal, opts RepeatOptions) *GraphTraversalV {
+	if tv.error != nil {
+		return tv
+	}
+
+	maxDepth := int64(config.GetInt("gremlin.max_repeat_depth"))
+	if maxDepth > 0 && opts.Times > maxDepth {
+		return &GraphTraversalV{error: fmt.Errorf("Repeat is limited to %d iterations", maxDepth)}
+	}
+
+	visited := make(map[graph.Identifier]bool)
+	for _, n := range tv.nodes {
+		visited[n.ID] = true
+	}
+
+	walked := tv.newStepV()
+	frontier := tv
+	for depth := int64(1); len(frontier.nodes) > 0; depth++ {
+		reached := tv.newStepV()
+		for i, n := range frontier.nodes {
+			step, err := st(frontier.at(i))
+			if err == nil && step != nil {
+				err = step.Error()
+			}
+			if err != nil {
+				return &GraphTraversalV{error: err}
+			}
+
+			ntv, ok := step.(*GraphTraversalV)
+			if !ok {
+				return &GraphTraversalV{error: errors.New("Repeat sub traversal has to return nodes")}
+			}
+
+			leaf := true
+			for j, child := range ntv.nodes {
+				if !visited[child.ID] {
+					visited[child.ID] = true
+					reached.add(child, ntv.path(j))
+					leaf = false
+				}
+			}
+
+			// the walk ends here, only returned if not bounded by Times or Until
+			if leaf && depth > 1 && !opts.Emit && opts.Times == 0 && opts.Until == nil {
+				walked.add(n, frontier.path(i))
+			}
+		}
+
+		frontier = tv.newStepV()
+		for i, n := range reached.nodes {
+			if opts.Emit {
+				walked.add(n, reached.path(i))
+			}
+
+			last := depth == opts.Times || depth == maxDepth
+			if !last && opts.Until != nil {
+				ok, err := opts.Until.matches(NewGraphTraversalV(tv.GraphTraversal, []*graph.Node{n}))
+				if err != nil {
+					return &GraphTraversalV{error: err}
+				}
+				last = ok
+			}
+
+			if !last {
+				frontier.add(n, reached.path(i))
+			} else if !opts.Emit {
+				walked.add(n, reached.path(i))
+			}
+		}
+	}
+
+	ntv := tv.newStepV()
+	it := ctx.PaginationRange.Iterator()
+	for i, n := range walked.nodes {
+		if it.Done() {
+			break
+		} else if it.Next() {
+			ntv.add(n, walked.path(i))
 		}
 	}
 
@@ -1089,14 +1496,14 @@ func (tv *GraphTraversalV) Both(ctx StepContext, s ...interface{}) *GraphTravers
 		return &GraphTraversalV{error: err}
 	}
 
-	ntv := &GraphTraversalV{GraphTraversal: tv.GraphTraversal, nodes: []*graph.Node{}}
+	ntv := tv.newStepV()
 	it := ctx.PaginationRange.Iterator()
 
 	tv.GraphTraversal.RLock()
 	defer tv.GraphTraversal.RUnlock()
 
 nodeloop:
-	for _, n := range tv.nodes {
+	for i, n := range tv.nodes {
 		for _, e := range tv.GraphTraversal.Graph.GetNodeEdges(n, nil) {
 			var nodes []*graph.Node
 			if e.GetChild() == n.ID {
@@ -1109,7 +1516,7 @@ nodeloop:
 				if it.Done() {
 					break nodeloop
 				} else if it.Next() {
-					ntv.nodes = append(ntv.nodes, node)
+					ntv.add(node, tv.path(i).extend(node))
 				}
 			}
 		}
@@ -1145,11 +1552,14 @@ func (tv *GraphTraversalV) Range(ctx StepContext, s ...interface{}) *GraphTraver
 		if !ok {
 			return &GraphTraversalV{error: fmt.Errorf("%s is not an integer", s[1])}
 		}
-		var nodes []*graph.Node
+		ntv := &GraphTraversalV{GraphTraversal: tv.GraphTraversal}
+		if tv.paths != nil {
+			ntv.paths = []graphPath{}
+		}
 		for ; from < int64(len(tv.nodes)) && from < to; from++ {
-			nodes = append(nodes, tv.nodes[from])
+			ntv.add(tv.nodes[from], tv.path(int(from)))
 		}
-		return &GraphTraversalV{GraphTraversal: tv.GraphTraversal, nodes: nodes}
+		return ntv
 	}
 
 	return &GraphTraversalV{error: errors.New("2 parameters must be provided to 'range'")}
@@ -1171,19 +1581,19 @@ func (tv *GraphTraversalV) Out(ctx StepContext, s ...interface{}) *GraphTraversa
 		return &GraphTraversalV{error: err}
 	}
 
-	ntv := &GraphTraversalV{GraphTraversal: tv.GraphTraversal, nodes: []*graph.Node{}}
+	ntv := tv.newStepV()
 	it := ctx.PaginationRange.Iterator()
 
 	tv.GraphTraversal.RLock()
 	defer tv.GraphTraversal.RUnlock()
 
 nodeloop:
-	for _, n := range tv.nodes {
+	for i, n := range tv.nodes {
 		for _, child := range tv.GraphTraversal.Graph.LookupChildren(n, metadata, nil) {
 			if it.Done() {
 				break nodeloop
 			} else if it.Next() {
-				ntv.nodes = append(ntv.nodes, child)
+				ntv.add(child, tv.path(i).extend(child))
 			}
 		}
 	}
@@ -1202,20 +1612,20 @@ func (tv *GraphTraversalV) OutE(ctx StepContext, s ...interface{}) *GraphTravers
 		return &GraphTraversalE{error: err}
 	}
 
-	nte := &GraphTraversalE{GraphTraversal: tv.GraphTraversal, edges: []*graph.Edge{}}
+	nte := tv.newStepE()
 	it := ctx.PaginationRange.Iterator()
 
 	tv.GraphTraversal.RLock()
 	defer tv.GraphTraversal.RUnlock()
 
 nodeloop:
-	for _, n := range tv.nodes {
+	for i, n := range tv.nodes {
 		for _, e := range tv.GraphTraversal.Graph.GetNodeEdges(n, metadata) {
 			if e.GetParent() == n.ID {
 				if it.Done() {
 					break nodeloop
 				} else if it.Next() {
-					nte.edges = append(nte.edges, e)
+					nte.add(e, tv.path(i).extend(e))
 				}
 			}
 		}
@@ -1235,19 +1645,19 @@ func (tv *GraphTraversalV) BothE(ctx StepContext, s ...interface{}) *GraphTraver
 		return &GraphTraversalE{GraphTraversal: tv.GraphTraversal, error: err}
 	}
 
-	nte := &GraphTraversalE{GraphTraversal: tv.GraphTraversal, edges: []*graph.Edge{}}
+	nte := tv.newStepE()
 	it := ctx.PaginationRange.Iterator()
 
 	tv.GraphTraversal.RLock()
 	defer tv.GraphTraversal.RUnlock()
 
 nodeloop:
-	for _, n := range tv.nodes {
+	for i, n := range tv.nodes {
 		for _, e := range tv.GraphTraversal.Graph.GetNodeEdges(n, metadata) {
 			if it.Done() {
 				break nodeloop
 			} else if it.Next() {
-				nte.edges = append(nte.edges, e)
+				nte.add(e, tv.path(i).extend(e))
 			}
 		}
 	}
@@ -1266,19 +1676,19 @@ func (tv *GraphTraversalV) In(ctx StepContext, s ...interface{}) *GraphTraversal
 		return &GraphTraversalV{error: err}
 	}
 
-	ntv := &GraphTraversalV{GraphTraversal: tv.GraphTraversal, nodes: []*graph.Node{}}
+	ntv := tv.newStepV()
 	it := ctx.PaginationRange.Iterator()
 
 	tv.GraphTraversal.RLock()
 	defer tv.GraphTraversal.RUnlock()
 
 nodeloop:
-	for _, n := range tv.nodes {
+	for i, n := range tv.nodes {
 		for _, parent := range tv.GraphTraversal.Graph.LookupParents(n, metadata, nil) {
 			if it.Done() {
 				break nodeloop
 			} else if it.Next() {
-				ntv.nodes = append(ntv.nodes, parent)
+				ntv.add(parent, tv.path(i).extend(parent))
 			}
 		}
 	}
@@ -1297,20 +1707,20 @@ func (tv *GraphTraversalV) InE(ctx StepContext, s ...interface{}) *GraphTraversa
 		return &GraphTraversalE{GraphTraversal: tv.GraphTraversal, error: err}
 	}
 
-	nte := &GraphTraversalE{GraphTraversal: tv.GraphTraversal, edges: []*graph.Edge{}}
+	nte := tv.newStepE()
 	it := ctx.PaginationRange.Iterator()
 
 	tv.GraphTraversal.RLock()
 	defer tv.GraphTraversal.RUnlock()
 
 nodeloop:
-	for _, n := range tv.nodes {
+	for i, n := range tv.nodes {
 		for _, e := range tv.GraphTraversal.Graph.GetNodeEdges(n, metadata) {
 			if e.GetChild() == n.ID {
 				if it.Done() {
 					break nodeloop
 				} else if it.Next() {
-					nte.edges = append(nte.edges, e)
+					nte.add(e, tv.path(i).extend(e))
 				}
 			}
 		}
@@ -1351,7 +1761,9 @@ func (tv *GraphTraversalV) SubGraph(ctx StepContext, s ...interface{}) *GraphTra
 
 	ng := graph.NewGraph(tv.GraphTraversal.Graph.GetHost(), memory, common.UnknownService)
 
-	return NewGraphTraversal(ng, tv.GraphTraversal.lockGraph)
+	gt := NewGraphTraversal(ng, tv.GraphTraversal.lockGraph)
+	gt.query = tv.GraphTraversal.query
+	return gt
 }
 
 // SubGraph step, node/edge out
@@ -1387,7 +1799,9 @@ func (sp *GraphTraversalShortestPath) SubGraph(ctx StepContext, s ...interface{}
 
 	ng := graph.NewGraph(sp.GraphTraversal.Graph.GetHost(), memory, common.UnknownService)
 
-	return NewGraphTraversal(ng, sp.GraphTraversal.lockGraph)
+	gt := NewGraphTraversal(ng, sp.GraphTraversal.lockGraph)
+	gt.query = sp.GraphTraversal.query
+	return gt
 }
 
 // Count step
@@ -1415,11 +1829,14 @@ func (te *GraphTraversalE) Range(ctx StepContext, s ...interface{}) *GraphTraver
 		if !ok {
 			return &GraphTraversalE{error: fmt.Errorf("%s is not an integer", s[1])}
 		}
-		var edges []*graph.Edge
+		nte := &GraphTraversalE{GraphTraversal: te.GraphTraversal}
+		if te.paths != nil {
+			nte.paths = []graphPath{}
+		}
 		for ; from < int64(len(te.edges)) && from < to; from++ {
-			edges = append(edges, te.edges[from])
+			nte.add(te.edges[from], te.path(int(from)))
 		}
-		return &GraphTraversalE{GraphTraversal: te.GraphTraversal, edges: edges}
+		return nte
 
 	default:
 		return &GraphTraversalE{GraphTraversal: te.GraphTraversal, error: errors.New("2 parameters must be provided to 'range'")}
@@ -1450,14 +1867,14 @@ func (te *GraphTraversalE) Dedup(ctx StepContext, keys ...interface{}) *GraphTra
 		key = k
 	}
 
-	ntv := &GraphTraversalE{GraphTraversal: te.GraphTraversal, edges: []*graph.Edge{}}
+	ntv := te.newStepE()
 	visited := make(map[interface{}]bool)
 	var kvisited interface{}
 
 	te.GraphTraversal.RLock()
 	defer te.GraphTraversal.RUnlock()
 
-	for _, e := range te.edges {
+	for i, e := range te.edges {
 		kvisited = e.ID
 		if key != "" {
 			if v, ok := e.Metadata()[key]; ok {
@@ -1466,7 +1883,7 @@ func (te *GraphTraversalE) Dedup(ctx StepContext, keys ...interface{}) *GraphTra
 		}
 
 		if _, ok := visited[kvisited]; !ok {
-			ntv.edges = append(ntv.edges, e)
+			ntv.add(e, te.path(i))
 			visited[kvisited] = true
 		}
 	}
@@ -1496,18 +1913,18 @@ func (te *GraphTraversalE) has(filterOp filters.BoolFilterOp, ctx StepContext, s
 		}
 	}
 
-	nte := &GraphTraversalE{GraphTraversal: te.GraphTraversal, edges: []*graph.Edge{}}
+	nte := te.newStepE()
 	it := ctx.PaginationRange.Iterator()
 
 	te.GraphTraversal.RLock()
 	defer te.GraphTraversal.RUnlock()
 
-	for _, e := range te.edges {
+	for i, e := range te.edges {
 		if it.Done() {
 			break
 		}
 		if (filter == nil || filter.Eval(e)) && it.Next() {
-			nte.edges = append(nte.edges, e)
+			nte.add(e, te.path(i))
 		}
 	}
 
@@ -1536,24 +1953,71 @@ func (te *GraphTraversalE) HasNot(ctx StepContext, s string) *GraphTraversalE {
 	}
 
 	filter := filters.NewNullFilter(s)
-	nte := &GraphTraversalE{GraphTraversal: te.GraphTraversal, edges: []*graph.Edge{}}
+	nte := te.newStepE()
 	it := ctx.PaginationRange.Iterator()
 
 	te.GraphTraversal.RLock()
 	defer te.GraphTraversal.RUnlock()
 
-	for _, e := range te.edges {
+	for i, e := range te.edges {
 		if it.Done() {
 			break
 		}
 		if (filter == nil || filter.Eval(e)) && it.Next() {
-			nte.edges = append(nte.edges, e)
+			nte.add(e, te.path(i))
+		}
+	}
+
+	return nte
+}
+
+// filter keeps the edges for which the matcher, called with a traversal
+// starting at the edge, returns true
+func (te *GraphTraversalE) filter(ctx StepContext, matcher func(start GraphTraversalStep) (bool, error)) *GraphTraversalE {
+	if te.error != nil {
+		return te
+	}
+
+	nte := te.newStepE()
+	it := ctx.PaginationRange.Iterator()
+
+	for i, e := range te.edges {
+		if it.Done() {
+			break
+		}
+
+		ok, err := matcher(NewGraphTraversalE(te.GraphTraversal, []*graph.Edge{e}))
+		if err != nil {
+			return &GraphTraversalE{error: err}
+		}
+		if ok && it.Next() {
+			nte.add(e, te.path(i))
 		}
 	}
 
 	return nte
 }
 
+// Where step keeps the edges for which the sub traversal returns a result
+func (te *GraphTraversalE) Where(ctx StepContext, st SubTraversal) *GraphTraversalE {
+	return te.filter(ctx, st.matches)
+}
+
+// Not step keeps the edges for which the sub traversal returns no result
+func (te *GraphTraversalE) Not(ctx StepContext, st SubTraversal) *GraphTraversalE {
+	return te.filter(ctx, notMatcher(st))
+}
+
+// And step keeps the edges for which all the sub traversals return a result
+func (te *GraphTraversalE) And(ctx StepContext, sts ...SubTraversal) *GraphTraversalE {
+	return te.filter(ctx, andMatcher(sts))
+}
+
+// Or step keeps the edges for which at least one sub traversal returns a result
+func (te *GraphTraversalE) Or(ctx StepContext, sts ...SubTraversal) *GraphTraversalE {
+	return te.filter(ctx, orMatcher(sts))
+}
+
 // InV step, node in
 func (te *GraphTraversalE) InV(ctx StepContext, s ...interface{}) *GraphTraversalV {
 	if te.error != nil {
@@ -1565,19 +2029,19 @@ func (te *GraphTraversalE) InV(ctx StepContext, s ...interface{}) *GraphTraversa
 		return &GraphTraversalV{error: err}
 	}
 
-	ntv := &GraphTraversalV{GraphTraversal: te.GraphTraversal, nodes: []*graph.Node{}}
+	ntv := te.newStepV()
 	it := ctx.PaginationRange.Iterator()
 
 	te.GraphTraversal.RLock()
 	defer te.GraphTraversal.RUnlock()
 
-	for _, e := range te.edges {
+	for i, e := range te.edges {
 		parents, _ := te.GraphTraversal.Graph.GetEdgeNodes(e, metadata, nil)
 		for _, parent := range parents {
 			if it.Done() {
 				break
 			} else if it.Next() {
-				ntv.nodes = append(ntv.nodes, parent)
+				ntv.add(parent, te.path(i).extend(parent))
 			}
 		}
 	}
@@ -1596,19 +2060,19 @@ func (te *GraphTraversalE) OutV(ctx StepContext, s ...interface{}) *GraphTravers
 		return &GraphTraversalV{error: err}
 	}
 
-	ntv := &GraphTraversalV{GraphTraversal: te.GraphTraversal, nodes: []*graph.Node{}}
+	ntv := te.newStepV()
 	it := ctx.PaginationRange.Iterator()
 
 	te.GraphTraversal.RLock()
 	defer te.GraphTraversal.RUnlock()
 
-	for _, e := range te.edges {
+	for i, e := range te.edges {
 		_, children := te.GraphTraversal.Graph.GetEdgeNodes(e, nil, metadata)
 		for _, child := range children {
 			if it.Done() {
 				break
 			} else if it.Next() {
-				ntv.nodes = append(ntv.nodes, child)
+				ntv.add(child, te.path(i).extend(child))
 			}
 		}
 	}
@@ -1627,19 +2091,19 @@ func (te *GraphTraversalE) BothV(ctx StepContext, s ...interface{}) *GraphTraver
 		return &GraphTraversalV{error: err}
 	}
 
-	ntv := NewGraphTraversalV(te.GraphTraversal, []*graph.Node{})
+	ntv := te.newStepV()
 	it := ctx.PaginationRange.Iterator()
 
 	te.GraphTraversal.RLock()
 	defer te.GraphTraversal.RUnlock()
 
-	for _, e := range te.edges {
+	for i, e := range te.edges {
 		parents, _ := te.GraphTraversal.Graph.GetEdgeNodes(e, metadata, nil)
 		for _, parent := range parents {
 			if it.Done() {
 				break
 			} else if it.Next() {
-				ntv.nodes = append(ntv.nodes, parent)
+				ntv.add(parent, te.path(i).extend(parent))
 			}
 		}
 
@@ -1648,7 +2112,7 @@ func (te *GraphTraversalE) BothV(ctx StepContext, s ...interface{}) *GraphTraver
 			if it.Done() {
 				break
 			} else if it.Next() {
-				ntv.nodes = append(ntv.nodes, child)
+				ntv.add(child, te.path(i).extend(child))
 			}
 		}
 	}
@@ -1691,7 +2155,9 @@ func (te *GraphTraversalE) SubGraph(ctx StepContext, s ...interface{}) *GraphTra
 
 	ng := graph.NewGraph(te.GraphTraversal.Graph.GetHost(), memory, common.UnknownService)
 
-	return NewGraphTraversal(ng, te.GraphTraversal.lockGraph)
+	gt := NewGraphTraversal(ng, te.GraphTraversal.lockGraph)
+	gt.query = te.GraphTraversal.query
+	return gt
 }
 
 // NewGraphTraversalValue creates a new traversal value step
@@ -0,0 +1,175 @@
+/*
+ * Copyright (C) 2018 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package traversal
+
+import (
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/topology/graph"
+)
+
+// MetadataChange describes the change of a metadata key, Old being nil if
+// the key was added, New being nil if the key was removed
+type MetadataChange struct {
+	Key string
+	Old interface{} `json:",omitempty"`
+	New interface{} `json:",omitempty"`
+}
+
+// ElementChanges describes the metadata changes of a node or an edge
+type ElementChanges struct {
+	ID      graph.Identifier
+	Changes []MetadataChange
+}
+
+// GraphChangeset describes the nodes and edges added, removed or whose
+// metadata changed between two points in time
+type GraphChangeset struct {
+	From         time.Time
+	To           time.Time
+	AddedNodes   []*graph.Node
+	RemovedNodes []*graph.Node
+	UpdatedNodes []ElementChanges
+	AddedEdges   []*graph.Edge
+	RemovedEdges []*graph.Edge
+	UpdatedEdges []ElementChanges
+}
+
+func toMetadataMap(i interface{}) (map[string]interface{}, bool) {
+	switch i := i.(type) {
+	case graph.Metadata:
+		return i, true
+	case map[string]interface{}:
+		return i, true
+	}
+	return nil, false
+}
+
+// diffMetadata returns the changes of the leaf keys of the metadata, the
+// nested keys being separated by dots
+func diffMetadata(prefix string, before, after map[string]interface{}) (changes []MetadataChange) {
+	keys := make(map[string]bool)
+	for k := range before {
+		keys[k] = true
+	}
+	for k := range after {
+		keys[k] = true
+	}
+
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	for _, k := range sorted {
+		ov, nv := before[k], after[k]
+
+		om, oIsMap := toMetadataMap(ov)
+		nm, nIsMap := toMetadataMap(nv)
+		if oIsMap && nIsMap {
+			changes = append(changes, diffMetadata(prefix+k+".", om, nm)...)
+			continue
+		}
+
+		if !reflect.DeepEqual(ov, nv) {
+			changes = append(changes, MetadataChange{Key: prefix + k, Old: ov, New: nv})
+		}
+	}
+	return
+}
+
+func sortNodes(nodes []*graph.Node) {
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+}
+
+func sortEdges(edges []*graph.Edge) {
+	sort.Slice(edges, func(i, j int) bool { return edges[i].ID < edges[j].ID })
+}
+
+// newGraphChangeset computes the changes between two graphs
+func newGraphChangeset(from, to time.Time, g1, g2 *graph.Graph) *GraphChangeset {
+	cs := &GraphChangeset{From: from, To: to}
+
+	cs.AddedNodes, cs.RemovedNodes, cs.AddedEdges, cs.RemovedEdges = g1.Diff(g2)
+	sortNodes(cs.AddedNodes)
+	sortNodes(cs.RemovedNodes)
+	sortEdges(cs.AddedEdges)
+	sortEdges(cs.RemovedEdges)
+
+	nodes := g2.GetNodes(nil)
+	sortNodes(nodes)
+	for _, n := range nodes {
+		if old := g1.GetNode(n.ID); old != nil {
+			if changes := diffMetadata("", old.Metadata(), n.Metadata()); len(changes) > 0 {
+				cs.UpdatedNodes = append(cs.UpdatedNodes, ElementChanges{ID: n.ID, Changes: changes})
+			}
+		}
+	}
+
+	edges := g2.GetEdges(nil)
+	sortEdges(edges)
+	for _, e := range edges {
+		if old := g1.GetEdge(e.ID); old != nil {
+			if changes := diffMetadata("", old.Metadata(), e.Metadata()); len(changes) > 0 {
+				cs.UpdatedEdges = append(cs.UpdatedEdges, ElementChanges{ID: e.ID, Changes: changes})
+			}
+		}
+	}
+
+	return cs
+}
+
+// cloneAt returns the graph as it was at the given time
+func (t *GraphTraversal) cloneAt(at time.Time) (*graph.Graph, error) {
+	return t.Graph.CloneWithContext(graph.Context{
+		TimePoint: true,
+		TimeSlice: common.NewTimeSlice(common.UnixMillis(at), common.UnixMillis(at)),
+	})
+}
+
+// Diff step : returns the changeset of the graph between from and to, on
+// history capable backends
+func (t *GraphTraversal) Diff(ctx StepContext, from, to time.Time) *GraphTraversalValue {
+	if t.error != nil {
+		return NewGraphTraversalValueFromError(t.error)
+	}
+
+	t.RLock()
+	defer t.RUnlock()
+
+	g1, err := t.cloneAt(from)
+	if err != nil {
+		return NewGraphTraversalValueFromError(err)
+	}
+
+	g2, err := t.cloneAt(to)
+	if err != nil {
+		return NewGraphTraversalValueFromError(err)
+	}
+
+	return NewGraphTraversalValue(t, newGraphChangeset(from, to, g1, g2))
+}
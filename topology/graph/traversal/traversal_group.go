@@ -0,0 +1,322 @@
+/*
+ * Copyright (C) 2018 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package traversal
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/skydive-project/skydive/topology/graph"
+)
+
+// FieldGetter describes an element having fields, like a node, an edge or a flow
+type FieldGetter interface {
+	GetField(name string) (interface{}, error)
+}
+
+// groupKey returns the string used to group a field value, as it is used
+// as a JSON object key
+func groupKey(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// ParseGroupCountParameter returns the key of the GroupCount step parameters
+func ParseGroupCountParameter(s ...interface{}) (string, error) {
+	if len(s) != 1 {
+		return "", errors.New("GroupCount requires 1 key")
+	}
+	key, ok := s[0].(string)
+	if !ok {
+		return "", errors.New("GroupCount key has to be a string")
+	}
+	return key, nil
+}
+
+// ParseGroupParameter returns the key and the optional sub traversal of the Group step parameters
+func ParseGroupParameter(s ...interface{}) (key string, st SubTraversal, err error) {
+	if len(s) == 0 || len(s) > 2 {
+		return "", nil, errors.New("Group requires a key and optionally a sub traversal")
+	}
+
+	var ok bool
+	if key, ok = s[0].(string); !ok {
+		return "", nil, errors.New("Group key has to be a string")
+	}
+	if len(s) == 2 {
+		if st, ok = s[1].(SubTraversal); !ok {
+			return "", nil, errors.New("Group value has to be a sub traversal")
+		}
+	}
+
+	return key, st, nil
+}
+
+// ParseProjectParameter returns the keys of the Project step parameters
+func ParseProjectParameter(s ...interface{}) ([]string, error) {
+	if len(s) == 0 {
+		return nil, errors.New("Project requires at least one key")
+	}
+	keys := make([]string, len(s))
+	for i, k := range s {
+		key, ok := k.(string)
+		if !ok {
+			return nil, errors.New("Project keys have to be strings")
+		}
+		keys[i] = key
+	}
+	return keys, nil
+}
+
+// GroupCount returns the number of elements per value of the key field,
+// the elements without this field are not counted
+func GroupCount(gt *GraphTraversal, elements []FieldGetter, key string) *GraphTraversalValue {
+	gt.RLock()
+	defer gt.RUnlock()
+
+	counts := make(map[string]int64)
+	for _, e := range elements {
+		if value, err := e.GetField(key); err == nil {
+			counts[groupKey(value)]++
+		}
+	}
+
+	return NewGraphTraversalValue(gt, counts)
+}
+
+// Group returns the elements per value of the key field. If a sub traversal
+// is given, it is applied to the elements of each group, the start step of
+// the sub traversal being created by newStep, and its result is returned
+// instead of the elements.
+func Group(gt *GraphTraversal, elements []FieldGetter, key string, st SubTraversal, newStep func(elements []FieldGetter) GraphTraversalStep) *GraphTraversalValue {
+	var keys []string
+	groups := make(map[string][]FieldGetter)
+
+	gt.RLock()
+	for _, e := range elements {
+		if value, err := e.GetField(key); err == nil {
+			k := groupKey(value)
+			if _, ok := groups[k]; !ok {
+				keys = append(keys, k)
+			}
+			groups[k] = append(groups[k], e)
+		}
+	}
+	gt.RUnlock()
+
+	// the graph is not locked while running the sub traversals
+	// as their steps lock it by themselves
+	result := make(map[string]interface{}, len(groups))
+	for _, k := range keys {
+		step := newStep(groups[k])
+		if st == nil {
+			result[k] = step.Values()
+			continue
+		}
+
+		step, err := st(step)
+		if err == nil && step != nil {
+			err = step.Error()
+		}
+		if err != nil {
+			return NewGraphTraversalValueFromError(err)
+		}
+		if step == nil {
+			return NewGraphTraversalValueFromError(ErrExecutionError)
+		}
+
+		// keep single values, like the one of Count, as is
+		if value, ok := step.(*GraphTraversalValue); ok {
+			if _, ok := value.value.([]interface{}); !ok {
+				result[k] = value.value
+				continue
+			}
+		}
+		result[k] = step.Values()
+	}
+
+	return NewGraphTraversalValue(gt, result)
+}
+
+// Project returns for each element an object with the values of the keys,
+// null if the element has no such field
+func Project(gt *GraphTraversal, elements []FieldGetter, keys ...string) *GraphTraversalValue {
+	gt.RLock()
+	defer gt.RUnlock()
+
+	projections := make([]interface{}, len(elements))
+	for i, e := range elements {
+		projection := make(map[string]interface{}, len(keys))
+		for _, key := range keys {
+			value, err := e.GetField(key)
+			if err != nil {
+				value = nil
+			}
+			projection[key] = value
+		}
+		projections[i] = projection
+	}
+
+	return NewGraphTraversalValue(gt, projections)
+}
+
+func (tv *GraphTraversalV) fieldGetters() []FieldGetter {
+	elements := make([]FieldGetter, len(tv.nodes))
+	for i, n := range tv.nodes {
+		elements[i] = n
+	}
+	return elements
+}
+
+func (tv *GraphTraversalV) newStep(elements []FieldGetter) GraphTraversalStep {
+	nodes := make([]*graph.Node, len(elements))
+	for i, e := range elements {
+		nodes[i] = e.(*graph.Node)
+	}
+	return NewGraphTraversalV(tv.GraphTraversal, nodes)
+}
+
+// GroupCount step : key
+func (tv *GraphTraversalV) GroupCount(ctx StepContext, s ...interface{}) *GraphTraversalValue {
+	if tv.error != nil {
+		return NewGraphTraversalValueFromError(tv.error)
+	}
+
+	key, err := ParseGroupCountParameter(s...)
+	if err != nil {
+		return NewGraphTraversalValueFromError(err)
+	}
+
+	return GroupCount(tv.GraphTraversal, tv.fieldGetters(), key)
+}
+
+// Group step : key, [sub traversal applied to each group]
+func (tv *GraphTraversalV) Group(ctx StepContext, s ...interface{}) *GraphTraversalValue {
+	if tv.error != nil {
+		return NewGraphTraversalValueFromError(tv.error)
+	}
+
+	key, st, err := ParseGroupParameter(s...)
+	if err != nil {
+		return NewGraphTraversalValueFromError(err)
+	}
+
+	return Group(tv.GraphTraversal, tv.fieldGetters(), key, st, tv.newStep)
+}
+
+// Project step : keys
+func (tv *GraphTraversalV) Project(ctx StepContext, s ...interface{}) *GraphTraversalValue {
+	if tv.error != nil {
+		return NewGraphTraversalValueFromError(tv.error)
+	}
+
+	keys, err := ParseProjectParameter(s...)
+	if err != nil {
+		return NewGraphTraversalValueFromError(err)
+	}
+
+	return Project(tv.GraphTraversal, tv.fieldGetters(), keys...)
+}
+
+func (te *GraphTraversalE) fieldGetters() []FieldGetter {
+	elements := make([]FieldGetter, len(te.edges))
+	for i, e := range te.edges {
+		elements[i] = e
+	}
+	return elements
+}
+
+func (te *GraphTraversalE) newStep(elements []FieldGetter) GraphTraversalStep {
+	edges := make([]*graph.Edge, len(elements))
+	for i, e := range elements {
+		edges[i] = e.(*graph.Edge)
+	}
+	return NewGraphTraversalE(te.GraphTraversal, edges)
+}
+
+// GroupCount step : key
+func (te *GraphTraversalE) GroupCount(ctx StepContext, s ...interface{}) *GraphTraversalValue {
+	if te.error != nil {
+		return NewGraphTraversalValueFromError(te.error)
+	}
+
+	key, err := ParseGroupCountParameter(s...)
+	if err != nil {
+		return NewGraphTraversalValueFromError(err)
+	}
+
+	return GroupCount(te.GraphTraversal, te.fieldGetters(), key)
+}
+
+// Group step : key, [sub traversal applied to each group]
+func (te *GraphTraversalE) Group(ctx StepContext, s ...interface{}) *GraphTraversalValue {
+	if te.error != nil {
+		return NewGraphTraversalValueFromError(te.error)
+	}
+
+	key, st, err := ParseGroupParameter(s...)
+	if err != nil {
+		return NewGraphTraversalValueFromError(err)
+	}
+
+	return Group(te.GraphTraversal, te.fieldGetters(), key, st, te.newStep)
+}
+
+// Project step : keys
+func (te *GraphTraversalE) Project(ctx StepContext, s ...interface{}) *GraphTraversalValue {
+	if te.error != nil {
+		return NewGraphTraversalValueFromError(te.error)
+	}
+
+	keys, err := ParseProjectParameter(s...)
+	if err != nil {
+		return NewGraphTraversalValueFromError(err)
+	}
+
+	return Project(te.GraphTraversal, te.fieldGetters(), keys...)
+}
+
+// PropertyValues returns at this step, the values of each metadata selected by the first key
+func (te *GraphTraversalE) PropertyValues(ctx StepContext, k ...interface{}) *GraphTraversalValue {
+	if te.error != nil {
+		return NewGraphTraversalValueFromError(te.error)
+	}
+
+	key, ok := k[0].(string)
+	if !ok {
+		return NewGraphTraversalValueFromError(errors.New("Values parameter has to be a string key"))
+	}
+
+	te.GraphTraversal.RLock()
+	defer te.GraphTraversal.RUnlock()
+
+	var s []interface{}
+	for _, e := range te.edges {
+		if value, err := e.GetField(key); err == nil {
+			s = append(s, value)
+		}
+	}
+	return NewGraphTraversalValue(te.GraphTraversal, s)
+}
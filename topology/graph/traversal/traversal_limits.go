@@ -0,0 +1,186 @@
+/*
+ * Copyright (C) 2018 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package traversal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/skydive-project/skydive/topology/graph"
+)
+
+// Errors returned when a query exceeds its limits
+var (
+	ErrQueryTimeout  = errors.New("Query timeout exceeded")
+	ErrQueryCanceled = errors.New("Query canceled")
+)
+
+// QueryLimits describes the resources a query is allowed to use, a zero
+// value meaning no limit
+type QueryLimits struct {
+	// Timeout is the maximum execution time of the query
+	Timeout time.Duration
+	// MaxVisited is the maximum number of elements returned by all the
+	// steps of the query, sub traversals included
+	MaxVisited int64
+	// MaxResultSize is the maximum number of values of the result
+	MaxResultSize int64
+}
+
+// queryState holds the context and the budget of a query execution,
+// shared by all the steps of the query
+type queryState struct {
+	ctx     context.Context
+	limits  QueryLimits
+	visited int64
+	// elements returned by the steps of the query, only recorded when
+	// the map is allocated
+	touched map[graph.Identifier]bool
+}
+
+// QueryContext returns the context of the query execution, to be used
+// by the steps doing remote calls
+func (t *GraphTraversal) QueryContext() context.Context {
+	if t == nil || t.query == nil {
+		return context.Background()
+	}
+	return t.query.ctx
+}
+
+// checkQuery returns an error if the query was canceled or exceeded its
+// timeout
+func (t *GraphTraversal) checkQuery() error {
+	if t == nil || t.query == nil {
+		return nil
+	}
+
+	switch t.query.ctx.Err() {
+	case context.DeadlineExceeded:
+		return ErrQueryTimeout
+	case context.Canceled:
+		return ErrQueryCanceled
+	}
+	return nil
+}
+
+// visit accounts for elements returned by a step of the query
+func (t *GraphTraversal) visit(n int) error {
+	if err := t.checkQuery(); err != nil {
+		return err
+	}
+
+	if t == nil || t.query == nil || t.query.limits.MaxVisited == 0 {
+		return nil
+	}
+
+	if visited := atomic.AddInt64(&t.query.visited, int64(n)); visited > t.query.limits.MaxVisited {
+		return fmt.Errorf("Query exceeded the maximum number of visited elements (%d)", t.query.limits.MaxVisited)
+	}
+	return nil
+}
+
+// record keeps the identifiers of the nodes and edges returned by a step
+// if requested by the query
+func (t *GraphTraversal) record(step GraphTraversalStep) {
+	if t == nil || t.query == nil || t.query.touched == nil {
+		return
+	}
+
+	switch step := step.(type) {
+	case *GraphTraversalV:
+		for _, n := range step.nodes {
+			t.query.touched[n.ID] = true
+		}
+	case *GraphTraversalE:
+		for _, e := range step.edges {
+			t.query.touched[e.ID] = true
+		}
+	}
+}
+
+// checkResultSize returns an error if the result exceeds the maximum size
+func (t *GraphTraversal) checkResultSize(step GraphTraversalStep) error {
+	return t.checkSize(stepSize(step))
+}
+
+func (t *GraphTraversal) checkSize(size int) error {
+	if t == nil || t.query == nil || t.query.limits.MaxResultSize == 0 {
+		return nil
+	}
+
+	if int64(size) > t.query.limits.MaxResultSize {
+		return fmt.Errorf("Query result exceeded the maximum size (%d)", t.query.limits.MaxResultSize)
+	}
+	return nil
+}
+
+// pathCheck returns the callback aborting a path search when the query is
+// canceled, times out or when the paths found, added to the size of the
+// paths already found by the step, exceed the maximum result size
+func (t *GraphTraversal) pathCheck(found int) graph.PathCheck {
+	return func(size int) error {
+		if err := t.checkQuery(); err != nil {
+			return err
+		}
+		return t.checkSize(found + size)
+	}
+}
+
+// stepSize returns the number of elements returned by a step
+func stepSize(step GraphTraversalStep) int {
+	switch step := step.(type) {
+	case *GraphTraversal:
+		return 0
+	case *GraphTraversalV:
+		return len(step.nodes)
+	case *GraphTraversalE:
+		return len(step.edges)
+	case *GraphTraversalShortestPath:
+		size := 0
+		for _, path := range step.paths {
+			size += len(path)
+		}
+		return size
+	}
+	return len(step.Values())
+}
+
+// stepGraphTraversal returns the graph traversal of a step, nil if unknown
+func stepGraphTraversal(step GraphTraversalStep) *GraphTraversal {
+	switch step := step.(type) {
+	case *GraphTraversal:
+		return step
+	case *GraphTraversalV:
+		return step.GraphTraversal
+	case *GraphTraversalE:
+		return step.GraphTraversal
+	case *GraphTraversalShortestPath:
+		return step.GraphTraversal
+	case *GraphTraversalValue:
+		return step.GraphTraversal
+	}
+	return nil
+}
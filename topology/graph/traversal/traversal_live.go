@@ -0,0 +1,368 @@
+/*
+ * Copyright (C) 2018 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package traversal
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/skydive-project/skydive/topology/graph"
+)
+
+// LiveQueryDelta describes the changes of the result of a live query
+type LiveQueryDelta struct {
+	Added   []interface{}
+	Removed []interface{}
+	Updated []interface{}
+}
+
+// Empty returns whether the delta holds no change
+func (d *LiveQueryDelta) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Updated) == 0
+}
+
+// LiveQuery keeps the result of a Gremlin query returning nodes or edges
+// up to date with the graph events. When the query only filters the nodes
+// or the edges of the graph on their own fields, only the changed element
+// is evaluated, otherwise the whole query is executed again if the changed
+// element may alter the result, at most once per refresh interval.
+type LiveQuery struct {
+	graph  *graph.Graph
+	ts     *GremlinTraversalSequence
+	steps  []GremlinTraversalStep
+	local  bool
+	edges  bool
+	result map[graph.Identifier]interface{}
+	// whether the elements the result depends on are known, in which case
+	// prefix is the number of filtering steps following the first one
+	tracked bool
+	prefix  int
+	touched map[graph.Identifier]bool
+	// elements changed since the last execution, nil if none
+	changed     map[graph.Identifier]bool
+	interval    time.Duration
+	lastRefresh time.Time
+	execs       int
+}
+
+// isLocalStep returns whether the step only filters elements on their fields
+func isLocalStep(step GremlinTraversalStep) bool {
+	if step.Context().StepContext.PaginationRange != nil {
+		return false
+	}
+
+	switch step.(type) {
+	case *GremlinTraversalStepHas, *GremlinTraversalStepHasKey, *GremlinTraversalStepHasNot, *GremlinTraversalStepHasEither:
+		return true
+	}
+	return false
+}
+
+// isTrackedStep returns whether the output of the step only depends on its
+// input elements and on their neighbors
+func isTrackedStep(step GremlinTraversalStep) bool {
+	switch step.(type) {
+	case *GremlinTraversalStepHas, *GremlinTraversalStepHasKey, *GremlinTraversalStepHasNot, *GremlinTraversalStepHasEither,
+		*GremlinTraversalStepOut, *GremlinTraversalStepIn, *GremlinTraversalStepBoth,
+		*GremlinTraversalStepOutV, *GremlinTraversalStepInV, *GremlinTraversalStepBothV,
+		*GremlinTraversalStepOutE, *GremlinTraversalStepInE, *GremlinTraversalStepBothE,
+		*GremlinTraversalStepDedup, *GremlinTraversalStepRange, *GremlinTraversalStepLimit, *GremlinTraversalStepSort:
+		return true
+	}
+	return false
+}
+
+// NewLiveQuery executes the query and returns the live query with its
+// initial result. The queries not only filtering elements are executed
+// again at most once per interval. The graph has to be locked by the caller.
+func NewLiveQuery(g *graph.Graph, ts *GremlinTraversalSequence, interval time.Duration) (*LiveQuery, []interface{}, error) {
+	steps, err := ts.reduce()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lq := &LiveQuery{graph: g, ts: ts, steps: steps, interval: interval}
+
+	if len(steps) > 0 {
+		switch steps[0].(type) {
+		case *GremlinTraversalStepV:
+			lq.local, lq.tracked = true, true
+		case *GremlinTraversalStepE:
+			lq.local, lq.tracked, lq.edges = true, true, true
+		}
+		lq.local = lq.local && steps[0].Context().StepContext.PaginationRange == nil
+
+		for i, step := range steps[1:] {
+			if lq.local = lq.local && isLocalStep(step); lq.local {
+				lq.prefix = i + 1
+			}
+			lq.tracked = lq.tracked && isTrackedStep(step)
+		}
+	}
+
+	result, err := lq.exec()
+	if err != nil {
+		return nil, nil, err
+	}
+	lq.result = result
+
+	values := make([]interface{}, 0, len(result))
+	for _, value := range result {
+		values = append(values, value)
+	}
+
+	return lq, values, nil
+}
+
+// exec executes the whole query, recording the elements returned by its
+// steps
+func (lq *LiveQuery) exec() (map[graph.Identifier]interface{}, error) {
+	lq.execs++
+	lq.lastRefresh = time.Now()
+
+	query := &queryState{ctx: context.Background(), touched: make(map[graph.Identifier]bool)}
+	res, err := lq.ts.exec(lq.graph, false, query)
+	if err != nil {
+		return nil, err
+	}
+	lq.touched = query.touched
+
+	result := make(map[graph.Identifier]interface{})
+	switch res.(type) {
+	case *GraphTraversalV:
+		for _, n := range res.(*GraphTraversalV).nodes {
+			result[n.ID] = n
+		}
+	case *GraphTraversalE:
+		for _, e := range res.(*GraphTraversalE).edges {
+			result[e.ID] = e
+		}
+	default:
+		return nil, errors.New("Live queries have to return nodes or edges")
+	}
+
+	return result, nil
+}
+
+// filter returns whether the element goes through the first step of the
+// query followed by the given ones
+func (lq *LiveQuery) filter(i interface{}, steps []GremlinTraversalStep) (bool, error) {
+	gt := NewGraphTraversal(lq.graph, false)
+	ctx := lq.steps[0].Context()
+
+	var start GraphTraversalStep
+	switch i := i.(type) {
+	case *graph.Node:
+		tv := NewGraphTraversalV(gt, []*graph.Node{i})
+		switch len(ctx.Params) {
+		case 0:
+		case 1:
+			if id, _ := ctx.Params[0].(string); graph.Identifier(id) != i.ID {
+				return false, nil
+			}
+		default:
+			tv = tv.Has(StepContext{}, ctx.Params...)
+		}
+		start = tv
+	case *graph.Edge:
+		te := NewGraphTraversalE(gt, []*graph.Edge{i})
+		switch len(ctx.Params) {
+		case 0:
+		case 1:
+			if id, _ := ctx.Params[0].(string); graph.Identifier(id) != i.ID {
+				return false, nil
+			}
+		default:
+			te = te.Has(StepContext{}, ctx.Params...)
+		}
+		start = te
+	}
+
+	res, err := execSteps(steps, start)
+	if err != nil {
+		return false, err
+	}
+
+	return len(res.Values()) > 0, nil
+}
+
+// matches returns whether the element is part of the result of the query
+// by executing the filtering steps on it only
+func (lq *LiveQuery) matches(i interface{}) (bool, error) {
+	return lq.filter(i, lq.steps[1:])
+}
+
+// relevant returns whether the change of the element may alter the result
+// of a query not only filtering elements, that is if it was returned by
+// one of the steps of the last execution, if it is linked to such an
+// element or if it goes through the leading filtering steps
+func (lq *LiveQuery) relevant(i interface{}, deleted bool) bool {
+	if !lq.tracked {
+		return true
+	}
+
+	switch i := i.(type) {
+	case *graph.Node:
+		if lq.touched[i.ID] {
+			return true
+		}
+		if !deleted {
+			for _, e := range lq.graph.GetNodeEdges(i, nil) {
+				if lq.touched[e.GetParent()] || lq.touched[e.GetChild()] {
+					return true
+				}
+			}
+		}
+		if lq.edges {
+			return false
+		}
+	case *graph.Edge:
+		if lq.touched[i.ID] || lq.touched[i.GetParent()] || lq.touched[i.GetChild()] {
+			return true
+		}
+		if !lq.edges {
+			return false
+		}
+	}
+
+	matches, err := lq.filter(i, lq.steps[1:1+lq.prefix])
+	return matches || err != nil
+}
+
+// Update returns the changes of the result of the query caused by the
+// addition, the update or the deletion of the given node or edge. When the
+// whole query has to be executed again less than an interval after the
+// last execution, the change is kept pending, see Flush.
+// The graph has to be locked by the caller.
+func (lq *LiveQuery) Update(i interface{}, deleted bool) (*LiveQueryDelta, error) {
+	var id graph.Identifier
+	switch i := i.(type) {
+	case *graph.Node:
+		if lq.local && lq.edges {
+			return &LiveQueryDelta{}, nil
+		}
+		id = i.ID
+	case *graph.Edge:
+		if lq.local && !lq.edges {
+			return &LiveQueryDelta{}, nil
+		}
+		id = i.ID
+	default:
+		return nil, errors.New("Live queries are only updated by nodes and edges")
+	}
+
+	if !lq.local {
+		if !lq.relevant(i, deleted) {
+			return &LiveQueryDelta{}, nil
+		}
+
+		if lq.changed == nil {
+			lq.changed = make(map[graph.Identifier]bool)
+		}
+		lq.changed[id] = true
+
+		if time.Since(lq.lastRefresh) < lq.interval {
+			return &LiveQueryDelta{}, nil
+		}
+		return lq.refresh()
+	}
+
+	delta := &LiveQueryDelta{}
+	_, found := lq.result[id]
+
+	matches := false
+	if !deleted {
+		var err error
+		if matches, err = lq.matches(i); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case matches && !found:
+		lq.result[id] = i
+		delta.Added = append(delta.Added, i)
+	case !matches && found:
+		delete(lq.result, id)
+		delta.Removed = append(delta.Removed, i)
+	case matches && found:
+		lq.result[id] = i
+		delta.Updated = append(delta.Updated, i)
+	}
+
+	return delta, nil
+}
+
+// Pending returns whether changes are waiting for the query to be executed
+// again
+func (lq *LiveQuery) Pending() bool {
+	return lq.changed != nil
+}
+
+// NextRefresh returns the delay before the pending changes can be flushed
+func (lq *LiveQuery) NextRefresh() time.Duration {
+	if delay := lq.interval - time.Since(lq.lastRefresh); delay > 0 {
+		return delay
+	}
+	return 0
+}
+
+// Flush executes the query again if changes are pending and returns the
+// changes of the result. The graph has to be locked by the caller.
+func (lq *LiveQuery) Flush() (*LiveQueryDelta, error) {
+	if !lq.Pending() {
+		return &LiveQueryDelta{}, nil
+	}
+	return lq.refresh()
+}
+
+// refresh executes the whole query and compares the result with the
+// previous one, the changed elements being reported as updated if they
+// are part of both
+func (lq *LiveQuery) refresh() (*LiveQueryDelta, error) {
+	changed := lq.changed
+	lq.changed = nil
+
+	result, err := lq.exec()
+	if err != nil {
+		return nil, err
+	}
+
+	delta := &LiveQueryDelta{}
+	for id, value := range result {
+		if _, found := lq.result[id]; !found {
+			delta.Added = append(delta.Added, value)
+		} else if changed[id] {
+			delta.Updated = append(delta.Updated, value)
+		}
+	}
+	for id, value := range lq.result {
+		if _, found := result[id]; !found {
+			delta.Removed = append(delta.Removed, value)
+		}
+	}
+	lq.result = result
+
+	return delta, nil
+}
@@ -23,6 +23,7 @@
 package traversal
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -41,6 +42,7 @@ type (
 		GraphTraversal *GraphTraversal
 		steps          []GremlinTraversalStep
 		extensions     []GremlinTraversalExtension
+		indexes        []*MetadataIndex
 	}
 
 	// GremlinTraversalStep describes a step
@@ -174,6 +176,90 @@ type (
 	GremlinTraversalStepSelect struct {
 		GremlinTraversalContext
 	}
+	// GremlinTraversalStepWhere step
+	GremlinTraversalStepWhere struct {
+		GremlinTraversalContext
+	}
+	// GremlinTraversalStepNot step
+	GremlinTraversalStepNot struct {
+		GremlinTraversalContext
+	}
+	// GremlinTraversalStepAnd step
+	GremlinTraversalStepAnd struct {
+		GremlinTraversalContext
+	}
+	// GremlinTraversalStepOr step
+	GremlinTraversalStepOr struct {
+		GremlinTraversalContext
+	}
+	// GremlinTraversalStepRepeat step, modulated by the following Times,
+	// Until and Emit steps
+	GremlinTraversalStepRepeat struct {
+		GremlinTraversalContext
+		times int64
+		until *GremlinTraversalSequence
+		emit  bool
+	}
+	// GremlinTraversalStepTimes step
+	GremlinTraversalStepTimes struct {
+		GremlinTraversalContext
+	}
+	// GremlinTraversalStepUntil step
+	GremlinTraversalStepUntil struct {
+		GremlinTraversalContext
+	}
+	// GremlinTraversalStepEmit step
+	GremlinTraversalStepEmit struct {
+		GremlinTraversalContext
+	}
+	// GremlinTraversalStepGroupCount step
+	GremlinTraversalStepGroupCount struct {
+		GremlinTraversalContext
+	}
+	// GremlinTraversalStepGroup step, the key and the value being given
+	// by the following By steps
+	GremlinTraversalStepGroup struct {
+		GremlinTraversalContext
+		keyBy   *GremlinTraversalStepBy
+		valueBy *GremlinTraversalStepBy
+	}
+	// GremlinTraversalStepBy step
+	GremlinTraversalStepBy struct {
+		GremlinTraversalContext
+	}
+	// GremlinTraversalStepProject step
+	GremlinTraversalStepProject struct {
+		GremlinTraversalContext
+	}
+	// GremlinTraversalStepPath step, the elements being possibly projected
+	// by a following By step
+	GremlinTraversalStepPath struct {
+		GremlinTraversalContext
+		by *GremlinTraversalStepBy
+	}
+	// GremlinTraversalStepDiff step, returns the changes of the graph
+	// between two points in time
+	GremlinTraversalStepDiff struct {
+		GremlinTraversalContext
+	}
+	// GremlinTraversalStepRevisions step, returns the successive versions
+	// of the elements
+	GremlinTraversalStepRevisions struct {
+		GremlinTraversalContext
+	}
+	// GremlinTraversalStepExplain step, returns the plan of the query
+	// instead of executing it
+	GremlinTraversalStepExplain struct {
+		GremlinTraversalContext
+	}
+	// GremlinTraversalStepKShortestPathsTo step
+	GremlinTraversalStepKShortestPathsTo struct {
+		GremlinTraversalContext
+	}
+	// GremlinTraversalStepAllPathsTo step
+	GremlinTraversalStepAllPathsTo struct {
+		GremlinTraversalContext
+	}
 )
 
 var (
@@ -192,6 +278,7 @@ type GremlinTraversalParser struct {
 		n   int
 	}
 	extensions []GremlinTraversalExtension
+	indexes    []*MetadataIndex
 }
 
 func invokeStepFnc(last GraphTraversalStep, name string, gremlinStep GremlinTraversalStep) (GraphTraversalStep, error) {
@@ -328,21 +415,8 @@ func (s *GremlinTraversalStepContext) Exec(last GraphTraversalStep) (_ GraphTrav
 		}
 		fallthrough
 	case 1:
-		switch param := s.Params[0].(type) {
-		case string:
-			if s.Params[0], err = parseTimeContext(param); err != nil {
-				return nil, err
-			}
-		case int64:
-			if param > math.MaxInt32 {
-				s.Params[0] = time.Unix(0, param*1000000)
-			} else {
-				s.Params[0] = time.Unix(param, 0)
-			}
-		case *NowPredicate:
-			s.Params[0] = time.Now()
-		default:
-			return nil, errors.New("Key 'Context' must be either an integer or a string")
+		if s.Params[0], err = parseTimeParam("Context", s.Params[0]); err != nil {
+			return nil, err
 		}
 	default:
 		return nil, errors.New("At most two parameters must be provided to 'Context'")
@@ -356,6 +430,53 @@ func (s *GremlinTraversalStepContext) Reduce(next GremlinTraversalStep) (Gremlin
 	return next, nil
 }
 
+// parseTimeParam returns the time of a step parameter, either a date, a
+// duration relative to now, a Unix timestamp in seconds or milliseconds
+// or NOW
+func parseTimeParam(name string, param interface{}) (time.Time, error) {
+	switch param := param.(type) {
+	case string:
+		return parseTimeContext(param)
+	case int64:
+		if param > math.MaxInt32 {
+			return time.Unix(0, param*1000000), nil
+		}
+		return time.Unix(param, 0), nil
+	case *NowPredicate:
+		return time.Now(), nil
+	case time.Time:
+		return param, nil
+	}
+	return time.Time{}, fmt.Errorf("Key '%s' must be either an integer or a string", name)
+}
+
+// Exec Diff step
+func (s *GremlinTraversalStepDiff) Exec(last GraphTraversalStep) (GraphTraversalStep, error) {
+	g, ok := last.(*GraphTraversal)
+	if !ok {
+		return nil, ErrExecutionError
+	}
+
+	from, err := parseTimeParam("Diff", s.Params[0])
+	if err != nil {
+		return nil, err
+	}
+
+	to := time.Now()
+	if len(s.Params) > 1 {
+		if to, err = parseTimeParam("Diff", s.Params[1]); err != nil {
+			return nil, err
+		}
+	}
+
+	return g.Diff(s.StepContext, from, to), nil
+}
+
+// Reduce Diff step
+func (s *GremlinTraversalStepDiff) Reduce(next GremlinTraversalStep) (GremlinTraversalStep, error) {
+	return next, nil
+}
+
 // Exec Has step
 func (s *GremlinTraversalStepHas) Exec(last GraphTraversalStep) (GraphTraversalStep, error) {
 	switch last.(type) {
@@ -674,20 +795,42 @@ func (s *GremlinTraversalStepBothE) Reduce(next GremlinTraversalStep) (GremlinTr
 	return next, nil
 }
 
+// parsePathToParams returns the metadata of the target nodes, the optional
+// metadata of the edges to walk through and the optional weight
+func parsePathToParams(name string, params []interface{}) (m graph.Metadata, e graph.Metadata, weight graph.PathWeight, err error) {
+	if len(params) > 0 {
+		if w, ok := params[len(params)-1].(*EdgeWeight); ok {
+			weight = w.weight
+			params = params[:len(params)-1]
+		}
+	}
+
+	if len(params) == 0 || len(params) > 2 {
+		return nil, nil, weight, fmt.Errorf("%s accepts the target Metadata, optionally the edge Metadata and a Weight : %v", name, params)
+	}
+
+	var ok bool
+	if m, ok = params[0].(graph.Metadata); !ok {
+		return nil, nil, weight, fmt.Errorf("%s target has to be a Metadata : %v", name, params)
+	}
+	if len(params) > 1 {
+		if e, ok = params[1].(graph.Metadata); !ok {
+			return nil, nil, weight, fmt.Errorf("%s edge filter has to be a Metadata : %v", name, params)
+		}
+	}
+
+	return m, e, weight, nil
+}
+
 // Exec ShortestPathTo step
 func (s *GremlinTraversalStepShortestPathTo) Exec(last GraphTraversalStep) (GraphTraversalStep, error) {
 	switch last.(type) {
 	case *GraphTraversalV:
-		if _, ok := s.Params[0].(graph.Metadata); !ok {
-			return nil, ErrExecutionError
-		}
-		if len(s.Params) > 1 {
-			if _, ok := s.Params[1].(graph.Metadata); !ok {
-				return nil, ErrExecutionError
-			}
-			return last.(*GraphTraversalV).ShortestPathTo(s.StepContext, s.Params[0].(graph.Metadata), s.Params[1].(graph.Metadata)), nil
+		m, e, weight, err := parsePathToParams("ShortestPathTo", s.Params)
+		if err != nil {
+			return nil, err
 		}
-		return last.(*GraphTraversalV).ShortestPathTo(s.StepContext, s.Params[0].(graph.Metadata), nil), nil
+		return last.(*GraphTraversalV).ShortestPathTo(s.StepContext, m, e, weight), nil
 	}
 
 	return nil, ErrExecutionError
@@ -698,6 +841,44 @@ func (s *GremlinTraversalStepShortestPathTo) Reduce(next GremlinTraversalStep) (
 	return next, nil
 }
 
+// Exec KShortestPathsTo step
+func (s *GremlinTraversalStepKShortestPathsTo) Exec(last GraphTraversalStep) (GraphTraversalStep, error) {
+	switch last.(type) {
+	case *GraphTraversalV:
+		m, e, weight, err := parsePathToParams("KShortestPathsTo", s.Params[1:])
+		if err != nil {
+			return nil, err
+		}
+		return last.(*GraphTraversalV).KShortestPathsTo(s.StepContext, s.Params[0].(int64), m, e, weight), nil
+	}
+
+	return nil, ErrExecutionError
+}
+
+// Reduce KShortestPathsTo step
+func (s *GremlinTraversalStepKShortestPathsTo) Reduce(next GremlinTraversalStep) (GremlinTraversalStep, error) {
+	return next, nil
+}
+
+// Exec AllPathsTo step
+func (s *GremlinTraversalStepAllPathsTo) Exec(last GraphTraversalStep) (GraphTraversalStep, error) {
+	switch last.(type) {
+	case *GraphTraversalV:
+		m, e, weight, err := parsePathToParams("AllPathsTo", s.Params)
+		if err != nil {
+			return nil, err
+		}
+		return last.(*GraphTraversalV).AllPathsTo(s.StepContext, m, e, weight), nil
+	}
+
+	return nil, ErrExecutionError
+}
+
+// Reduce AllPathsTo step
+func (s *GremlinTraversalStepAllPathsTo) Reduce(next GremlinTraversalStep) (GremlinTraversalStep, error) {
+	return next, nil
+}
+
 // Exec Both step
 func (s *GremlinTraversalStepBoth) Exec(last GraphTraversalStep) (GraphTraversalStep, error) {
 	switch last.(type) {
@@ -868,17 +1049,360 @@ func (s *GremlinTraversalStepSelect) Reduce(next GremlinTraversalStep) (GremlinT
 	return next, nil
 }
 
-// Exec sequence step
-func (s *GremlinTraversalSequence) Exec(g *graph.Graph, lockGraph bool) (GraphTraversalStep, error) {
-	var step GremlinTraversalStep
-	var last GraphTraversalStep
-	var err error
+// subTraversalsParams converts the sub traversal parameters of a step
+func subTraversalsParams(params []interface{}) ([]SubTraversal, error) {
+	var sts []SubTraversal
+	for _, param := range params {
+		seq, ok := param.(*GremlinTraversalSequence)
+		if !ok {
+			return nil, fmt.Errorf("Sub traversal expected, got: %v", param)
+		}
+		sts = append(sts, seq.SubTraversal())
+	}
+	return sts, nil
+}
 
-	s.GraphTraversal = NewGraphTraversal(g, lockGraph)
-	last = s.GraphTraversal
+// Exec Where step
+func (s *GremlinTraversalStepWhere) Exec(last GraphTraversalStep) (GraphTraversalStep, error) {
+	sts, err := subTraversalsParams(s.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	switch last.(type) {
+	case *GraphTraversalV:
+		return last.(*GraphTraversalV).Where(s.StepContext, sts[0]), nil
+	case *GraphTraversalE:
+		return last.(*GraphTraversalE).Where(s.StepContext, sts[0]), nil
+	}
+
+	return nil, ErrExecutionError
+}
+
+// Reduce Where step
+func (s *GremlinTraversalStepWhere) Reduce(next GremlinTraversalStep) (GremlinTraversalStep, error) {
+	if s.ReduceRange(next) {
+		return s, nil
+	}
+
+	return next, nil
+}
+
+// Exec Not step
+func (s *GremlinTraversalStepNot) Exec(last GraphTraversalStep) (GraphTraversalStep, error) {
+	sts, err := subTraversalsParams(s.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	switch last.(type) {
+	case *GraphTraversalV:
+		return last.(*GraphTraversalV).Not(s.StepContext, sts[0]), nil
+	case *GraphTraversalE:
+		return last.(*GraphTraversalE).Not(s.StepContext, sts[0]), nil
+	}
+
+	return nil, ErrExecutionError
+}
+
+// Reduce Not step
+func (s *GremlinTraversalStepNot) Reduce(next GremlinTraversalStep) (GremlinTraversalStep, error) {
+	if s.ReduceRange(next) {
+		return s, nil
+	}
+
+	return next, nil
+}
+
+// Exec And step
+func (s *GremlinTraversalStepAnd) Exec(last GraphTraversalStep) (GraphTraversalStep, error) {
+	sts, err := subTraversalsParams(s.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	switch last.(type) {
+	case *GraphTraversalV:
+		return last.(*GraphTraversalV).And(s.StepContext, sts...), nil
+	case *GraphTraversalE:
+		return last.(*GraphTraversalE).And(s.StepContext, sts...), nil
+	}
+
+	return nil, ErrExecutionError
+}
+
+// Reduce And step
+func (s *GremlinTraversalStepAnd) Reduce(next GremlinTraversalStep) (GremlinTraversalStep, error) {
+	if s.ReduceRange(next) {
+		return s, nil
+	}
+
+	return next, nil
+}
+
+// Exec Or step
+func (s *GremlinTraversalStepOr) Exec(last GraphTraversalStep) (GraphTraversalStep, error) {
+	sts, err := subTraversalsParams(s.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	switch last.(type) {
+	case *GraphTraversalV:
+		return last.(*GraphTraversalV).Or(s.StepContext, sts...), nil
+	case *GraphTraversalE:
+		return last.(*GraphTraversalE).Or(s.StepContext, sts...), nil
+	}
+
+	return nil, ErrExecutionError
+}
+
+// Reduce Or step
+func (s *GremlinTraversalStepOr) Reduce(next GremlinTraversalStep) (GremlinTraversalStep, error) {
+	if s.ReduceRange(next) {
+		return s, nil
+	}
+
+	return next, nil
+}
+
+// Exec Repeat step
+func (s *GremlinTraversalStepRepeat) Exec(last GraphTraversalStep) (GraphTraversalStep, error) {
+	sts, err := subTraversalsParams(s.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := RepeatOptions{Times: s.times, Emit: s.emit}
+	if s.until != nil {
+		opts.Until = s.until.SubTraversal()
+	}
+
+	switch last.(type) {
+	case *GraphTraversalV:
+		return last.(*GraphTraversalV).Repeat(s.StepContext, sts[0], opts), nil
+	}
+
+	return nil, ErrExecutionError
+}
+
+// Reduce Repeat step
+func (s *GremlinTraversalStepRepeat) Reduce(next GremlinTraversalStep) (GremlinTraversalStep, error) {
+	switch next := next.(type) {
+	case *GremlinTraversalStepTimes:
+		s.times = next.Params[0].(int64)
+		return s, nil
+	case *GremlinTraversalStepUntil:
+		s.until = next.Params[0].(*GremlinTraversalSequence)
+		return s, nil
+	case *GremlinTraversalStepEmit:
+		s.emit = true
+		return s, nil
+	}
+
+	if s.ReduceRange(next) {
+		return s, nil
+	}
+
+	return next, nil
+}
+
+// Exec Times step
+func (s *GremlinTraversalStepTimes) Exec(last GraphTraversalStep) (GraphTraversalStep, error) {
+	return nil, errors.New("Times has to follow a Repeat step")
+}
+
+// Reduce Times step
+func (s *GremlinTraversalStepTimes) Reduce(next GremlinTraversalStep) (GremlinTraversalStep, error) {
+	return next, nil
+}
+
+// Exec Until step
+func (s *GremlinTraversalStepUntil) Exec(last GraphTraversalStep) (GraphTraversalStep, error) {
+	return nil, errors.New("Until has to follow a Repeat step")
+}
+
+// Reduce Until step
+func (s *GremlinTraversalStepUntil) Reduce(next GremlinTraversalStep) (GremlinTraversalStep, error) {
+	return next, nil
+}
+
+// Exec Emit step
+func (s *GremlinTraversalStepEmit) Exec(last GraphTraversalStep) (GraphTraversalStep, error) {
+	return nil, errors.New("Emit has to follow a Repeat step")
+}
+
+// Reduce Emit step
+func (s *GremlinTraversalStepEmit) Reduce(next GremlinTraversalStep) (GremlinTraversalStep, error) {
+	return next, nil
+}
+
+// Exec GroupCount step
+func (s *GremlinTraversalStepGroupCount) Exec(last GraphTraversalStep) (GraphTraversalStep, error) {
+	switch last.(type) {
+	case *GraphTraversalV:
+		return last.(*GraphTraversalV).GroupCount(s.StepContext, s.Params...), nil
+	case *GraphTraversalE:
+		return last.(*GraphTraversalE).GroupCount(s.StepContext, s.Params...), nil
+	}
+
+	return invokeStepFnc(last, "GroupCount", s)
+}
+
+// Reduce GroupCount step
+func (s *GremlinTraversalStepGroupCount) Reduce(next GremlinTraversalStep) (GremlinTraversalStep, error) {
+	return next, nil
+}
+
+// Exec Group step
+func (s *GremlinTraversalStepGroup) Exec(last GraphTraversalStep) (GraphTraversalStep, error) {
+	if s.keyBy == nil {
+		return nil, errors.New("Group has to be followed by a By step giving the key")
+	}
+
+	params := []interface{}{s.keyBy.Params[0]}
+	if s.valueBy != nil {
+		params = append(params, s.valueBy.Params[0].(*GremlinTraversalSequence).SubTraversal())
+	}
+
+	switch last.(type) {
+	case *GraphTraversalV:
+		return last.(*GraphTraversalV).Group(s.StepContext, params...), nil
+	case *GraphTraversalE:
+		return last.(*GraphTraversalE).Group(s.StepContext, params...), nil
+	}
+
+	return invokeStepFnc(last, "Group", &GremlinTraversalStepGroup{
+		GremlinTraversalContext: GremlinTraversalContext{StepContext: s.StepContext, Params: params},
+	})
+}
+
+// Reduce Group step
+func (s *GremlinTraversalStepGroup) Reduce(next GremlinTraversalStep) (GremlinTraversalStep, error) {
+	by, ok := next.(*GremlinTraversalStepBy)
+	if !ok {
+		return next, nil
+	}
+
+	// as Reduce is called each time the sequence is executed, the same
+	// By step can be seen twice
+	switch {
+	case s.keyBy == nil || s.keyBy == by:
+		if _, ok := by.Params[0].(string); !ok {
+			return nil, fmt.Errorf("First By of Group has to be a string key : %v", by.Params)
+		}
+		s.keyBy = by
+	case s.valueBy == nil || s.valueBy == by:
+		if _, ok := by.Params[0].(*GremlinTraversalSequence); !ok {
+			return nil, fmt.Errorf("Second By of Group has to be a sub traversal : %v", by.Params)
+		}
+		s.valueBy = by
+	default:
+		return nil, errors.New("Group accepts at most two By steps")
+	}
+
+	return s, nil
+}
+
+// Exec By step
+func (s *GremlinTraversalStepBy) Exec(last GraphTraversalStep) (GraphTraversalStep, error) {
+	return nil, errors.New("By has to follow a Group or a Path step")
+}
+
+// Reduce By step
+func (s *GremlinTraversalStepBy) Reduce(next GremlinTraversalStep) (GremlinTraversalStep, error) {
+	return next, nil
+}
+
+// Exec Project step
+func (s *GremlinTraversalStepProject) Exec(last GraphTraversalStep) (GraphTraversalStep, error) {
+	switch last.(type) {
+	case *GraphTraversalV:
+		return last.(*GraphTraversalV).Project(s.StepContext, s.Params...), nil
+	case *GraphTraversalE:
+		return last.(*GraphTraversalE).Project(s.StepContext, s.Params...), nil
+	}
+
+	return invokeStepFnc(last, "Project", s)
+}
+
+// Reduce Project step
+func (s *GremlinTraversalStepProject) Reduce(next GremlinTraversalStep) (GremlinTraversalStep, error) {
+	return next, nil
+}
+
+// Exec Path step
+func (s *GremlinTraversalStepPath) Exec(last GraphTraversalStep) (GraphTraversalStep, error) {
+	var params []interface{}
+	if s.by != nil {
+		params = s.by.Params
+	}
+
+	switch last.(type) {
+	case *GraphTraversalV:
+		return last.(*GraphTraversalV).Path(s.StepContext, params...), nil
+	case *GraphTraversalE:
+		return last.(*GraphTraversalE).Path(s.StepContext, params...), nil
+	}
+
+	return nil, ErrExecutionError
+}
+
+// Reduce Path step
+func (s *GremlinTraversalStepPath) Reduce(next GremlinTraversalStep) (GremlinTraversalStep, error) {
+	by, ok := next.(*GremlinTraversalStepBy)
+	if !ok {
+		return next, nil
+	}
+
+	if s.by != nil && s.by != by {
+		return nil, errors.New("Path accepts at most one By step")
+	}
+	if _, ok := by.Params[0].(string); !ok {
+		return nil, fmt.Errorf("By of Path has to be a string key : %v", by.Params)
+	}
+	s.by = by
+
+	return s, nil
+}
+
+// Exec Revisions step
+func (s *GremlinTraversalStepRevisions) Exec(last GraphTraversalStep) (GraphTraversalStep, error) {
+	switch last := last.(type) {
+	case *GraphTraversalV:
+		return last.Revisions(s.StepContext), nil
+	case *GraphTraversalE:
+		return last.Revisions(s.StepContext), nil
+	}
+
+	return nil, ErrExecutionError
+}
+
+// Reduce Revisions step
+func (s *GremlinTraversalStepRevisions) Reduce(next GremlinTraversalStep) (GremlinTraversalStep, error) {
+	if s.ReduceRange(next) {
+		return s, nil
+	}
+
+	return next, nil
+}
+
+// Exec Explain step
+func (s *GremlinTraversalStepExplain) Exec(last GraphTraversalStep) (GraphTraversalStep, error) {
+	return nil, errors.New("Explain has to be the last step")
+}
+
+// Reduce Explain step
+func (s *GremlinTraversalStepExplain) Reduce(next GremlinTraversalStep) (GremlinTraversalStep, error) {
+	return next, nil
+}
+
+// reduce merges the steps of the sequence that can be merged
+func (s *GremlinTraversalSequence) reduce() ([]GremlinTraversalStep, error) {
+	var steps []GremlinTraversalStep
 
 	for i := 0; i < len(s.steps); {
-		step = s.steps[i]
+		step := s.steps[i]
 
 		for i = i + 1; i < len(s.steps); i = i + 1 {
 			next, err := step.Reduce(s.steps[i])
@@ -890,28 +1414,116 @@ func (s *GremlinTraversalSequence) Exec(g *graph.Graph, lockGraph bool) (GraphTr
 			}
 		}
 
+		steps = append(steps, step)
+	}
+
+	return steps, nil
+}
+
+func execSteps(steps []GremlinTraversalStep, last GraphTraversalStep) (GraphTraversalStep, error) {
+	var err error
+
+	for _, step := range steps {
 		if last, err = step.Exec(last); err != nil {
 			return nil, err
 		}
 
+		if last == nil {
+			return nil, ErrExecutionError
+		}
+
 		if err := last.Error(); err != nil {
 			return nil, err
 		}
+
+		if gt := stepGraphTraversal(last); gt != nil {
+			if err := gt.visit(stepSize(last)); err != nil {
+				return nil, err
+			}
+			gt.record(last)
+		}
 	}
 
-	res, ok := last.(GraphTraversalStep)
-	if !ok {
-		return nil, ErrExecutionError
+	return last, nil
+}
+
+// Exec sequence step
+func (s *GremlinTraversalSequence) Exec(g *graph.Graph, lockGraph bool) (GraphTraversalStep, error) {
+	return s.ExecWithContext(context.Background(), g, lockGraph, QueryLimits{})
+}
+
+// ExecWithContext executes the sequence within the given limits, the
+// execution being aborted as soon as the context is done
+func (s *GremlinTraversalSequence) ExecWithContext(ctx context.Context, g *graph.Graph, lockGraph bool, limits QueryLimits) (GraphTraversalStep, error) {
+	return s.exec(g, lockGraph, &queryState{ctx: ctx, limits: limits})
+}
+
+// exec executes the sequence with the given query state
+func (s *GremlinTraversalSequence) exec(g *graph.Graph, lockGraph bool, query *queryState) (GraphTraversalStep, error) {
+	steps, err := s.reduce()
+	if err != nil {
+		return nil, err
+	}
+
+	if query.limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		query.ctx, cancel = context.WithTimeout(query.ctx, query.limits.Timeout)
+		defer cancel()
+	}
+
+	steps = s.plan(g, steps)
+
+	s.GraphTraversal = NewGraphTraversal(g, lockGraph)
+	s.GraphTraversal.query = query
+
+	if len(steps) > 0 {
+		if _, ok := steps[len(steps)-1].(*GremlinTraversalStepExplain); ok {
+			return NewGraphTraversalValue(s.GraphTraversal, explain(steps[:len(steps)-1])), nil
+		}
+	}
+
+	// recording the paths has a cost, only done when requested
+	for _, step := range steps {
+		if _, ok := step.(*GremlinTraversalStepPath); ok {
+			s.GraphTraversal.TrackPaths()
+			break
+		}
+	}
+
+	res, err := execSteps(steps, s.GraphTraversal)
+	if err != nil {
+		// report the cancellation rather than the error of the aborted step
+		if qerr := s.GraphTraversal.checkQuery(); qerr != nil {
+			return nil, qerr
+		}
+		return nil, err
+	}
+
+	if err := s.GraphTraversal.checkResultSize(res); err != nil {
+		return nil, err
 	}
 
 	return res, nil
 }
 
+// SubTraversal returns the sequence as a traversal starting at the given step.
+// The steps of a sub traversal are reduced while parsing.
+func (s *GremlinTraversalSequence) SubTraversal() SubTraversal {
+	return func(start GraphTraversalStep) (GraphTraversalStep, error) {
+		return execSteps(s.steps, start)
+	}
+}
+
 // AddTraversalExtension registers a new gremlin traversal extension
 func (p *GremlinTraversalParser) AddTraversalExtension(e GremlinTraversalExtension) {
 	p.extensions = append(p.extensions, e)
 }
 
+// AddIndex registers a metadata index to be used by the queries
+func (p *GremlinTraversalParser) AddIndex(index *MetadataIndex) {
+	p.indexes = append(p.indexes, index)
+}
+
 // NewGremlinTraversalParser creates a new gremlin language parser on the graph
 func NewGremlinTraversalParser() *GremlinTraversalParser {
 	return &GremlinTraversalParser{}
@@ -1062,6 +1674,26 @@ func (p *GremlinTraversalParser) parseStepParams() ([]interface{}, error) {
 				return nil, fmt.Errorf("One parameter expected with IPV4RANGE: %v", ipParams)
 			}
 			params = append(params, IPV4Range(ipParams[0]))
+		case WEIGHT:
+			weightParams, err := p.parseStepParams()
+			if err != nil {
+				return nil, err
+			}
+			if len(weightParams) != 1 && len(weightParams) != 2 {
+				return nil, fmt.Errorf("One or two parameters expected with WEIGHT: %v", weightParams)
+			}
+			key, ok := weightParams[0].(string)
+			if !ok {
+				return nil, fmt.Errorf("WEIGHT predicate expects a string key as parameter, got: %v", weightParams)
+			}
+			inverse := false
+			if len(weightParams) == 2 {
+				if mode, ok := weightParams[1].(string); !ok || mode != "inverse" {
+					return nil, fmt.Errorf("WEIGHT predicate only accepts the \"inverse\" mode, got: %v", weightParams)
+				}
+				inverse = true
+			}
+			params = append(params, Weight(key, inverse))
 		case FOREVER:
 			params = append(params, &ForeverPredicate{})
 		case NOW:
@@ -1071,7 +1703,17 @@ func (p *GremlinTraversalParser) parseStepParams() ([]interface{}, error) {
 		case FALSE:
 			params = append(params, false)
 		default:
-			return nil, fmt.Errorf("Unexpected token while parsing parameters, got: %s", lit)
+			// a step keyword starts a sub traversal
+			if tok <= G {
+				return nil, fmt.Errorf("Unexpected token while parsing parameters, got: %s", lit)
+			}
+			p.unscan()
+
+			seq, err := p.parseSubTraversal()
+			if err != nil {
+				return nil, err
+			}
+			params = append(params, seq)
 		}
 		tok, lit = p.scanIgnoreWhitespace()
 	}
@@ -1079,6 +1721,51 @@ func (p *GremlinTraversalParser) parseStepParams() ([]interface{}, error) {
 	return params, nil
 }
 
+// parseSubTraversal parses dot-delimited steps not starting with `G`,
+// like `Out().Has("Type", "bridge")`
+func (p *GremlinTraversalParser) parseSubTraversal() (*GremlinTraversalSequence, error) {
+	seq := &GremlinTraversalSequence{
+		extensions: p.extensions,
+		indexes:    p.indexes,
+	}
+
+	for {
+		step, err := p.parserStep()
+		if err != nil {
+			return nil, err
+		}
+		seq.steps = append(seq.steps, step)
+
+		if tok, _ := p.scanIgnoreWhitespace(); tok != DOT {
+			p.unscan()
+			break
+		}
+	}
+
+	steps, err := seq.reduce()
+	if err != nil {
+		return nil, err
+	}
+	seq.steps = steps
+
+	return seq, nil
+}
+
+func checkSubTraversalParams(name string, params []interface{}, min, max int) error {
+	if len(params) < min || (max != 0 && len(params) > max) {
+		if min == max {
+			return fmt.Errorf("%s requires %d sub traversal : %v", name, min, params)
+		}
+		return fmt.Errorf("%s requires at least %d sub traversal : %v", name, min, params)
+	}
+	for _, param := range params {
+		if _, ok := param.(*GremlinTraversalSequence); !ok {
+			return fmt.Errorf("%s parameters have to be sub traversals : %v", name, params)
+		}
+	}
+	return nil
+}
+
 func (p *GremlinTraversalParser) parserStep() (GremlinTraversalStep, error) {
 	tok, lit := p.scanIgnoreWhitespace()
 	if tok == IDENT {
@@ -1170,10 +1857,26 @@ func (p *GremlinTraversalParser) parserStep() (GremlinTraversalStep, error) {
 			return nil, fmt.Errorf("HasKey accepts only one parameter of type string : %v", params)
 		}
 	case SHORTESTPATHTO:
-		if len(params) == 0 || len(params) > 2 {
-			return nil, fmt.Errorf("ShortestPathTo predicate accepts only 1 or 2 parameters : %v", params)
+		if _, _, _, err := parsePathToParams("ShortestPathTo", params); err != nil {
+			return nil, err
 		}
 		return &GremlinTraversalStepShortestPathTo{gremlinStepContext}, nil
+	case KSHORTESTPATHSTO:
+		if len(params) == 0 {
+			return nil, fmt.Errorf("KShortestPathsTo requires the number of paths : %v", params)
+		}
+		if k, ok := params[0].(int64); !ok || k <= 0 {
+			return nil, fmt.Errorf("KShortestPathsTo number of paths has to be a positive integer : %v", params)
+		}
+		if _, _, _, err := parsePathToParams("KShortestPathsTo", params[1:]); err != nil {
+			return nil, err
+		}
+		return &GremlinTraversalStepKShortestPathsTo{gremlinStepContext}, nil
+	case ALLPATHSTO:
+		if _, _, _, err := parsePathToParams("AllPathsTo", params); err != nil {
+			return nil, err
+		}
+		return &GremlinTraversalStepAllPathsTo{gremlinStepContext}, nil
 	case BOTH:
 		return &GremlinTraversalStepBoth{gremlinStepContext}, nil
 	case CONTEXT:
@@ -1241,6 +1944,97 @@ func (p *GremlinTraversalParser) parserStep() (GremlinTraversalStep, error) {
 		}
 
 		return &GremlinTraversalStepSelect{gremlinStepContext}, nil
+	case WHERE:
+		if err := checkSubTraversalParams("Where", params, 1, 1); err != nil {
+			return nil, err
+		}
+		return &GremlinTraversalStepWhere{gremlinStepContext}, nil
+	case NOT:
+		if err := checkSubTraversalParams("Not", params, 1, 1); err != nil {
+			return nil, err
+		}
+		return &GremlinTraversalStepNot{gremlinStepContext}, nil
+	case AND:
+		if err := checkSubTraversalParams("And", params, 1, 0); err != nil {
+			return nil, err
+		}
+		return &GremlinTraversalStepAnd{gremlinStepContext}, nil
+	case OR:
+		if err := checkSubTraversalParams("Or", params, 1, 0); err != nil {
+			return nil, err
+		}
+		return &GremlinTraversalStepOr{gremlinStepContext}, nil
+	case REPEAT:
+		if err := checkSubTraversalParams("Repeat", params, 1, 1); err != nil {
+			return nil, err
+		}
+		return &GremlinTraversalStepRepeat{GremlinTraversalContext: gremlinStepContext}, nil
+	case TIMES:
+		if len(params) != 1 {
+			return nil, fmt.Errorf("Times requires 1 parameter : %v", params)
+		}
+		if times, ok := params[0].(int64); !ok || times <= 0 {
+			return nil, fmt.Errorf("Times parameter has to be a positive integer : %v", params)
+		}
+		return &GremlinTraversalStepTimes{gremlinStepContext}, nil
+	case UNTIL:
+		if err := checkSubTraversalParams("Until", params, 1, 1); err != nil {
+			return nil, err
+		}
+		return &GremlinTraversalStepUntil{gremlinStepContext}, nil
+	case EMIT:
+		if len(params) != 0 {
+			return nil, fmt.Errorf("Emit accepts no parameter : %v", params)
+		}
+		return &GremlinTraversalStepEmit{gremlinStepContext}, nil
+	case GROUPCOUNT:
+		if len(params) != 1 {
+			return nil, fmt.Errorf("GroupCount requires 1 parameter : %v", params)
+		}
+		if _, ok := params[0].(string); !ok {
+			return nil, fmt.Errorf("GroupCount parameter has to be a string key : %v", params)
+		}
+		return &GremlinTraversalStepGroupCount{gremlinStepContext}, nil
+	case GROUP:
+		if len(params) != 0 {
+			return nil, fmt.Errorf("Group accepts no parameter, use By : %v", params)
+		}
+		return &GremlinTraversalStepGroup{GremlinTraversalContext: gremlinStepContext}, nil
+	case BY:
+		if len(params) != 1 {
+			return nil, fmt.Errorf("By requires 1 parameter : %v", params)
+		}
+		return &GremlinTraversalStepBy{gremlinStepContext}, nil
+	case PROJECT:
+		if len(params) == 0 {
+			return nil, fmt.Errorf("Project requires at least one key : %v", params)
+		}
+		for _, param := range params {
+			if _, ok := param.(string); !ok {
+				return nil, fmt.Errorf("Project parameters have to be string keys : %v", params)
+			}
+		}
+		return &GremlinTraversalStepProject{gremlinStepContext}, nil
+	case PATH:
+		if len(params) != 0 {
+			return nil, fmt.Errorf("Path accepts no parameter, use By : %v", params)
+		}
+		return &GremlinTraversalStepPath{GremlinTraversalContext: gremlinStepContext}, nil
+	case DIFF:
+		if len(params) == 0 || len(params) > 2 {
+			return nil, fmt.Errorf("Diff requires one or two time parameters : %v", params)
+		}
+		return &GremlinTraversalStepDiff{gremlinStepContext}, nil
+	case REVISIONS:
+		if len(params) != 0 {
+			return nil, fmt.Errorf("Revisions accepts no parameter : %v", params)
+		}
+		return &GremlinTraversalStepRevisions{gremlinStepContext}, nil
+	case EXPLAIN:
+		if len(params) != 0 {
+			return nil, fmt.Errorf("Explain accepts no parameter : %v", params)
+		}
+		return &GremlinTraversalStepExplain{gremlinStepContext}, nil
 	}
 
 	// extensions
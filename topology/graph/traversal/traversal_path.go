@@ -0,0 +1,124 @@
+/*
+ * Copyright (C) 2018 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package traversal
+
+import (
+	"errors"
+)
+
+// graphPath is the ordered list of the nodes and edges walked by a traverser
+type graphPath []interface{}
+
+// extend returns a copy of the path with the given node or edge appended,
+// nil if the paths are not tracked
+func (p graphPath) extend(e interface{}) graphPath {
+	if p == nil {
+		return nil
+	}
+	np := make(graphPath, len(p), len(p)+1)
+	copy(np, p)
+	return append(np, e)
+}
+
+// ParsePathParameter returns the optional key used to project the
+// elements of the paths
+func ParsePathParameter(s ...interface{}) (string, error) {
+	switch len(s) {
+	case 0:
+		return "", nil
+	case 1:
+		key, ok := s[0].(string)
+		if !ok {
+			return "", errors.New("Path key has to be a string")
+		}
+		return key, nil
+	default:
+		return "", errors.New("Path accepts at most 1 key")
+	}
+}
+
+// pathsToValue returns the paths as a value step, each element being
+// replaced by the value of the key if given, nil if the element has no
+// such field
+func pathsToValue(gt *GraphTraversal, paths []graphPath, keys ...interface{}) *GraphTraversalValue {
+	key, err := ParsePathParameter(keys...)
+	if err != nil {
+		return NewGraphTraversalValueFromError(err)
+	}
+
+	gt.RLock()
+	defer gt.RUnlock()
+
+	values := make([]interface{}, len(paths))
+	for i, p := range paths {
+		path := make([]interface{}, len(p))
+		for j, e := range p {
+			if key == "" {
+				path[j] = e
+			} else if v, err := e.(FieldGetter).GetField(key); err == nil {
+				path[j] = v
+			}
+		}
+		values[i] = path
+	}
+
+	return NewGraphTraversalValue(gt, values)
+}
+
+// Path step returns for each node the nodes and edges walked to reach it,
+// starting with the element of the first step. If the paths were not
+// tracked, each path is only made of the node.
+func (tv *GraphTraversalV) Path(ctx StepContext, keys ...interface{}) *GraphTraversalValue {
+	if tv.error != nil {
+		return NewGraphTraversalValueFromError(tv.error)
+	}
+
+	paths := tv.paths
+	if paths == nil {
+		paths = make([]graphPath, len(tv.nodes))
+		for i, n := range tv.nodes {
+			paths[i] = graphPath{n}
+		}
+	}
+
+	return pathsToValue(tv.GraphTraversal, paths, keys...)
+}
+
+// Path step returns for each edge the nodes and edges walked to reach it,
+// starting with the element of the first step. If the paths were not
+// tracked, each path is only made of the edge.
+func (te *GraphTraversalE) Path(ctx StepContext, keys ...interface{}) *GraphTraversalValue {
+	if te.error != nil {
+		return NewGraphTraversalValueFromError(te.error)
+	}
+
+	paths := te.paths
+	if paths == nil {
+		paths = make([]graphPath, len(te.edges))
+		for i, e := range te.edges {
+			paths[i] = graphPath{e}
+		}
+	}
+
+	return pathsToValue(te.GraphTraversal, paths, keys...)
+}
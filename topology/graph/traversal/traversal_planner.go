@@ -0,0 +1,273 @@
+/*
+ * Copyright (C) 2018 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package traversal
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/skydive-project/skydive/filters"
+	"github.com/skydive-project/skydive/topology/graph"
+)
+
+// MetadataIndex indexes the nodes and the edges of a graph by the string
+// values of metadata keys so that the queries starting with V().Has() or
+// E().Has() on these keys do not have to scan the whole graph
+type MetadataIndex struct {
+	graph   *graph.Graph
+	keys    map[string]bool
+	indexer *graph.Indexer
+}
+
+func indexHash(key, value string) string {
+	return key + "\x00" + value
+}
+
+// indexValues returns the string values of a key, the elements of a list
+// being indexed separately as Has matches any of them
+func indexValues(g filters.Getter, key string) (values []string) {
+	field, err := g.GetField(key)
+	if err != nil {
+		return nil
+	}
+
+	switch field := field.(type) {
+	case string:
+		values = append(values, field)
+	case []string:
+		values = append(values, field...)
+	case []interface{}:
+		for _, intf := range field {
+			if s, ok := intf.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+	return
+}
+
+func (m *MetadataIndex) hash(g filters.Getter) map[string]interface{} {
+	kv := make(map[string]interface{})
+	for key := range m.keys {
+		for _, value := range indexValues(g, key) {
+			kv[indexHash(key, value)] = nil
+		}
+	}
+	return kv
+}
+
+// Start indexes the graph and follows its updates
+func (m *MetadataIndex) Start() {
+	m.graph.RLock()
+	defer m.graph.RUnlock()
+
+	for _, n := range m.graph.GetNodes(nil) {
+		m.indexer.OnNodeAdded(n)
+	}
+	for _, e := range m.graph.GetEdges(nil) {
+		m.indexer.OnEdgeAdded(e)
+	}
+	m.indexer.Start()
+}
+
+// Stop stops following the updates of the graph
+func (m *MetadataIndex) Stop() {
+	m.indexer.Stop()
+}
+
+// NewMetadataIndex returns a new index of the nodes and edges of the graph
+// on the given metadata keys
+func NewMetadataIndex(g *graph.Graph, keys ...string) *MetadataIndex {
+	m := &MetadataIndex{
+		graph: g,
+		keys:  make(map[string]bool),
+	}
+	for _, key := range keys {
+		m.keys[key] = true
+	}
+
+	m.indexer = graph.NewElementIndexer(g, g,
+		func(n *graph.Node) map[string]interface{} { return m.hash(n) },
+		func(e *graph.Edge) map[string]interface{} { return m.hash(e) },
+		false)
+
+	return m
+}
+
+// gremlinTraversalStepIndexLookup replaces a V or E step filtering on an
+// indexed key, the candidates returned by the index being then filtered
+// by the step parameters
+type gremlinTraversalStepIndexLookup struct {
+	GremlinTraversalStep
+	index *MetadataIndex
+	key   string
+	value string
+}
+
+// Exec index lookup step
+func (s *gremlinTraversalStepIndexLookup) Exec(last GraphTraversalStep) (GraphTraversalStep, error) {
+	gt, ok := last.(*GraphTraversal)
+	if !ok {
+		return nil, ErrExecutionError
+	}
+
+	if gt.error != nil {
+		return nil, gt.error
+	}
+
+	ctx := s.Context()
+	matcher, err := ParamsToMetadataFilter(filters.BoolFilterOp_AND, ctx.Params...)
+	if err != nil {
+		return nil, err
+	}
+
+	gt.RLock()
+	defer gt.RUnlock()
+
+	it := ctx.StepContext.PaginationRange.Iterator()
+	hash := indexHash(s.key, s.value)
+
+	if _, ok := s.GremlinTraversalStep.(*GremlinTraversalStepE); ok {
+		candidates, _ := s.index.indexer.EdgesFromHash(hash)
+
+		var edges []*graph.Edge
+		for _, e := range candidates {
+			if it.Done() {
+				break
+			} else if e.MatchMetadata(matcher) && it.Next() {
+				edges = append(edges, e)
+			}
+		}
+		return NewGraphTraversalE(gt, edges), nil
+	}
+
+	candidates, _ := s.index.indexer.FromHash(hash)
+
+	var nodes []*graph.Node
+	for _, n := range candidates {
+		if it.Done() {
+			break
+		} else if n.MatchMetadata(matcher) && it.Next() {
+			nodes = append(nodes, n)
+		}
+	}
+	return NewGraphTraversalV(gt, nodes), nil
+}
+
+// lookupIndex returns the index and the key/value pair to be used for the
+// V or E parameters, a nil index if the step has to scan the graph
+func (s *GremlinTraversalSequence) lookupIndex(g *graph.Graph, params []interface{}) (*MetadataIndex, string, string) {
+	// only plain string values are looked up, predicates are evaluated
+	// on the whole graph
+	for i := 0; i+1 < len(params); i += 2 {
+		key, ok := params[i].(string)
+		if !ok {
+			continue
+		}
+		value, ok := params[i+1].(string)
+		if !ok {
+			continue
+		}
+
+		for _, index := range s.indexes {
+			if index.graph == g && index.keys[key] {
+				return index, key, value
+			}
+		}
+	}
+	return nil, "", ""
+}
+
+// plan rewrites the leading V().Has() or E().Has() filter into an index
+// lookup when the graph is indexed on one of the filtered keys
+func (s *GremlinTraversalSequence) plan(g *graph.Graph, steps []GremlinTraversalStep) []GremlinTraversalStep {
+	if len(steps) == 0 || len(s.indexes) == 0 {
+		return steps
+	}
+
+	switch steps[0].(type) {
+	case *GremlinTraversalStepV, *GremlinTraversalStepE:
+	default:
+		return steps
+	}
+
+	params := steps[0].Context().Params
+	if len(params) < 2 || len(params)%2 != 0 {
+		return steps
+	}
+
+	index, key, value := s.lookupIndex(g, params)
+	if index == nil {
+		return steps
+	}
+
+	planned := make([]GremlinTraversalStep, len(steps))
+	copy(planned, steps)
+	planned[0] = &gremlinTraversalStepIndexLookup{GremlinTraversalStep: steps[0], index: index, key: key, value: value}
+
+	return planned
+}
+
+// stepName returns the name of a step as used in the queries
+func stepName(step GremlinTraversalStep) string {
+	t := reflect.TypeOf(step)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	name := strings.TrimPrefix(t.Name(), "GremlinTraversalStep")
+	return strings.TrimSuffix(name, "GremlinTraversalStep")
+}
+
+// explain returns the description of the execution plan of the steps
+func explain(steps []GremlinTraversalStep) []interface{} {
+	plan := []interface{}{}
+	for _, step := range steps {
+		ctx := step.Context()
+		desc := map[string]interface{}{"Step": stepName(step)}
+
+		switch step := step.(type) {
+		case *gremlinTraversalStepIndexLookup:
+			desc["Step"] = stepName(step.GremlinTraversalStep)
+			desc["Access"] = "IndexLookup"
+			desc["Index"] = step.key
+			desc["Value"] = step.value
+			desc["Params"] = ctx.Params
+		case *GremlinTraversalStepV, *GremlinTraversalStepE:
+			if len(ctx.Params) == 1 {
+				desc["Access"] = "IDLookup"
+			} else {
+				desc["Access"] = "FullScan"
+			}
+			if len(ctx.Params) > 0 {
+				desc["Params"] = ctx.Params
+			}
+		}
+
+		if r := ctx.StepContext.PaginationRange; r != nil {
+			desc["Range"] = r
+		}
+
+		plan = append(plan, desc)
+	}
+	return plan
+}
@@ -0,0 +1,143 @@
+/*
+ * Copyright (C) 2018 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package traversal
+
+import (
+	"sort"
+
+	"github.com/skydive-project/skydive/topology/graph"
+)
+
+// ElementRevision describes a version of a node or an edge, along with the
+// metadata changes since the previous version
+type ElementRevision struct {
+	Revision  int64
+	UpdatedAt int64
+	Metadata  graph.Metadata
+	Changes   []MetadataChange `json:",omitempty"`
+}
+
+// ElementRevisions describes the successive versions of a node or an edge
+type ElementRevisions struct {
+	ID        graph.Identifier
+	Revisions []ElementRevision
+}
+
+type versionedElement interface {
+	GetFieldInt64(field string) (int64, error)
+	Metadata() graph.Metadata
+}
+
+func newElementRevisions(id graph.Identifier, elements []versionedElement) ElementRevisions {
+	er := ElementRevisions{ID: id, Revisions: make([]ElementRevision, 0, len(elements))}
+
+	for _, e := range elements {
+		revision, _ := e.GetFieldInt64("Revision")
+		updatedAt, _ := e.GetFieldInt64("UpdatedAt")
+		er.Revisions = append(er.Revisions, ElementRevision{
+			Revision:  revision,
+			UpdatedAt: updatedAt,
+			Metadata:  e.Metadata(),
+		})
+	}
+
+	sort.SliceStable(er.Revisions, func(i, j int) bool {
+		return er.Revisions[i].Revision < er.Revisions[j].Revision
+	})
+
+	for i := 1; i < len(er.Revisions); i++ {
+		er.Revisions[i].Changes = diffMetadata("", er.Revisions[i-1].Metadata, er.Revisions[i].Metadata)
+	}
+
+	return er
+}
+
+// Revisions step : returns the successive versions of each node within the
+// time slice of the graph context, a single one out of a Context range
+func (tv *GraphTraversalV) Revisions(ctx StepContext) *GraphTraversalValue {
+	if tv.error != nil {
+		return NewGraphTraversalValueFromError(tv.error)
+	}
+
+	tv.GraphTraversal.RLock()
+	defer tv.GraphTraversal.RUnlock()
+
+	// a node is returned once per revision within a time slice
+	seen := make(map[graph.Identifier]bool)
+	values := []interface{}{}
+
+	it := ctx.PaginationRange.Iterator()
+	for _, n := range tv.nodes {
+		if seen[n.ID] {
+			continue
+		}
+		seen[n.ID] = true
+
+		if it.Done() {
+			break
+		} else if it.Next() {
+			var elements []versionedElement
+			for _, revision := range tv.GraphTraversal.Graph.GetNodeRevisions(n.ID) {
+				elements = append(elements, revision)
+			}
+			values = append(values, newElementRevisions(n.ID, elements))
+		}
+	}
+
+	return NewGraphTraversalValue(tv.GraphTraversal, values)
+}
+
+// Revisions step : returns the successive versions of each edge within the
+// time slice of the graph context, a single one out of a Context range
+func (te *GraphTraversalE) Revisions(ctx StepContext) *GraphTraversalValue {
+	if te.error != nil {
+		return NewGraphTraversalValueFromError(te.error)
+	}
+
+	te.GraphTraversal.RLock()
+	defer te.GraphTraversal.RUnlock()
+
+	// an edge is returned once per revision within a time slice
+	seen := make(map[graph.Identifier]bool)
+	values := []interface{}{}
+
+	it := ctx.PaginationRange.Iterator()
+	for _, e := range te.edges {
+		if seen[e.ID] {
+			continue
+		}
+		seen[e.ID] = true
+
+		if it.Done() {
+			break
+		} else if it.Next() {
+			var elements []versionedElement
+			for _, revision := range te.GraphTraversal.Graph.GetEdgeRevisions(e.ID) {
+				elements = append(elements, revision)
+			}
+			values = append(values, newElementRevisions(e.ID, elements))
+		}
+	}
+
+	return NewGraphTraversalValue(te.GraphTraversal, values)
+}
@@ -97,6 +97,25 @@ const (
 	NOW
 	AS
 	SELECT
+	WHERE
+	NOT
+	AND
+	OR
+	REPEAT
+	TIMES
+	UNTIL
+	EMIT
+	GROUPCOUNT
+	GROUP
+	BY
+	PROJECT
+	PATH
+	KSHORTESTPATHSTO
+	ALLPATHSTO
+	WEIGHT
+	EXPLAIN
+	DIFF
+	REVISIONS
 
 	TRUE
 	FALSE
@@ -307,6 +326,44 @@ func (s *GremlinTraversalScanner) scanIdent() (tok Token, lit string) {
 		return AS, buf.String()
 	case "SELECT":
 		return SELECT, buf.String()
+	case "WHERE":
+		return WHERE, buf.String()
+	case "NOT":
+		return NOT, buf.String()
+	case "AND":
+		return AND, buf.String()
+	case "OR":
+		return OR, buf.String()
+	case "REPEAT":
+		return REPEAT, buf.String()
+	case "TIMES":
+		return TIMES, buf.String()
+	case "UNTIL":
+		return UNTIL, buf.String()
+	case "EMIT":
+		return EMIT, buf.String()
+	case "GROUPCOUNT":
+		return GROUPCOUNT, buf.String()
+	case "GROUP":
+		return GROUP, buf.String()
+	case "BY":
+		return BY, buf.String()
+	case "PROJECT":
+		return PROJECT, buf.String()
+	case "PATH":
+		return PATH, buf.String()
+	case "KSHORTESTPATHSTO":
+		return KSHORTESTPATHSTO, buf.String()
+	case "ALLPATHSTO":
+		return ALLPATHSTO, buf.String()
+	case "WEIGHT":
+		return WEIGHT, buf.String()
+	case "EXPLAIN":
+		return EXPLAIN, buf.String()
+	case "DIFF":
+		return DIFF, buf.String()
+	case "REVISIONS":
+		return REVISIONS, buf.String()
 	case "TRUE":
 		return TRUE, buf.String()
 	case "FALSE":
@@ -23,8 +23,13 @@
 package traversal
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/skydive-project/skydive/common"
 	"github.com/skydive-project/skydive/topology/graph"
@@ -469,6 +474,77 @@ func TestTraversalShortestPathTo(t *testing.T) {
 	}
 }
 
+func TestTraversalKShortestPathsTo(t *testing.T) {
+	g := newTransversalGraph(t)
+
+	pathsToString := func(res GraphTraversalStep) string {
+		var s []string
+		for _, path := range res.Values() {
+			var values []string
+			for _, n := range path.([]*graph.Node) {
+				values = append(values, fmt.Sprintf("%v", n.Metadata()["Value"]))
+			}
+			s = append(s, strings.Join(values, "/"))
+		}
+		return strings.Join(s, " ")
+	}
+
+	query := `G.V().Has("Value", 1).AllPathsTo(Metadata("Value", 4))`
+	if s := pathsToString(execTraversalQuery(t, g, query)); s != "1/4 1/3/4 1/2/3/4" {
+		t.Fatalf("Should return 3 paths, returned: %s", s)
+	}
+
+	query = `G.V().Has("Value", 1).KShortestPathsTo(2, Metadata("Value", 4))`
+	if s := pathsToString(execTraversalQuery(t, g, query)); s != "1/4 1/3/4" {
+		t.Fatalf("Should return 2 paths, returned: %s", s)
+	}
+
+	query = `G.V().Has("Value", 1).KShortestPathsTo(5, Metadata("Value", 3), Metadata("Direction", "Left"))`
+	if s := pathsToString(execTraversalQuery(t, g, query)); s != "1/2/3" {
+		t.Fatalf("Should return 1 path, returned: %s", s)
+	}
+
+	// make the direct link more expensive
+	ctx := StepContext{}
+	e4 := NewGraphTraversal(g, false).E(ctx).Has(ctx, "Name", "e4").Values()[0].(*graph.Edge)
+	g.AddMetadata(e4, "Cost", 5)
+
+	query = `G.V().Has("Value", 1).ShortestPathTo(Metadata("Value", 4), Weight("Cost"))`
+	if s := pathsToString(execTraversalQuery(t, g, query)); s != "1/3/4" {
+		t.Fatalf("Should return the lightest path, returned: %s", s)
+	}
+
+	query = `G.V().Has("Value", 1).AllPathsTo(Metadata("Value", 4), Weight("Cost"))`
+	if s := pathsToString(execTraversalQuery(t, g, query)); s != "1/3/4 1/2/3/4 1/4" {
+		t.Fatalf("Should return the paths from the lightest, returned: %s", s)
+	}
+
+	// prefer the fastest links
+	g.AddMetadata(e4, "Speed", 1)
+	for _, name := range []string{"e3", "e5"} {
+		e := NewGraphTraversal(g, false).E(ctx).Has(ctx, "Name", name).Values()[0].(*graph.Edge)
+		g.AddMetadata(e, "Speed", 100)
+	}
+
+	query = `G.V().Has("Value", 1).ShortestPathTo(Metadata("Value", 4), Weight("Speed", "inverse"))`
+	if s := pathsToString(execTraversalQuery(t, g, query)); s != "1/3/4" {
+		t.Fatalf("Should return the fastest path, returned: %s", s)
+	}
+
+	query = `G.V().Has("Value", 1).ShortestPathTo(Metadata("Value", 4), Weight("Speed"))`
+	if s := pathsToString(execTraversalQuery(t, g, query)); s != "1/4" {
+		t.Fatalf("Should return the path with the lowest speed, returned: %s", s)
+	}
+
+	if _, err := NewGremlinTraversalParser().Parse(strings.NewReader(`G.V().AllPathsTo(Metadata("Value", 4), Weight("Speed", "reverse"))`)); err == nil {
+		t.Fatal("Weight should only accept the inverse mode")
+	}
+
+	if _, err := NewGremlinTraversalParser().Parse(strings.NewReader(`G.V().KShortestPathsTo(0, Metadata("Value", 4))`)); err == nil {
+		t.Fatal("KShortestPathsTo should only accept a positive number of paths")
+	}
+}
+
 func TestTraversalBothV(t *testing.T) {
 	g := newTransversalGraph(t)
 	ctx := StepContext{}
@@ -509,6 +585,464 @@ func TestTraversalSubGraph(t *testing.T) {
 	}
 }
 
+func TestTraversalWhere(t *testing.T) {
+	g := newTransversalGraph(t)
+	ctx := StepContext{}
+
+	tr := NewGraphTraversal(g, false)
+
+	toNode4 := func(start GraphTraversalStep) (GraphTraversalStep, error) {
+		return start.(*GraphTraversalV).Out(ctx).Has(ctx, "Name", "Node4"), nil
+	}
+
+	tv := tr.V(ctx).Where(ctx, toNode4)
+	if len(tv.Values()) != 2 {
+		t.Fatalf("Should return 2 nodes, returned: %v", tv.Values())
+	}
+
+	tv = tr.V(ctx).Not(ctx, toNode4)
+	if len(tv.Values()) != 2 {
+		t.Fatalf("Should return 2 nodes, returned: %v", tv.Values())
+	}
+
+	query := `G.V().Not(Out())`
+	res := execTraversalQuery(t, g, query)
+	if len(res.Values()) != 1 {
+		t.Fatalf("Should return 1 node, returned: %v", res.Values())
+	}
+
+	query = `G.V().And(Out(), In())`
+	res = execTraversalQuery(t, g, query)
+	if len(res.Values()) != 2 {
+		t.Fatalf("Should return 2 nodes, returned: %v", res.Values())
+	}
+
+	query = `G.V().Or(Has("Name", "Node4"), Out().Has("Value", 2))`
+	res = execTraversalQuery(t, g, query)
+	if len(res.Values()) != 2 {
+		t.Fatalf("Should return 2 nodes, returned: %v", res.Values())
+	}
+
+	query = `G.V().Where(Out().Where(Out().Has("Name", "Node4"))).Has("Type", "intf")`
+	res = execTraversalQuery(t, g, query)
+	if len(res.Values()) != 2 {
+		t.Fatalf("Should return 2 nodes, returned: %v", res.Values())
+	}
+
+	query = `G.E().Where(OutV().Has("Name", "Node4"))`
+	res = execTraversalQuery(t, g, query)
+	if len(res.Values()) != 2 {
+		t.Fatalf("Should return 2 edges, returned: %v", res.Values())
+	}
+
+	if _, err := NewGremlinTraversalParser().Parse(strings.NewReader(`G.V().Where("Type")`)); err == nil {
+		t.Fatal("Where should only accept a sub traversal")
+	}
+}
+
+func TestTraversalRepeat(t *testing.T) {
+	g := newTransversalGraph(t)
+
+	query := `G.V().Has("Value", 2).Repeat(Out()).Times(2)`
+	res := execTraversalQuery(t, g, query)
+	if len(res.Values()) != 1 || res.Values()[0].(*graph.Node).Metadata()["Value"] != int64(4) {
+		t.Fatalf("Should return Node4, returned: %v", res.Values())
+	}
+
+	query = `G.V().Has("Value", 2).Repeat(Out()).Emit()`
+	res = execTraversalQuery(t, g, query)
+	if len(res.Values()) != 2 {
+		t.Fatalf("Should return 2 nodes, returned: %v", res.Values())
+	}
+
+	query = `G.V().Has("Value", 2).Repeat(Out())`
+	res = execTraversalQuery(t, g, query)
+	if len(res.Values()) != 1 {
+		t.Fatalf("Should return 1 node, returned: %v", res.Values())
+	}
+
+	query = `G.V().Has("Value", 1).Repeat(Out()).Until(Has("Name", "Node4"))`
+	res = execTraversalQuery(t, g, query)
+	if len(res.Values()) != 1 {
+		t.Fatalf("Should return 1 node, returned: %v", res.Values())
+	}
+
+	// create a cycle
+	ctx := StepContext{}
+	tr := NewGraphTraversal(g, false)
+	n1 := tr.V(ctx).Has(ctx, "Value", 1).Values()[0].(*graph.Node)
+	n4 := tr.V(ctx).Has(ctx, "Value", 4).Values()[0].(*graph.Node)
+	g.Link(n4, n1, graph.Metadata{"Name": "e6"})
+
+	query = `G.V().Has("Value", 1).Repeat(Out()).Emit()`
+	res = execTraversalQuery(t, g, query)
+	if len(res.Values()) != 3 {
+		t.Fatalf("Should return 3 nodes, returned: %v", res.Values())
+	}
+
+	out := func(start GraphTraversalStep) (GraphTraversalStep, error) {
+		return start.(*GraphTraversalV).Out(ctx), nil
+	}
+	if tv := tr.V(ctx).Repeat(ctx, out, RepeatOptions{Times: 1000}); tv.Error() == nil {
+		t.Fatal("Repeat should be limited by the maximum depth")
+	}
+
+	if _, err := NewGremlinTraversalParser().Parse(strings.NewReader(`G.V().Repeat(Out()).Times(0)`)); err == nil {
+		t.Fatal("Times should only accept a positive integer")
+	}
+}
+
+func TestTraversalGroup(t *testing.T) {
+	g := newTransversalGraph(t)
+
+	query := `G.V().GroupCount("Type")`
+	res := execTraversalQuery(t, g, query)
+	if b, _ := json.Marshal(res); string(b) != `{"intf":2}` {
+		t.Fatalf("Should return 2 intf, returned: %s", string(b))
+	}
+
+	query = `G.E().GroupCount("Direction")`
+	res = execTraversalQuery(t, g, query)
+	if b, _ := json.Marshal(res); string(b) != `{"Left":2}` {
+		t.Fatalf("Should return 2 Left edges, returned: %s", string(b))
+	}
+
+	query = `G.V().Group().By("Type").By(Count())`
+	res = execTraversalQuery(t, g, query)
+	if b, _ := json.Marshal(res); string(b) != `{"intf":2}` {
+		t.Fatalf("Should return 2 intf, returned: %s", string(b))
+	}
+
+	query = `G.V().Group().By("Type").By(Values("Value"))`
+	res = execTraversalQuery(t, g, query)
+	if b, _ := json.Marshal(res); string(b) != `{"intf":[1,2]}` {
+		t.Fatalf("Should return the values of the intf, returned: %s", string(b))
+	}
+
+	query = `G.V().Group().By("Type")`
+	res = execTraversalQuery(t, g, query)
+	if groups := res.Values()[0].(map[string]interface{}); len(groups["intf"].([]interface{})) != 2 {
+		t.Fatalf("Should return 2 intf, returned: %v", res.Values())
+	}
+
+	query = `G.V().Has("Value", 4).Project("Value", "Name", "Type")`
+	res = execTraversalQuery(t, g, query)
+	if b, _ := json.Marshal(res); string(b) != `[{"Name":"Node4","Type":null,"Value":4}]` {
+		t.Fatalf("Should return the projection of Node4, returned: %s", string(b))
+	}
+
+	ts, err := NewGremlinTraversalParser().Parse(strings.NewReader(`G.V().Group().By("Type").By(Count()).By(Count())`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ts.Exec(g, false); err == nil {
+		t.Fatal("Group should accept at most 2 By steps")
+	}
+}
+
+func TestTraversalPath(t *testing.T) {
+	g := newTransversalGraph(t)
+
+	query := `G.V().Has("Value", 1).Out().Out().Path().By("Value")`
+	res := execTraversalQuery(t, g, query)
+	var paths []string
+	for _, path := range res.Values() {
+		b, _ := json.Marshal(path)
+		paths = append(paths, string(b))
+	}
+	sort.Strings(paths)
+	if strings.Join(paths, ",") != "[1,2,3],[1,3,4]" {
+		t.Fatalf("Should return 2 paths, returned: %v", paths)
+	}
+
+	query = `G.V().Has("Value", 3).OutE().OutV().Path().By("Value")`
+	res = execTraversalQuery(t, g, query)
+	if b, _ := json.Marshal(res); string(b) != `[[3,null,4]]` {
+		t.Fatalf("Should return the path through the edge, returned: %s", string(b))
+	}
+
+	query = `G.V().Has("Value", 2).Repeat(Out()).Times(2).Path().By("Value")`
+	res = execTraversalQuery(t, g, query)
+	if b, _ := json.Marshal(res); string(b) != `[[2,3,4]]` {
+		t.Fatalf("Should return the walked path, returned: %s", string(b))
+	}
+
+	query = `G.V().Has("Value", 4).In().Has("Value", 3).Path()`
+	res = execTraversalQuery(t, g, query)
+	path := res.Values()[0].([]interface{})
+	if len(path) != 2 || path[0].(*graph.Node).Metadata()["Value"] != int64(4) {
+		t.Fatalf("Should return Node4 and its parent, returned: %v", res.Values())
+	}
+
+	// paths not tracked, only the last node is returned
+	ctx := StepContext{}
+	tr := NewGraphTraversal(g, false)
+	if res := tr.V(ctx).Has(ctx, "Value", 1).Out(ctx).Path(ctx); len(res.Values()[0].([]interface{})) != 1 {
+		t.Fatalf("Should return paths of 1 node, returned: %v", res.Values())
+	}
+}
+
+func TestLiveQuery(t *testing.T) {
+	g := newTransversalGraph(t)
+
+	newLiveQuery := func(query string, interval time.Duration) (*LiveQuery, []interface{}) {
+		ts, err := NewGremlinTraversalParser().Parse(strings.NewReader(query))
+		if err != nil {
+			t.Fatal(err)
+		}
+		lq, values, err := NewLiveQuery(g, ts, interval)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return lq, values
+	}
+
+	lq, values := newLiveQuery(`G.V().Has("Type", "intf").HasKey("Bytes")`, 0)
+	if len(values) != 2 {
+		t.Fatalf("Should return 2 nodes, returned: %v", values)
+	}
+
+	ctx := StepContext{}
+	n3 := NewGraphTraversal(g, false).V(ctx).Has(ctx, "Value", 3).Values()[0].(*graph.Node)
+	g.AddMetadata(n3, "Type", "intf")
+	if delta, _ := lq.Update(n3, false); !delta.Empty() {
+		t.Fatalf("Node3 has no Bytes, returned: %+v", delta)
+	}
+
+	g.AddMetadata(n3, "Bytes", 3024)
+	if delta, _ := lq.Update(n3, false); len(delta.Added) != 1 || delta.Added[0] != n3 {
+		t.Fatalf("Node3 should be added, returned: %+v", delta)
+	}
+
+	g.AddMetadata(n3, "Bytes", 4024)
+	if delta, _ := lq.Update(n3, false); len(delta.Updated) != 1 || len(delta.Added) != 0 {
+		t.Fatalf("Node3 should be updated, returned: %+v", delta)
+	}
+
+	g.DelNode(n3)
+	if delta, _ := lq.Update(n3, true); len(delta.Removed) != 1 {
+		t.Fatalf("Node3 should be removed, returned: %+v", delta)
+	}
+
+	// not local, the whole query is evaluated
+	lq, values = newLiveQuery(`G.V().Has("Value", 1).Out()`, 0)
+	if len(values) != 2 {
+		t.Fatalf("Should return 2 nodes, returned: %v", values)
+	}
+
+	// neither linked to the nodes of the query nor matching its first step
+	execs := lq.execs
+	n6 := g.NewNode(graph.GenID(), graph.Metadata{"Value": int64(6)})
+	if delta, _ := lq.Update(n6, false); !delta.Empty() || lq.execs != execs {
+		t.Fatalf("Node6 should not trigger an execution, returned: %+v", delta)
+	}
+
+	n1 := NewGraphTraversal(g, false).V(ctx).Has(ctx, "Value", 1).Values()[0].(*graph.Node)
+	n5 := g.NewNode(graph.GenID(), graph.Metadata{"Value": int64(5)})
+	e := g.Link(n1, n5, nil)
+	if delta, _ := lq.Update(e, false); len(delta.Added) != 1 || delta.Added[0] != n5 || lq.execs != execs+1 {
+		t.Fatalf("Node5 should be added, returned: %+v", delta)
+	}
+
+	// executions coalesced within the refresh interval
+	lq, _ = newLiveQuery(`G.V().Has("Value", 1).Out()`, time.Hour)
+	execs = lq.execs
+	n7 := g.NewNode(graph.GenID(), graph.Metadata{"Value": int64(7)})
+	e = g.Link(n1, n7, nil)
+	if delta, _ := lq.Update(e, false); !delta.Empty() || !lq.Pending() || lq.execs != execs {
+		t.Fatalf("Change should be pending, returned: %+v", delta)
+	}
+
+	g.AddMetadata(n7, "Name", "node7")
+	if delta, _ := lq.Update(n7, false); !delta.Empty() || lq.execs != execs {
+		t.Fatalf("Change should be pending, returned: %+v", delta)
+	}
+
+	if delta, _ := lq.Flush(); len(delta.Added) != 1 || delta.Added[0] != n7 || lq.Pending() || lq.execs != execs+1 {
+		t.Fatalf("Node7 should be added once flushed, returned: %+v", delta)
+	}
+
+	ts, _ := NewGremlinTraversalParser().Parse(strings.NewReader(`G.V().Count()`))
+	if _, _, err := NewLiveQuery(g, ts, 0); err == nil {
+		t.Fatal("Live queries should only return nodes or edges")
+	}
+}
+
+func TestQueryLimits(t *testing.T) {
+	g := newTransversalGraph(t)
+
+	execWithLimits := func(ctx context.Context, query string, limits QueryLimits) error {
+		ts, err := NewGremlinTraversalParser().Parse(strings.NewReader(query))
+		if err != nil {
+			t.Fatalf("%s: %s", query, err)
+		}
+		_, err = ts.ExecWithContext(ctx, g, false, limits)
+		return err
+	}
+
+	if err := execWithLimits(context.Background(), `G.V()`, QueryLimits{MaxVisited: 4, MaxResultSize: 4}); err != nil {
+		t.Fatalf("Should be within the limits, returned: %s", err)
+	}
+
+	if err := execWithLimits(context.Background(), `G.V().Out()`, QueryLimits{MaxVisited: 4}); err == nil {
+		t.Fatal("Should exceed the maximum number of visited elements")
+	}
+
+	if err := execWithLimits(context.Background(), `G.V()`, QueryLimits{MaxResultSize: 3}); err == nil {
+		t.Fatal("Should exceed the maximum result size")
+	}
+
+	if err := execWithLimits(context.Background(), `G.V().Has("Value", 1).AllPathsTo(Metadata("Value", 4))`, QueryLimits{MaxResultSize: 5}); err == nil {
+		t.Fatal("Path search should exceed the maximum result size")
+	}
+
+	if err := execWithLimits(context.Background(), `G.V().Has("Value", 1).KShortestPathsTo(3, Metadata("Value", 4))`, QueryLimits{MaxResultSize: 9}); err != nil {
+		t.Fatalf("Path search should be within the limits, returned: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := execWithLimits(ctx, `G.V().Repeat(Out()).Emit()`, QueryLimits{}); err != ErrQueryCanceled {
+		t.Fatalf("Should be canceled, returned: %v", err)
+	}
+}
+
+func TestTraversalIndex(t *testing.T) {
+	g := newTransversalGraph(t)
+
+	index := NewMetadataIndex(g, "Name", "IPV4")
+	index.Start()
+	defer index.Stop()
+
+	p := NewGremlinTraversalParser()
+	p.AddIndex(index)
+
+	exec := func(query string) GraphTraversalStep {
+		ts, err := p.Parse(strings.NewReader(query))
+		if err != nil {
+			t.Fatalf("%s: %s", query, err)
+		}
+		res, err := ts.Exec(g, false)
+		if err != nil {
+			t.Fatalf("%s: %s", query, err)
+		}
+		return res
+	}
+
+	res := exec(`G.V().Has("Name", "Node4").Explain()`)
+	plan := res.Values()[0].(map[string]interface{})
+	if plan["Access"] != "IndexLookup" || plan["Index"] != "Name" {
+		t.Fatalf("Should use the Name index, returned: %v", plan)
+	}
+
+	res = exec(`G.V().Has("Value", 4).Explain()`)
+	if plan := res.Values()[0].(map[string]interface{}); plan["Access"] != "FullScan" {
+		t.Fatalf("Should scan the graph, returned: %v", plan)
+	}
+
+	if res = exec(`G.V().Has("Name", "Node4", "Value", 4)`); len(res.Values()) != 1 {
+		t.Fatalf("Should return 1 node, returned: %v", res.Values())
+	}
+
+	if res = exec(`G.V().Has("Name", "Node4", "Value", 3)`); len(res.Values()) != 0 {
+		t.Fatalf("Should return no node, returned: %v", res.Values())
+	}
+
+	if res = exec(`G.V().Has("IPV4", "10.0.1.2")`); len(res.Values()) != 1 {
+		t.Fatalf("Should return 1 node, returned: %v", res.Values())
+	}
+
+	if res = exec(`G.E().Has("Name", "e3").OutV()`); len(res.Values()) != 1 {
+		t.Fatalf("Should return 1 node, returned: %v", res.Values())
+	}
+
+	// index following the graph updates
+	n5 := g.NewNode(graph.GenID(), graph.Metadata{"Name": "Node5"})
+	if res = exec(`G.V().Has("Name", "Node5")`); len(res.Values()) != 1 {
+		t.Fatalf("Should return 1 node, returned: %v", res.Values())
+	}
+
+	g.AddMetadata(n5, "Name", "Node6")
+	if res = exec(`G.V().Has("Name", "Node5")`); len(res.Values()) != 0 {
+		t.Fatalf("Should return no node, returned: %v", res.Values())
+	}
+}
+
+func TestGraphChangeset(t *testing.T) {
+	g1 := newGraph(t)
+	g2 := newGraph(t)
+
+	g1.NewNode(graph.Identifier("N1"), graph.Metadata{"Name": "eth0", "MTU": int64(1500), "Neutron": map[string]interface{}{"PortID": "p1"}})
+	g1.NewNode(graph.Identifier("N2"), graph.Metadata{"Name": "eth1"})
+	g1.NewNode(graph.Identifier("N3"), graph.Metadata{"Name": "eth2"})
+	g1.NewNode(graph.Identifier("N4"), graph.Metadata{"Name": "eth3"})
+
+	n1 := g2.NewNode(graph.Identifier("N1"), graph.Metadata{"Name": "eth0", "MTU": int64(9000), "Neutron": map[string]interface{}{"PortID": "p2"}, "State": "UP"})
+	g2.NewNode(graph.Identifier("N2"), graph.Metadata{"Name": "eth1"})
+	n4 := g2.NewNode(graph.Identifier("N4"), graph.Metadata{"Name": "eth3"})
+	g2.NewEdge(graph.Identifier("E1"), n1, n4, nil)
+
+	cs := newGraphChangeset(time.Unix(0, 0), time.Unix(1, 0), g1, g2)
+	if len(cs.AddedNodes) != 0 || len(cs.RemovedNodes) != 1 || cs.RemovedNodes[0].ID != "N3" {
+		t.Fatalf("N3 should be removed, returned: %+v", cs)
+	}
+
+	if len(cs.AddedEdges) != 1 || cs.AddedEdges[0].ID != "E1" {
+		t.Fatalf("E1 should be added, returned: %+v", cs)
+	}
+
+	if len(cs.UpdatedNodes) != 1 || cs.UpdatedNodes[0].ID != "N1" {
+		t.Fatalf("Only N1 should be updated, returned: %+v", cs.UpdatedNodes)
+	}
+
+	b, _ := json.Marshal(cs.UpdatedNodes[0].Changes)
+	expected := `[{"Key":"MTU","Old":1500,"New":9000},{"Key":"Neutron.PortID","Old":"p1","New":"p2"},{"Key":"State","New":"UP"}]`
+	if string(b) != expected {
+		t.Fatalf("Expected %s, got %s", expected, string(b))
+	}
+}
+
+type fakeRevision struct {
+	revision int64
+	metadata graph.Metadata
+}
+
+func (r *fakeRevision) GetFieldInt64(field string) (int64, error) {
+	if field == "Revision" {
+		return r.revision, nil
+	}
+	return r.revision * 1000, nil
+}
+
+func (r *fakeRevision) Metadata() graph.Metadata {
+	return r.metadata
+}
+
+func TestTraversalRevisions(t *testing.T) {
+	g := newTransversalGraph(t)
+
+	res := execTraversalQuery(t, g, `G.V().Has("Value", 1).Revisions()`)
+	if len(res.Values()) != 1 || len(res.Values()[0].(ElementRevisions).Revisions) != 1 {
+		t.Fatalf("Should return 1 revision, returned: %v", res.Values())
+	}
+
+	er := newElementRevisions("N1", []versionedElement{
+		&fakeRevision{revision: 3, metadata: graph.Metadata{"State": "DOWN", "MTU": int64(9000)}},
+		&fakeRevision{revision: 1, metadata: graph.Metadata{"State": "DOWN"}},
+		&fakeRevision{revision: 2, metadata: graph.Metadata{"State": "UP"}},
+	})
+
+	if len(er.Revisions) != 3 || er.Revisions[0].Revision != 1 || er.Revisions[0].Changes != nil {
+		t.Fatalf("Revisions should be sorted, returned: %+v", er)
+	}
+
+	b, _ := json.Marshal(er.Revisions[2].Changes)
+	expected := `[{"Key":"MTU","New":9000},{"Key":"State","Old":"UP","New":"DOWN"}]`
+	if string(b) != expected {
+		t.Fatalf("Expected %s, got %s", expected, string(b))
+	}
+}
+
 func execTraversalQuery(t *testing.T, g *graph.Graph, query string) GraphTraversalStep {
 	ts, err := NewGremlinTraversalParser().Parse(strings.NewReader(query))
 	if err != nil {
@@ -52,6 +52,9 @@ type InterfaceMetric struct {
 	TxHeartbeatErrors int64 `json:"TxHeartbeatErrors,omitempty"`
 	TxPackets         int64 `json:"TxPackets,omitempty"`
 	TxWindowErrors    int64 `json:"TxWindowErrors,omitempty"`
+	QdiscBacklog      int64 `json:"QdiscBacklog,omitempty"`
+	QdiscDrops        int64 `json:"QdiscDrops,omitempty"`
+	QdiscOverlimits   int64 `json:"QdiscOverlimits,omitempty"`
 	Start             int64 `json:"Start,omitempty"`
 	Last              int64 `json:"Last,omitempty"`
 }
@@ -125,6 +128,12 @@ func (im *InterfaceMetric) GetFieldInt64(field string) (int64, error) {
 		return im.RxCompressed, nil
 	case "TxCompressed":
 		return im.TxCompressed, nil
+	case "QdiscBacklog":
+		return im.QdiscBacklog, nil
+	case "QdiscDrops":
+		return im.QdiscDrops, nil
+	case "QdiscOverlimits":
+		return im.QdiscOverlimits, nil
 	}
 	return 0, common.ErrFieldNotFound
 }
@@ -157,6 +166,9 @@ func (im *InterfaceMetric) Add(m common.Metric) common.Metric {
 		TxHeartbeatErrors: im.TxHeartbeatErrors + om.TxHeartbeatErrors,
 		TxPackets:         im.TxPackets + om.TxPackets,
 		TxWindowErrors:    im.TxWindowErrors + om.TxWindowErrors,
+		QdiscBacklog:      im.QdiscBacklog + om.QdiscBacklog,
+		QdiscDrops:        im.QdiscDrops + om.QdiscDrops,
+		QdiscOverlimits:   im.QdiscOverlimits + om.QdiscOverlimits,
 		Start:             im.Start,
 		Last:              im.Last,
 	}
@@ -190,6 +202,9 @@ func (im *InterfaceMetric) Sub(m common.Metric) common.Metric {
 		TxHeartbeatErrors: im.TxHeartbeatErrors - om.TxHeartbeatErrors,
 		TxPackets:         im.TxPackets - om.TxPackets,
 		TxWindowErrors:    im.TxWindowErrors - om.TxWindowErrors,
+		QdiscBacklog:      im.QdiscBacklog, // gauge, not a counter
+		QdiscDrops:        im.QdiscDrops - om.QdiscDrops,
+		QdiscOverlimits:   im.QdiscOverlimits - om.QdiscOverlimits,
 		Start:             im.Start,
 		Last:              im.Last,
 	}
@@ -220,7 +235,9 @@ func (im *InterfaceMetric) IsZero() bool {
 		im.TxFifoErrors +
 		im.TxHeartbeatErrors +
 		im.TxPackets +
-		im.TxWindowErrors) == 0
+		im.TxWindowErrors +
+		im.QdiscDrops +
+		im.QdiscOverlimits) == 0
 }
 
 func (im *InterfaceMetric) applyRatio(ratio float64) *InterfaceMetric {
@@ -248,6 +265,9 @@ func (im *InterfaceMetric) applyRatio(ratio float64) *InterfaceMetric {
 		TxHeartbeatErrors: int64(float64(im.TxHeartbeatErrors) * ratio),
 		TxPackets:         int64(float64(im.TxPackets) * ratio),
 		TxWindowErrors:    int64(float64(im.TxWindowErrors) * ratio),
+		QdiscBacklog:      im.QdiscBacklog,
+		QdiscDrops:        int64(float64(im.QdiscDrops) * ratio),
+		QdiscOverlimits:   int64(float64(im.QdiscOverlimits) * ratio),
 		Start:             im.Start,
 		Last:              im.Last,
 	}
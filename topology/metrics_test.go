@@ -64,3 +64,29 @@ func TestSlice(t *testing.T) {
 		t.Errorf("Slice 2 error, expected %+v, got %+v", expected, s2)
 	}
 }
+
+func TestQdiscMetric(t *testing.T) {
+	prev := &InterfaceMetric{
+		TxPackets:       100,
+		QdiscBacklog:    10,
+		QdiscDrops:      5,
+		QdiscOverlimits: 20,
+	}
+
+	curr := &InterfaceMetric{
+		TxPackets:       100,
+		QdiscBacklog:    30,
+		QdiscDrops:      5,
+		QdiscOverlimits: 20,
+	}
+
+	// only the backlog changed, it is not taken into account as a change
+	if diff := curr.Sub(prev).(*InterfaceMetric); !diff.IsZero() || diff.QdiscBacklog != 30 {
+		t.Errorf("Expected no change but the backlog, got %+v", diff)
+	}
+
+	curr.QdiscDrops = 8
+	if diff := curr.Sub(prev).(*InterfaceMetric); diff.IsZero() || diff.QdiscDrops != 3 {
+		t.Errorf("Expected 3 drops, got %+v", diff)
+	}
+}
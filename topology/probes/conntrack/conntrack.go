@@ -0,0 +1,438 @@
+// +build linux
+
+/*
+ * Copyright (C) 2018 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package conntrack
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/filters"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/topology/graph"
+)
+
+const (
+	nfnlSubsysCtnetlink = 1
+	ipctnlMsgCtNew      = 0
+	ipctnlMsgCtDelete   = 2
+
+	nfnlgrpConntrackNew     = 1
+	nfnlgrpConntrackDestroy = 3
+
+	ctaTupleOrig    = 1
+	ctaTupleReply   = 2
+	ctaTupleIP      = 1
+	ctaTupleProto   = 2
+	ctaIPV4Src      = 1
+	ctaIPV4Dst      = 2
+	ctaIPV6Src      = 3
+	ctaIPV6Dst      = 4
+	ctaProtoNum     = 1
+	ctaProtoSrcPort = 2
+	ctaProtoDstPort = 3
+
+	nlaTypeMask = 0x3fff
+	sizeofNfgen = 4
+)
+
+// nsProbe follows the conntrack entries of a network namespace
+type nsProbe struct {
+	common.RWMutex
+	node   *graph.Node
+	nsPath string
+	socket *nl.NetlinkSocket
+	index  *natIndex
+	state  int64
+}
+
+// Probe describes a probe following the NAT entries of the conntrack table
+// of the host and of the network namespaces found by the netns probe. As a
+// busy host tracks a large number of connections, the entries are not
+// stored in the graph but looked up on demand, see WSNATServer.
+type Probe struct {
+	common.RWMutex
+	graph.DefaultGraphListener
+	graph  *graph.Graph
+	host   *graph.Node
+	probes map[graph.Identifier]*nsProbe
+}
+
+func protocolName(proto uint8) string {
+	switch proto {
+	case syscall.IPPROTO_TCP:
+		return flow.FlowProtocol_TCP.String()
+	case syscall.IPPROTO_UDP:
+		return flow.FlowProtocol_UDP.String()
+	case syscall.IPPROTO_SCTP:
+		return flow.FlowProtocol_SCTP.String()
+	}
+	return ""
+}
+
+func parseTuple(data []byte) (t Tuple, proto uint8, err error) {
+	attrs, err := nl.ParseRouteAttr(data)
+	if err != nil {
+		return t, 0, err
+	}
+
+	for _, attr := range attrs {
+		switch attr.Attr.Type & nlaTypeMask {
+		case ctaTupleIP:
+			ipAttrs, err := nl.ParseRouteAttr(attr.Value)
+			if err != nil {
+				return t, 0, err
+			}
+			for _, ipAttr := range ipAttrs {
+				switch ipAttr.Attr.Type & nlaTypeMask {
+				case ctaIPV4Src, ctaIPV6Src:
+					t.SrcAddress = net.IP(ipAttr.Value).String()
+				case ctaIPV4Dst, ctaIPV6Dst:
+					t.DstAddress = net.IP(ipAttr.Value).String()
+				}
+			}
+		case ctaTupleProto:
+			protoAttrs, err := nl.ParseRouteAttr(attr.Value)
+			if err != nil {
+				return t, 0, err
+			}
+			for _, protoAttr := range protoAttrs {
+				switch protoAttr.Attr.Type & nlaTypeMask {
+				case ctaProtoNum:
+					proto = protoAttr.Value[0]
+				case ctaProtoSrcPort:
+					t.SrcPort = int64(binary.BigEndian.Uint16(protoAttr.Value))
+				case ctaProtoDstPort:
+					t.DstPort = int64(binary.BigEndian.Uint16(protoAttr.Value))
+				}
+			}
+		}
+	}
+
+	return t, proto, nil
+}
+
+// parseEntry decodes a conntrack netlink message
+func parseEntry(data []byte) (*NATEntry, error) {
+	if len(data) < sizeofNfgen {
+		return nil, errors.New("Conntrack message too short")
+	}
+
+	attrs, err := nl.ParseRouteAttr(data[sizeofNfgen:])
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &NATEntry{}
+	for _, attr := range attrs {
+		switch attr.Attr.Type & nlaTypeMask {
+		case ctaTupleOrig:
+			var proto uint8
+			if entry.Original, proto, err = parseTuple(attr.Value); err != nil {
+				return nil, err
+			}
+			entry.Protocol = protocolName(proto)
+		case ctaTupleReply:
+			if entry.Reply, _, err = parseTuple(attr.Value); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return entry, nil
+}
+
+func newNATEntry(f *netlink.ConntrackFlow) *NATEntry {
+	return &NATEntry{
+		Protocol: protocolName(f.Forward.Protocol),
+		Original: Tuple{
+			SrcAddress: f.Forward.SrcIP.String(),
+			SrcPort:    int64(f.Forward.SrcPort),
+			DstAddress: f.Forward.DstIP.String(),
+			DstPort:    int64(f.Forward.DstPort),
+		},
+		Reply: Tuple{
+			SrcAddress: f.Reverse.SrcIP.String(),
+			SrcPort:    int64(f.Reverse.SrcPort),
+			DstAddress: f.Reverse.DstIP.String(),
+			DstPort:    int64(f.Reverse.DstPort),
+		},
+	}
+}
+
+func (p *nsProbe) update(entry *NATEntry, deleted bool) {
+	if entry.Protocol == "" || !entry.IsNAT() {
+		return
+	}
+
+	p.Lock()
+	p.index.update(entry, deleted)
+	p.Unlock()
+}
+
+func (p *nsProbe) lookup(hashes []string) []*NATEntry {
+	p.RLock()
+	defer p.RUnlock()
+
+	return p.index.lookup(hashes)
+}
+
+func (p *nsProbe) entries() []*NATEntry {
+	p.RLock()
+	defer p.RUnlock()
+
+	entries := make([]*NATEntry, 0, len(p.index.entries))
+	for _, entry := range p.index.entries {
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func (p *nsProbe) run() {
+	for atomic.LoadInt64(&p.state) == common.RunningState {
+		msgs, err := p.socket.Receive()
+		if err != nil {
+			if atomic.LoadInt64(&p.state) != common.RunningState {
+				return
+			}
+			if errno, ok := err.(syscall.Errno); !ok || !errno.Temporary() {
+				logging.GetLogger().Errorf("Failed to receive conntrack events for %s: %s", p.node.ID, err)
+				return
+			}
+			continue
+		}
+
+		for _, msg := range msgs {
+			if msg.Header.Type>>8 != nfnlSubsysCtnetlink {
+				continue
+			}
+
+			entry, err := parseEntry(msg.Data)
+			if err != nil {
+				logging.GetLogger().Debugf("Failed to parse conntrack event: %s", err)
+				continue
+			}
+
+			switch msg.Header.Type & 0xff {
+			case ipctnlMsgCtNew:
+				p.update(entry, false)
+			case ipctnlMsgCtDelete:
+				p.update(entry, true)
+			}
+		}
+	}
+}
+
+func (p *nsProbe) stop() {
+	if atomic.CompareAndSwapInt64(&p.state, common.RunningState, common.StoppingState) {
+		p.socket.Close()
+	}
+}
+
+func newNsProbe(node *graph.Node, nsPath string) (*nsProbe, error) {
+	probe := &nsProbe{
+		node:   node,
+		nsPath: nsPath,
+		index:  newNATIndex(),
+	}
+
+	var context *common.NetNSContext
+	var err error
+
+	// Enter the network namespace if necessary
+	if nsPath != "" {
+		if context, err = common.NewNetNsContext(nsPath); err != nil {
+			return nil, fmt.Errorf("Failed to switch namespace: %s", err)
+		}
+	}
+	defer context.Close()
+
+	// subscribe before dumping the table so that no entry is missed
+	if probe.socket, err = nl.Subscribe(syscall.NETLINK_NETFILTER, nfnlgrpConntrackNew, nfnlgrpConntrackDestroy); err != nil {
+		return nil, fmt.Errorf("Failed to subscribe to conntrack events: %s", err)
+	}
+
+	handle, err := netlink.NewHandle(syscall.NETLINK_NETFILTER)
+	if err != nil {
+		probe.socket.Close()
+		return nil, fmt.Errorf("Failed to create netlink handle: %s", err)
+	}
+	defer handle.Delete()
+
+	for _, family := range []netlink.InetFamily{syscall.AF_INET, syscall.AF_INET6} {
+		flows, err := handle.ConntrackTableList(netlink.ConntrackTable, family)
+		if err != nil {
+			probe.socket.Close()
+			return nil, fmt.Errorf("Failed to list conntrack entries: %s", err)
+		}
+
+		for _, f := range flows {
+			probe.update(newNATEntry(f), false)
+		}
+	}
+
+	atomic.StoreInt64(&probe.state, common.RunningState)
+	go probe.run()
+
+	return probe, nil
+}
+
+func (p *Probe) register(node *graph.Node, nsPath string) {
+	probe, err := newNsProbe(node, nsPath)
+	if err != nil {
+		logging.GetLogger().Errorf("Failed to register conntrack probe for %s: %s", node.ID, err)
+		p.Lock()
+		delete(p.probes, node.ID)
+		p.Unlock()
+		return
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	// the namespace may have been removed in the meantime
+	if _, ok := p.probes[node.ID]; !ok {
+		probe.stop()
+		return
+	}
+	p.probes[node.ID] = probe
+}
+
+func (p *Probe) unregister(node *graph.Node) {
+	p.Lock()
+	defer p.Unlock()
+
+	if probe, ok := p.probes[node.ID]; ok {
+		if probe != nil {
+			probe.stop()
+		}
+		delete(p.probes, node.ID)
+	}
+}
+
+// OnNodeAdded event
+func (p *Probe) OnNodeAdded(n *graph.Node) {
+	if tp, _ := n.GetFieldString("Type"); tp != "netns" {
+		return
+	}
+
+	path, _ := n.GetFieldString("Path")
+	if path == "" {
+		return
+	}
+
+	p.Lock()
+	_, ok := p.probes[n.ID]
+	if !ok {
+		// reserved until the probe is registered
+		p.probes[n.ID] = nil
+	}
+	p.Unlock()
+
+	if !ok {
+		go p.register(n, path)
+	}
+}
+
+// OnNodeDeleted event
+func (p *Probe) OnNodeDeleted(n *graph.Node) {
+	p.unregister(n)
+}
+
+// LookupNAT returns the NAT entries of the host and of the namespaces
+// having a tuple matching one of the hashes
+func (p *Probe) LookupNAT(hashes []string) []*NATEntry {
+	p.RLock()
+	defer p.RUnlock()
+
+	var entries []*NATEntry
+	for _, probe := range p.probes {
+		if probe != nil {
+			entries = append(entries, probe.lookup(hashes)...)
+		}
+	}
+	return entries
+}
+
+// NATEntries returns the NAT entries of the conntrack tables of the host
+// or network namespace nodes, indexed by node ID
+func (p *Probe) NATEntries(nodes []graph.Identifier) map[string][]*NATEntry {
+	p.RLock()
+	defer p.RUnlock()
+
+	entries := make(map[string][]*NATEntry)
+	for _, id := range nodes {
+		if probe := p.probes[id]; probe != nil {
+			entries[string(id)] = probe.entries()
+		}
+	}
+	return entries
+}
+
+// Start the probe
+func (p *Probe) Start() {
+	p.graph.RLock()
+	p.probes[p.host.ID] = nil
+	go p.register(p.host, "")
+
+	filter := graph.NewElementFilter(filters.NewTermStringFilter("Type", "netns"))
+	for _, n := range p.graph.GetNodes(filter) {
+		p.OnNodeAdded(n)
+	}
+	p.graph.AddEventListener(p)
+	p.graph.RUnlock()
+}
+
+// Stop the probe
+func (p *Probe) Stop() {
+	p.graph.RemoveEventListener(p)
+
+	p.Lock()
+	defer p.Unlock()
+
+	for id, probe := range p.probes {
+		if probe != nil {
+			probe.stop()
+		}
+		delete(p.probes, id)
+	}
+}
+
+// NewProbe creates a new conntrack probe
+func NewProbe(g *graph.Graph, host *graph.Node) (*Probe, error) {
+	return &Probe{
+		graph:  g,
+		host:   host,
+		probes: make(map[graph.Identifier]*nsProbe),
+	}, nil
+}
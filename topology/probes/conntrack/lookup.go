@@ -0,0 +1,207 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package conntrack
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/topology/graph"
+	ws "github.com/skydive-project/skydive/websocket"
+)
+
+// Namespace "Conntrack"
+const (
+	Namespace = "Conntrack"
+)
+
+// NATQuery describes a lookup of the NAT entries having a tuple matching
+// one of the hashes
+type NATQuery struct {
+	Hashes []string
+}
+
+// NATEntriesQuery describes a lookup of the NAT entries of the conntrack
+// tables of the host or network namespace nodes
+type NATEntriesQuery struct {
+	Nodes []graph.Identifier
+}
+
+// NATTable describes a table of NAT entries looked up by tuple hashes or
+// by host or network namespace node
+type NATTable interface {
+	LookupNAT(hashes []string) []*NATEntry
+	NATEntries(nodes []graph.Identifier) map[string][]*NATEntry
+}
+
+// NATClient describes a mechanism to look up the NAT entries of the agents
+type NATClient interface {
+	LookupNAT(ctx context.Context, hashes []string) ([]*NATEntry, error)
+	NATEntries(ctx context.Context, nodes map[string][]graph.Identifier) (map[string][]*NATEntry, error)
+}
+
+// WSNATServer describes a mechanism to look up the NAT entries of an agent
+// via Websocket
+type WSNATServer struct {
+	table NATTable
+}
+
+// OnStructMessage NATQuery
+func (s *WSNATServer) OnStructMessage(c ws.Speaker, msg *ws.StructMessage) {
+	switch msg.Type {
+	case "NATQuery":
+		var query NATQuery
+		if err := msg.UnmarshalObj(&query); err != nil {
+			logging.GetLogger().Errorf("Unable to decode NAT query message %v", msg)
+			c.SendMessage(msg.Reply(nil, "NATReply", http.StatusBadRequest))
+			return
+		}
+
+		entries := s.table.LookupNAT(query.Hashes)
+		c.SendMessage(msg.Reply(entries, "NATReply", http.StatusOK))
+	case "NATEntriesQuery":
+		var query NATEntriesQuery
+		if err := msg.UnmarshalObj(&query); err != nil {
+			logging.GetLogger().Errorf("Unable to decode NAT entries query message %v", msg)
+			c.SendMessage(msg.Reply(nil, "NATEntriesReply", http.StatusBadRequest))
+			return
+		}
+
+		entries := s.table.NATEntries(query.Nodes)
+		c.SendMessage(msg.Reply(entries, "NATEntriesReply", http.StatusOK))
+	}
+}
+
+// NewWSNATServer creates a new NAT entries lookup server based on websocket
+func NewWSNATServer(table NATTable, pool ws.StructSpeakerPool) *WSNATServer {
+	s := &WSNATServer{table: table}
+	pool.AddStructMessageHandler(s, []string{Namespace})
+	return s
+}
+
+// WSNATClient implements a NAT entries lookup client using WebSocket
+type WSNATClient struct {
+	structServer *ws.StructServer
+}
+
+// request sends a message to an agent and decodes its reply, returning
+// false on failure
+func (c *WSNATClient) request(ctx context.Context, host string, msg *ws.StructMessage, reply interface{}) bool {
+	// do not wait for the agent longer than the caller
+	timeout := ws.DefaultRequestTimeout
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < timeout {
+		timeout = time.Until(deadline)
+	}
+
+	resp, err := c.structServer.Request(host, msg, timeout)
+	if err != nil {
+		logging.GetLogger().Errorf("Unable to send message to agent %s: %s", host, err)
+		return false
+	}
+
+	if resp == nil || resp.Status != http.StatusOK || resp.UnmarshalObj(reply) != nil {
+		logging.GetLogger().Errorf("Error returned while reading %s reply from: %s", msg.Type, host)
+		return false
+	}
+	return true
+}
+
+func (c *WSNATClient) lookupNAT(ctx context.Context, ch chan []*NATEntry, host string, hashes []string) {
+	msg := ws.NewStructMessage(Namespace, "NATQuery", NATQuery{Hashes: hashes})
+
+	var entries []*NATEntry
+	if !c.request(ctx, host, msg, &entries) {
+		entries = nil
+	}
+	ch <- entries
+}
+
+func (c *WSNATClient) natEntries(ctx context.Context, ch chan map[string][]*NATEntry, host string, nodes []graph.Identifier) {
+	msg := ws.NewStructMessage(Namespace, "NATEntriesQuery", NATEntriesQuery{Nodes: nodes})
+
+	var entries map[string][]*NATEntry
+	if !c.request(ctx, host, msg, &entries) {
+		entries = nil
+	}
+	ch <- entries
+}
+
+// LookupNAT returns the NAT entries of the agents having a tuple matching
+// one of the hashes
+func (c *WSNATClient) LookupNAT(ctx context.Context, hashes []string) ([]*NATEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	speakers := c.structServer.GetSpeakersByType(common.AgentService)
+	ch := make(chan []*NATEntry, len(speakers))
+
+	for _, speaker := range speakers {
+		go c.lookupNAT(ctx, ch, speaker.GetRemoteHost(), hashes)
+	}
+
+	var entries []*NATEntry
+	for range speakers {
+		select {
+		case e := <-ch:
+			entries = append(entries, e...)
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return entries, nil
+}
+
+// NATEntries returns the NAT entries of the conntrack tables of the nodes,
+// indexed by node ID, the nodes being grouped by the host of their agent
+func (c *WSNATClient) NATEntries(ctx context.Context, nodes map[string][]graph.Identifier) (map[string][]*NATEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ch := make(chan map[string][]*NATEntry, len(nodes))
+	for host, ids := range nodes {
+		go c.natEntries(ctx, ch, host, ids)
+	}
+
+	entries := make(map[string][]*NATEntry)
+	for range nodes {
+		select {
+		case e := <-ch:
+			for id, nodeEntries := range e {
+				entries[id] = append(entries[id], nodeEntries...)
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return entries, nil
+}
+
+// NewWSNATClient creates a new NAT entries lookup client based on websocket
+func NewWSNATClient(w *ws.StructServer) *WSNATClient {
+	return &WSNATClient{structServer: w}
+}
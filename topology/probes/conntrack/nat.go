@@ -0,0 +1,172 @@
+/*
+ * Copyright (C) 2018 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package conntrack
+
+import (
+	"net"
+
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/topology/probes/socketinfo"
+)
+
+// Tuple describes the addresses and ports of a direction of a connection
+type Tuple struct {
+	SrcAddress string
+	SrcPort    int64
+	DstAddress string
+	DstPort    int64
+}
+
+// Hash computes the hash of a tuple
+func (t Tuple) Hash(protocol flow.FlowProtocol) string {
+	return socketinfo.HashTuple(protocol, net.ParseIP(t.SrcAddress), t.SrcPort, net.ParseIP(t.DstAddress), t.DstPort)
+}
+
+// Reverse returns the tuple of the other direction of the connection
+func (t Tuple) Reverse() Tuple {
+	return Tuple{
+		SrcAddress: t.DstAddress,
+		SrcPort:    t.DstPort,
+		DstAddress: t.SrcAddress,
+		DstPort:    t.SrcPort,
+	}
+}
+
+// NATEntry describes a connection tracked by netfilter whose addresses or
+// ports are translated. Original is the tuple sent by the initiator, Reply
+// the tuple sent back by the responder, translated when the reply is not
+// the reverse of the original tuple.
+type NATEntry struct {
+	Protocol string
+	Original Tuple
+	Reply    Tuple
+}
+
+// FlowProtocol returns the flow protocol of the connection
+func (e *NATEntry) FlowProtocol() flow.FlowProtocol {
+	return flow.FlowProtocol(flow.FlowProtocol_value[e.Protocol])
+}
+
+// IsNAT returns whether the addresses or ports of the connection are translated
+func (e *NATEntry) IsNAT() bool {
+	return e.Reply != e.Original.Reverse()
+}
+
+// Peer returns the tuple at the other side of the translation of a tuple
+// of the connection, in the same direction, false if the tuple is not part
+// of the connection
+func (e *NATEntry) Peer(t Tuple) (Tuple, bool) {
+	switch t {
+	case e.Original:
+		return e.Reply.Reverse(), true
+	case e.Original.Reverse():
+		return e.Reply, true
+	case e.Reply:
+		return e.Original.Reverse(), true
+	case e.Reply.Reverse():
+		return e.Original, true
+	}
+	return Tuple{}, false
+}
+
+// Hashes returns the hashes of the tuples of the connection in both
+// directions, on both sides of the translation
+func (e *NATEntry) Hashes() []string {
+	protocol := e.FlowProtocol()
+	return []string{
+		e.Original.Hash(protocol),
+		e.Original.Reverse().Hash(protocol),
+		e.Reply.Hash(protocol),
+		e.Reply.Reverse().Hash(protocol),
+	}
+}
+
+type natKey struct {
+	protocol string
+	original Tuple
+}
+
+// natIndex holds NAT entries indexed by the hashes of their tuples
+type natIndex struct {
+	entries map[natKey]*NATEntry
+	hashes  map[string]map[natKey]*NATEntry
+}
+
+func (i *natIndex) del(key natKey) {
+	entry, ok := i.entries[key]
+	if !ok {
+		return
+	}
+
+	for _, hash := range entry.Hashes() {
+		if entries := i.hashes[hash]; entries != nil {
+			delete(entries, key)
+			if len(entries) == 0 {
+				delete(i.hashes, hash)
+			}
+		}
+	}
+	delete(i.entries, key)
+}
+
+// update adds or replaces an entry, or removes it if deleted
+func (i *natIndex) update(entry *NATEntry, deleted bool) {
+	key := natKey{protocol: entry.Protocol, original: entry.Original}
+
+	i.del(key)
+	if deleted {
+		return
+	}
+
+	i.entries[key] = entry
+	for _, hash := range entry.Hashes() {
+		entries := i.hashes[hash]
+		if entries == nil {
+			entries = make(map[natKey]*NATEntry)
+			i.hashes[hash] = entries
+		}
+		entries[key] = entry
+	}
+}
+
+// lookup returns the entries having a tuple matching one of the hashes
+func (i *natIndex) lookup(hashes []string) []*NATEntry {
+	var entries []*NATEntry
+	found := make(map[natKey]bool)
+	for _, hash := range hashes {
+		for key, entry := range i.hashes[hash] {
+			if !found[key] {
+				found[key] = true
+				entries = append(entries, entry)
+			}
+		}
+	}
+	return entries
+}
+
+func newNATIndex() *natIndex {
+	return &natIndex{
+		entries: make(map[natKey]*NATEntry),
+		hashes:  make(map[string]map[natKey]*NATEntry),
+	}
+}
@@ -0,0 +1,102 @@
+/*
+ * Copyright (C) 2018 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package conntrack
+
+import (
+	"testing"
+)
+
+func TestNATEntryPeer(t *testing.T) {
+	// client 10.0.0.1 connecting to the virtual IP 172.30.0.1:80 translated
+	// to the pod 192.168.0.2:8080
+	entry := &NATEntry{
+		Protocol: "TCP",
+		Original: Tuple{SrcAddress: "10.0.0.1", SrcPort: 40000, DstAddress: "172.30.0.1", DstPort: 80},
+		Reply:    Tuple{SrcAddress: "192.168.0.2", SrcPort: 8080, DstAddress: "10.0.0.1", DstPort: 40000},
+	}
+
+	if !entry.IsNAT() {
+		t.Fatal("Entry should be a NAT entry")
+	}
+
+	client := entry.Original
+	pod := Tuple{SrcAddress: "10.0.0.1", SrcPort: 40000, DstAddress: "192.168.0.2", DstPort: 8080}
+
+	if peer, ok := entry.Peer(client); !ok || peer != pod {
+		t.Errorf("Expected %+v, got %+v", pod, peer)
+	}
+
+	if peer, ok := entry.Peer(pod); !ok || peer != client {
+		t.Errorf("Expected %+v, got %+v", client, peer)
+	}
+
+	if peer, ok := entry.Peer(pod.Reverse()); !ok || peer != client.Reverse() {
+		t.Errorf("Expected %+v, got %+v", client.Reverse(), peer)
+	}
+
+	if _, ok := entry.Peer(Tuple{SrcAddress: "10.0.0.3", DstAddress: "10.0.0.4"}); ok {
+		t.Error("Unrelated tuple should not have a peer")
+	}
+
+	entry.Reply = entry.Original.Reverse()
+	if entry.IsNAT() {
+		t.Error("Entry should not be a NAT entry")
+	}
+}
+
+func TestNATIndex(t *testing.T) {
+	index := newNATIndex()
+
+	entry := &NATEntry{
+		Protocol: "TCP",
+		Original: Tuple{SrcAddress: "10.0.0.1", SrcPort: 40000, DstAddress: "172.30.0.1", DstPort: 80},
+		Reply:    Tuple{SrcAddress: "192.168.0.2", SrcPort: 8080, DstAddress: "10.0.0.1", DstPort: 40000},
+	}
+	index.update(entry, false)
+
+	pod := Tuple{SrcAddress: "10.0.0.1", SrcPort: 40000, DstAddress: "192.168.0.2", DstPort: 8080}
+	for _, tuple := range []Tuple{entry.Original, entry.Original.Reverse(), pod, pod.Reverse()} {
+		if entries := index.lookup([]string{tuple.Hash(entry.FlowProtocol())}); len(entries) != 1 || entries[0] != entry {
+			t.Errorf("Expected the entry for %+v, got %+v", tuple, entries)
+		}
+	}
+
+	unrelated := Tuple{SrcAddress: "10.0.0.3", SrcPort: 1234, DstAddress: "10.0.0.4", DstPort: 80}
+	if entries := index.lookup([]string{unrelated.Hash(entry.FlowProtocol())}); len(entries) != 0 {
+		t.Errorf("Unrelated tuple should not match any entry, got %+v", entries)
+	}
+
+	// the reply of a connection may be updated
+	updated := *entry
+	updated.Reply = Tuple{SrcAddress: "192.168.0.3", SrcPort: 8080, DstAddress: "10.0.0.1", DstPort: 40000}
+	index.update(&updated, false)
+
+	if entries := index.lookup([]string{pod.Hash(entry.FlowProtocol())}); len(entries) != 0 {
+		t.Errorf("Previous reply should not match anymore, got %+v", entries)
+	}
+
+	index.update(&updated, true)
+	if len(index.entries) != 0 || len(index.hashes) != 0 {
+		t.Errorf("Index should be empty: %+v", index)
+	}
+}
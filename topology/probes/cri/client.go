@@ -0,0 +1,223 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package cri
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/topology/graph"
+	"github.com/skydive-project/skydive/topology/probes/cri/runtime"
+)
+
+const requestTimeout = 10 * time.Second
+
+// PodSandbox describes the pod sandbox of a container
+type PodSandbox struct {
+	ID        string
+	Name      string
+	Namespace string
+	UID       string
+}
+
+// Container describes a running container as reported by the runtime
+type Container struct {
+	ID         string
+	Name       string
+	Image      string
+	Labels     map[string]string
+	PodSandbox PodSandbox
+	PID        int
+}
+
+// Metadata returns the metadata of the graph node of the container
+func (c *Container) Metadata(runtimeName string) graph.Metadata {
+	cri := map[string]interface{}{
+		"ContainerID":   c.ID,
+		"ContainerName": c.Name,
+		"ContainerPID":  int64(c.PID),
+		"Image":         c.Image,
+		"PodSandbox": map[string]interface{}{
+			"ID":        c.PodSandbox.ID,
+			"Name":      c.PodSandbox.Name,
+			"Namespace": c.PodSandbox.Namespace,
+			"UID":       c.PodSandbox.UID,
+		},
+	}
+
+	if runtimeName != "" {
+		cri["Runtime"] = runtimeName
+	}
+
+	if len(c.Labels) != 0 {
+		cri["Labels"] = common.NormalizeValue(c.Labels)
+	}
+
+	return graph.Metadata{
+		"Type":    "container",
+		"Name":    c.Name,
+		"Manager": "cri",
+		"CRI":     cri,
+	}
+}
+
+// client wraps the gRPC connection to the runtime service of a CRI socket
+type client struct {
+	conn    *grpc.ClientConn
+	runtime runtime.RuntimeServiceClient
+}
+
+// containerInfo is the verbose information returned by containerd and CRI-O
+// along with the status of a container
+type containerInfo struct {
+	Pid int `json:"pid"`
+}
+
+func dialUnix(addr string, timeout time.Duration) (net.Conn, error) {
+	return net.DialTimeout("unix", addr, timeout)
+}
+
+func newClient(endpoint string) (*client, error) {
+	if !strings.HasPrefix(endpoint, "unix://") && !strings.HasPrefix(endpoint, "/") {
+		return nil, fmt.Errorf("Unsupported CRI endpoint %s, only unix sockets are supported", endpoint)
+	}
+	addr := strings.TrimPrefix(endpoint, "unix://")
+
+	conn, err := grpc.Dial(addr, grpc.WithInsecure(), grpc.WithDialer(dialUnix))
+	if err != nil {
+		return nil, err
+	}
+
+	return &client{
+		conn:    conn,
+		runtime: runtime.NewRuntimeServiceClient(conn),
+	}, nil
+}
+
+func (c *client) close() error {
+	return c.conn.Close()
+}
+
+// version returns the name of the runtime
+func (c *client) version() (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	resp, err := c.runtime.Version(ctx, &runtime.VersionRequest{})
+	if err != nil {
+		return "", err
+	}
+	return resp.RuntimeName, nil
+}
+
+// runningContainers returns the identifiers of the running containers
+func (c *client) runningContainers() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	resp, err := c.runtime.ListContainers(ctx, &runtime.ListContainersRequest{
+		Filter: &runtime.ContainerFilter{
+			State: &runtime.ContainerStateValue{State: runtime.ContainerState_CONTAINER_RUNNING},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(resp.Containers))
+	for i, container := range resp.Containers {
+		ids[i] = container.Id
+	}
+	return ids, nil
+}
+
+// inspect returns the description of a container, its PID being retrieved
+// from the verbose information of its status
+func (c *client) inspect(id string) (*Container, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	resp, err := c.runtime.ContainerStatus(ctx, &runtime.ContainerStatusRequest{ContainerId: id, Verbose: true})
+	if err != nil {
+		return nil, err
+	}
+
+	status := resp.Status
+	if status == nil {
+		return nil, errors.New("No status returned")
+	}
+
+	var info containerInfo
+	if err := json.Unmarshal([]byte(resp.Info["info"]), &info); err != nil {
+		return nil, fmt.Errorf("Failed to decode verbose information: %s", err)
+	}
+	if info.Pid == 0 {
+		return nil, errors.New("No PID found in verbose information")
+	}
+
+	container := &Container{
+		ID:     status.Id,
+		Labels: status.Labels,
+		PID:    info.Pid,
+	}
+
+	if status.Metadata != nil {
+		container.Name = status.Metadata.Name
+	}
+	if status.Image != nil {
+		container.Image = status.Image.Image
+	}
+
+	// the status of a container doesn't hold its pod sandbox, retrieve it
+	// from the container list
+	list, err := c.runtime.ListContainers(ctx, &runtime.ListContainersRequest{
+		Filter: &runtime.ContainerFilter{Id: id},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(list.Containers) == 0 {
+		return nil, fmt.Errorf("Container %s not found", id)
+	}
+	container.PodSandbox.ID = list.Containers[0].PodSandboxId
+
+	sandbox, err := c.runtime.PodSandboxStatus(ctx, &runtime.PodSandboxStatusRequest{PodSandboxId: container.PodSandbox.ID})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get status of pod sandbox %s: %s", container.PodSandbox.ID, err)
+	}
+	if sandbox.Status != nil && sandbox.Status.Metadata != nil {
+		container.PodSandbox.Name = sandbox.Status.Metadata.Name
+		container.PodSandbox.Namespace = sandbox.Status.Metadata.Namespace
+		container.PodSandbox.UID = sandbox.Status.Metadata.Uid
+	}
+
+	return container, nil
+}
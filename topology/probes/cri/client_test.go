@@ -0,0 +1,229 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package cri
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/skydive-project/skydive/topology/probes/cri/runtime"
+)
+
+// fakeRuntime implements the CRI runtime service with static containers
+type fakeRuntime struct {
+	sandboxes  map[string]*runtime.PodSandboxStatus
+	containers []*runtime.Container
+	pids       map[string]string
+	listErr    error
+}
+
+func (f *fakeRuntime) Version(ctx context.Context, req *runtime.VersionRequest) (*runtime.VersionResponse, error) {
+	return &runtime.VersionResponse{Version: "0.1.0", RuntimeName: "fake", RuntimeVersion: "1.0", RuntimeApiVersion: "v1alpha2"}, nil
+}
+
+func (f *fakeRuntime) PodSandboxStatus(ctx context.Context, req *runtime.PodSandboxStatusRequest) (*runtime.PodSandboxStatusResponse, error) {
+	return &runtime.PodSandboxStatusResponse{Status: f.sandboxes[req.PodSandboxId]}, nil
+}
+
+func (f *fakeRuntime) ListPodSandbox(ctx context.Context, req *runtime.ListPodSandboxRequest) (*runtime.ListPodSandboxResponse, error) {
+	resp := &runtime.ListPodSandboxResponse{}
+	for _, status := range f.sandboxes {
+		resp.Items = append(resp.Items, &runtime.PodSandbox{Id: status.Id, Metadata: status.Metadata, State: status.State})
+	}
+	return resp, nil
+}
+
+func (f *fakeRuntime) ListContainers(ctx context.Context, req *runtime.ListContainersRequest) (*runtime.ListContainersResponse, error) {
+	if f.listErr != nil {
+		return nil, f.listErr
+	}
+
+	resp := &runtime.ListContainersResponse{}
+	for _, c := range f.containers {
+		if filter := req.Filter; filter != nil {
+			if filter.Id != "" && filter.Id != c.Id {
+				continue
+			}
+			if filter.State != nil && filter.State.State != c.State {
+				continue
+			}
+		}
+		resp.Containers = append(resp.Containers, c)
+	}
+	return resp, nil
+}
+
+func (f *fakeRuntime) ContainerStatus(ctx context.Context, req *runtime.ContainerStatusRequest) (*runtime.ContainerStatusResponse, error) {
+	for _, c := range f.containers {
+		if c.Id == req.ContainerId {
+			status := &runtime.ContainerStatus{
+				Id:       c.Id,
+				Metadata: c.Metadata,
+				State:    c.State,
+				Image:    c.Image,
+				Labels:   c.Labels,
+			}
+			return &runtime.ContainerStatusResponse{
+				Status: status,
+				Info:   map[string]string{"info": `{"sandboxID": "` + c.PodSandboxId + `", "pid": ` + f.pids[c.Id] + `}`},
+			}, nil
+		}
+	}
+	return nil, grpc.Errorf(codes.NotFound, "container %s not found", req.ContainerId)
+}
+
+func newFakeRuntime() *fakeRuntime {
+	return &fakeRuntime{
+		sandboxes: map[string]*runtime.PodSandboxStatus{
+			"sandbox1": {
+				Id:       "sandbox1",
+				Metadata: &runtime.PodSandboxMetadata{Name: "nginx", Namespace: "default", Uid: "uid1"},
+			},
+		},
+		containers: []*runtime.Container{
+			{
+				Id:           "container1",
+				PodSandboxId: "sandbox1",
+				Metadata:     &runtime.ContainerMetadata{Name: "nginx"},
+				Image:        &runtime.ImageSpec{Image: "docker.io/library/nginx:latest"},
+				State:        runtime.ContainerState_CONTAINER_RUNNING,
+				Labels:       map[string]string{"io.kubernetes.pod.name": "nginx"},
+			},
+			{
+				Id:           "container2",
+				PodSandboxId: "sandbox1",
+				Metadata:     &runtime.ContainerMetadata{Name: "sidecar"},
+				Image:        &runtime.ImageSpec{Image: "docker.io/library/busybox:latest"},
+				State:        runtime.ContainerState_CONTAINER_RUNNING,
+			},
+			{
+				Id:           "container3",
+				PodSandboxId: "sandbox1",
+				Metadata:     &runtime.ContainerMetadata{Name: "init"},
+				Image:        &runtime.ImageSpec{Image: "docker.io/library/busybox:latest"},
+				State:        runtime.ContainerState_CONTAINER_EXITED,
+			},
+		},
+		pids: map[string]string{"container1": "1234", "container2": "1235", "container3": "0"},
+	}
+}
+
+func startFakeRuntime(t *testing.T, f *fakeRuntime) (string, func()) {
+	dir, err := ioutil.TempDir("", "skydive-cri")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	socket := filepath.Join(dir, "cri.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	server := grpc.NewServer()
+	runtime.RegisterRuntimeServiceServer(server, f)
+	go server.Serve(listener)
+
+	return "unix://" + socket, func() {
+		server.Stop()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestClient(t *testing.T) {
+	endpoint, stop := startFakeRuntime(t, newFakeRuntime())
+	defer stop()
+
+	c, err := newClient(endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.close()
+
+	name, err := c.version()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "fake" {
+		t.Errorf("Expected runtime name fake, got %s", name)
+	}
+
+	ids, err := c.runningContainers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(ids)
+	if !reflect.DeepEqual(ids, []string{"container1", "container2"}) {
+		t.Errorf("Expected only the running containers, got %v", ids)
+	}
+
+	container, err := c.inspect("container1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &Container{
+		ID:     "container1",
+		Name:   "nginx",
+		Image:  "docker.io/library/nginx:latest",
+		Labels: map[string]string{"io.kubernetes.pod.name": "nginx"},
+		PodSandbox: PodSandbox{
+			ID:        "sandbox1",
+			Name:      "nginx",
+			Namespace: "default",
+			UID:       "uid1",
+		},
+		PID: 1234,
+	}
+	if !reflect.DeepEqual(container, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, container)
+	}
+
+	metadata := container.Metadata(name)
+	if metadata["Type"] != "container" || metadata["Manager"] != "cri" {
+		t.Errorf("Wrong container metadata: %v", metadata)
+	}
+
+	cri := metadata["CRI"].(map[string]interface{})
+	if cri["ContainerPID"] != int64(1234) || cri["Image"] != "docker.io/library/nginx:latest" || cri["Runtime"] != "fake" {
+		t.Errorf("Wrong CRI metadata: %v", cri)
+	}
+
+	if _, err := c.inspect("container3"); err == nil {
+		t.Error("Expected an error for a container without PID")
+	}
+
+	if _, err := c.inspect("unknown"); err == nil {
+		t.Error("Expected an error for an unknown container")
+	}
+}
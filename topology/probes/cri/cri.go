@@ -0,0 +1,302 @@
+// +build linux
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package cri
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vishvananda/netns"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/topology"
+	"github.com/skydive-project/skydive/topology/graph"
+	ns "github.com/skydive-project/skydive/topology/probes/netns"
+)
+
+type containerNode struct {
+	Pid  int
+	Node *graph.Node
+}
+
+// namespaceRegisterer describes how the network namespaces of the
+// containers are registered, implemented by the netns probe
+type namespaceRegisterer interface {
+	Register(path string, name string) (*graph.Node, error)
+	Unregister(path string)
+}
+
+// Probe describes a topology probe reporting the containers of a runtime
+// implementing the Kubernetes Container Runtime Interface, like containerd
+// or CRI-O. As the interface doesn't provide any event, the containers
+// are polled to detect their start and their termination.
+type Probe struct {
+	common.RWMutex
+	*ns.Probe
+	endpoint     string
+	interval     time.Duration
+	client       *client
+	runtimeName  string
+	state        int64
+	quit         chan struct{}
+	wg           sync.WaitGroup
+	hostNs       netns.NsHandle
+	namespaces   namespaceRegisterer
+	containerMap map[string]containerNode
+}
+
+func (probe *Probe) containerNamespace(pid int) string {
+	return fmt.Sprintf("/proc/%d/ns/net", pid)
+}
+
+func (probe *Probe) registerContainer(id string) {
+	probe.Lock()
+	defer probe.Unlock()
+
+	if _, ok := probe.containerMap[id]; ok {
+		return
+	}
+
+	container, err := probe.client.inspect(id)
+	if err != nil {
+		logging.GetLogger().Errorf("Failed to inspect CRI container %s: %s", id, err)
+		return
+	}
+
+	nsHandle, err := netns.GetFromPid(container.PID)
+	if err != nil {
+		return
+	}
+	defer nsHandle.Close()
+
+	namespace := probe.containerNamespace(container.PID)
+	logging.GetLogger().Debugf("Register CRI container %s and PID %d", container.ID, container.PID)
+
+	var n *graph.Node
+	if probe.hostNs.Equal(nsHandle) {
+		// The pod uses the network of the host
+		n = probe.Root
+	} else {
+		name := container.PodSandbox.Name
+		if name == "" {
+			name = container.Name
+		}
+
+		if n, err = probe.namespaces.Register(namespace, name); err != nil {
+			logging.GetLogger().Debugf("Failed to register probe for namespace %s: %s", namespace, err)
+			return
+		}
+
+		probe.Graph.Lock()
+		probe.Graph.AddMetadata(n, "Manager", "cri")
+		probe.Graph.Unlock()
+	}
+
+	probe.Graph.Lock()
+	node := probe.Graph.NewNode(graph.GenID(), container.Metadata(probe.runtimeName))
+	topology.AddOwnershipLink(probe.Graph, n, node, nil)
+	probe.Graph.Unlock()
+
+	probe.containerMap[container.ID] = containerNode{
+		Pid:  container.PID,
+		Node: node,
+	}
+}
+
+func (probe *Probe) unregisterContainer(id string) {
+	probe.Lock()
+	defer probe.Unlock()
+
+	infos, ok := probe.containerMap[id]
+	if !ok {
+		return
+	}
+
+	probe.Graph.Lock()
+	probe.Graph.DelNode(infos.Node)
+	probe.Graph.Unlock()
+
+	namespace := probe.containerNamespace(infos.Pid)
+	logging.GetLogger().Debugf("Stop listening for namespace %s with PID %d", namespace, infos.Pid)
+	probe.namespaces.Unregister(namespace)
+
+	delete(probe.containerMap, id)
+}
+
+// sync registers the containers that started and unregisters the ones
+// that terminated since the last poll
+func (probe *Probe) sync() error {
+	ids, err := probe.client.runningContainers()
+	if err != nil {
+		return fmt.Errorf("Failed to list CRI containers: %s", err)
+	}
+
+	running := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		running[id] = true
+	}
+
+	probe.RLock()
+	var terminated []string
+	for id := range probe.containerMap {
+		if !running[id] {
+			terminated = append(terminated, id)
+		}
+	}
+	probe.RUnlock()
+
+	for _, id := range terminated {
+		probe.unregisterContainer(id)
+	}
+
+	for _, id := range ids {
+		if atomic.LoadInt64(&probe.state) != common.RunningState {
+			break
+		}
+		probe.registerContainer(id)
+	}
+
+	return nil
+}
+
+// poll synchronizes the containers, a failed poll being retried on the
+// next one unless the runtime can't be reached anymore
+func (probe *Probe) poll() error {
+	err := probe.sync()
+	if err == nil {
+		return nil
+	}
+
+	if _, verr := probe.client.version(); verr != nil {
+		return fmt.Errorf("Lost connection to CRI runtime: %s", verr)
+	}
+
+	logging.GetLogger().Error(err)
+	return nil
+}
+
+func (probe *Probe) connect() error {
+	var err error
+
+	logging.GetLogger().Debugf("Connecting to CRI runtime: %s", probe.endpoint)
+	if probe.client, err = newClient(probe.endpoint); err != nil {
+		return fmt.Errorf("Failed to create client to CRI runtime: %s", err)
+	}
+	defer probe.client.close()
+
+	if probe.runtimeName, err = probe.client.version(); err != nil {
+		return fmt.Errorf("Failed to connect to CRI runtime: %s", err)
+	}
+
+	if probe.hostNs, err = netns.Get(); err != nil {
+		return err
+	}
+	defer probe.hostNs.Close()
+
+	probe.RLock()
+	var ids []string
+	for id := range probe.containerMap {
+		ids = append(ids, id)
+	}
+	probe.RUnlock()
+
+	for _, id := range ids {
+		probe.unregisterContainer(id)
+	}
+
+	ticker := time.NewTicker(probe.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := probe.poll(); err != nil {
+			return err
+		}
+
+		select {
+		case <-probe.quit:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Start the probe
+func (probe *Probe) Start() {
+	if !atomic.CompareAndSwapInt64(&probe.state, common.StoppedState, common.RunningState) {
+		return
+	}
+
+	probe.quit = make(chan struct{})
+	probe.wg.Add(1)
+
+	go func() {
+		defer probe.wg.Done()
+
+		for atomic.LoadInt64(&probe.state) == common.RunningState {
+			if err := probe.connect(); err != nil {
+				logging.GetLogger().Error(err)
+
+				select {
+				case <-probe.quit:
+					return
+				case <-time.After(1 * time.Second):
+				}
+			}
+		}
+	}()
+}
+
+// Stop the probe
+func (probe *Probe) Stop() {
+	if !atomic.CompareAndSwapInt64(&probe.state, common.RunningState, common.StoppingState) {
+		return
+	}
+
+	close(probe.quit)
+	probe.wg.Wait()
+
+	atomic.StoreInt64(&probe.state, common.StoppedState)
+}
+
+// NewProbe creates a new topology CRI probe
+func NewProbe(nsProbe *ns.Probe, endpoint string) (*Probe, error) {
+	interval := config.GetInt("cri.update")
+	if interval <= 0 {
+		return nil, fmt.Errorf("Invalid CRI update interval: %d", interval)
+	}
+
+	return &Probe{
+		Probe:        nsProbe,
+		endpoint:     endpoint,
+		interval:     time.Duration(interval) * time.Second,
+		namespaces:   nsProbe,
+		containerMap: make(map[string]containerNode),
+		state:        common.StoppedState,
+	}, nil
+}
@@ -0,0 +1,231 @@
+// +build linux
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package cri
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/vishvananda/netns"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/filters"
+	"github.com/skydive-project/skydive/topology"
+	"github.com/skydive-project/skydive/topology/graph"
+	"github.com/skydive-project/skydive/topology/probes/cri/runtime"
+	ns "github.com/skydive-project/skydive/topology/probes/netns"
+)
+
+// fakeNamespaces registers the namespaces as netns nodes, counting their
+// references like the netns probe
+type fakeNamespaces struct {
+	graph *graph.Graph
+	root  *graph.Node
+	nodes map[string]*graph.Node
+	refs  map[string]int
+}
+
+func (f *fakeNamespaces) Register(path string, name string) (*graph.Node, error) {
+	f.refs[path]++
+	if n, ok := f.nodes[path]; ok {
+		return n, nil
+	}
+
+	f.graph.Lock()
+	n := f.graph.NewNode(graph.GenID(), graph.Metadata{"Type": "netns", "Name": name, "Path": path})
+	topology.AddOwnershipLink(f.graph, f.root, n, nil)
+	f.graph.Unlock()
+
+	f.nodes[path] = n
+	return n, nil
+}
+
+func (f *fakeNamespaces) Unregister(path string) {
+	if f.refs[path] == 0 {
+		return
+	}
+
+	if f.refs[path]--; f.refs[path] == 0 {
+		f.graph.Lock()
+		f.graph.DelNode(f.nodes[path])
+		f.graph.Unlock()
+
+		delete(f.nodes, path)
+		delete(f.refs, path)
+	}
+}
+
+// newTestProbe returns a probe connected to the given runtime, its
+// containers running in the namespace of the test process
+func newTestProbe(t *testing.T, f *fakeRuntime) (*Probe, *fakeNamespaces, func()) {
+	pid := strconv.Itoa(os.Getpid())
+	f.pids = map[string]string{"container1": pid, "container2": pid, "container3": "0"}
+
+	endpoint, stop := startFakeRuntime(t, f)
+
+	c, err := newClient(endpoint)
+	if err != nil {
+		stop()
+		t.Fatal(err)
+	}
+
+	b, err := graph.NewMemoryBackend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := graph.NewGraphFromConfig(b, common.UnknownService)
+
+	g.Lock()
+	root := g.NewNode(graph.GenID(), graph.Metadata{"Type": "host"})
+	g.Unlock()
+
+	namespaces := &fakeNamespaces{graph: g, root: root, nodes: make(map[string]*graph.Node), refs: make(map[string]int)}
+	probe := &Probe{
+		Probe:        &ns.Probe{Graph: g, Root: root},
+		client:       c,
+		runtimeName:  "fake",
+		state:        common.RunningState,
+		hostNs:       netns.None(),
+		namespaces:   namespaces,
+		containerMap: make(map[string]containerNode),
+	}
+
+	return probe, namespaces, func() {
+		c.close()
+		stop()
+	}
+}
+
+func containerNodes(g *graph.Graph) []*graph.Node {
+	g.RLock()
+	defer g.RUnlock()
+	return g.GetNodes(graph.NewElementFilter(filters.NewTermStringFilter("Type", "container")))
+}
+
+func TestSync(t *testing.T) {
+	f := newFakeRuntime()
+	probe, namespaces, cleanup := newTestProbe(t, f)
+	defer cleanup()
+
+	g := probe.Graph
+	namespace := fmt.Sprintf("/proc/%d/ns/net", os.Getpid())
+
+	if err := probe.sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	if nodes := containerNodes(g); len(nodes) != 2 {
+		t.Fatalf("Expected 2 container nodes, got %v", nodes)
+	}
+	if namespaces.refs[namespace] != 2 {
+		t.Fatalf("Expected 2 references to %s, got %v", namespace, namespaces.refs)
+	}
+	netnsNode := namespaces.nodes[namespace]
+
+	// the sidecar terminated
+	f.containers[1].State = runtime.ContainerState_CONTAINER_EXITED
+
+	if err := probe.sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	nodes := containerNodes(g)
+	if len(nodes) != 1 {
+		t.Fatalf("Expected 1 container node, got %v", nodes)
+	}
+	if name, _ := nodes[0].GetFieldString("Name"); name != "nginx" {
+		t.Errorf("Expected the nginx container to be kept, got %s", name)
+	}
+	if namespaces.refs[namespace] != 1 {
+		t.Errorf("Expected 1 reference to %s, got %v", namespace, namespaces.refs)
+	}
+
+	// the pod was deleted
+	f.containers = f.containers[1:]
+
+	if err := probe.sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	if nodes := containerNodes(g); len(nodes) != 0 {
+		t.Errorf("Expected no container node, got %v", nodes)
+	}
+	if len(probe.containerMap) != 0 {
+		t.Errorf("Expected no registered container, got %v", probe.containerMap)
+	}
+	if len(namespaces.refs) != 0 {
+		t.Errorf("Expected the namespace to be unregistered, got %v", namespaces.refs)
+	}
+
+	g.RLock()
+	if n := g.GetNode(netnsNode.ID); n != nil {
+		t.Errorf("Expected the netns node to be removed, got %v", n)
+	}
+	g.RUnlock()
+}
+
+func TestPollTransientError(t *testing.T) {
+	f := newFakeRuntime()
+	probe, _, cleanup := newTestProbe(t, f)
+	defer cleanup()
+
+	if err := probe.poll(); err != nil {
+		t.Fatal(err)
+	}
+	nodes := containerNodes(probe.Graph)
+	if len(nodes) != 2 {
+		t.Fatalf("Expected 2 container nodes, got %v", nodes)
+	}
+
+	// a failed listing keeps the containers as they are
+	f.listErr = grpc.Errorf(codes.DeadlineExceeded, "listing timeout")
+	if err := probe.poll(); err != nil {
+		t.Fatalf("A failed poll should be retried, got: %s", err)
+	}
+	kept := containerNodes(probe.Graph)
+	if len(kept) != 2 {
+		t.Fatalf("Expected the container nodes to be kept, got %v", kept)
+	}
+	for _, n := range kept {
+		if n.ID != nodes[0].ID && n.ID != nodes[1].ID {
+			t.Errorf("Expected the container nodes to be kept, got %v", kept)
+		}
+	}
+
+	f.listErr = nil
+	if err := probe.poll(); err != nil || len(containerNodes(probe.Graph)) != 2 {
+		t.Errorf("Expected the containers to be polled again, got %v (%v)", containerNodes(probe.Graph), err)
+	}
+
+	// the connection is lost once the runtime is gone
+	cleanup()
+	if err := probe.poll(); err == nil {
+		t.Error("Expected an error once the runtime is stopped")
+	}
+}
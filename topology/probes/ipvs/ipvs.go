@@ -0,0 +1,514 @@
+// +build linux
+
+/*
+ * Copyright (C) 2018 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package ipvs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/topology"
+	"github.com/skydive-project/skydive/topology/graph"
+)
+
+const (
+	ipvsGenlName    = "IPVS"
+	ipvsGenlVersion = 1
+
+	ipvsCmdGetService = 4
+	ipvsCmdGetDest    = 8
+
+	ipvsCmdAttrService = 1
+	ipvsCmdAttrDest    = 2
+
+	ipvsSvcAttrAF        = 1
+	ipvsSvcAttrProtocol  = 2
+	ipvsSvcAttrAddr      = 3
+	ipvsSvcAttrPort      = 4
+	ipvsSvcAttrFWMark    = 5
+	ipvsSvcAttrSchedName = 6
+
+	ipvsDestAttrAddr        = 1
+	ipvsDestAttrPort        = 2
+	ipvsDestAttrFwdMethod   = 3
+	ipvsDestAttrWeight      = 4
+	ipvsDestAttrActiveConns = 7
+	ipvsDestAttrInactConns  = 8
+	ipvsDestAttrStats       = 10
+	ipvsDestAttrAddrFamily  = 11
+	ipvsDestAttrStats64     = 12
+
+	ipvsStatsConns    = 1
+	ipvsStatsInPkts   = 2
+	ipvsStatsOutPkts  = 3
+	ipvsStatsInBytes  = 4
+	ipvsStatsOutBytes = 5
+
+	ipvsFwdMask = 0x7
+
+	nlaTypeMask = 0x3fff
+	sizeofGenl  = 4
+)
+
+var forwardMethods = map[uint32]string{
+	0: "masq",
+	1: "local",
+	2: "tunnel",
+	3: "route",
+	4: "bypass",
+}
+
+var protocols = map[uint16]string{
+	syscall.IPPROTO_TCP:  "TCP",
+	syscall.IPPROTO_UDP:  "UDP",
+	syscall.IPPROTO_SCTP: "SCTP",
+}
+
+// Service describes an IPVS virtual service
+type Service struct {
+	Protocol  string
+	Address   string
+	Port      int64
+	FWMark    int64
+	Scheduler string
+	// attributes identifying the service in the real server requests
+	attrs []*nl.RtAttr
+}
+
+// Server describes a real server of an IPVS virtual service
+type Server struct {
+	Address       string
+	Port          int64
+	Weight        int64
+	ForwardMethod string
+	Metric        *ServerMetric
+}
+
+// Probe describes a probe modeling the IPVS virtual services of the host
+// and their real servers
+type Probe struct {
+	graph      *graph.Graph
+	host       *graph.Node
+	intfName   string
+	owned      map[graph.Identifier]bool
+	lastUpdate time.Time
+	quit       chan bool
+}
+
+func parseAddress(family uint16, addr []byte) string {
+	if family == syscall.AF_INET && len(addr) >= net.IPv4len {
+		return net.IP(addr[:net.IPv4len]).String()
+	}
+	return net.IP(addr).String()
+}
+
+func parseStats(data []byte, is64 bool, metric *ServerMetric) error {
+	attrs, err := nl.ParseRouteAttr(data)
+	if err != nil {
+		return err
+	}
+
+	native := nl.NativeEndian()
+	for _, attr := range attrs {
+		var value int64
+		switch {
+		case len(attr.Value) >= 8 && (is64 || attr.Attr.Type&nlaTypeMask == ipvsStatsInBytes || attr.Attr.Type&nlaTypeMask == ipvsStatsOutBytes):
+			value = int64(native.Uint64(attr.Value))
+		case len(attr.Value) >= 4:
+			value = int64(native.Uint32(attr.Value))
+		default:
+			continue
+		}
+
+		switch attr.Attr.Type & nlaTypeMask {
+		case ipvsStatsConns:
+			metric.Connections = value
+		case ipvsStatsInPkts:
+			metric.InPackets = value
+		case ipvsStatsOutPkts:
+			metric.OutPackets = value
+		case ipvsStatsInBytes:
+			metric.InBytes = value
+		case ipvsStatsOutBytes:
+			metric.OutBytes = value
+		}
+	}
+	return nil
+}
+
+// nestedAttrs returns the attributes nested in the given top level
+// attribute of a generic netlink message
+func nestedAttrs(msg []byte, attrType uint16) ([]syscall.NetlinkRouteAttr, error) {
+	if len(msg) < sizeofGenl {
+		return nil, fmt.Errorf("IPVS message too short")
+	}
+
+	attrs, err := nl.ParseRouteAttr(msg[sizeofGenl:])
+	if err != nil {
+		return nil, err
+	}
+
+	for _, attr := range attrs {
+		if attr.Attr.Type&nlaTypeMask == attrType {
+			return nl.ParseRouteAttr(attr.Value)
+		}
+	}
+	return nil, fmt.Errorf("IPVS attribute %d not found", attrType)
+}
+
+func parseService(msg []byte) (*Service, error) {
+	attrs, err := nestedAttrs(msg, ipvsCmdAttrService)
+	if err != nil {
+		return nil, err
+	}
+
+	service := &Service{}
+	var family uint16
+	var addr []byte
+
+	native := nl.NativeEndian()
+	for _, attr := range attrs {
+		attrType := attr.Attr.Type & nlaTypeMask
+		switch attrType {
+		case ipvsSvcAttrAF:
+			family = native.Uint16(attr.Value)
+		case ipvsSvcAttrProtocol:
+			proto := native.Uint16(attr.Value)
+			if service.Protocol = protocols[proto]; service.Protocol == "" {
+				service.Protocol = fmt.Sprintf("%d", proto)
+			}
+		case ipvsSvcAttrAddr:
+			addr = attr.Value
+		case ipvsSvcAttrPort:
+			service.Port = int64(binary.BigEndian.Uint16(attr.Value))
+		case ipvsSvcAttrFWMark:
+			service.FWMark = int64(native.Uint32(attr.Value))
+		case ipvsSvcAttrSchedName:
+			service.Scheduler = strings.TrimRight(string(attr.Value), "\x00")
+		default:
+			continue
+		}
+
+		switch attrType {
+		case ipvsSvcAttrAF, ipvsSvcAttrProtocol, ipvsSvcAttrAddr, ipvsSvcAttrPort, ipvsSvcAttrFWMark:
+			service.attrs = append(service.attrs, nl.NewRtAttr(int(attrType), attr.Value))
+		}
+	}
+
+	if addr != nil {
+		service.Address = parseAddress(family, addr)
+	}
+
+	return service, nil
+}
+
+func parseServer(msg []byte, family uint16) (*Server, error) {
+	attrs, err := nestedAttrs(msg, ipvsCmdAttrDest)
+	if err != nil {
+		return nil, err
+	}
+
+	server := &Server{Metric: &ServerMetric{}}
+	var addr []byte
+
+	native := nl.NativeEndian()
+	for _, attr := range attrs {
+		switch attr.Attr.Type & nlaTypeMask {
+		case ipvsDestAttrAddr:
+			addr = attr.Value
+		case ipvsDestAttrAddrFamily:
+			family = native.Uint16(attr.Value)
+		case ipvsDestAttrPort:
+			server.Port = int64(binary.BigEndian.Uint16(attr.Value))
+		case ipvsDestAttrFwdMethod:
+			server.ForwardMethod = forwardMethods[native.Uint32(attr.Value)&ipvsFwdMask]
+		case ipvsDestAttrWeight:
+			server.Weight = int64(int32(native.Uint32(attr.Value)))
+		case ipvsDestAttrActiveConns:
+			server.Metric.ActiveConnections = int64(native.Uint32(attr.Value))
+		case ipvsDestAttrInactConns:
+			server.Metric.InactiveConnections = int64(native.Uint32(attr.Value))
+		case ipvsDestAttrStats:
+			if err := parseStats(attr.Value, false, server.Metric); err != nil {
+				return nil, err
+			}
+		case ipvsDestAttrStats64:
+			if err := parseStats(attr.Value, true, server.Metric); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if addr != nil {
+		server.Address = parseAddress(family, addr)
+	}
+
+	return server, nil
+}
+
+func (s *Service) family() uint16 {
+	for _, attr := range s.attrs {
+		if attr.Type == ipvsSvcAttrAF {
+			return nl.NativeEndian().Uint16(attr.Data)
+		}
+	}
+	return syscall.AF_INET
+}
+
+func familyName(family uint16) string {
+	if family == syscall.AF_INET6 {
+		return "IPv6"
+	}
+	return "IPv4"
+}
+
+// name returns the name of the service, the fwmark services of the IPv4 and
+// IPv6 families being different services for the same mark
+func (s *Service) name() string {
+	if s.FWMark != 0 {
+		return fmt.Sprintf("FWM:%d:%s", s.FWMark, familyName(s.family()))
+	}
+	return fmt.Sprintf("%s:%s:%d", s.Protocol, s.Address, s.Port)
+}
+
+func dump(familyID uint16, cmd uint8, attrs ...nl.NetlinkRequestData) ([][]byte, error) {
+	req := nl.NewNetlinkRequest(int(familyID), syscall.NLM_F_DUMP)
+	req.AddData(&nl.Genlmsg{Command: cmd, Version: ipvsGenlVersion})
+	for _, attr := range attrs {
+		req.AddData(attr)
+	}
+	return req.Execute(syscall.NETLINK_GENERIC, 0)
+}
+
+// getServices returns the virtual services of the host and their real servers
+func getServices() (map[*Service][]*Server, error) {
+	family, err := netlink.GenlFamilyGet(ipvsGenlName)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get the IPVS netlink family, is the ip_vs module loaded ? %s", err)
+	}
+
+	msgs, err := dump(family.ID, ipvsCmdGetService)
+	if err != nil {
+		return nil, err
+	}
+
+	services := make(map[*Service][]*Server)
+	for _, msg := range msgs {
+		service, err := parseService(msg)
+		if err != nil {
+			return nil, err
+		}
+
+		attr := nl.NewRtAttr(ipvsCmdAttrService, nil)
+		for _, child := range service.attrs {
+			attr.AddChild(child)
+		}
+
+		msgs, err := dump(family.ID, ipvsCmdGetDest, attr)
+		if err != nil {
+			return nil, err
+		}
+
+		var servers []*Server
+		for _, msg := range msgs {
+			server, err := parseServer(msg, service.family())
+			if err != nil {
+				return nil, err
+			}
+			servers = append(servers, server)
+		}
+		services[service] = servers
+	}
+
+	return services, nil
+}
+
+func (p *Probe) getOrCreate(parent *graph.Node, id graph.Identifier, m graph.Metadata) *graph.Node {
+	node := p.graph.GetNode(id)
+	if node == nil {
+		node = p.graph.NewNode(id, m)
+		topology.AddOwnershipLink(p.graph, parent, node, nil)
+	} else {
+		tr := p.graph.StartMetadataTransaction(node)
+		for k, v := range m {
+			tr.AddMetadata(k, v)
+		}
+		tr.Commit()
+	}
+	return node
+}
+
+func (p *Probe) updateMetric(node *graph.Node, currMetric *ServerMetric, now time.Time) {
+	currMetric.Last = int64(common.UnixMillis(now))
+
+	tr := p.graph.StartMetadataTransaction(node)
+
+	if prevMetric, err := node.GetField("Metric"); err == nil {
+		if prevMetric, ok := prevMetric.(*ServerMetric); ok {
+			lastUpdateMetric := currMetric.Sub(prevMetric).(*ServerMetric)
+
+			// nothing changed since last update
+			if lastUpdateMetric.IsZero() &&
+				currMetric.ActiveConnections == prevMetric.ActiveConnections &&
+				currMetric.InactiveConnections == prevMetric.InactiveConnections {
+				return
+			}
+
+			if !p.lastUpdate.IsZero() {
+				lastUpdateMetric.Start = int64(common.UnixMillis(p.lastUpdate))
+				lastUpdateMetric.Last = int64(common.UnixMillis(now))
+				tr.AddMetadata("LastUpdateMetric", lastUpdateMetric)
+			}
+		}
+	}
+
+	tr.AddMetadata("Metric", currMetric)
+	tr.Commit()
+}
+
+// sync updates the nodes of the virtual services and of the real servers,
+// the graph has to be locked
+func (p *Probe) sync(services map[*Service][]*Server, now time.Time) map[graph.Identifier]bool {
+	nodes := make(map[graph.Identifier]bool)
+
+	intf := p.graph.LookupFirstChild(p.host, graph.Metadata{"Name": p.intfName})
+
+	for service, servers := range services {
+		name := service.name()
+
+		m := graph.Metadata{
+			"Type":      "ipvs-service",
+			"Manager":   "ipvs",
+			"Name":      name,
+			"Scheduler": service.Scheduler,
+		}
+		if service.FWMark != 0 {
+			m["FWMark"] = service.FWMark
+			m["Family"] = familyName(service.family())
+		} else {
+			m["Protocol"] = service.Protocol
+			m["Address"] = service.Address
+			m["Port"] = service.Port
+		}
+
+		serviceID := graph.GenID(string(p.host.ID), "ipvs", name)
+		serviceNode := p.getOrCreate(p.host, serviceID, m)
+		nodes[serviceID] = true
+
+		// the virtual IPs are bound to the IPVS dummy interface
+		if intf != nil && !p.graph.AreLinked(intf, serviceNode, graph.Metadata{"RelationType": "ipvs"}) {
+			p.graph.NewEdge(graph.GenID(string(intf.ID), string(serviceID), "RelationType", "ipvs"), intf, serviceNode, graph.Metadata{"RelationType": "ipvs"})
+		}
+
+		for _, server := range servers {
+			serverID := graph.GenID(string(serviceID), server.Address, fmt.Sprintf("%d", server.Port))
+			serverNode := p.getOrCreate(serviceNode, serverID, graph.Metadata{
+				"Type":          "ipvs-server",
+				"Manager":       "ipvs",
+				"Name":          fmt.Sprintf("%s:%d", server.Address, server.Port),
+				"Address":       server.Address,
+				"Port":          server.Port,
+				"Weight":        server.Weight,
+				"ForwardMethod": server.ForwardMethod,
+			})
+			p.updateMetric(serverNode, server.Metric, now)
+			nodes[serverID] = true
+		}
+	}
+
+	return nodes
+}
+
+func (p *Probe) refresh() {
+	services, err := getServices()
+	if err != nil {
+		logging.GetLogger().Errorf("Failed to retrieve IPVS services: %s", err)
+		return
+	}
+	now := time.Now().UTC()
+
+	p.graph.Lock()
+	defer p.graph.Unlock()
+
+	nodes := p.sync(services, now)
+
+	// delete the nodes of the removed services and servers
+	for id := range p.owned {
+		if nodes[id] {
+			continue
+		}
+		if node := p.graph.GetNode(id); node != nil {
+			p.graph.DelNode(node)
+		}
+	}
+
+	p.owned = nodes
+	p.lastUpdate = now
+}
+
+// Start the probe
+func (p *Probe) Start() {
+	go func() {
+		seconds := config.GetInt("agent.topology.ipvs.update")
+		ticker := time.NewTicker(time.Duration(seconds) * time.Second)
+		defer ticker.Stop()
+
+		p.refresh()
+
+		for {
+			select {
+			case <-p.quit:
+				return
+			case <-ticker.C:
+				p.refresh()
+			}
+		}
+	}()
+}
+
+// Stop the probe
+func (p *Probe) Stop() {
+	p.quit <- true
+}
+
+// NewProbe creates a new IPVS probe
+func NewProbe(g *graph.Graph, host *graph.Node) (*Probe, error) {
+	return &Probe{
+		graph:    g,
+		host:     host,
+		intfName: config.GetString("agent.topology.ipvs.interface"),
+		owned:    make(map[graph.Identifier]bool),
+		quit:     make(chan bool),
+	}, nil
+}
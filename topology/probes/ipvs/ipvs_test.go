@@ -0,0 +1,255 @@
+// +build linux
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package ipvs
+
+import (
+	"encoding/binary"
+	"net"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/vishvananda/netlink/nl"
+)
+
+func u16Attr(attrType int, v uint16) *nl.RtAttr {
+	b := make([]byte, 2)
+	nl.NativeEndian().PutUint16(b, v)
+	return nl.NewRtAttr(attrType, b)
+}
+
+func u32Attr(attrType int, v uint32) *nl.RtAttr {
+	b := make([]byte, 4)
+	nl.NativeEndian().PutUint32(b, v)
+	return nl.NewRtAttr(attrType, b)
+}
+
+func u64Attr(attrType int, v uint64) *nl.RtAttr {
+	b := make([]byte, 8)
+	nl.NativeEndian().PutUint64(b, v)
+	return nl.NewRtAttr(attrType, b)
+}
+
+func portAttr(attrType int, port uint16) *nl.RtAttr {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, port)
+	return nl.NewRtAttr(attrType, b)
+}
+
+// addrAttr returns an address attribute, the kernel always sending the 16
+// bytes of an union nf_inet_addr
+func addrAttr(attrType int, ip string) *nl.RtAttr {
+	b := make([]byte, 16)
+	if ip4 := net.ParseIP(ip).To4(); ip4 != nil {
+		copy(b, ip4)
+	} else {
+		copy(b, net.ParseIP(ip))
+	}
+	return nl.NewRtAttr(attrType, b)
+}
+
+// ipvsMessage returns a generic netlink message holding the given
+// attributes nested in a top level attribute
+func ipvsMessage(cmdAttr int, attrs ...*nl.RtAttr) []byte {
+	top := nl.NewRtAttr(cmdAttr, nil)
+	for _, attr := range attrs {
+		top.AddChild(attr)
+	}
+	return append(make([]byte, sizeofGenl), top.Serialize()...)
+}
+
+func TestParseService(t *testing.T) {
+	tests := []struct {
+		name     string
+		msg      []byte
+		expected Service
+		family   uint16
+		id       string
+	}{
+		{
+			name: "IPv4",
+			msg: ipvsMessage(ipvsCmdAttrService,
+				u16Attr(ipvsSvcAttrAF, syscall.AF_INET),
+				u16Attr(ipvsSvcAttrProtocol, syscall.IPPROTO_TCP),
+				addrAttr(ipvsSvcAttrAddr, "10.0.0.1"),
+				portAttr(ipvsSvcAttrPort, 80),
+				nl.NewRtAttr(ipvsSvcAttrSchedName, []byte("rr\x00")),
+			),
+			expected: Service{Protocol: "TCP", Address: "10.0.0.1", Port: 80, Scheduler: "rr"},
+			family:   syscall.AF_INET,
+			id:       "TCP:10.0.0.1:80",
+		},
+		{
+			name: "IPv6",
+			msg: ipvsMessage(ipvsCmdAttrService,
+				u16Attr(ipvsSvcAttrAF, syscall.AF_INET6),
+				u16Attr(ipvsSvcAttrProtocol, syscall.IPPROTO_UDP),
+				addrAttr(ipvsSvcAttrAddr, "fd00::1"),
+				portAttr(ipvsSvcAttrPort, 53),
+				nl.NewRtAttr(ipvsSvcAttrSchedName, []byte("wlc\x00")),
+			),
+			expected: Service{Protocol: "UDP", Address: "fd00::1", Port: 53, Scheduler: "wlc"},
+			family:   syscall.AF_INET6,
+			id:       "UDP:fd00::1:53",
+		},
+		{
+			name: "fwmark",
+			msg: ipvsMessage(ipvsCmdAttrService,
+				u16Attr(ipvsSvcAttrAF, syscall.AF_INET),
+				u32Attr(ipvsSvcAttrFWMark, 42),
+				nl.NewRtAttr(ipvsSvcAttrSchedName, []byte("sh\x00")),
+			),
+			expected: Service{FWMark: 42, Scheduler: "sh"},
+			family:   syscall.AF_INET,
+			id:       "FWM:42:IPv4",
+		},
+		{
+			name: "IPv6 fwmark",
+			msg: ipvsMessage(ipvsCmdAttrService,
+				u16Attr(ipvsSvcAttrAF, syscall.AF_INET6),
+				u32Attr(ipvsSvcAttrFWMark, 42),
+				nl.NewRtAttr(ipvsSvcAttrSchedName, []byte("sh\x00")),
+			),
+			expected: Service{FWMark: 42, Scheduler: "sh"},
+			family:   syscall.AF_INET6,
+			id:       "FWM:42:IPv6",
+		},
+	}
+
+	for _, test := range tests {
+		service, err := parseService(test.msg)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+			continue
+		}
+
+		// the identifying attributes are checked through the family
+		if family := service.family(); family != test.family {
+			t.Errorf("%s: expected family %d, got %d", test.name, test.family, family)
+		}
+
+		if name := service.name(); name != test.id {
+			t.Errorf("%s: expected name %s, got %s", test.name, test.id, name)
+		}
+
+		service.attrs = nil
+		if !reflect.DeepEqual(*service, test.expected) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, *service)
+		}
+	}
+
+	if _, err := parseService(ipvsMessage(ipvsCmdAttrDest)); err == nil {
+		t.Error("A message without service attribute should be rejected")
+	}
+}
+
+func TestParseServer(t *testing.T) {
+	stats32 := nl.NewRtAttr(ipvsDestAttrStats, nil)
+	stats32.AddChild(u32Attr(ipvsStatsConns, 12))
+	stats32.AddChild(u32Attr(ipvsStatsInPkts, 100))
+	stats32.AddChild(u32Attr(ipvsStatsOutPkts, 80))
+	stats32.AddChild(u64Attr(ipvsStatsInBytes, 1<<33))
+	stats32.AddChild(u64Attr(ipvsStatsOutBytes, 4000))
+
+	stats64 := nl.NewRtAttr(ipvsDestAttrStats64, nil)
+	stats64.AddChild(u64Attr(ipvsStatsConns, 1<<32+1))
+	stats64.AddChild(u64Attr(ipvsStatsInPkts, 1<<34))
+	stats64.AddChild(u64Attr(ipvsStatsOutPkts, 1<<35))
+	stats64.AddChild(u64Attr(ipvsStatsInBytes, 1<<40))
+	stats64.AddChild(u64Attr(ipvsStatsOutBytes, 1<<41))
+
+	tests := []struct {
+		name     string
+		msg      []byte
+		family   uint16
+		expected Server
+	}{
+		{
+			name: "IPv4 with 32 bits stats",
+			msg: ipvsMessage(ipvsCmdAttrDest,
+				addrAttr(ipvsDestAttrAddr, "10.1.0.2"),
+				portAttr(ipvsDestAttrPort, 8080),
+				u32Attr(ipvsDestAttrFwdMethod, 0),
+				u32Attr(ipvsDestAttrWeight, 1),
+				u32Attr(ipvsDestAttrActiveConns, 3),
+				u32Attr(ipvsDestAttrInactConns, 1),
+				stats32,
+			),
+			family: syscall.AF_INET,
+			expected: Server{
+				Address:       "10.1.0.2",
+				Port:          8080,
+				Weight:        1,
+				ForwardMethod: "masq",
+				Metric: &ServerMetric{
+					ActiveConnections:   3,
+					InactiveConnections: 1,
+					Connections:         12,
+					InPackets:           100,
+					OutPackets:          80,
+					InBytes:             1 << 33,
+					OutBytes:            4000,
+				},
+			},
+		},
+		{
+			name: "IPv6 with 64 bits stats",
+			msg: ipvsMessage(ipvsCmdAttrDest,
+				addrAttr(ipvsDestAttrAddr, "fd00::2"),
+				u16Attr(ipvsDestAttrAddrFamily, syscall.AF_INET6),
+				portAttr(ipvsDestAttrPort, 53),
+				u32Attr(ipvsDestAttrFwdMethod, 3),
+				u32Attr(ipvsDestAttrWeight, 5),
+				stats64,
+			),
+			family: syscall.AF_INET,
+			expected: Server{
+				Address:       "fd00::2",
+				Port:          53,
+				Weight:        5,
+				ForwardMethod: "route",
+				Metric: &ServerMetric{
+					Connections: 1<<32 + 1,
+					InPackets:   1 << 34,
+					OutPackets:  1 << 35,
+					InBytes:     1 << 40,
+					OutBytes:    1 << 41,
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		server, err := parseServer(test.msg, test.family)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(*server, test.expected) {
+			t.Errorf("%s: expected %+v (%+v), got %+v (%+v)", test.name, test.expected, test.expected.Metric, *server, server.Metric)
+		}
+	}
+}
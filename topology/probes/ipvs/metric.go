@@ -0,0 +1,181 @@
+/*
+ * Copyright (C) 2018 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package ipvs
+
+import (
+	"github.com/skydive-project/skydive/common"
+)
+
+// ServerMetric the connections, packets and bytes counters of a real server,
+// the active and inactive connections being the current number of connections
+// easyjson:json
+type ServerMetric struct {
+	Connections         int64 `json:"Connections,omitempty"`
+	ActiveConnections   int64 `json:"ActiveConnections,omitempty"`
+	InactiveConnections int64 `json:"InactiveConnections,omitempty"`
+	InPackets           int64 `json:"InPackets,omitempty"`
+	OutPackets          int64 `json:"OutPackets,omitempty"`
+	InBytes             int64 `json:"InBytes,omitempty"`
+	OutBytes            int64 `json:"OutBytes,omitempty"`
+	Start               int64 `json:"Start,omitempty"`
+	Last                int64 `json:"Last,omitempty"`
+}
+
+// GetStart returns start time
+func (sm *ServerMetric) GetStart() int64 {
+	return sm.Start
+}
+
+// SetStart set start time
+func (sm *ServerMetric) SetStart(start int64) {
+	sm.Start = start
+}
+
+// GetLast returns last time
+func (sm *ServerMetric) GetLast() int64 {
+	return sm.Last
+}
+
+// SetLast set last time
+func (sm *ServerMetric) SetLast(last int64) {
+	sm.Last = last
+}
+
+// GetFieldInt64 returns field by name
+func (sm *ServerMetric) GetFieldInt64(field string) (int64, error) {
+	switch field {
+	case "Connections":
+		return sm.Connections, nil
+	case "ActiveConnections":
+		return sm.ActiveConnections, nil
+	case "InactiveConnections":
+		return sm.InactiveConnections, nil
+	case "InPackets":
+		return sm.InPackets, nil
+	case "OutPackets":
+		return sm.OutPackets, nil
+	case "InBytes":
+		return sm.InBytes, nil
+	case "OutBytes":
+		return sm.OutBytes, nil
+	}
+	return 0, common.ErrFieldNotFound
+}
+
+// GetFields returns all the field keys available
+func (sm *ServerMetric) GetFields() []string {
+	return metricsFields
+}
+
+// Add sum two metrics and return a new Metrics object
+func (sm *ServerMetric) Add(m common.Metric) common.Metric {
+	om := m.(*ServerMetric)
+
+	return &ServerMetric{
+		Connections:         sm.Connections + om.Connections,
+		ActiveConnections:   sm.ActiveConnections + om.ActiveConnections,
+		InactiveConnections: sm.InactiveConnections + om.InactiveConnections,
+		InPackets:           sm.InPackets + om.InPackets,
+		OutPackets:          sm.OutPackets + om.OutPackets,
+		InBytes:             sm.InBytes + om.InBytes,
+		OutBytes:            sm.OutBytes + om.OutBytes,
+		Start:               sm.Start,
+		Last:                sm.Last,
+	}
+}
+
+// Sub subtracts two metrics and return a new metrics object, the active and
+// inactive connections being gauges they are not subtracted
+func (sm *ServerMetric) Sub(m common.Metric) common.Metric {
+	om := m.(*ServerMetric)
+
+	return &ServerMetric{
+		Connections:         sm.Connections - om.Connections,
+		ActiveConnections:   sm.ActiveConnections,
+		InactiveConnections: sm.InactiveConnections,
+		InPackets:           sm.InPackets - om.InPackets,
+		OutPackets:          sm.OutPackets - om.OutPackets,
+		InBytes:             sm.InBytes - om.InBytes,
+		OutBytes:            sm.OutBytes - om.OutBytes,
+		Start:               sm.Start,
+		Last:                sm.Last,
+	}
+}
+
+// IsZero returns true if all the counters are equal to zero
+func (sm *ServerMetric) IsZero() bool {
+	return (sm.Connections +
+		sm.InPackets +
+		sm.OutPackets +
+		sm.InBytes +
+		sm.OutBytes) == 0
+}
+
+// Split splits a metric into two parts
+func (sm *ServerMetric) Split(cut int64) (common.Metric, common.Metric) {
+	if cut < sm.Start {
+		return nil, sm
+	} else if cut > sm.Last {
+		return sm, nil
+	} else if sm.Start == sm.Last {
+		return sm, nil
+	} else if cut == sm.Start {
+		return nil, sm
+	} else if cut == sm.Last {
+		return sm, nil
+	}
+
+	ratio := float64(cut-sm.Start) / float64(sm.Last-sm.Start)
+
+	m1 := &ServerMetric{
+		Connections:         int64(float64(sm.Connections) * ratio),
+		ActiveConnections:   sm.ActiveConnections,
+		InactiveConnections: sm.InactiveConnections,
+		InPackets:           int64(float64(sm.InPackets) * ratio),
+		OutPackets:          int64(float64(sm.OutPackets) * ratio),
+		InBytes:             int64(float64(sm.InBytes) * ratio),
+		OutBytes:            int64(float64(sm.OutBytes) * ratio),
+		Start:               sm.Start,
+		Last:                cut,
+	}
+
+	m2 := &ServerMetric{
+		Connections:         sm.Connections - m1.Connections,
+		ActiveConnections:   sm.ActiveConnections,
+		InactiveConnections: sm.InactiveConnections,
+		InPackets:           sm.InPackets - m1.InPackets,
+		OutPackets:          sm.OutPackets - m1.OutPackets,
+		InBytes:             sm.InBytes - m1.InBytes,
+		OutBytes:            sm.OutBytes - m1.OutBytes,
+		Start:               cut,
+		Last:                sm.Last,
+	}
+
+	return m1, m2
+}
+
+var metricsFields []string
+
+func init() {
+	metricsFields = common.StructFieldKeys(ServerMetric{})
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright (C) 2018 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package ipvs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestServerMetric(t *testing.T) {
+	prev := &ServerMetric{
+		Connections:       10,
+		ActiveConnections: 4,
+		InBytes:           1000,
+		Start:             0,
+		Last:              100,
+	}
+
+	curr := &ServerMetric{
+		Connections:       15,
+		ActiveConnections: 2,
+		InBytes:           3000,
+		Start:             0,
+		Last:              200,
+	}
+
+	expected := &ServerMetric{
+		Connections:       5,
+		ActiveConnections: 2,
+		InBytes:           2000,
+		Start:             0,
+		Last:              200,
+	}
+
+	if diff := curr.Sub(prev); !reflect.DeepEqual(expected, diff) {
+		t.Errorf("Expected %+v, got %+v", expected, diff)
+	}
+
+	m1, m2 := expected.Split(50)
+	if m1.(*ServerMetric).InBytes != 500 || m2.(*ServerMetric).InBytes != 1500 {
+		t.Errorf("Wrong split, got %+v and %+v", m1, m2)
+	}
+
+	if m1.(*ServerMetric).ActiveConnections != 2 || m2.(*ServerMetric).ActiveConnections != 2 {
+		t.Errorf("Active connections should not be split, got %+v and %+v", m1, m2)
+	}
+
+	if !(&ServerMetric{ActiveConnections: 3}).IsZero() {
+		t.Error("Active connections should not be taken into account as a change")
+	}
+}
@@ -35,6 +35,9 @@ const (
 	dockerContainerNameField = "Docker.Labels.io.kubernetes.container.name"
 	dockerPodNameField       = "Docker.Labels.io.kubernetes.pod.name"
 	dockerPodNamespaceField  = "Docker.Labels.io.kubernetes.pod.namespace"
+	criContainerNameField    = "CRI.Labels.io.kubernetes.container.name"
+	criPodNameField          = "CRI.Labels.io.kubernetes.pod.name"
+	criPodNamespaceField     = "CRI.Labels.io.kubernetes.pod.namespace"
 )
 
 type containerProbe struct {
@@ -140,3 +143,29 @@ func newContainerLinker(g *graph.Graph, subprobes map[string]Subprobe) probe.Pro
 
 	return graph.NewMetadataIndexerLinker(g, k8sIndexer, dockerIndexer, newEdgeMetadata())
 }
+
+func newCRIIndexer(g *graph.Graph) *graph.MetadataIndexer {
+	m := graph.NewElementFilter(filters.NewAndFilter(
+		filters.NewTermStringFilter("Manager", "cri"),
+		filters.NewTermStringFilter("Type", "container"),
+		filters.NewNotNullFilter(criPodNamespaceField),
+		filters.NewNotNullFilter(criPodNameField),
+	))
+
+	return graph.NewMetadataIndexer(g, g, m, criPodNamespaceField, criPodNameField, criContainerNameField)
+}
+
+func newCRIContainerLinker(g *graph.Graph, subprobes map[string]Subprobe) probe.Probe {
+	podProbe := subprobes["pod"]
+	if podProbe == nil {
+		return nil
+	}
+
+	k8sIndexer := newObjectIndexer(g, g, "container", "Namespace", "Pod", "Name")
+	k8sIndexer.Start()
+
+	criIndexer := newCRIIndexer(g)
+	criIndexer.Start()
+
+	return graph.NewMetadataIndexerLinker(g, k8sIndexer, criIndexer, newEdgeMetadata())
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright (C) 2018 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"github.com/skydive-project/skydive/filters"
+	"github.com/skydive-project/skydive/probe"
+	"github.com/skydive-project/skydive/topology/graph"
+)
+
+func newIPVSIndexer(g *graph.Graph, nodeType string) *graph.MetadataIndexer {
+	m := graph.NewElementFilter(filters.NewAndFilter(
+		filters.NewTermStringFilter("Manager", "ipvs"),
+		filters.NewTermStringFilter("Type", nodeType),
+		filters.NewNotNullFilter("Address"),
+	))
+
+	return graph.NewMetadataIndexer(g, g, m, "Address")
+}
+
+func newIPVSEdgeMetadata() graph.Metadata {
+	m := newEdgeMetadata()
+	m.SetField("RelationType", "ipvs")
+	return m
+}
+
+// newIPVSServiceLinker links the services to the IPVS virtual services of
+// their cluster IP
+func newIPVSServiceLinker(g *graph.Graph, subprobes map[string]Subprobe) probe.Probe {
+	serviceProbe := subprobes["service"]
+	if serviceProbe == nil {
+		return nil
+	}
+
+	serviceIndexer := graph.NewMetadataIndexer(g, serviceProbe, graph.Metadata{"Type": "service"}, "ClusterIP")
+	serviceIndexer.Start()
+
+	ipvsIndexer := newIPVSIndexer(g, "ipvs-service")
+	ipvsIndexer.Start()
+
+	return graph.NewMetadataIndexerLinker(g, serviceIndexer, ipvsIndexer, newIPVSEdgeMetadata())
+}
+
+// newIPVSPodLinker links the IPVS real servers to the pods of their address
+func newIPVSPodLinker(g *graph.Graph, subprobes map[string]Subprobe) probe.Probe {
+	podProbe := subprobes["pod"]
+	if podProbe == nil {
+		return nil
+	}
+
+	ipvsIndexer := newIPVSIndexer(g, "ipvs-server")
+	ipvsIndexer.Start()
+
+	podIndexer := graph.NewMetadataIndexer(g, podProbe, graph.Metadata{"Type": "pod"}, "IP")
+	podIndexer.Start()
+
+	return graph.NewMetadataIndexerLinker(g, ipvsIndexer, podIndexer, newIPVSEdgeMetadata())
+}
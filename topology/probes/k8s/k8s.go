@@ -111,12 +111,15 @@ func NewK8sProbe(g *graph.Graph) (*Probe, error) {
 
 	linkerHandlers := []linkHandler{
 		newContainerLinker,
+		newCRIContainerLinker,
 		newHostNodeLinker,
 		newNodePodLinker,
 		newIngressServiceLinker,
 		newNamespaceLinker,
 		newNetworkPolicyLinker,
 		newServicePodLinker,
+		newIPVSServiceLinker,
+		newIPVSPodLinker,
 	}
 
 	var linkers []probe.Probe
@@ -0,0 +1,501 @@
+// +build linux
+
+/*
+ * Copyright (C) 2018 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package netfilter
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/vishvananda/netlink/nl"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/filters"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/topology"
+	"github.com/skydive-project/skydive/topology/graph"
+)
+
+const (
+	nfnlSubsysNFTables = 10
+	nfnlgrpNFTables    = 7
+
+	// delay during which the nftables notifications are gathered before
+	// reading the rules again, a ruleset load sending one per object
+	notifyDelay = 500 * time.Millisecond
+)
+
+// Probe describes a probe reading the netfilter tables, chains and rules
+// of the host and of the network namespaces found by the netns probe. They
+// are added as child nodes of the host or namespace node, the rules and
+// the chain policies counters being exposed as metrics. The rules are read
+// periodically, and as soon as the kernel notifies an nftables change.
+type Probe struct {
+	common.RWMutex
+	graph.DefaultGraphListener
+	graph      *graph.Graph
+	host       *graph.Node
+	backends   []string
+	namespaces map[graph.Identifier]string
+	pending    map[graph.Identifier]bool
+	owned      map[graph.Identifier]map[graph.Identifier]bool
+	lastUpdate map[graph.Identifier]time.Time
+	watchers   map[graph.Identifier]*nftWatcher
+	notify     chan bool
+	quit       chan bool
+}
+
+// nftWatcher receives the nftables change notifications of a namespace
+type nftWatcher struct {
+	socket *nl.NetlinkSocket
+	state  int64
+}
+
+func (w *nftWatcher) run(id graph.Identifier, notify func()) {
+	for atomic.LoadInt64(&w.state) == common.RunningState {
+		msgs, err := w.socket.Receive()
+		if err != nil {
+			if atomic.LoadInt64(&w.state) != common.RunningState {
+				return
+			}
+			if errno, ok := err.(syscall.Errno); !ok || !errno.Temporary() {
+				logging.GetLogger().Errorf("Failed to receive nftables notifications for %s: %s", id, err)
+				return
+			}
+			continue
+		}
+
+		for _, msg := range msgs {
+			if msg.Header.Type>>8 == nfnlSubsysNFTables {
+				notify()
+				break
+			}
+		}
+	}
+}
+
+func (w *nftWatcher) stop() {
+	if atomic.CompareAndSwapInt64(&w.state, common.RunningState, common.StoppingState) {
+		w.socket.Close()
+	}
+}
+
+// watch subscribes to the nftables notifications of a namespace, the host
+// one if the path is empty
+func (p *Probe) watch(id graph.Identifier, nsPath string) (*nftWatcher, error) {
+	var context *common.NetNSContext
+	var err error
+
+	if nsPath != "" {
+		if context, err = common.NewNetNsContext(nsPath); err != nil {
+			return nil, fmt.Errorf("Failed to switch namespace: %s", err)
+		}
+	}
+	defer context.Close()
+
+	socket, err := nl.Subscribe(syscall.NETLINK_NETFILTER, nfnlgrpNFTables)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to subscribe to nftables notifications: %s", err)
+	}
+
+	w := &nftWatcher{socket: socket, state: common.RunningState}
+	go w.run(id, func() { p.notifyChange(id) })
+
+	return w, nil
+}
+
+// notifyChange schedules the read of the rules of a namespace
+func (p *Probe) notifyChange(id graph.Identifier) {
+	p.Lock()
+	p.pending[id] = true
+	p.Unlock()
+
+	select {
+	case p.notify <- true:
+	default:
+	}
+}
+
+func (p *Probe) hasBackend(backend string) bool {
+	for _, b := range p.backends {
+		if b == backend {
+			return true
+		}
+	}
+	return false
+}
+
+// readRuleset reads the netfilter tables of a namespace, the host one if
+// the path is empty
+func (p *Probe) readRuleset(nsPath string) ([]*Table, error) {
+	var context *common.NetNSContext
+	var err error
+
+	// commands are executed from the namespace of the locked thread
+	if nsPath != "" {
+		if context, err = common.NewNetNsContext(nsPath); err != nil {
+			return nil, fmt.Errorf("Failed to switch namespace: %s", err)
+		}
+	}
+	defer context.Close()
+
+	var tables []*Table
+
+	if p.hasBackend(IPTablesBackend) {
+		for _, save := range []struct{ family, command string }{{"ip", "iptables-save"}, {"ip6", "ip6tables-save"}} {
+			if _, err := exec.LookPath(save.command); err != nil {
+				continue
+			}
+
+			out, err := exec.Command(save.command, "-c").Output()
+			if err != nil {
+				return nil, fmt.Errorf("Failed to execute %s: %s", save.command, err)
+			}
+
+			t, err := ParseIPTablesSave(save.family, bytes.NewReader(out))
+			if err != nil {
+				return nil, err
+			}
+			tables = append(tables, t...)
+		}
+	}
+
+	if p.hasBackend(NFTablesBackend) {
+		if _, err := exec.LookPath("nft"); err == nil {
+			out, err := exec.Command("nft", "-j", "list", "ruleset").Output()
+			if err != nil {
+				return nil, fmt.Errorf("Failed to execute nft: %s", err)
+			}
+
+			t, err := ParseNFTablesJSON(out)
+			if err != nil {
+				return nil, err
+			}
+			tables = append(tables, t...)
+		}
+	}
+
+	return tables, nil
+}
+
+func (p *Probe) getOrCreate(parent *graph.Node, id graph.Identifier, m graph.Metadata) *graph.Node {
+	node := p.graph.GetNode(id)
+	if node == nil {
+		node = p.graph.NewNode(id, m)
+		topology.AddOwnershipLink(p.graph, parent, node, nil)
+	} else {
+		tr := p.graph.StartMetadataTransaction(node)
+		for k, v := range m {
+			tr.AddMetadata(k, v)
+		}
+		tr.Commit()
+	}
+	return node
+}
+
+func (p *Probe) updateMetric(node *graph.Node, currMetric *RuleMetric, now, last time.Time) {
+	if currMetric == nil {
+		return
+	}
+	currMetric.Last = int64(common.UnixMillis(now))
+
+	tr := p.graph.StartMetadataTransaction(node)
+
+	if prevMetric, err := node.GetField("Metric"); err == nil {
+		if prevMetric, ok := prevMetric.(*RuleMetric); ok {
+			lastUpdateMetric := currMetric.Sub(prevMetric).(*RuleMetric)
+
+			// nothing changed since last update
+			if lastUpdateMetric.IsZero() {
+				return
+			}
+
+			if !last.IsZero() {
+				lastUpdateMetric.Start = int64(common.UnixMillis(last))
+				lastUpdateMetric.Last = int64(common.UnixMillis(now))
+				tr.AddMetadata("LastUpdateMetric", lastUpdateMetric)
+			}
+		}
+	}
+
+	tr.AddMetadata("Metric", currMetric)
+	tr.Commit()
+}
+
+// sync updates the nodes of the tables, chains and rules of a namespace,
+// the graph has to be locked
+func (p *Probe) sync(parent *graph.Node, tables []*Table, now, last time.Time) map[graph.Identifier]bool {
+	nodes := make(map[graph.Identifier]bool)
+
+	for _, table := range tables {
+		tableID := graph.GenID(string(parent.ID), "netfilter", table.Backend, table.Family, table.Name)
+		tableNode := p.getOrCreate(parent, tableID, graph.Metadata{
+			"Type":    "netfilter-table",
+			"Name":    table.Name,
+			"Backend": table.Backend,
+			"Family":  table.Family,
+		})
+		nodes[tableID] = true
+
+		for _, chain := range table.Chains {
+			m := graph.Metadata{
+				"Type":  "netfilter-chain",
+				"Name":  chain.Name,
+				"Table": table.Name,
+			}
+			if chain.Policy != "" {
+				m["Policy"] = chain.Policy
+			}
+			if chain.Hook != "" {
+				m["Hook"] = chain.Hook
+			}
+
+			chainID := graph.GenID(string(tableID), chain.Name)
+			chainNode := p.getOrCreate(tableNode, chainID, m)
+			p.updateMetric(chainNode, chain.Metric, now, last)
+			nodes[chainID] = true
+
+			for _, rule := range chain.Rules {
+				m := graph.Metadata{
+					"Type":     "netfilter-rule",
+					"Name":     rule.Rule,
+					"Rule":     rule.Rule,
+					"Position": rule.Position,
+					"Chain":    chain.Name,
+					"Table":    table.Name,
+				}
+				if rule.Handle != 0 {
+					m["Handle"] = rule.Handle
+				}
+
+				ruleID := graph.GenID(string(chainID), rule.key)
+				ruleNode := p.getOrCreate(chainNode, ruleID, m)
+				p.updateMetric(ruleNode, rule.Metric, now, last)
+				nodes[ruleID] = true
+			}
+		}
+	}
+
+	return nodes
+}
+
+func (p *Probe) delNodes(nodes map[graph.Identifier]bool) {
+	for id := range nodes {
+		if node := p.graph.GetNode(id); node != nil {
+			p.graph.DelNode(node)
+		}
+	}
+}
+
+// refreshNamespace reads the rules of a namespace and updates its nodes
+func (p *Probe) refreshNamespace(id graph.Identifier, path string) {
+	// rules changes notified from now on, a failure leaving the periodic
+	// reads only, as with iptables-legacy
+	if _, found := p.watchers[id]; !found {
+		w, err := p.watch(id, path)
+		if err != nil {
+			logging.GetLogger().Debugf("Only periodic netfilter reads for %s: %s", id, err)
+		}
+		p.watchers[id] = w
+	}
+
+	tables, err := p.readRuleset(path)
+	if err != nil {
+		logging.GetLogger().Errorf("Failed to read netfilter rules of %s: %s", id, err)
+		return
+	}
+	now := time.Now().UTC()
+
+	p.graph.Lock()
+	if parent := p.graph.GetNode(id); parent != nil {
+		nodes := p.sync(parent, tables, now, p.lastUpdate[id])
+
+		// delete the nodes of the removed tables, chains and rules
+		for nodeID := range nodes {
+			delete(p.owned[id], nodeID)
+		}
+		p.delNodes(p.owned[id])
+
+		p.owned[id] = nodes
+		p.lastUpdate[id] = now
+	}
+	p.graph.Unlock()
+}
+
+// refresh reads the rules of all the namespaces
+func (p *Probe) refresh() {
+	p.Lock()
+	namespaces := make(map[graph.Identifier]string, len(p.namespaces))
+	for id, path := range p.namespaces {
+		namespaces[id] = path
+	}
+	p.pending = make(map[graph.Identifier]bool)
+	p.Unlock()
+
+	for id, path := range namespaces {
+		p.refreshNamespace(id, path)
+	}
+
+	// delete the nodes of the removed namespaces
+	for id, nodes := range p.owned {
+		if _, found := namespaces[id]; !found {
+			p.graph.Lock()
+			p.delNodes(nodes)
+			p.graph.Unlock()
+
+			delete(p.owned, id)
+			delete(p.lastUpdate, id)
+		}
+	}
+
+	for id, w := range p.watchers {
+		if _, found := namespaces[id]; !found {
+			if w != nil {
+				w.stop()
+			}
+			delete(p.watchers, id)
+		}
+	}
+}
+
+// refreshPending reads the rules of the namespaces notified as changed
+func (p *Probe) refreshPending() {
+	p.Lock()
+	namespaces := make(map[graph.Identifier]string, len(p.pending))
+	for id := range p.pending {
+		if path, found := p.namespaces[id]; found {
+			namespaces[id] = path
+		}
+	}
+	p.pending = make(map[graph.Identifier]bool)
+	p.Unlock()
+
+	for id, path := range namespaces {
+		p.refreshNamespace(id, path)
+	}
+}
+
+// OnNodeAdded event
+func (p *Probe) OnNodeAdded(n *graph.Node) {
+	if tp, _ := n.GetFieldString("Type"); tp != "netns" {
+		return
+	}
+
+	if path, _ := n.GetFieldString("Path"); path != "" {
+		p.Lock()
+		p.namespaces[n.ID] = path
+		p.Unlock()
+	}
+}
+
+// OnNodeDeleted event
+func (p *Probe) OnNodeDeleted(n *graph.Node) {
+	p.Lock()
+	delete(p.namespaces, n.ID)
+	p.Unlock()
+}
+
+// Start the probe
+func (p *Probe) Start() {
+	p.graph.RLock()
+	p.Lock()
+	p.namespaces[p.host.ID] = ""
+	p.Unlock()
+
+	filter := graph.NewElementFilter(filters.NewTermStringFilter("Type", "netns"))
+	for _, n := range p.graph.GetNodes(filter) {
+		p.OnNodeAdded(n)
+	}
+	p.graph.AddEventListener(p)
+	p.graph.RUnlock()
+
+	go func() {
+		seconds := config.GetInt("agent.topology.netfilter.update")
+		ticker := time.NewTicker(time.Duration(seconds) * time.Second)
+		defer ticker.Stop()
+
+		defer func() {
+			for _, w := range p.watchers {
+				if w != nil {
+					w.stop()
+				}
+			}
+		}()
+
+		p.refresh()
+
+		// the ticker keeps the counters up to date, the rules changes being
+		// notified for nftables only
+		var settle <-chan time.Time
+		for {
+			select {
+			case <-p.quit:
+				return
+			case <-ticker.C:
+				p.refresh()
+			case <-p.notify:
+				if settle == nil {
+					settle = time.After(notifyDelay)
+				}
+			case <-settle:
+				settle = nil
+				p.refreshPending()
+			}
+		}
+	}()
+}
+
+// Stop the probe
+func (p *Probe) Stop() {
+	p.graph.RemoveEventListener(p)
+	p.quit <- true
+}
+
+// NewProbe creates a new netfilter probe
+func NewProbe(g *graph.Graph, host *graph.Node) (*Probe, error) {
+	backends := config.GetStringSlice("agent.topology.netfilter.backends")
+	for _, backend := range backends {
+		if backend != IPTablesBackend && backend != NFTablesBackend {
+			return nil, fmt.Errorf("Unknown netfilter backend: %s", backend)
+		}
+	}
+
+	return &Probe{
+		graph:      g,
+		host:       host,
+		backends:   backends,
+		namespaces: make(map[graph.Identifier]string),
+		pending:    make(map[graph.Identifier]bool),
+		owned:      make(map[graph.Identifier]map[graph.Identifier]bool),
+		lastUpdate: make(map[graph.Identifier]time.Time),
+		watchers:   make(map[graph.Identifier]*nftWatcher),
+		notify:     make(chan bool, 1),
+		quit:       make(chan bool),
+	}, nil
+}
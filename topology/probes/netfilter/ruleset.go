@@ -0,0 +1,408 @@
+/*
+ * Copyright (C) 2018 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package netfilter
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/skydive-project/skydive/common"
+)
+
+const (
+	// IPTablesBackend rules read with iptables-save and ip6tables-save
+	IPTablesBackend = "iptables"
+	// NFTablesBackend rules read with nft
+	NFTablesBackend = "nftables"
+)
+
+// Rule describes a netfilter rule of a chain
+type Rule struct {
+	Rule     string
+	Position int64
+	Handle   int64
+	Metric   *RuleMetric
+	key      string
+}
+
+// Chain describes a netfilter chain and its rules
+type Chain struct {
+	Name   string
+	Policy string
+	Hook   string
+	Metric *RuleMetric
+	Rules  []*Rule
+}
+
+// Table describes a netfilter table and its chains
+type Table struct {
+	Backend string
+	Family  string
+	Name    string
+	Chains  []*Chain
+}
+
+func (t *Table) chain(name string) *Chain {
+	for _, chain := range t.Chains {
+		if chain.Name == name {
+			return chain
+		}
+	}
+
+	chain := &Chain{Name: name}
+	t.Chains = append(t.Chains, chain)
+	return chain
+}
+
+func (c *Chain) addRule(rule *Rule) {
+	rule.Position = int64(len(c.Rules)) + 1
+	c.Rules = append(c.Rules, rule)
+}
+
+// parseCounters parses iptables-save counters, ie [packets:bytes]
+func parseCounters(s string) (*RuleMetric, error) {
+	if !strings.HasPrefix(s, "[") || !strings.HasSuffix(s, "]") {
+		return nil, fmt.Errorf("Invalid counters: %s", s)
+	}
+
+	counters := strings.Split(s[1:len(s)-1], ":")
+	if len(counters) != 2 {
+		return nil, fmt.Errorf("Invalid counters: %s", s)
+	}
+
+	packets, err := strconv.ParseInt(counters[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid packets counter: %s", s)
+	}
+
+	bytes, err := strconv.ParseInt(counters[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid bytes counter: %s", s)
+	}
+
+	return &RuleMetric{Packets: packets, Bytes: bytes}, nil
+}
+
+// ParseIPTablesSave parses the output of iptables-save -c or ip6tables-save -c
+func ParseIPTablesSave(family string, r io.Reader) ([]*Table, error) {
+	var tables []*Table
+	var table *Table
+
+	// identical rules of a chain are distinguished by their occurrence
+	occurrences := make(map[string]int)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case line == "COMMIT":
+			table = nil
+		case strings.HasPrefix(line, "*"):
+			table = &Table{Backend: IPTablesBackend, Family: family, Name: line[1:]}
+			tables = append(tables, table)
+		case table == nil:
+			return nil, fmt.Errorf("Unexpected line outside of a table: %s", line)
+		case strings.HasPrefix(line, ":"):
+			// :CHAIN POLICY [packets:bytes]
+			fields := strings.Fields(line[1:])
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("Invalid chain: %s", line)
+			}
+
+			chain := table.chain(fields[0])
+			if fields[1] != "-" {
+				chain.Policy = fields[1]
+			}
+			if len(fields) > 2 {
+				metric, err := parseCounters(fields[2])
+				if err != nil {
+					return nil, err
+				}
+				chain.Metric = metric
+			}
+		default:
+			// [packets:bytes] -A CHAIN rule
+			var metric *RuleMetric
+			if strings.HasPrefix(line, "[") {
+				i := strings.Index(line, "]")
+				if i == -1 {
+					return nil, fmt.Errorf("Invalid rule: %s", line)
+				}
+
+				var err error
+				if metric, err = parseCounters(line[:i+1]); err != nil {
+					return nil, err
+				}
+				line = strings.TrimSpace(line[i+1:])
+			}
+
+			fields := strings.SplitN(line, " ", 3)
+			if len(fields) < 2 || fields[0] != "-A" {
+				return nil, fmt.Errorf("Invalid rule: %s", line)
+			}
+
+			var spec string
+			if len(fields) == 3 {
+				spec = fields[2]
+			}
+
+			chain := table.chain(fields[1])
+
+			key := table.Name + "/" + chain.Name + "/" + spec
+			occurrences[key]++
+
+			chain.addRule(&Rule{
+				Rule:   spec,
+				Metric: metric,
+				key:    fmt.Sprintf("%s#%d", spec, occurrences[key]),
+			})
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return tables, nil
+}
+
+type nftTable struct {
+	Family string
+	Name   string
+}
+
+type nftChain struct {
+	Family string
+	Table  string
+	Name   string
+	Hook   string
+	Policy string
+}
+
+type nftRule struct {
+	Family  string
+	Table   string
+	Chain   string
+	Handle  int64
+	Comment string
+	Expr    []map[string]json.RawMessage
+}
+
+type nftCounter struct {
+	Packets int64
+	Bytes   int64
+}
+
+// ParseNFTablesJSON parses the output of nft -j list ruleset
+func ParseNFTablesJSON(data []byte) ([]*Table, error) {
+	var ruleset struct {
+		Nftables []map[string]json.RawMessage
+	}
+
+	if err := json.Unmarshal(data, &ruleset); err != nil {
+		return nil, fmt.Errorf("Unable to decode nftables ruleset: %s", err)
+	}
+
+	var tables []*Table
+	table := func(family, name string) *Table {
+		for _, t := range tables {
+			if t.Family == family && t.Name == name {
+				return t
+			}
+		}
+
+		t := &Table{Backend: NFTablesBackend, Family: family, Name: name}
+		tables = append(tables, t)
+		return t
+	}
+
+	for _, object := range ruleset.Nftables {
+		if raw, ok := object["table"]; ok {
+			var t nftTable
+			if err := json.Unmarshal(raw, &t); err != nil {
+				return nil, err
+			}
+			table(t.Family, t.Name)
+		} else if raw, ok := object["chain"]; ok {
+			var c nftChain
+			if err := json.Unmarshal(raw, &c); err != nil {
+				return nil, err
+			}
+
+			chain := table(c.Family, c.Table).chain(c.Name)
+			chain.Hook, chain.Policy = c.Hook, c.Policy
+		} else if raw, ok := object["rule"]; ok {
+			var r nftRule
+			if err := json.Unmarshal(raw, &r); err != nil {
+				return nil, err
+			}
+
+			rule := &Rule{Handle: r.Handle, key: strconv.FormatInt(r.Handle, 10)}
+
+			var exprs []string
+			for _, expr := range r.Expr {
+				if raw, ok := expr["counter"]; ok {
+					var counter nftCounter
+					if err := json.Unmarshal(raw, &counter); err == nil {
+						rule.Metric = &RuleMetric{Packets: counter.Packets, Bytes: counter.Bytes}
+					}
+					continue
+				}
+
+				b, err := json.Marshal(expr)
+				if err != nil {
+					return nil, err
+				}
+				exprs = append(exprs, string(b))
+			}
+			rule.Rule = strings.Join(exprs, " ")
+			if r.Comment != "" {
+				rule.Rule += " comment " + strconv.Quote(r.Comment)
+			}
+
+			table(r.Family, r.Table).chain(r.Chain).addRule(rule)
+		}
+	}
+
+	return tables, nil
+}
+
+// RuleMetric the packets and bytes counters of a rule or of the policy of a chain
+// easyjson:json
+type RuleMetric struct {
+	Packets int64 `json:"Packets,omitempty"`
+	Bytes   int64 `json:"Bytes,omitempty"`
+	Start   int64 `json:"Start,omitempty"`
+	Last    int64 `json:"Last,omitempty"`
+}
+
+// GetStart returns start time
+func (rm *RuleMetric) GetStart() int64 {
+	return rm.Start
+}
+
+// SetStart set start time
+func (rm *RuleMetric) SetStart(start int64) {
+	rm.Start = start
+}
+
+// GetLast returns last time
+func (rm *RuleMetric) GetLast() int64 {
+	return rm.Last
+}
+
+// SetLast set last time
+func (rm *RuleMetric) SetLast(last int64) {
+	rm.Last = last
+}
+
+// GetFieldInt64 returns field by name
+func (rm *RuleMetric) GetFieldInt64(field string) (int64, error) {
+	switch field {
+	case "Packets":
+		return rm.Packets, nil
+	case "Bytes":
+		return rm.Bytes, nil
+	}
+	return 0, common.ErrFieldNotFound
+}
+
+// GetFields returns all the field keys available
+func (rm *RuleMetric) GetFields() []string {
+	return metricsFields
+}
+
+// Add sum two metrics and return a new Metrics object
+func (rm *RuleMetric) Add(m common.Metric) common.Metric {
+	om := m.(*RuleMetric)
+
+	return &RuleMetric{
+		Packets: rm.Packets + om.Packets,
+		Bytes:   rm.Bytes + om.Bytes,
+		Start:   rm.Start,
+		Last:    rm.Last,
+	}
+}
+
+// Sub subtracts two metrics and return a new metrics object
+func (rm *RuleMetric) Sub(m common.Metric) common.Metric {
+	om := m.(*RuleMetric)
+
+	return &RuleMetric{
+		Packets: rm.Packets - om.Packets,
+		Bytes:   rm.Bytes - om.Bytes,
+		Start:   rm.Start,
+		Last:    rm.Last,
+	}
+}
+
+// IsZero returns true if all the values are equal to zero
+func (rm *RuleMetric) IsZero() bool {
+	return rm.Packets == 0 && rm.Bytes == 0
+}
+
+// Split splits a metric into two parts
+func (rm *RuleMetric) Split(cut int64) (common.Metric, common.Metric) {
+	if cut < rm.Start {
+		return nil, rm
+	} else if cut > rm.Last {
+		return rm, nil
+	} else if rm.Start == rm.Last {
+		return rm, nil
+	} else if cut == rm.Start {
+		return nil, rm
+	} else if cut == rm.Last {
+		return rm, nil
+	}
+
+	duration := float64(rm.Last - rm.Start)
+	ratio1 := float64(cut-rm.Start) / duration
+
+	m1 := &RuleMetric{
+		Packets: int64(float64(rm.Packets) * ratio1),
+		Bytes:   int64(float64(rm.Bytes) * ratio1),
+		Start:   rm.Start,
+		Last:    cut,
+	}
+	m2 := &RuleMetric{
+		Packets: rm.Packets - m1.Packets,
+		Bytes:   rm.Bytes - m1.Bytes,
+		Start:   cut,
+		Last:    rm.Last,
+	}
+
+	return m1, m2
+}
+
+var metricsFields []string
+
+func init() {
+	metricsFields = common.StructFieldKeys(RuleMetric{})
+}
@@ -0,0 +1,119 @@
+/*
+ * Copyright (C) 2018 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package netfilter
+
+import (
+	"strings"
+	"testing"
+)
+
+const iptablesSave = `# Generated by iptables-save v1.6.2
+*filter
+:INPUT ACCEPT [1024:65536]
+:FORWARD DROP [3:180]
+:OUTPUT ACCEPT [512:32768]
+:DOCKER - [0:0]
+[10:600] -A INPUT -i lo -j ACCEPT
+[0:0] -A FORWARD -o docker0 -j DOCKER
+[0:0] -A DOCKER -p tcp -j ACCEPT
+[5:300] -A DOCKER -p tcp -j ACCEPT
+COMMIT
+# Completed
+`
+
+const nftRuleset = `{"nftables": [
+  {"metainfo": {"version": "0.9.0", "json_schema_version": 1}},
+  {"table": {"family": "inet", "name": "filter", "handle": 1}},
+  {"chain": {"family": "inet", "table": "filter", "name": "input", "handle": 1, "type": "filter", "hook": "input", "prio": 0, "policy": "drop"}},
+  {"rule": {"family": "inet", "table": "filter", "chain": "input", "handle": 4, "expr": [
+    {"match": {"op": "==", "left": {"payload": {"protocol": "tcp", "field": "dport"}}, "right": 22}},
+    {"counter": {"packets": 7, "bytes": 420}},
+    {"accept": null}
+  ]}}
+]}`
+
+func TestParseIPTablesSave(t *testing.T) {
+	tables, err := ParseIPTablesSave("ip", strings.NewReader(iptablesSave))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tables) != 1 || tables[0].Name != "filter" || tables[0].Backend != IPTablesBackend {
+		t.Fatalf("Expected the filter table, got %+v", tables)
+	}
+
+	chains := tables[0].Chains
+	if len(chains) != 4 {
+		t.Fatalf("Expected 4 chains, got %d", len(chains))
+	}
+
+	if chains[1].Name != "FORWARD" || chains[1].Policy != "DROP" || chains[1].Metric.Packets != 3 {
+		t.Errorf("Wrong FORWARD chain: %+v", chains[1])
+	}
+
+	if chains[3].Name != "DOCKER" || chains[3].Policy != "" {
+		t.Errorf("Wrong DOCKER chain: %+v", chains[3])
+	}
+
+	rules := chains[3].Rules
+	if len(rules) != 2 {
+		t.Fatalf("Expected 2 DOCKER rules, got %d", len(rules))
+	}
+
+	if rules[1].Rule != "-p tcp -j ACCEPT" || rules[1].Position != 2 || rules[1].Metric.Bytes != 300 {
+		t.Errorf("Wrong DOCKER rule: %+v", rules[1])
+	}
+
+	if rules[0].key == rules[1].key {
+		t.Errorf("Identical rules should have different keys: %s", rules[0].key)
+	}
+}
+
+func TestParseNFTablesJSON(t *testing.T) {
+	tables, err := ParseNFTablesJSON([]byte(nftRuleset))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tables) != 1 || tables[0].Family != "inet" || tables[0].Backend != NFTablesBackend {
+		t.Fatalf("Expected the inet filter table, got %+v", tables)
+	}
+
+	chain := tables[0].Chains[0]
+	if chain.Name != "input" || chain.Hook != "input" || chain.Policy != "drop" {
+		t.Errorf("Wrong input chain: %+v", chain)
+	}
+
+	if len(chain.Rules) != 1 {
+		t.Fatalf("Expected 1 rule, got %d", len(chain.Rules))
+	}
+
+	rule := chain.Rules[0]
+	if rule.Handle != 4 || rule.Metric == nil || rule.Metric.Packets != 7 || rule.Metric.Bytes != 420 {
+		t.Errorf("Wrong rule: %+v", rule)
+	}
+
+	if strings.Contains(rule.Rule, "counter") || !strings.Contains(rule.Rule, "accept") {
+		t.Errorf("Wrong rule expression: %s", rule.Rule)
+	}
+}
@@ -86,6 +86,7 @@ type NetNsProbe struct {
 	ethtool              *ethtool.Ethtool
 	handle               *netlink.Handle
 	socket               *nl.NetlinkSocket
+	tcSocket             *nl.NetlinkSocket
 	indexToChildrenQueue map[int64][]pendingLink
 	links                map[string]*graph.Node
 	state                int64
@@ -426,6 +427,10 @@ func (u *NetNsProbe) addLinkToTopology(link netlink.Link) {
 		metadata["Metric"] = metric
 	}
 
+	if tc := u.getTrafficControl(link); tc != nil {
+		metadata["TC"] = tc
+	}
+
 	if linkType == "veth" {
 		stats, err := u.ethtool.Stats(attrs.Name)
 		if err != nil && err != syscall.ENODEV {
@@ -787,10 +792,25 @@ func (u *NetNsProbe) cloneLinkNodes() map[string]*graph.Node {
 }
 
 func (u *NetNsProbe) updateIntfMetric(now, last time.Time) {
+	qdiscStats, err := u.getQdiscStatistics()
+	if err != nil {
+		logging.GetLogger().Warningf("Unable to retrieve qdisc statistics of %s: %s", u.Root.ID, err)
+	}
+
 	for name, node := range u.cloneLinkNodes() {
 		if link, err := u.handle.LinkByName(name); err == nil {
 			currMetric := newInterfaceMetricsFromNetlink(link)
-			if currMetric == nil || currMetric.IsZero() {
+			if currMetric == nil {
+				continue
+			}
+
+			if stats, ok := qdiscStats[int32(link.Attrs().Index)]; ok {
+				currMetric.QdiscBacklog = stats.backlog
+				currMetric.QdiscDrops = stats.drops
+				currMetric.QdiscOverlimits = stats.overlimits
+			}
+
+			if currMetric.IsZero() {
 				continue
 			}
 			currMetric.Last = int64(common.UnixMillis(now))
@@ -891,6 +911,7 @@ Ready:
 		case t := <-metricTicker.C:
 			now := t.UTC()
 			u.updateIntfMetric(now, last)
+			u.updateIntfTrafficControl()
 			last = now
 		case <-u.quit:
 			return
@@ -957,6 +978,9 @@ func (u *NetNsProbe) closeFds() {
 	if u.socket != nil {
 		u.socket.Close()
 	}
+	if u.tcSocket != nil {
+		u.tcSocket.Close()
+	}
 	if u.ethtool != nil {
 		u.ethtool.Close()
 	}
@@ -1010,6 +1034,11 @@ func newNetNsProbe(g *graph.Graph, root *graph.Node, nsPath string) (*NetNsProbe
 		return errFnc(fmt.Errorf("Failed to subscribe to netlink messages: %s", err))
 	}
 
+	// socket not bound to any group used to dump the qdisc statistics
+	if probe.tcSocket, err = nl.Subscribe(syscall.NETLINK_ROUTE); err != nil {
+		return errFnc(fmt.Errorf("Failed to create netlink socket: %s", err))
+	}
+
 	if probe.ethtool, err = ethtool.NewEthtool(); err != nil {
 		return errFnc(fmt.Errorf("Failed to create ethtool object: %s", err))
 	}
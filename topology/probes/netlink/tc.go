@@ -0,0 +1,319 @@
+// +build linux
+
+/*
+ * Copyright (C) 2018 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package netlink
+
+import (
+	"reflect"
+	"syscall"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+
+	"github.com/skydive-project/skydive/logging"
+)
+
+const (
+	tcaStatsQueue = 3
+
+	tcMinIngress = 0xfff2
+	tcMinEgress  = 0xfff3
+)
+
+// Qdisc describes a queueing discipline of an interface
+// easyjson:json
+type Qdisc struct {
+	Kind       string
+	Handle     string
+	Parent     string
+	Parameters map[string]interface{} `json:"Parameters,omitempty"`
+}
+
+// Class describes a class of a classful queueing discipline
+// easyjson:json
+type Class struct {
+	Kind       string
+	Handle     string
+	Parent     string
+	Parameters map[string]interface{} `json:"Parameters,omitempty"`
+}
+
+// Filter describes a traffic control filter, eBPF programs attached with
+// clsact being bpf filters of the ingress or egress direction
+// easyjson:json
+type Filter struct {
+	Kind       string
+	Handle     string
+	Parent     string
+	Direction  string `json:"Direction,omitempty"`
+	Priority   int64
+	Protocol   int64
+	Parameters map[string]interface{} `json:"Parameters,omitempty"`
+}
+
+// TrafficControl describes the qdiscs, classes and filters of an interface
+// easyjson:json
+type TrafficControl struct {
+	Qdiscs  []*Qdisc  `json:"Qdiscs,omitempty"`
+	Classes []*Class  `json:"Classes,omitempty"`
+	Filters []*Filter `json:"Filters,omitempty"`
+}
+
+type qdiscStatistics struct {
+	backlog    int64
+	drops      int64
+	overlimits int64
+}
+
+// tcParameters returns the kind specific parameters of a qdisc, a class or
+// a filter, ie. the scalar exported fields of the netlink object but its
+// embedded attributes
+func tcParameters(obj interface{}) map[string]interface{} {
+	v := reflect.Indirect(reflect.ValueOf(obj))
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	params := make(map[string]interface{})
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.Anonymous || field.PkgPath != "" {
+			continue
+		}
+
+		value := v.Field(i)
+		switch value.Kind() {
+		case reflect.Bool:
+			params[field.Name] = value.Bool()
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			params[field.Name] = value.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			params[field.Name] = int64(value.Uint())
+		case reflect.String:
+			if s := value.String(); s != "" {
+				params[field.Name] = s
+			}
+		}
+	}
+
+	if len(params) == 0 {
+		return nil
+	}
+	return params
+}
+
+// filterParent describes a parent handle the filters of a qdisc are
+// attached to, with the direction of these filters
+type filterParent struct {
+	handle    uint32
+	direction string
+}
+
+// qdiscFilterParents returns the parent handles of the filters of a qdisc,
+// the filters of clsact being attached to its ingress and egress minors
+func qdiscFilterParents(qdisc netlink.Qdisc) []filterParent {
+	attrs := qdisc.Attrs()
+
+	switch qdisc.Type() {
+	case "clsact":
+		major := uint16(attrs.Handle >> 16)
+		return []filterParent{
+			{handle: netlink.MakeHandle(major, tcMinIngress), direction: "ingress"},
+			{handle: netlink.MakeHandle(major, tcMinEgress), direction: "egress"},
+		}
+	case "ingress":
+		return []filterParent{{handle: attrs.Handle, direction: "ingress"}}
+	}
+	return []filterParent{{handle: attrs.Handle}}
+}
+
+func (u *NetNsProbe) getFilters(link netlink.Link, parent uint32, direction string) (filters []*Filter) {
+	list, err := u.handle.FilterList(link, parent)
+	if err != nil {
+		logging.GetLogger().Warningf("Unable to retrieve filters of %s: %s", link.Attrs().Name, err)
+		return
+	}
+
+	for _, filter := range list {
+		attrs := filter.Attrs()
+		filters = append(filters, &Filter{
+			Kind:       filter.Type(),
+			Handle:     netlink.HandleStr(attrs.Handle),
+			Parent:     netlink.HandleStr(attrs.Parent),
+			Direction:  direction,
+			Priority:   int64(attrs.Priority),
+			Protocol:   int64(attrs.Protocol),
+			Parameters: tcParameters(filter),
+		})
+	}
+	return
+}
+
+// getTrafficControl returns the qdiscs, classes and filters of a link, nil
+// if the link has no qdisc or if they can't be retrieved
+func (u *NetNsProbe) getTrafficControl(link netlink.Link) *TrafficControl {
+	qdiscs, err := u.handle.QdiscList(link)
+	if err != nil {
+		logging.GetLogger().Warningf("Unable to retrieve qdiscs of %s: %s", link.Attrs().Name, err)
+		return nil
+	}
+
+	if len(qdiscs) == 0 {
+		return nil
+	}
+
+	tc := &TrafficControl{}
+	for _, qdisc := range qdiscs {
+		attrs := qdisc.Attrs()
+		tc.Qdiscs = append(tc.Qdiscs, &Qdisc{
+			Kind:       qdisc.Type(),
+			Handle:     netlink.HandleStr(attrs.Handle),
+			Parent:     netlink.HandleStr(attrs.Parent),
+			Parameters: tcParameters(qdisc),
+		})
+
+		for _, parent := range qdiscFilterParents(qdisc) {
+			tc.Filters = append(tc.Filters, u.getFilters(link, parent.handle, parent.direction)...)
+		}
+	}
+
+	classes, err := u.handle.ClassList(link, 0)
+	if err != nil {
+		logging.GetLogger().Warningf("Unable to retrieve classes of %s: %s", link.Attrs().Name, err)
+	}
+
+	for _, class := range classes {
+		attrs := class.Attrs()
+		tc.Classes = append(tc.Classes, &Class{
+			Kind:       class.Type(),
+			Handle:     netlink.HandleStr(attrs.Handle),
+			Parent:     netlink.HandleStr(attrs.Parent),
+			Parameters: tcParameters(class),
+		})
+	}
+
+	return tc
+}
+
+func parseQdiscStatistics(data []byte, stats *qdiscStatistics) error {
+	attrs, err := nl.ParseRouteAttr(data)
+	if err != nil {
+		return err
+	}
+
+	native := nl.NativeEndian()
+	for _, attr := range attrs {
+		// struct gnet_stats_queue { qlen, backlog, drops, requeues, overlimits }
+		if attr.Attr.Type == tcaStatsQueue && len(attr.Value) >= 20 {
+			stats.backlog += int64(native.Uint32(attr.Value[4:8]))
+			stats.drops += int64(native.Uint32(attr.Value[8:12]))
+			stats.overlimits += int64(native.Uint32(attr.Value[16:20]))
+		}
+	}
+	return nil
+}
+
+// getQdiscStatistics dumps the statistics of the root, ingress and clsact
+// qdiscs of the namespace, indexed by interface index
+func (u *NetNsProbe) getQdiscStatistics() (map[int32]*qdiscStatistics, error) {
+	req := nl.NewNetlinkRequest(syscall.RTM_GETQDISC, syscall.NLM_F_DUMP)
+	req.AddData(nl.NewTcMsg())
+
+	if err := u.tcSocket.Send(req); err != nil {
+		return nil, err
+	}
+
+	stats := make(map[int32]*qdiscStatistics)
+	for {
+		msgs, err := u.tcSocket.Receive()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, m := range msgs {
+			if m.Header.Seq != req.Seq {
+				continue
+			}
+
+			switch m.Header.Type {
+			case syscall.NLMSG_DONE:
+				return stats, nil
+			case syscall.NLMSG_ERROR:
+				if errno := int32(nl.NativeEndian().Uint32(m.Data[0:4])); errno != 0 {
+					return nil, syscall.Errno(-errno)
+				}
+				return stats, nil
+			case syscall.RTM_NEWQDISC:
+			default:
+				continue
+			}
+
+			msg := nl.DeserializeTcMsg(m.Data)
+			if msg.Parent != netlink.HANDLE_ROOT && msg.Parent != netlink.HANDLE_INGRESS {
+				continue
+			}
+
+			attrs, err := nl.ParseRouteAttr(m.Data[nl.SizeofTcMsg:])
+			if err != nil {
+				return nil, err
+			}
+
+			for _, attr := range attrs {
+				if attr.Attr.Type != nl.TCA_STATS2 {
+					continue
+				}
+
+				s, ok := stats[msg.Ifindex]
+				if !ok {
+					s = &qdiscStatistics{}
+					stats[msg.Ifindex] = s
+				}
+
+				if err := parseQdiscStatistics(attr.Value, s); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+}
+
+func (u *NetNsProbe) updateIntfTrafficControl() {
+	for name, node := range u.cloneLinkNodes() {
+		link, err := u.handle.LinkByName(name)
+		if err != nil {
+			continue
+		}
+
+		tc := u.getTrafficControl(link)
+
+		u.Graph.Lock()
+		if tc != nil {
+			u.Graph.AddMetadata(node, "TC", tc)
+		} else if _, err := node.GetField("TC"); err == nil {
+			// no qdisc anymore, or they can't be retrieved
+			u.Graph.DelMetadata(node, "TC")
+		}
+		u.Graph.Unlock()
+	}
+}
@@ -0,0 +1,167 @@
+// +build linux
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ *
+ */
+
+package netlink
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+)
+
+// gnetStatsQueue returns a struct gnet_stats_queue attribute
+func gnetStatsQueue(qlen, backlog, drops, requeues, overlimits uint32) []byte {
+	value := make([]byte, 20)
+	native := nl.NativeEndian()
+	native.PutUint32(value[0:4], qlen)
+	native.PutUint32(value[4:8], backlog)
+	native.PutUint32(value[8:12], drops)
+	native.PutUint32(value[12:16], requeues)
+	native.PutUint32(value[16:20], overlimits)
+	return nl.NewRtAttr(tcaStatsQueue, value).Serialize()
+}
+
+func TestParseQdiscStatistics(t *testing.T) {
+	const tcaStatsBasic = 1
+
+	tests := []struct {
+		name     string
+		data     []byte
+		initial  qdiscStatistics
+		expected qdiscStatistics
+		err      bool
+	}{
+		{
+			name:     "queue",
+			data:     gnetStatsQueue(1, 1500, 3, 4, 5),
+			expected: qdiscStatistics{backlog: 1500, drops: 3, overlimits: 5},
+		},
+		{
+			name:     "basic and queue",
+			data:     append(nl.NewRtAttr(tcaStatsBasic, make([]byte, 16)).Serialize(), gnetStatsQueue(0, 200, 7, 0, 9)...),
+			expected: qdiscStatistics{backlog: 200, drops: 7, overlimits: 9},
+		},
+		{
+			name:     "accumulated with other qdiscs",
+			data:     gnetStatsQueue(0, 100, 1, 0, 2),
+			initial:  qdiscStatistics{backlog: 1000, drops: 10, overlimits: 20},
+			expected: qdiscStatistics{backlog: 1100, drops: 11, overlimits: 22},
+		},
+		{
+			name: "truncated queue",
+			data: nl.NewRtAttr(tcaStatsQueue, make([]byte, 16)).Serialize(),
+		},
+		{
+			name: "invalid attribute length",
+			data: []byte{0xff, 0x00, tcaStatsQueue, 0x00, 0x01, 0x02, 0x03, 0x04},
+			err:  true,
+		},
+	}
+
+	for _, test := range tests {
+		stats := test.initial
+		err := parseQdiscStatistics(test.data, &stats)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: an error was expected", test.name)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+		} else if stats != test.expected {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, stats)
+		}
+	}
+}
+
+func TestTCParameters(t *testing.T) {
+	tbf := &netlink.Tbf{
+		QdiscAttrs: netlink.QdiscAttrs{Handle: netlink.MakeHandle(1, 0), Parent: netlink.HANDLE_ROOT},
+		Rate:       125000,
+		Limit:      3000,
+		Buffer:     1600,
+	}
+
+	params := tcParameters(tbf)
+	for key, value := range map[string]interface{}{"Rate": int64(125000), "Limit": int64(3000), "Buffer": int64(1600)} {
+		if params[key] != value {
+			t.Errorf("Expected %s to be %v, got: %+v", key, value, params)
+		}
+	}
+	for _, key := range []string{"QdiscAttrs", "Handle", "Parent"} {
+		if _, found := params[key]; found {
+			t.Errorf("Embedded attribute %s should not be a parameter, got: %+v", key, params)
+		}
+	}
+
+	generic := &netlink.GenericQdisc{QdiscType: "pfifo_fast"}
+	if params := tcParameters(generic); !reflect.DeepEqual(params, map[string]interface{}{"QdiscType": "pfifo_fast"}) {
+		t.Errorf("Unexpected generic qdisc parameters: %+v", params)
+	}
+
+	if params := tcParameters(&netlink.GenericQdisc{}); params != nil {
+		t.Errorf("Empty strings should not be parameters, got: %+v", params)
+	}
+
+	if params := tcParameters("clsact"); params != nil {
+		t.Errorf("Only structures should have parameters, got: %+v", params)
+	}
+}
+
+func TestQdiscFilterParents(t *testing.T) {
+	tests := []struct {
+		name     string
+		qdisc    netlink.Qdisc
+		expected []filterParent
+	}{
+		{
+			name:  "clsact",
+			qdisc: &netlink.GenericQdisc{QdiscAttrs: netlink.QdiscAttrs{Handle: netlink.MakeHandle(0xffff, 0), Parent: netlink.HANDLE_INGRESS}, QdiscType: "clsact"},
+			expected: []filterParent{
+				{handle: netlink.MakeHandle(0xffff, 0xfff2), direction: "ingress"},
+				{handle: netlink.MakeHandle(0xffff, 0xfff3), direction: "egress"},
+			},
+		},
+		{
+			name:     "ingress",
+			qdisc:    &netlink.Ingress{QdiscAttrs: netlink.QdiscAttrs{Handle: netlink.MakeHandle(0xffff, 0), Parent: netlink.HANDLE_INGRESS}},
+			expected: []filterParent{{handle: netlink.MakeHandle(0xffff, 0), direction: "ingress"}},
+		},
+		{
+			name:     "htb",
+			qdisc:    &netlink.Htb{QdiscAttrs: netlink.QdiscAttrs{Handle: netlink.MakeHandle(1, 0), Parent: netlink.HANDLE_ROOT}},
+			expected: []filterParent{{handle: netlink.MakeHandle(1, 0)}},
+		},
+	}
+
+	for _, test := range tests {
+		if parents := qdiscFilterParents(test.qdisc); !reflect.DeepEqual(parents, test.expected) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, parents)
+		}
+	}
+}
@@ -27,8 +27,10 @@ import (
 	"net/http"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
 	"github.com/skydive-project/skydive/logging"
 	"github.com/skydive-project/skydive/topology/graph"
 	"github.com/skydive-project/skydive/topology/graph/traversal"
@@ -41,6 +43,13 @@ type topologySubscriber struct {
 	ts            *traversal.GremlinTraversalSequence
 }
 
+type liveQuerySubscriber struct {
+	id        string
+	speaker   ws.Speaker
+	query     *traversal.LiveQuery
+	scheduled bool
+}
+
 // SubscriberEndpoint sends all the modifications to its subscribers.
 type SubscriberEndpoint struct {
 	common.RWMutex
@@ -50,6 +59,8 @@ type SubscriberEndpoint struct {
 	wg            sync.WaitGroup
 	gremlinParser *traversal.GremlinTraversalParser
 	subscribers   map[string]*topologySubscriber
+	liveQueries   map[string]map[string]*liveQuerySubscriber
+	liveRefresh   time.Duration
 }
 
 func (t *SubscriberEndpoint) getGraph(gremlinQuery string, ts *traversal.GremlinTraversalSequence, lockGraph bool) (*graph.Graph, error) {
@@ -105,11 +116,100 @@ func (t *SubscriberEndpoint) OnConnected(c ws.Speaker) {
 func (t *SubscriberEndpoint) OnDisconnected(c ws.Speaker) {
 	t.Lock()
 	delete(t.subscribers, c.GetRemoteHost())
+	delete(t.liveQueries, c.GetRemoteHost())
 	t.Unlock()
 }
 
+// registerLiveQuery executes the query of a client and keeps its result up
+// to date, the changes being sent as LiveQueryEvent messages
+func (t *SubscriberEndpoint) registerLiveQuery(c ws.Speaker, req graph.LiveQueryRequestMsg) (*graph.LiveQueryMsg, error) {
+	ts, err := t.gremlinParser.Parse(strings.NewReader(req.GremlinQuery))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid live query '%s' for client %s: %s", req.GremlinQuery, c.GetRemoteHost(), err)
+	}
+
+	// keep the graph locked until registered so that no event is missed
+	t.Graph.RLock()
+	defer t.Graph.RUnlock()
+
+	query, values, err := traversal.NewLiveQuery(t.Graph, ts, t.liveRefresh)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to register live query '%s' for client %s: %s", req.GremlinQuery, c.GetRemoteHost(), err)
+	}
+
+	host := c.GetRemoteHost()
+
+	t.Lock()
+	if _, ok := t.liveQueries[host]; !ok {
+		t.liveQueries[host] = make(map[string]*liveQuerySubscriber)
+	}
+	t.liveQueries[host][req.ID] = &liveQuerySubscriber{id: req.ID, speaker: c, query: query}
+	t.Unlock()
+
+	logging.GetLogger().Infof("Client %s registered live query %s: %s", host, req.ID, req.GremlinQuery)
+
+	return &graph.LiveQueryMsg{ID: req.ID, Values: values}, nil
+}
+
+// notifyLiveQueries sends to the live query subscribers the changes of the
+// result of their queries caused by a graph event
+func (t *SubscriberEndpoint) notifyLiveQueries(i interface{}, deleted bool) {
+	t.RLock()
+	defer t.RUnlock()
+
+	for _, queries := range t.liveQueries {
+		for _, lq := range queries {
+			delta, err := lq.query.Update(i, deleted)
+			if err != nil {
+				logging.GetLogger().Errorf("Unable to update live query %s: %s", lq.id, err)
+				continue
+			}
+
+			t.sendLiveQueryDelta(lq, delta)
+
+			// changes kept pending by the query are flushed once its
+			// refresh interval elapsed
+			if lq.query.Pending() && !lq.scheduled {
+				lq.scheduled = true
+				lq := lq
+				time.AfterFunc(lq.query.NextRefresh(), func() { t.flushLiveQuery(lq) })
+			}
+		}
+	}
+}
+
+// flushLiveQuery sends the pending changes of a live query
+func (t *SubscriberEndpoint) flushLiveQuery(lq *liveQuerySubscriber) {
+	t.Graph.RLock()
+	defer t.Graph.RUnlock()
+
+	t.RLock()
+	defer t.RUnlock()
+
+	lq.scheduled = false
+
+	// the query may have been stopped in the meantime
+	if t.liveQueries[lq.speaker.GetRemoteHost()][lq.id] != lq {
+		return
+	}
+
+	delta, err := lq.query.Flush()
+	if err != nil {
+		logging.GetLogger().Errorf("Unable to update live query %s: %s", lq.id, err)
+		return
+	}
+	t.sendLiveQueryDelta(lq, delta)
+}
+
+func (t *SubscriberEndpoint) sendLiveQueryDelta(lq *liveQuerySubscriber, delta *traversal.LiveQueryDelta) {
+	if !delta.Empty() {
+		msg := &graph.LiveQueryMsg{ID: lq.id, Added: delta.Added, Removed: delta.Removed, Updated: delta.Updated}
+		lq.speaker.SendMessage(ws.NewStructMessage(graph.Namespace, graph.LiveQueryEventMsgType, msg))
+	}
+}
+
 // OnStructMessage is triggered when receiving a message from a subscriber.
-// It only responds to SyncRequestMsgType messages
+// It responds to SyncRequestMsgType and live query messages
 func (t *SubscriberEndpoint) OnStructMessage(c ws.Speaker, msg *ws.StructMessage) {
 	msgType, obj, err := graph.UnmarshalMessage(msg)
 	if err != nil {
@@ -117,6 +217,24 @@ func (t *SubscriberEndpoint) OnStructMessage(c ws.Speaker, msg *ws.StructMessage
 		return
 	}
 
+	switch msgType {
+	case graph.LiveQueryRequestMsgType:
+		result, status := interface{}(nil), http.StatusOK
+		if reply, err := t.registerLiveQuery(c, obj.(graph.LiveQueryRequestMsg)); err != nil {
+			logging.GetLogger().Error(err)
+			status = http.StatusBadRequest
+		} else {
+			result = reply
+		}
+		c.SendMessage(msg.Reply(result, graph.LiveQueryReplyMsgType, status))
+		return
+	case graph.LiveQueryStopMsgType:
+		t.Lock()
+		delete(t.liveQueries[c.GetRemoteHost()], obj.(graph.LiveQueryStopMsg).ID)
+		t.Unlock()
+		return
+	}
+
 	// this kind of message usually comes from external clients like the WebUI
 	if msgType == graph.SyncRequestMsgType {
 		t.Graph.RLock()
@@ -197,31 +315,37 @@ func (t *SubscriberEndpoint) notifyClients(msg *ws.StructMessage) {
 // OnNodeUpdated graph node updated event. Implements the EventListener interface.
 func (t *SubscriberEndpoint) OnNodeUpdated(n *graph.Node) {
 	t.notifyClients(ws.NewStructMessage(graph.Namespace, graph.NodeUpdatedMsgType, n))
+	t.notifyLiveQueries(n, false)
 }
 
 // OnNodeAdded graph node added event. Implements the EventListener interface.
 func (t *SubscriberEndpoint) OnNodeAdded(n *graph.Node) {
 	t.notifyClients(ws.NewStructMessage(graph.Namespace, graph.NodeAddedMsgType, n))
+	t.notifyLiveQueries(n, false)
 }
 
 // OnNodeDeleted graph node deleted event. Implements the EventListener interface.
 func (t *SubscriberEndpoint) OnNodeDeleted(n *graph.Node) {
 	t.notifyClients(ws.NewStructMessage(graph.Namespace, graph.NodeDeletedMsgType, n))
+	t.notifyLiveQueries(n, true)
 }
 
 // OnEdgeUpdated graph edge updated event. Implements the EventListener interface.
 func (t *SubscriberEndpoint) OnEdgeUpdated(e *graph.Edge) {
 	t.notifyClients(ws.NewStructMessage(graph.Namespace, graph.EdgeUpdatedMsgType, e))
+	t.notifyLiveQueries(e, false)
 }
 
 // OnEdgeAdded graph edge added event. Implements the EventListener interface.
 func (t *SubscriberEndpoint) OnEdgeAdded(e *graph.Edge) {
 	t.notifyClients(ws.NewStructMessage(graph.Namespace, graph.EdgeAddedMsgType, e))
+	t.notifyLiveQueries(e, false)
 }
 
 // OnEdgeDeleted graph edge deleted event. Implements the EventListener interface.
 func (t *SubscriberEndpoint) OnEdgeDeleted(e *graph.Edge) {
 	t.notifyClients(ws.NewStructMessage(graph.Namespace, graph.EdgeDeletedMsgType, e))
+	t.notifyLiveQueries(e, true)
 }
 
 // NewSubscriberEndpoint returns a new server to be used by external subscribers,
@@ -231,6 +355,8 @@ func NewSubscriberEndpoint(pool ws.StructSpeakerPool, g *graph.Graph, tr *traver
 		Graph:         g,
 		pool:          pool,
 		subscribers:   make(map[string]*topologySubscriber),
+		liveQueries:   make(map[string]map[string]*liveQuerySubscriber),
+		liveRefresh:   time.Duration(config.GetInt("gremlin.live_query_refresh")) * time.Millisecond,
 		gremlinParser: tr,
 	}
 
@@ -64,6 +64,10 @@ var (
 	RawPacketLimitNotValid = func(min, max uint32) error {
 		return valid.TextErr{Err: fmt.Errorf("A valid raw packet limit size is > %d && <= %d", min, max)}
 	}
+	// SamplingRateNotValid validator
+	SamplingRateNotValid = func(min, max uint32) error {
+		return valid.TextErr{Err: fmt.Errorf("A valid sampling rate is >= %d && <= %d", min, max)}
+	}
 	//LayerKeyModeNotValid validator
 	LayerKeyModeNotValid = func() error {
 		return valid.TextErr{Err: errors.New("Not a valid layer key mode")}
@@ -90,7 +94,7 @@ func isGremlinExpr(v interface{}, param string) error {
 
 	tr := traversal.NewGremlinTraversalParser()
 	tr.AddTraversalExtension(ge.NewMetricsTraversalExtension())
-	tr.AddTraversalExtension(ge.NewFlowTraversalExtension(nil, nil))
+	tr.AddTraversalExtension(ge.NewFlowTraversalExtension(nil, nil, nil))
 	tr.AddTraversalExtension(ge.NewSocketsTraversalExtension())
 	tr.AddTraversalExtension(ge.NewRawPacketsTraversalExtension())
 	tr.AddTraversalExtension(ge.NewDescendantsTraversalExtension())
@@ -145,6 +149,15 @@ func isValidRawPacketLimit(v interface{}, param string) error {
 	return nil
 }
 
+func isValidSamplingRate(v interface{}, param string) error {
+	rate, ok := v.(int)
+	if !ok || rate < 0 || uint32(rate) > flow.MaxSamplingRate {
+		return SamplingRateNotValid(0, flow.MaxSamplingRate)
+	}
+
+	return nil
+}
+
 func isValidLayerKeyMode(v interface{}, param string) error {
 	name, ok := v.(string)
 	if !ok {
@@ -187,6 +200,7 @@ func init() {
 	skydiveValidator.SetValidationFunc("isBPFFilter", isBPFFilter)
 	skydiveValidator.SetValidationFunc("isValidCaptureHeaderSize", isValidCaptureHeaderSize)
 	skydiveValidator.SetValidationFunc("isValidRawPacketLimit", isValidRawPacketLimit)
+	skydiveValidator.SetValidationFunc("isValidSamplingRate", isValidSamplingRate)
 	skydiveValidator.SetValidationFunc("isValidLayerKeyMode", isValidLayerKeyMode)
 	skydiveValidator.SetValidationFunc("isValidWorkflow", isValidWorkflow)
 	skydiveValidator.SetTag("valid")